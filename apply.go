@@ -0,0 +1,142 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"promptbuilder/pkg/promptbuilder"
+)
+
+// runApply writes the files of a model response back into basedir and
+// returns the exit code.
+func runApply(args []string) int {
+	flags := flag.NewFlagSet("apply", flag.ExitOnError)
+	baseDir := flags.String("basedir", ".", "Directory the file paths of the response are relative to")
+	dryRun := flags.Bool("dry-run", false, "Print the changes as a diff without writing them")
+	pathMapFile := flags.String("pathmap", "", "Path map saved with a renamed prompt, to restore the original names of the response")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: promptbuilder apply [-basedir dir] [-dry-run] [-pathmap file] response.md")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return exitConfig
+	}
+
+	var pathMap promptbuilder.PathMap
+	if *pathMapFile != "" {
+		var err error
+		if pathMap, err = promptbuilder.ReadPathMap(*pathMapFile); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return exitError
+		}
+	}
+
+	response, err := os.Open(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+	defer response.Close()
+
+	changes, err := promptbuilder.ParseResponse(response)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error parsing response: %v\n", err)
+		return exitError
+	}
+	if len(changes) == 0 {
+		fmt.Fprintln(os.Stderr, "No file changes found in the response")
+		return exitError
+	}
+
+	failed := false
+	for _, change := range changes {
+		change = pathMap.RestoreChange(change)
+		fullPath, err := promptbuilder.ResolveChangePath(*baseDir, change.Path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Skipping %v\n", err)
+			failed = true
+			continue
+		}
+
+		old, err := os.ReadFile(fullPath)
+		exists := err == nil
+		if err != nil && !os.IsNotExist(err) {
+			fmt.Fprintf(os.Stderr, "Error reading %s: %v\n", change.Path, err)
+			failed = true
+			continue
+		}
+
+		content := change.Content
+		if change.IsPatch() {
+			if !exists && !change.Delete && change.Hunks[0].OldStart > 0 {
+				fmt.Fprintf(os.Stderr, "Skipping %s: the diff changes a file that does not exist\n", change.Path)
+				failed = true
+				continue
+			}
+			var conflicts int
+			content, conflicts = change.Patch(string(old))
+			if conflicts > 0 {
+				fmt.Fprintf(os.Stderr, "Warning: %d of %d hunks did not apply to %s and were written as conflict markers\n", conflicts, len(change.Hunks), change.Path)
+				failed = true
+			}
+		}
+
+		name := change.Path
+		if absBase, err := filepath.Abs(*baseDir); err == nil {
+			if rel, err := filepath.Rel(absBase, fullPath); err == nil {
+				name = rel
+			}
+		}
+		name = filepath.ToSlash(name)
+		if change.Delete {
+			if !exists {
+				continue
+			}
+			if *dryRun {
+				fmt.Print(promptbuilder.UnifiedDiff("a/"+name, "/dev/null", string(old), ""))
+				continue
+			}
+			if err := os.Remove(fullPath); err != nil {
+				fmt.Fprintf(os.Stderr, "Error deleting %s: %v\n", change.Path, err)
+				failed = true
+				continue
+			}
+			fmt.Printf("Deleted %s\n", name)
+			continue
+		}
+
+		if *dryRun {
+			oldName := "a/" + name
+			if !exists {
+				oldName = "/dev/null"
+			}
+			fmt.Print(promptbuilder.UnifiedDiff(oldName, "b/"+name, string(old), content))
+			continue
+		}
+
+		if exists && string(old) == content {
+			fmt.Printf("Unchanged %s\n", name)
+			continue
+		}
+		if err := promptbuilder.ApplyChange(fullPath, content); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing %s: %v\n", change.Path, err)
+			failed = true
+			continue
+		}
+		if exists {
+			fmt.Printf("Updated %s\n", name)
+		} else {
+			fmt.Printf("Created %s\n", name)
+		}
+	}
+
+	if failed {
+		return exitError
+	}
+	return 0
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"promptbuilder/pkg/promptbuilder"
+)
+
+// chatSession is an interactive conversation about the files of a config.
+// The prompt is sent once as the system message; files that change
+// between turns are sent again with the next question.
+type chatSession struct {
+	config   *promptbuilder.Config
+	format   string
+	model    string
+	client   *promptbuilder.Client
+	history  []promptbuilder.Message
+	snapshot map[string][sha256.Size]byte // content hash of every file, by path
+}
+
+// runChat starts an interactive chat about the prompt built from the input
+// file and returns the exit code.
+func runChat(args []string) int {
+	flags := flag.NewFlagSet("chat", flag.ExitOnError)
+	inputFile := flags.String("input", "input.txt", "Input file path")
+	format := flags.String("format", promptbuilder.FormatMarkdown, "Output format ("+strings.Join(promptbuilder.OutputFormats, ", ")+")")
+	provider := flags.String("provider", promptbuilder.ProviderOllama, "Model provider ("+strings.Join(promptbuilder.Providers, ", ")+")")
+	llmModel := flags.String("llm-model", "", "Model to chat with (default: the provider's default model)")
+	flags.Parse(args)
+
+	status = os.Stderr
+	fmt.Fprintln(status, "promptbuilder v"+version)
+
+	config, err := promptbuilder.ReadConfig(*inputFile)
+	if err != nil {
+		fmt.Fprintf(status, "Error reading input file: %v\n", err)
+		return exitConfig
+	}
+	if err := config.Validate(); err != nil {
+		fmt.Fprintf(status, "Invalid configuration: %v\n", err)
+		return exitConfig
+	}
+	client, err := promptbuilder.NewClient(*provider, *llmModel)
+	if err != nil {
+		fmt.Fprintf(status, "Error: %v\n", err)
+		return exitConfig
+	}
+
+	session := &chatSession{
+		config: config,
+		format: *format,
+		model:  promptbuilder.ProviderTokenModel(*provider),
+		client: client,
+	}
+	if err := session.start(); err != nil {
+		fmt.Fprintf(status, "Error: %v\n", err)
+		return exitError
+	}
+	fmt.Fprintf(status, "Chatting with %s (%s). Type exit or press Ctrl+D to quit.\n", client.Provider, client.Model)
+
+	scanner := bufio.NewScanner(os.Stdin)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1<<20)
+	for {
+		fmt.Fprint(status, "> ")
+		if !scanner.Scan() {
+			fmt.Fprintln(status)
+			break
+		}
+		question := strings.TrimSpace(scanner.Text())
+		if question == "" {
+			continue
+		}
+		if question == "exit" || question == "quit" {
+			break
+		}
+
+		reply, err := session.ask(question)
+		if err != nil {
+			fmt.Fprintf(status, "Error: %v\n", err)
+			continue
+		}
+		fmt.Println(strings.TrimRight(reply, "\n"))
+		fmt.Println()
+	}
+
+	if err := scanner.Err(); err != nil {
+		fmt.Fprintf(status, "Error reading input: %v\n", err)
+		return exitError
+	}
+	return 0
+}
+
+// start builds the prompt and makes it the system message.
+func (s *chatSession) start() error {
+	builder, err := promptbuilder.New(s.config,
+		promptbuilder.WithFormat(s.format),
+		promptbuilder.WithModel(s.model),
+		promptbuilder.WithLogger(status),
+	)
+	if err != nil {
+		return err
+	}
+
+	var prompt strings.Builder
+	report, err := builder.Build(context.Background(), &prompt)
+	if err != nil {
+		return fmt.Errorf("error generating prompt: %v", err)
+	}
+	fmt.Fprintf(status, "Loaded %d files (%d estimated tokens)\n", len(report.Files), report.TotalTokens)
+
+	s.history = []promptbuilder.Message{{Role: "system", Content: prompt.String()}}
+	s.snapshot, err = s.takeSnapshot()
+	return err
+}
+
+// ask sends the question, preceded by the files that changed since the
+// previous turn, and records both in the history.
+func (s *chatSession) ask(question string) (string, error) {
+	update, err := s.changes()
+	if err != nil {
+		return "", err
+	}
+
+	content := question
+	if update != "" {
+		content = update + "\n\n" + question
+	}
+
+	messages := append(s.history, promptbuilder.Message{Role: "user", Content: content})
+	reply, err := s.client.Chat(context.Background(), messages)
+	if err != nil {
+		return "", err
+	}
+
+	s.history = append(messages, promptbuilder.Message{Role: "assistant", Content: reply})
+	return reply, nil
+}
+
+// changes renders the files added or modified since the last snapshot,
+// and lists the deleted ones. It returns "" when nothing changed.
+func (s *chatSession) changes() (string, error) {
+	snapshot, err := s.takeSnapshot()
+	if err != nil {
+		return "", err
+	}
+
+	var changed, deleted []string
+	for path, hash := range snapshot {
+		if old, ok := s.snapshot[path]; !ok || old != hash {
+			changed = append(changed, path)
+		}
+	}
+	for path := range s.snapshot {
+		if _, ok := snapshot[path]; !ok {
+			deleted = append(deleted, path)
+		}
+	}
+	sort.Strings(changed)
+	sort.Strings(deleted)
+	s.snapshot = snapshot
+
+	var update []string
+	if len(changed) > 0 {
+		files, err := s.render(changed)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(status, "Sending %d changed files\n", len(changed))
+		update = append(update, "These files changed since the previous message:\n\n"+strings.TrimRight(files, "\n"))
+	}
+	if len(deleted) > 0 {
+		update = append(update, "These files were deleted: "+strings.Join(deleted, ", "))
+	}
+	return strings.Join(update, "\n\n"), nil
+}
+
+// render builds a prompt holding only the given files, without header,
+// footer or any extra section.
+func (s *chatSession) render(paths []string) (string, error) {
+	config := *s.config
+	config.HeaderText = ""
+	config.FooterText = ""
+	config.Sections = nil
+	config.Tree = false
+	config.DirectoryStructure = false
+	config.GitDiff = ""
+	config.Metadata = false
+	config.Changed = ""
+	config.MaxTokens = 0
+	config.Includes = nil
+	for _, path := range paths {
+		config.Includes = append(config.Includes, promptbuilder.Include{Path: path})
+	}
+
+	builder, err := promptbuilder.New(&config,
+		promptbuilder.WithFormat(s.format),
+		promptbuilder.WithModel(s.model),
+	)
+	if err != nil {
+		return "", err
+	}
+
+	var output strings.Builder
+	if _, err := builder.Build(context.Background(), &output); err != nil {
+		return "", fmt.Errorf("error rendering changed files: %v", err)
+	}
+	return output.String(), nil
+}
+
+// takeSnapshot hashes the content of every file selected by the config.
+func (s *chatSession) takeSnapshot() (map[string][sha256.Size]byte, error) {
+	builder, err := promptbuilder.New(s.config)
+	if err != nil {
+		return nil, err
+	}
+	files, err := builder.Files(context.Background())
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot := make(map[string][sha256.Size]byte, len(files))
+	for _, file := range files {
+		content, err := os.ReadFile(filepath.Join(s.config.BaseDir, file.RelPath))
+		if err != nil {
+			continue
+		}
+		snapshot[file.RelPath] = sha256.Sum256(content)
+	}
+	return snapshot, nil
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+// command is a subcommand, such as build or serve. run is given the
+// arguments after the name of the command and returns the exit code.
+type command struct {
+	name    string
+	summary string
+	run     func(args []string) int
+}
+
+// commands are the subcommands in the order listed by help. They are set
+// in init, since help lists them.
+var commands []command
+
+func init() {
+	commands = []command{
+		{"build", "Generate the prompt from an input file (the default command)", runBuild},
+		{"list", "List the files that would be included, without writing output", runList},
+		{"watch", "Generate the prompt again whenever an included file changes", runWatch},
+		{"init", "Write a starter input file for the current directory", runInit},
+		{"validate", "Check an input file for mistakes without generating output", runValidate},
+		{"import", "Convert the settings of repomix, files-to-prompt or code2prompt", runImport},
+		{"select", "Generate a prompt from the files most similar to a question", runSelect},
+		{"diff", "Show which files changed between the last two generations", runDiff},
+		{"apply", "Write the files of a model response back into basedir", runApply},
+		{"chat", "Chat with a model about the prompt of an input file", runChat},
+		{"session", "Keep a conversation with a model, sending only what changed", runSession},
+		{"serve", "Serve prompts over HTTP", runServe},
+		{"vocabulary", "Download the token vocabularies that count tokens exactly", runVocabulary},
+		{"help", "Show the commands, or the flags of a command", runHelp},
+	}
+}
+
+// findCommand returns the command of the given name, or nil.
+func findCommand(name string) *command {
+	for i := range commands {
+		if commands[i].name == name {
+			return &commands[i]
+		}
+	}
+	return nil
+}
+
+// printCommands lists the commands with their summary.
+func printCommands() {
+	fmt.Fprintln(os.Stderr, "Commands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-12s%s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintln(os.Stderr, "\nWithout a command, promptbuilder runs build.")
+	fmt.Fprintln(os.Stderr, "Run promptbuilder help <command> for the flags of a command.")
+}
+
+// commandName is the command being run, "" for build without a command.
+var commandName string
+
+// buildUsage prints the flags of the build commands, and lists the commands
+// when none was named.
+func buildUsage() {
+	if commandName != "" {
+		fmt.Fprintf(os.Stderr, "Usage: promptbuilder %s [flags]\n", commandName)
+	} else {
+		fmt.Fprintln(os.Stderr, "Usage: promptbuilder [command] [flags]")
+		fmt.Fprintln(os.Stderr)
+		printCommands()
+		fmt.Fprintln(os.Stderr, "\nFlags of build:")
+	}
+	flag.PrintDefaults()
+}
+
+// runHelp lists the commands, or shows the flags of the named command.
+func runHelp(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "Usage: promptbuilder [command] [flags]")
+		fmt.Fprintln(os.Stderr)
+		printCommands()
+		return 0
+	}
+	cmd := findCommand(args[0])
+	if cmd == nil || cmd.name == "help" {
+		fmt.Fprintf(os.Stderr, "Error: unknown command %q\n", args[0])
+		return exitConfig
+	}
+	// The flag sets of the commands print their usage and exit for -h
+	commandName = cmd.name
+	return cmd.run([]string{"-h"})
+}
+
+// runList lists the files that build would include, like build -dry-run.
+func runList(args []string) int {
+	return runBuild(append([]string{"-dry-run"}, args...))
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"promptbuilder/pkg/promptbuilder"
+)
+
+// runDiff prints which files changed between the last two generations
+// kept in the history and returns the exit code.
+func runDiff(args []string) int {
+	flags := flag.NewFlagSet("diff", flag.ExitOnError)
+	inputFile := flags.String("input", "input.txt", "Input file whose history directive names the history")
+	historyDir := flags.String("history", "", "History directory (default: the history of the input file)")
+	names := flags.Bool("names", false, "Only print the paths of the added and changed files, one per line")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: promptbuilder diff [-input file] [-history dir] [-names]")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	dir := *historyDir
+	if dir == "" {
+		config, err := promptbuilder.ReadConfig(*inputFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: cannot read input file: %v\n", err)
+			return exitConfig
+		}
+		if dir = config.HistoryDir(); dir == "" {
+			fmt.Fprintf(os.Stderr, "Error: %s does not set history, and -history is not given\n", *inputFile)
+			return exitConfig
+		}
+	}
+
+	diff, err := promptbuilder.DiffHistory(dir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+
+	if *names {
+		for _, path := range diff.Added {
+			fmt.Println(path)
+		}
+		for _, path := range diff.Changed {
+			fmt.Println(path)
+		}
+		return 0
+	}
+
+	fmt.Printf("Changes from %s to %s:\n", diff.From, diff.To)
+	for _, path := range diff.Changed {
+		fmt.Printf("  changed  %s\n", path)
+	}
+	for _, path := range diff.Added {
+		fmt.Printf("  added    %s\n", path)
+	}
+	for _, path := range diff.Removed {
+		fmt.Printf("  removed  %s\n", path)
+	}
+	fmt.Printf("%d changed, %d added, %d removed, %d unchanged (%+d tokens)\n", len(diff.Changed), len(diff.Added), len(diff.Removed), diff.Unchanged, diff.Tokens)
+	return 0
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"promptbuilder/pkg/promptbuilder"
+)
+
+// runImport converts the settings of another tool into an input file, so
+// that a setup carries over when switching to promptbuilder. -from names a
+// repomix.config.json file, a script that runs files-to-prompt or
+// code2prompt, or one of these commands, whose arguments follow.
+func runImport(args []string) int {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	from := flags.String("from", "", "repomix.config.json, a script running files-to-prompt or code2prompt, or files-to-prompt or code2prompt followed by their arguments")
+	output := flags.String("output", "input.txt", "Input file to write, or - for stdout")
+	force := flags.Bool("force", false, "Overwrite an existing input file")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: promptbuilder import -from file [-output input.txt] [-force]")
+		fmt.Fprintln(os.Stderr, "       promptbuilder import -from files-to-prompt|code2prompt -- args...")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if *from == "" {
+		flags.Usage()
+		return exitConfig
+	}
+
+	var migration *promptbuilder.Migration
+	var err error
+	dir := "."
+	source := *from
+	if _, statErr := os.Stat(*from); os.IsNotExist(statErr) && promptbuilder.IsTool(*from) {
+		migration, err = promptbuilder.MigrateCommand(append([]string{*from}, flags.Args()...))
+		source = ""
+	} else {
+		var data []byte
+		data, err = os.ReadFile(*from)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return exitConfig
+		}
+		dir = filepath.Dir(*from)
+		if strings.EqualFold(filepath.Ext(*from), ".json") {
+			migration, err = promptbuilder.MigrateRepomix(data)
+		} else {
+			migration, err = promptbuilder.MigrateScript(data)
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s: %v\n", *from, err)
+		return exitConfig
+	}
+	if migration.DefaultExcludes {
+		for _, preset := range promptbuilder.DetectPresets(dir) {
+			migration.Directives = append(migration.Directives, promptbuilder.Directive{Key: "preset", Value: preset})
+		}
+	}
+
+	if *output == stdoutPath {
+		if err := migration.WriteConfig(os.Stdout, source); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return exitError
+		}
+		return 0
+	}
+	if _, err := os.Stat(*output); err == nil && !*force {
+		fmt.Fprintf(os.Stderr, "Error: %s already exists, use -force to overwrite it\n", *output)
+		return exitConfig
+	}
+	file, err := os.Create(*output)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error creating %s: %v\n", *output, err)
+		return exitError
+	}
+	defer file.Close()
+	if err := migration.WriteConfig(file, source); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing %s: %v\n", *output, err)
+		return exitError
+	}
+
+	fmt.Printf("Wrote %s from the %s settings\n", *output, migration.Tool)
+	for _, note := range migration.Notes {
+		fmt.Printf("Note: %s\n", note)
+	}
+	if len(migration.Flags) > 0 {
+		fmt.Printf("Run promptbuilder with: %s\n", strings.Join(migration.Flags, " "))
+	}
+	return 0
+}
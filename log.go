@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+
+	"promptbuilder/pkg/promptbuilder"
+)
+
+// Log formats accepted by -log-format.
+const (
+	logFormatText = "text"
+	logFormatJSON = "json"
+)
+
+// logger receives the progress, warning and error messages of a build.
+// It writes to stderr, so that they never mix with a prompt written to
+// stdout.
+var logger = slog.New(promptbuilder.NewLogHandler(os.Stderr, slog.LevelInfo))
+
+// newLogger returns the logger for the -quiet, -verbose and -log-format
+// flags. quiet keeps warnings and errors only, verbose adds debug
+// messages.
+func newLogger(format string, quiet bool, verbose bool) (*slog.Logger, error) {
+	level := slog.LevelInfo
+	switch {
+	case quiet && verbose:
+		return nil, fmt.Errorf("-quiet and -verbose cannot be combined")
+	case quiet:
+		level = slog.LevelWarn
+	case verbose:
+		level = slog.LevelDebug
+	}
+
+	switch format {
+	case logFormatText:
+		return slog.New(promptbuilder.NewLogHandler(os.Stderr, level)), nil
+	case logFormatJSON:
+		return slog.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: level})), nil
+	}
+	return nil, fmt.Errorf("unknown log format %q (use %s or %s)", format, logFormatText, logFormatJSON)
+}
+
+// fail logs an error and exits with code.
+func fail(code int, format string, args ...any) {
+	logger.Error(fmt.Sprintf(format, args...))
+	os.Exit(code)
+}
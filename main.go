@@ -1,331 +1,969 @@
 package main
 
 import (
-	"bufio"
-	"bytes"
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
+	"log/slog"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"strings"
-	"unicode/utf8"
+	"syscall"
+
+	"promptbuilder/pkg/promptbuilder"
 )
 
 var version = "0.2"
 
-type Config struct {
-	HeaderText        string
-	BaseDir           string
-	Includes          []string
-	ExcludeFolders    []string
-	ExcludeExtensions []string
-	ExcludeFiles      []string // New: list of specific files to exclude
-}
-
-func (c *Config) validate() error {
-	if c.BaseDir == "" {
-		return fmt.Errorf("basedir is required")
-	}
+// stdoutPath is the -output value that streams the prompt to stdout.
+const stdoutPath = "-"
 
-	// Convert to absolute path if relative
-	if !filepath.IsAbs(c.BaseDir) {
-		absPath, err := filepath.Abs(c.BaseDir)
-		if err != nil {
-			return fmt.Errorf("failed to convert basedir to absolute path: %v", err)
-		}
-		c.BaseDir = absPath
-	}
+// status receives the messages of the interactive subcommands.
+var status io.Writer = os.Stdout
 
-	if _, err := os.Stat(c.BaseDir); os.IsNotExist(err) {
-		return fmt.Errorf("basedir does not exist: %s", c.BaseDir)
-	}
+// stringList is a flag that can be repeated, collecting every value.
+type stringList []string
 
-	if len(c.Includes) == 0 {
-		return fmt.Errorf("at least one include path is required")
-	}
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
 
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
 	return nil
 }
 
-func readInputFile(filepath string) (*Config, error) {
-	file, err := os.Open(filepath)
-	if err != nil {
-		return nil, fmt.Errorf("error opening file: %v", err)
-	}
-	defer file.Close()
+// optionalValue is a flag that can be given with or without a value;
+// "-changed" alone is the same as "-changed=true".
+type optionalValue struct {
+	value string
+}
 
-	config := &Config{
-		Includes:          make([]string, 0),
-		ExcludeFolders:    make([]string, 0),
-		ExcludeExtensions: make([]string, 0),
-		ExcludeFiles:      make([]string, 0), // Initialize ExcludeFiles
-	}
+func (v *optionalValue) String() string {
+	return v.value
+}
 
-	scanner := bufio.NewScanner(file)
-	headerLines := []string{}
-	isHeader := true
+func (v *optionalValue) Set(value string) error {
+	v.value = value
+	return nil
+}
 
-	for scanner.Scan() {
-		line := scanner.Text()
+func (v *optionalValue) IsBoolFlag() bool {
+	return true
+}
 
-		if line == "---" {
-			isHeader = false
-			config.HeaderText = strings.Join(headerLines, "\n")
-			continue
-		}
+// configFlags maps command-line flags to the config directives they
+// override.
+var configFlags = map[string]string{
+	"basedir":                  "basedir",
+	"include":                  "include",
+	"include-extension":        "includeextension",
+	"exclude-folder":           "excludefolder",
+	"exclude-extension":        "excludeextension",
+	"exclude-file":             "excludefile",
+	"exclude-pattern":          "excludepattern",
+	"force-include":            "forceinclude",
+	"include-binary":           "includebinary",
+	"text-extension":           "textextension",
+	"binary-extension":         "binaryextension",
+	"binary-sample-size":       "binarysamplesize",
+	"gitignore":                "usegitignore",
+	"promptignore":             "usepromptignore",
+	"ignore-case":              "ignorecase",
+	"absolute-paths":           "absolutepaths",
+	"anonymize-paths":          "anonymizepaths",
+	"dedupe":                   "dedupe",
+	"near-duplicates":          "nearduplicates",
+	"omitted-note":             "omittednote",
+	"rename":                   "rename",
+	"skip-generated":           "skipgenerated",
+	"follow-symlinks":          "followsymlinks",
+	"include-hidden":           "includehidden",
+	"max-tokens":               "maxtokens",
+	"max-file-size":            "maxfilesize",
+	"exclude-larger-than":      "excludelargerthan",
+	"max-files":                "maxfiles",
+	"max-total-size":           "maxtotalsize",
+	"truncate-mode":            "truncatemode",
+	"csv-preview":              "csvpreview",
+	"encoding":                 "encoding",
+	"tree":                     "tree",
+	"directory-structure":      "directorystructure",
+	"split-tokens":             "splittokens",
+	"split-chars":              "splitchars",
+	"changed":                  "changed",
+	"sort":                     "sort",
+	"reverse":                  "reverse",
+	"group-by":                 "groupby",
+	"stats":                    "stats",
+	"strict":                   "strict",
+	"follow-imports":           "followimports",
+	"strip-comments":           "stripcomments",
+	"trim-trailing-whitespace": "trimtrailingwhitespace",
+	"collapse-blank-lines":     "collapseblanklines",
+	"tab-width":                "tabwidth",
+	"strip-notebook-outputs":   "stripnotebookoutputs",
+	"line-numbers":             "linenumbers",
+	"cache":                    "cache",
+	"history":                  "history",
+	"prompt-caching":           "promptcaching",
+	"preset":                   "preset",
+	"var":                      "var",
+	"cost":                     "cost",
+	"price":                    "price",
+	"file-header":              "fileheader",
+	"template":                 "template",
+	"git-diff":                 "gitdiff",
+	"git-ref":                  "gitref",
+	"metadata":                 "metadata",
+}
 
-		if isHeader {
-			headerLines = append(headerLines, line)
-		} else {
-			if line == "" {
-				continue
-			}
+func defineConfigFlags() {
+	flag.String("basedir", "", "Base directory (overrides basedir)")
+	flag.Var(&stringList{}, "include", "Path to include, repeatable (replaces the configured includes)")
+	flag.Var(&stringList{}, "include-extension", "Extension to allow, repeatable")
+	flag.Var(&stringList{}, "exclude-folder", "Folder to exclude, repeatable")
+	flag.Var(&stringList{}, "exclude-extension", "Extension to exclude, repeatable")
+	flag.Var(&stringList{}, "exclude-file", "File to exclude, repeatable")
+	flag.Var(&stringList{}, "exclude-pattern", "Regular expression matched against relative paths to exclude, repeatable")
+	flag.Var(&stringList{}, "include-binary", "Binary file embedded base64-encoded, as \"path\" or \"path as image|file\", repeatable")
+	flag.Var(&stringList{}, "force-include", "File read even when it looks binary or matches an exclude rule, repeatable")
+	flag.Var(&stringList{}, "text-extension", "Extension of files always read as text, repeatable")
+	flag.Var(&stringList{}, "binary-extension", "Extension of files always skipped as binary, repeatable")
+	flag.String("binary-sample-size", "", "Bytes read to tell binary files from text (default 512)")
+	flag.Bool("gitignore", false, "Skip files ignored by .gitignore")
+	flag.Bool("promptignore", true, "Skip files ignored by .promptignore files")
+	flag.Bool("ignore-case", false, "Match include and exclude rules regardless of case")
+	flag.Bool("absolute-paths", false, "Name files by their full path in the output instead of relative to basedir")
+	flag.Bool("dedupe", false, "Replace files identical to an earlier one with a reference to it")
+	flag.String("near-duplicates", "", "Replace files this similar to an earlier one with a diff against it (true for 0.95, or e.g. 90%)")
+	flag.Bool("omitted-note", false, "List the files left out as binary, too large or over the token budget in the prompt")
+	flag.Bool("anonymize-paths", false, "Replace the location of basedir and the home directory in the output")
+	flag.Var(&stringList{}, "rename", "Name replaced in paths and content as old=>new, repeatable (the reverse map is saved to <output>.pathmap.json)")
+	flag.Bool("skip-generated", false, "Skip lockfiles, source maps, minified files and files with a generated header")
+	flag.Bool("follow-symlinks", false, "Walk symlinked folders and include symlinked files")
+	flag.Bool("include-hidden", false, "Include files and folders whose name starts with a dot (.env files still need to be named)")
+	flag.String("max-tokens", "", "Token budget for the whole output")
+	flag.String("max-file-size", "", "Truncate files larger than this size (e.g. 100kb)")
+	flag.String("exclude-larger-than", "", "Skip files larger than this size (e.g. 500kb)")
+	flag.String("max-files", "", "Warn, or fail with -strict, when more files are found")
+	flag.String("max-total-size", "", "Warn, or fail with -strict, when the files found are larger in total (e.g. 50mb)")
+	flag.String("truncate-mode", "", "Lines to keep from truncated files (head, tail, headtail)")
+	flag.String("csv-preview", "", "Keep only the header and the first and last N rows of CSV and TSV files")
+	flag.String("encoding", "", "What to do with files that are not UTF-8 (transcode, replace, skip)")
+	flag.Bool("tree", false, "Render a directory tree after the header")
+	flag.Bool("directory-structure", false, "Add a directory structure section (XML format)")
+	flag.String("split-tokens", "", "Split the output into parts of at most N tokens")
+	flag.String("split-chars", "", "Split the output into parts of at most N characters")
+	flag.String("sort", "", "Order of the files (path, size, mtime, extension, tokens, deps, none)")
+	flag.Bool("reverse", false, "Reverse the order of the files")
+	flag.Bool("stats", false, "Append a statistics block to the output and print it")
+	flag.String("follow-imports", "", "Add the in-module Go packages imported by included Go files (true, or the number of levels)")
+	flag.Bool("strict", false, "Fail on warnings such as a missing include path or a skipped binary file")
+	flag.String("group-by", "", "Group the files under a heading per directory (dir, none)")
+	flag.Bool("strip-comments", false, "Remove comments from the file contents")
+	flag.Bool("trim-trailing-whitespace", false, "Remove whitespace at the ends of lines")
+	flag.Bool("collapse-blank-lines", false, "Replace runs of blank lines with a single one")
+	flag.String("tab-width", "", "Replace tabs with this many spaces")
+	flag.Bool("strip-notebook-outputs", false, "Leave out the cell outputs of Jupyter notebooks")
+	flag.Bool("line-numbers", false, "Prefix every line of file content with its number")
+	flag.String("cache", "", "Cache processed files in this directory (relative to basedir), or true for "+promptbuilder.DefaultCacheDir)
+	flag.String("history", "", "Keep every generation in this directory (relative to basedir), or true for "+promptbuilder.DefaultHistoryDir)
+	flag.Bool("prompt-caching", false, "Mark the context for prompt caching (anthropic format)")
+	flag.Var(&stringList{}, "preset", "Apply a preset of excludes ("+strings.Join(promptbuilder.PresetNames(), ", ")+"), repeatable")
+	flag.Var(&stringList{}, "var", "Header variable as name=value, repeatable")
+	flag.String("cost", "", "Comma-separated models to estimate the cost of the prompt for (known: "+strings.Join(promptbuilder.PricedModels(), ", ")+")")
+	flag.Var(&stringList{}, "price", "Price of a model as model=dollars per million input tokens, repeatable")
+	flag.String("file-header", "", "Template of the line before each file in markdown, e.g. \"## {{.RelPath}} ({{.Lines}} lines)\"")
+	flag.String("template", "", "text/template file controlling the output layout")
+	flag.String("git-diff", "", "Add the git diff against this ref as a section")
+	flag.String("git-ref", "", "Read the files from this git ref instead of the working tree")
+	flag.Bool("metadata", false, "Add a git metadata block under the header")
+	flag.Var(&optionalValue{}, "changed", "Only include files changed in the working tree, or since a ref with -changed=<ref>")
+}
 
-			parts := strings.SplitN(line, "=", 2)
-			if len(parts) != 2 {
-				continue
-			}
+// applyConfigFlags applies the config flags given on the command line on
+// top of the values read from the input file. Repeatable flags add to the
+// configured lists, except -include which replaces the configured
+// includes.
+func applyConfigFlags(config *promptbuilder.Config) error {
+	var err error
+	flag.Visit(func(f *flag.Flag) {
+		key, ok := configFlags[f.Name]
+		if !ok || err != nil {
+			return
+		}
 
-			key := strings.ToLower(strings.TrimSpace(parts[0]))
-			value := strings.TrimSpace(parts[1])
-
-			switch key {
-			case "basedir":
-				config.BaseDir = value
-			case "include":
-				config.Includes = append(config.Includes, value)
-			case "excludefolder":
-				config.ExcludeFolders = append(config.ExcludeFolders, value)
-			case "excludeextension":
-				ext := value
-				if !strings.HasPrefix(ext, "*.") {
-					ext = "*." + ext
+		if list, ok := f.Value.(*stringList); ok {
+			if key == "include" {
+				config.Includes = nil
+				config.Sections = nil
+			}
+			for _, value := range *list {
+				if err = config.Set(key, value); err != nil {
+					return
 				}
-				config.ExcludeExtensions = append(config.ExcludeExtensions, ext)
-			case "excludefile":
-				config.ExcludeFiles = append(config.ExcludeFiles, value)
 			}
+			return
 		}
+
+		err = config.Set(key, f.Value.String())
+	})
+	return err
+}
+
+// Exit codes of a prompt build, so that scripts and CI jobs can tell a
+// broken or partial run from a successful one.
+const (
+	exitError    = 1 // reading files or writing the output failed
+	exitConfig   = 2 // invalid input file, flags or configuration
+	exitNoFiles  = 3 // no file matched the include paths
+	exitWarnings = 4 // a warning occurred in strict mode
+
+	exitInterrupted = 130 // stopped by SIGINT or SIGTERM, as shells report it
+)
+
+// errOutputExists is returned when -no-clobber finds the output in place.
+var errOutputExists = errors.New("already exists")
+
+// logTokenReport logs the tokens of every file and of the whole output,
+// and the files dropped by the token budget.
+func logTokenReport(report *promptbuilder.Report, model string) {
+	for _, f := range report.Files {
+		logger.Debug(fmt.Sprintf("  %8d  %s", f.Tokens, f.Path), "path", f.Path, "tokens", f.Tokens)
+	}
+	total := "Estimated total tokens"
+	if report.ExactTokens {
+		total = "Total tokens"
+	}
+	logger.Info(fmt.Sprintf("%s (%s): %d", total, model, report.TotalTokens), "tokens", report.TotalTokens, "exact", report.ExactTokens)
+	for _, cost := range report.Costs {
+		logger.Info(fmt.Sprintf("Estimated cost (%s, %d tokens at $%.2f per million): %s", cost.Model, cost.Tokens, cost.PerMillion, promptbuilder.FormatDollars(cost.Dollars)),
+			"model", cost.Model, "tokens", cost.Tokens, "dollars", cost.Dollars)
 	}
 
-	if err := scanner.Err(); err != nil {
-		return nil, fmt.Errorf("error reading file: %v", err)
+	if len(report.Omitted) > 0 {
+		message := fmt.Sprintf("Omitted %d files to stay within the token budget:", len(report.Omitted))
+		for _, f := range report.Omitted {
+			message += fmt.Sprintf("\n  %8d  %s", f.Tokens, f.Path)
+		}
+		logger.Warn(message, "omitted", len(report.Omitted))
 	}
+}
 
-	return config, nil
+// logWarningSummary logs the warnings of a build grouped by kind, after
+// the messages of the run, so that they are not lost among them.
+func logWarningSummary(report *promptbuilder.Report) {
+	if summary := report.WarningSummary(); summary != "" {
+		logger.Info(strings.TrimSuffix(summary, "\n"), "warnings", len(report.Warnings), "redactions", len(report.Redactions))
+	}
 }
 
-func isBinaryFile(path string) (bool, error) {
-	file, err := os.Open(path)
-	if err != nil {
-		return false, err
+// printFileList prints the files of a dry run with their size, line count
+// and estimated tokens to stdout.
+func printFileList(report *promptbuilder.Report, model string) {
+	var size, lines, tokens int
+	fmt.Printf("%10s %8s %8s  %s\n", "SIZE", "LINES", "TOKENS", "PATH")
+	for _, f := range report.Files {
+		fmt.Printf("%10d %8d %8d  %s\n", f.Size, f.Lines, f.Tokens, f.Path)
+		size += f.Size
+		lines += f.Lines
+		tokens += f.Tokens
+	}
+	fmt.Printf("%10d %8d %8d  total (%d files)\n", size, lines, tokens, len(report.Files))
+	fmt.Printf("Estimated tokens of the whole output (%s): %d\n", model, report.TotalTokens)
+	for _, cost := range report.Costs {
+		fmt.Printf("Estimated cost (%s, %d tokens at $%.2f per million): %s\n", cost.Model, cost.Tokens, cost.PerMillion, promptbuilder.FormatDollars(cost.Dollars))
 	}
-	defer file.Close()
 
-	buf := make([]byte, 512)
-	n, err := file.Read(buf)
-	if err != nil && err != io.EOF {
-		return false, err
+	if len(report.Omitted) > 0 {
+		fmt.Printf("Would omit %d files to stay within the token budget:\n", len(report.Omitted))
+		for _, f := range report.Omitted {
+			fmt.Printf("%10d %8d %8d  %s\n", f.Size, f.Lines, f.Tokens, f.Path)
+		}
 	}
-	buf = buf[:n]
+}
 
-	if bytes.IndexByte(buf, 0) != -1 {
-		return true, nil
+func main() {
+	if len(os.Args) > 1 {
+		if cmd := findCommand(os.Args[1]); cmd != nil {
+			commandName = cmd.name
+			os.Exit(cmd.run(os.Args[2:]))
+		}
 	}
+	// Without a command, the flags are those of build, as in the versions
+	// before commands
+	os.Exit(runBuild(os.Args[1:]))
+}
 
-	return !utf8.Valid(buf), nil
+// buildFlags are the flags of the build, list and watch commands, besides
+// the config flags of defineConfigFlags.
+type buildFlags struct {
+	inputFile         *string
+	outputFile        *string
+	header            *string
+	headerFile        *string
+	footer            *string
+	footerFile        *string
+	format            *string
+	model             *string
+	dryRun            *bool
+	auto              *bool
+	send              *string
+	question          *string
+	appendChanged     *string
+	noClobber         *bool
+	statsJSON         *bool
+	filesFrom         *string
+	fromStackTrace    *string
+	stackTraceContext *int
+	quiet             *bool
+	verbose           *bool
+	noProgress        *bool
+	logFormat         *string
+	llmModel          *string
 }
 
-func isExcludedFolder(path string, excludeFolders []string) bool {
-	for _, folder := range excludeFolders {
-		if filepath.Base(path) == folder {
-			return true
-		}
+// defineBuildFlags defines the flags of the build commands on the
+// command line flag set.
+func defineBuildFlags() *buildFlags {
+	opts := &buildFlags{
+		inputFile:         flag.String("input", "input.txt", "Input file path (default: input.txt)"),
+		outputFile:        flag.String("output", "output.txt", "Output file path, or - for stdout; may hold placeholders such as {{.Profile}}, {{.Date}} and {{.ShortHash}} (default: output.txt)"),
+		header:            flag.String("header", "", "Header text (overrides the header of the input file)"),
+		headerFile:        flag.String("header-file", "", "File whose content is used as header text"),
+		footer:            flag.String("footer", "", "Footer text appended after all files (overrides the footer of the input file)"),
+		footerFile:        flag.String("footer-file", "", "File whose content is used as footer text"),
+		format:            flag.String("format", promptbuilder.FormatMarkdown, "Output format ("+strings.Join(promptbuilder.OutputFormats, ", ")+")"),
+		model:             flag.String("model", promptbuilder.DefaultModel, "Model family to count tokens for ("+strings.Join(promptbuilder.SupportedModels(), ", ")+"); gpt-4o and gpt-4 are counted exactly once promptbuilder vocabulary has downloaded their tokenizer, the others estimated"),
+		dryRun:            flag.Bool("dry-run", false, "List the files that would be included, with sizes and token estimates, without writing output"),
+		auto:              flag.Bool("auto", false, "Detect the project type in basedir and apply matching presets and defaults"),
+		send:              flag.String("send", "", "Send the prompt to a model provider ("+strings.Join(promptbuilder.Providers, ", ")+") and write its reply to the output"),
+		question:          flag.String("prompt", "", "Question appended to the prompt sent with -send"),
+		appendChanged:     flag.String("append-changed", "", "Only include the files changed since a previous generation, given as its history directory or files.json"),
+		noClobber:         flag.Bool("no-clobber", false, "Refuse to overwrite an existing output file"),
+		statsJSON:         flag.Bool("stats-json", false, "Also write per-file counts, skipped files and timing to <output>.stats.json"),
+		filesFrom:         flag.String("files-from", "", "Read the paths to include from this file, or - for stdin, instead of the includes of the input file"),
+		fromStackTrace:    flag.String("from-stacktrace", "", "Include the files of the frames of a stack trace in this file, or - for stdin, instead of the includes of the input file"),
+		stackTraceContext: flag.Int("stacktrace-context", 0, "With -from-stacktrace, only include this many lines around each frame (0 for whole files)"),
+		quiet:             flag.Bool("quiet", false, "Only log warnings and errors"),
+		verbose:           flag.Bool("verbose", false, "Also log debug messages, such as the tokens of every file"),
+		noProgress:        flag.Bool("no-progress", false, "Do not show a progress bar, even for large builds on a terminal"),
+		logFormat:         flag.String("log-format", logFormatText, "Format of the messages written to stderr (text, json)"),
+		llmModel:          flag.String("llm-model", "", "Model used by -send and named in request formats (default: the provider's default model)"),
 	}
-	return false
+	defineConfigFlags()
+	return opts
 }
 
-func isExcludedExtension(path string, excludeExtensions []string) bool {
-	ext := filepath.Ext(path)
-	if ext == "" {
-		return false
+// runBuild generates the prompt and returns the exit code.
+func runBuild(args []string) int {
+	opts := defineBuildFlags()
+	flag.Usage = buildUsage
+	flag.CommandLine.Parse(args)
+	if flag.NArg() > 0 {
+		fail(exitConfig, "Unknown command %q, run promptbuilder help for the list of commands", flag.Arg(0))
 	}
 
-	for _, pattern := range excludeExtensions {
-		if pattern == "*"+ext {
-			return true
+	if *opts.send != "" {
+		// The reply goes to stdout unless -output says otherwise, and
+		// tokens are estimated for the provider's models
+		if !isFlagSet("output") {
+			*opts.outputFile = stdoutPath
+		}
+		if !isFlagSet("model") {
+			*opts.model = promptbuilder.ProviderTokenModel(*opts.send)
 		}
 	}
-	return false
-}
 
-func isExcludedFile(path string, baseDir string, excludeFiles []string) bool {
-	// Get the relative path from baseDir
-	relPath, err := filepath.Rel(baseDir, path)
+	flagLogger, err := newLogger(*opts.logFormat, *opts.quiet, *opts.verbose)
 	if err != nil {
-		return false
+		fail(exitConfig, "Invalid flag: %v", err)
 	}
+	logger = flagLogger
+
+	// The bar shares stderr with the messages, so it is only drawn for a
+	// person watching a terminal
+	var bar *progressBar
+	if !*opts.noProgress && !*opts.quiet && *opts.logFormat == logFormatText && isTerminal(os.Stderr) {
+		bar = &progressBar{w: os.Stderr}
+		logger = slog.New(progressHandler{logger.Handler(), bar})
+	}
+	logger.Debug("promptbuilder v" + version)
 
-	// Convert to forward slashes for consistency
-	relPath = filepath.ToSlash(relPath)
+	if *opts.outputFile, err = promptbuilder.ExpandPath(*opts.outputFile); err != nil {
+		fail(exitConfig, "Invalid output path: %v", err)
+	}
+	opts.useInputFile()
 
-	for _, excludeFile := range excludeFiles {
-		// Convert exclude pattern to forward slashes
-		excludePattern := filepath.ToSlash(excludeFile)
+	config, err := readConfig(*opts.inputFile)
+	if err != nil {
+		fail(exitConfig, "Cannot read input file: %v", err)
+	}
 
-		// Try both exact match and filename-only match
-		if relPath == excludePattern || filepath.Base(path) == excludePattern {
-			return true
+	if err := applyConfigFlags(config); err != nil {
+		fail(exitConfig, "Invalid flag: %v", err)
+	}
+	if *opts.filesFrom != "" {
+		paths, err := readFileList(*opts.filesFrom)
+		if err != nil {
+			fail(exitError, "Cannot read file list: %v", err)
 		}
+		if err := config.UseFileList(paths); err != nil {
+			fail(exitConfig, "Invalid file list: %v", err)
+		}
+		logger.Debug(fmt.Sprintf("Read %d paths from %s", len(paths), *opts.filesFrom), "paths", len(paths))
 	}
-	return false
-}
+	if *opts.fromStackTrace != "" {
+		if *opts.filesFrom != "" {
+			fail(exitConfig, "Invalid flag: -from-stacktrace cannot be combined with -files-from")
+		}
+		frames, err := readStackTrace(*opts.fromStackTrace)
+		if err != nil {
+			fail(exitError, "Cannot read stack trace: %v", err)
+		}
+		if err := config.UseStackTrace(frames, *opts.stackTraceContext); err != nil {
+			fail(exitNoFiles, "Cannot use stack trace: %v", err)
+		}
+		logger.Info(fmt.Sprintf("Found %d files of the stack trace in basedir", len(config.Includes)), "files", len(config.Includes))
+	}
+	if *opts.auto {
+		detected, err := config.AutoDetect()
+		if err != nil {
+			fail(exitError, "Cannot detect project type: %v", err)
+		}
+		if len(detected) == 0 {
+			logger.Info("No known project type detected, including everything")
+		} else {
+			logger.Info("Detected project type: "+strings.Join(detected, ", "), "types", detected)
+		}
+	}
+	if *opts.headerFile != "" {
+		content, err := os.ReadFile(*opts.headerFile)
+		if err != nil {
+			fail(exitError, "Cannot read header file: %v", err)
+		}
+		config.HeaderText = strings.TrimRight(string(content), "\n")
+	}
+	if *opts.header != "" {
+		config.HeaderText = *opts.header
+	}
+	if *opts.footerFile != "" {
+		content, err := os.ReadFile(*opts.footerFile)
+		if err != nil {
+			fail(exitError, "Cannot read footer file: %v", err)
+		}
+		config.FooterText = strings.TrimRight(string(content), "\n")
+	}
+	if *opts.footer != "" {
+		config.FooterText = *opts.footer
+	}
+
+	ctx, stop := signalContext()
+	defer stop()
 
-func collectFiles(path string, config *Config) ([]string, error) {
-	var files []string
+	if err := config.ValidateContext(ctx); err != nil {
+		if ctx.Err() != nil {
+			fail(exitInterrupted, "Interrupted")
+		}
+		fail(exitConfig, "Invalid configuration: %v", err)
+	}
 
-	err := filepath.Walk(path, func(currentPath string, info os.FileInfo, err error) error {
+	options := []promptbuilder.Option{
+		promptbuilder.WithFormat(*opts.format),
+		promptbuilder.WithModel(*opts.model),
+		promptbuilder.WithRequestModel(*opts.llmModel),
+		promptbuilder.WithSlog(logger),
+	}
+	if bar != nil {
+		options = append(options, promptbuilder.WithProgress(bar.update))
+	}
+	if *opts.appendChanged != "" {
+		manifest, err := promptbuilder.ReadManifest(*opts.appendChanged)
 		if err != nil {
-			return err
+			fail(exitConfig, "Cannot read previous generation: %v", err)
 		}
+		options = append(options, promptbuilder.WithPrevious(manifest))
+	}
+	builder, err := promptbuilder.New(config, options...)
+	if err != nil {
+		fail(exitConfig, "%v", err)
+	}
 
-		// Skip excluded folders
-		if info.IsDir() && isExcludedFolder(currentPath, config.ExcludeFolders) {
-			return filepath.SkipDir
+	if *opts.dryRun {
+		report, err := builder.DryRun(ctx)
+		if ctx.Err() != nil {
+			fail(exitInterrupted, "Interrupted")
+		}
+		if err != nil {
+			fail(exitCode(err), "%v", err)
+		}
+		printFileList(report, *opts.model)
+		logWarningSummary(report)
+		if len(report.Files) == 0 && len(report.Omitted) == 0 {
+			return exitNoFiles
 		}
+		return 0
+	}
 
-		// Skip directories, excluded extensions, and excluded files
-		if !info.IsDir() &&
-			!isExcludedExtension(currentPath, config.ExcludeExtensions) &&
-			!isExcludedFile(currentPath, config.BaseDir, config.ExcludeFiles) {
-			relPath, err := filepath.Rel(path, currentPath)
-			if err != nil {
-				return err
+	if *opts.outputFile != stdoutPath {
+		profile := strings.TrimSuffix(filepath.Base(*opts.inputFile), filepath.Ext(*opts.inputFile))
+		path, err := builder.OutputPath(ctx, *opts.outputFile, profile)
+		if err != nil {
+			fail(exitConfig, "Invalid output path: %v", err)
+		}
+		if path != *opts.outputFile {
+			if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+				fail(exitError, "Cannot create output directory: %v", err)
 			}
-			files = append(files, relPath)
+			*opts.outputFile = path
 		}
+	}
+	if *opts.noClobber && *opts.outputFile != stdoutPath {
+		// Checked again when the output is renamed into place, but failing
+		// here saves building a prompt that cannot be written
+		for _, path := range []string{*opts.outputFile, promptbuilder.PartPath(*opts.outputFile, 1)} {
+			if _, err := os.Stat(path); err == nil {
+				fail(exitConfig, "%s already exists, remove it or drop -no-clobber", path)
+			}
+		}
+	}
 
-		return nil
-	})
-
-	if err != nil {
-		return nil, err
+	if *opts.send != "" {
+		if *opts.question == "" {
+			fail(exitConfig, "-send requires a question given with -prompt")
+		}
+		client, err := promptbuilder.NewClient(*opts.send, *opts.llmModel)
+		if err != nil {
+			fail(exitConfig, "%v", err)
+		}
+		err = sendPrompt(ctx, builder, client, *opts.question, *opts.outputFile, *opts.noClobber)
+		if ctx.Err() != nil {
+			fail(exitInterrupted, "Interrupted")
+		}
+		if err != nil {
+			fail(exitCode(err), "%v", err)
+		}
+		return 0
 	}
 
-	return files, nil
-}
+	split := (config.SplitTokens > 0 || config.SplitChars > 0) && !promptbuilder.IsRequestFormat(*opts.format)
+	if split && *opts.outputFile == stdoutPath {
+		fail(exitConfig, "split output cannot be written to stdout")
+	}
+	if *opts.statsJSON && *opts.outputFile == stdoutPath {
+		fail(exitConfig, "-stats-json needs an output file")
+	}
 
-func findFiles(config *Config) ([]string, error) {
-	var allFiles []string
+	var report *promptbuilder.Report
+	if split {
+		report, err = buildParts(ctx, builder, *opts.outputFile, *opts.noClobber)
+	} else {
+		report, err = buildToFile(ctx, builder, *opts.outputFile, *opts.noClobber)
+	}
+	if ctx.Err() != nil {
+		if *opts.outputFile == stdoutPath {
+			fail(exitInterrupted, "Interrupted")
+		}
+		fail(exitInterrupted, "Interrupted, the output was not written")
+	}
+	if err != nil {
+		fail(exitCode(err), "Cannot generate output: %v", err)
+	}
 
-	for _, includePath := range config.Includes {
-		fullPath := filepath.Join(config.BaseDir, includePath)
-		fileInfo, err := os.Stat(fullPath)
+	logTokenReport(report, *opts.model)
+	if config.Stats {
+		logger.Info(strings.TrimSuffix(report.StatsTable(), "\n"))
+	}
+	if *opts.statsJSON {
+		data, err := report.StatsJSON()
+		if err == nil {
+			err = os.WriteFile(promptbuilder.StatsPath(*opts.outputFile), data, 0o644)
+		}
 		if err != nil {
-			fmt.Printf("Warning: Cannot access path %s: %v\n", includePath, err)
-			continue
+			fail(exitError, "Cannot write statistics: %v", err)
 		}
-
-		if fileInfo.IsDir() {
-			// If it's a directory, collect all files recursively
-			files, err := collectFiles(fullPath, config)
-			if err != nil {
-				return nil, fmt.Errorf("error collecting files from %s: %v", includePath, err)
+	}
+	var historyDir string
+	if config.History != "" {
+		var outputs []string
+		if split {
+			for part := 1; part <= report.Parts; part++ {
+				outputs = append(outputs, promptbuilder.PartPath(*opts.outputFile, part))
 			}
+		} else if *opts.outputFile != stdoutPath {
+			outputs = append(outputs, *opts.outputFile)
+		}
+		if historyDir, err = builder.SaveHistory(report, outputs); err != nil {
+			fail(exitError, "Cannot save history: %v", err)
+		}
+	}
+	pathMap := builder.PathMap()
+	if pathMap != nil && *opts.outputFile != stdoutPath {
+		if err := pathMap.Write(promptbuilder.PathMapPath(*opts.outputFile)); err != nil {
+			fail(exitError, "Cannot write path map: %v", err)
+		}
+	}
+
+	logger.Info(fmt.Sprintf("Successfully processed %d files", len(report.Files)), "files", len(report.Files))
+	if split {
+		message := fmt.Sprintf("Output split into %d parts:", report.Parts)
+		for part := 1; part <= report.Parts; part++ {
+			message += "\n  " + promptbuilder.PartPath(*opts.outputFile, part)
+		}
+		logger.Info(message, "parts", report.Parts)
+	} else if *opts.outputFile != stdoutPath {
+		logger.Info("Output written to: "+*opts.outputFile, "output", *opts.outputFile)
+	}
+	if *opts.statsJSON {
+		logger.Info("Statistics written to: "+promptbuilder.StatsPath(*opts.outputFile), "stats", promptbuilder.StatsPath(*opts.outputFile))
+	}
+	if historyDir != "" {
+		logger.Info("Generation saved to: "+historyDir, "history", historyDir)
+	}
+	if pathMap != nil && *opts.outputFile != stdoutPath {
+		logger.Info("Path map written to: "+promptbuilder.PathMapPath(*opts.outputFile), "pathmap", promptbuilder.PathMapPath(*opts.outputFile))
+	}
+	logWarningSummary(report)
+	if len(report.Files) == 0 && len(report.Omitted) == 0 {
+		return exitNoFiles
+	}
+	return 0
+}
 
-			// Add directory prefix to found files
-			for _, f := range files {
-				allFiles = append(allFiles, filepath.Join(includePath, f))
+// useInputFile looks for the input file in the parent directories when
+// -input is not given. When it is found there, the run continues in its
+// directory, and the paths given as flags are made absolute.
+func (opts *buildFlags) useInputFile() {
+	if isFlagSet("input") {
+		return
+	}
+	found, err := findInputFile()
+	if err != nil {
+		fail(exitError, "Cannot look for an input file: %v", err)
+	}
+	if found != "" && filepath.Dir(found) == "." {
+		*opts.inputFile = found
+	} else if found != "" {
+		// Paths in the input file are relative to its directory, where
+		// the run continues, while the paths given as flags stay
+		// relative to the current directory
+		for _, path := range []*string{opts.outputFile, opts.headerFile, opts.footerFile, opts.filesFrom, opts.fromStackTrace, opts.appendChanged} {
+			if *path != "" && *path != stdoutPath && !filepath.IsAbs(*path) && (path != opts.outputFile || isFlagSet("output")) {
+				*path, _ = filepath.Abs(*path)
 			}
-		} else {
-			// If it's a file and not excluded
-			if !isExcludedExtension(fullPath, config.ExcludeExtensions) &&
-				!isExcludedFile(fullPath, config.BaseDir, config.ExcludeFiles) {
-				allFiles = append(allFiles, includePath)
+		}
+		for _, name := range []string{"basedir", "template"} {
+			if f := flag.Lookup(name); isFlagSet(name) && !filepath.IsAbs(f.Value.String()) {
+				if _, err := os.Stat(f.Value.String()); err == nil {
+					abs, _ := filepath.Abs(f.Value.String())
+					f.Value.Set(abs)
+				}
 			}
 		}
+		if err := os.Chdir(filepath.Dir(found)); err != nil {
+			fail(exitError, "Cannot change to the directory of the input file: %v", err)
+		}
+		*opts.inputFile = filepath.Base(found)
+		logger.Info("Using input file "+found, "input", found)
 	}
+}
 
-	return allFiles, nil
+// readFileList reads the paths given with -files-from from a file, or from
+// stdin for -.
+func readFileList(path string) ([]string, error) {
+	r, err := openInput(path)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return promptbuilder.ReadFileList(r)
 }
 
-func generateOutput(config *Config, files []string, outputPath string) error {
-	output, err := os.Create(outputPath)
+// readStackTrace reads the frames of the stack trace given with
+// -from-stacktrace from a file, or from stdin for -.
+func readStackTrace(path string) ([]promptbuilder.StackFrame, error) {
+	r, err := openInput(path)
 	if err != nil {
-		return fmt.Errorf("error creating output file: %v", err)
+		return nil, err
+	}
+	defer r.Close()
+	return promptbuilder.ParseStackTrace(r)
+}
+
+// openInput opens a file named on the command line, or stdin for -.
+func openInput(path string) (io.ReadCloser, error) {
+	if path == "-" {
+		return io.NopCloser(os.Stdin), nil
+	}
+	return os.Open(path)
+}
+
+// exitCode returns the exit code for an error of a build: exitWarnings
+// for a warning in strict mode, exitError for anything else.
+func exitCode(err error) int {
+	if errors.Is(err, promptbuilder.ErrStrict) {
+		return exitWarnings
+	}
+	if errors.Is(err, context.Canceled) {
+		return exitInterrupted
+	}
+	if errors.Is(err, errOutputExists) {
+		return exitConfig
+	}
+	return exitError
+}
+
+// runInit scaffolds a starter config for the current directory and returns
+// the exit code.
+func runInit(args []string) int {
+	flags := flag.NewFlagSet("init", flag.ExitOnError)
+	format := flags.String("format", promptbuilder.ConfigFormatText, "Config format (txt, yaml)")
+	force := flags.Bool("force", false, "Overwrite an existing config file")
+	flags.Parse(args)
+
+	var path string
+	switch *format {
+	case promptbuilder.ConfigFormatText:
+		path = "input.txt"
+	case promptbuilder.ConfigFormatYAML:
+		path = "promptbuilder.yaml"
+	default:
+		fmt.Fprintf(os.Stderr, "Error: unsupported config format: %s\n", *format)
+		return exitConfig
+	}
+
+	if _, err := os.Stat(path); err == nil && !*force {
+		fmt.Fprintf(os.Stderr, "Error: %s already exists, use -force to overwrite it\n", path)
+		return exitConfig
+	}
+
+	suggestion, err := promptbuilder.Suggest(context.Background(), ".")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error scanning directory: %v\n", err)
+		return exitError
+	}
+
+	output, err := os.Create(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error creating %s: %v\n", path, err)
+		return exitError
 	}
 	defer output.Close()
 
-	if config.HeaderText != "" {
-		fmt.Fprintln(output, config.HeaderText)
-		fmt.Fprintln(output)
+	if err := suggestion.WriteConfig(output, *format); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing %s: %v\n", path, err)
+		return exitError
 	}
 
-	for _, relPath := range files {
-		fullPath := filepath.Join(config.BaseDir, relPath)
+	fmt.Printf("Wrote %s\n", path)
+	if suggestion.Language != "" {
+		fmt.Printf("Detected language: %s\n", suggestion.Language)
+	}
+	if len(suggestion.Presets) > 0 {
+		fmt.Printf("Detected presets: %s\n", strings.Join(suggestion.Presets, ", "))
+	}
+	return 0
+}
 
-		// Check if file is binary
-		isBinary, err := isBinaryFile(fullPath)
-		if err != nil {
-			fmt.Printf("Warning: Error checking if file is binary %s: %v\n", relPath, err)
-			continue
+// readConfig reads the input file. When the default input file does not
+// exist, an empty config is used so that a prompt can be described with
+// flags alone.
+func readConfig(inputFile string) (*promptbuilder.Config, error) {
+	if _, err := os.Stat(inputFile); os.IsNotExist(err) && !isFlagSet("input") {
+		return promptbuilder.NewConfig(), nil
+	}
+	return promptbuilder.ReadConfig(inputFile)
+}
+
+// inputFileNames are the input files looked for when -input is not given,
+// in order of preference.
+var inputFileNames = []string{"input.txt", "promptbuilder.yaml", "promptbuilder.yml", "promptbuilder.toml", "promptbuilder.json"}
+
+// findInputFile looks for an input file in the current directory and then
+// in its parents, like git looks for .git, so that promptbuilder runs from
+// any subdirectory of a repository. The search stops at the root of the
+// git repository. It returns the path of the file found, relative to the
+// current directory, or "" when there is none.
+func findInputFile() (string, error) {
+	dir, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+	up := "."
+	for {
+		for _, name := range inputFileNames {
+			if info, err := os.Stat(filepath.Join(dir, name)); err == nil && !info.IsDir() {
+				return filepath.Join(up, name), nil
+			}
 		}
-		if isBinary {
-			fmt.Printf("Skipping binary file: %s\n", relPath)
-			continue
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			return "", nil
 		}
-
-		content, err := os.ReadFile(fullPath)
-		if err != nil {
-			return fmt.Errorf("error reading file %s: %v", relPath, err)
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", nil
 		}
-
-		fmt.Fprintf(output, "# %s\n", fullPath)
-		fmt.Fprintln(output, "```")
-		fmt.Fprintln(output, string(content))
-		fmt.Fprintln(output, "```")
-		fmt.Fprintln(output)
+		dir = parent
+		up = filepath.Join(up, "..")
 	}
+}
 
-	return nil
+// isFlagSet reports whether the flag was given on the command line.
+func isFlagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
 }
 
-func main() {
-	fmt.Println("promptbuilder v" + version)
+// signalContext returns a context cancelled by the first SIGINT or
+// SIGTERM, so that the build stops and removes its partial output. A
+// second signal kills the process.
+func signalContext() (context.Context, context.CancelFunc) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	context.AfterFunc(ctx, stop)
+	return ctx, stop
+}
 
-	inputFile := flag.String("input", "input.txt", "Input file path (default: input.txt)")
-	outputFile := flag.String("output", "output.txt", "Output file path (default: output.txt)")
-	flag.Parse()
+// buildToFile writes the prompt to outputPath. The output is written to a
+// temporary file that replaces outputPath once the build succeeds, so a
+// build that fails or is interrupted leaves the previous output alone
+// rather than a truncated one. With noClobber, an existing output is
+// never replaced.
+func buildToFile(ctx context.Context, builder *promptbuilder.Builder, outputPath string, noClobber bool) (*promptbuilder.Report, error) {
+	if outputPath == stdoutPath {
+		return builder.Build(ctx, os.Stdout)
+	}
 
-	config, err := readInputFile(*inputFile)
+	output, err := createAtomic(outputPath)
 	if err != nil {
-		fmt.Printf("Error reading input file: %v\n", err)
-		os.Exit(1)
+		return nil, fmt.Errorf("error creating output file: %v", err)
 	}
 
-	if err := config.validate(); err != nil {
-		fmt.Printf("Invalid configuration: %v\n", err)
-		os.Exit(1)
+	report, err := builder.Build(ctx, output)
+	if closeErr := output.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = output.commit(noClobber)
+	}
+	if err != nil {
+		output.abort()
+		return nil, err
+	}
+	return report, nil
+}
+
+// buildParts writes the prompt split into parts next to outputPath. The
+// parts replace the files of the previous build only once all of them
+// have been written, and parts of the previous build beyond the last
+// new one are removed. With noClobber, no part is written if any of them
+// exists.
+func buildParts(ctx context.Context, builder *promptbuilder.Builder, outputPath string, noClobber bool) (*promptbuilder.Report, error) {
+	var parts []*atomicFile
+	abort := func() {
+		for _, part := range parts {
+			part.abort()
+		}
+	}
+
+	report, err := builder.BuildParts(ctx, func(part int) (io.WriteCloser, error) {
+		output, err := createAtomic(promptbuilder.PartPath(outputPath, part))
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, output)
+		return output, nil
+	})
+	if err != nil {
+		abort()
+		return nil, err
+	}
+	if noClobber {
+		for _, part := range parts {
+			if _, err := os.Lstat(part.path); err == nil {
+				abort()
+				return nil, fmt.Errorf("%s %w", part.path, errOutputExists)
+			}
+		}
+	}
+	for i, part := range parts {
+		if err := part.commit(noClobber); err != nil {
+			// Parts that replaced a file of the previous build stay, as
+			// it is gone; new ones are removed, as the set is incomplete
+			abort()
+			for _, done := range parts[:i] {
+				if !done.replaced {
+					os.Remove(done.path)
+				}
+			}
+			return nil, err
+		}
+	}
+	if !noClobber {
+		for part := len(parts) + 1; ; part++ {
+			if err := os.Remove(promptbuilder.PartPath(outputPath, part)); err != nil {
+				break
+			}
+		}
 	}
+	return report, nil
+}
+
+// atomicFile is written under a temporary name next to path, and moved
+// to path by commit.
+type atomicFile struct {
+	*os.File
+	path     string
+	replaced bool // commit replaced an existing file
+}
 
-	files, err := findFiles(config)
+func createAtomic(path string) (*atomicFile, error) {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
 	if err != nil {
-		fmt.Printf("Error finding files: %v\n", err)
-		os.Exit(1)
+		return nil, err
 	}
+	return &atomicFile{File: tmp, path: path}, nil
+}
 
-	if len(files) == 0 {
-		fmt.Println("Warning: No files found matching the include paths")
-	} else {
-		fmt.Printf("Found %d matching files\n", len(files))
+// commit moves the closed file to its path, keeping the permissions of
+// the file it replaces. With noClobber, the file is linked to its path,
+// which fails if the path exists, even when it was created since it was
+// last checked.
+func (f *atomicFile) commit(noClobber bool) error {
+	if noClobber {
+		if err := os.Chmod(f.Name(), 0o644); err != nil {
+			return err
+		}
+		if err := os.Link(f.Name(), f.path); err != nil {
+			if os.IsExist(err) {
+				return fmt.Errorf("%s %w", f.path, errOutputExists)
+			}
+			return err
+		}
+		return os.Remove(f.Name())
 	}
 
-	if err := generateOutput(config, files, *outputFile); err != nil {
-		fmt.Printf("Error generating output: %v\n", err)
-		os.Exit(1)
+	mode := os.FileMode(0o644)
+	if info, err := os.Stat(f.path); err == nil {
+		mode = info.Mode().Perm()
+		f.replaced = true
+	}
+	if err := os.Chmod(f.Name(), mode); err != nil {
+		return err
 	}
+	return os.Rename(f.Name(), f.path)
+}
 
-	fmt.Printf("Successfully processed %d files\n", len(files))
-	fmt.Printf("Output written to: %s\n", *outputFile)
+// abort removes the temporary file.
+func (f *atomicFile) abort() {
+	f.Close()
+	os.Remove(f.Name())
 }
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"promptbuilder/pkg/promptbuilder"
+)
+
+// testParts builds three files of base, split so that each lands in a
+// part of its own, to the parts of output.
+func testParts(t *testing.T, base string, output string, noClobber bool) error {
+	t.Helper()
+	config, err := promptbuilder.ParseConfig(strings.NewReader("---\nbasedir=" + base + "\ninclude=a.txt\ninclude=b.txt\ninclude=c.txt\nsplitChars=200\n"))
+	if err != nil {
+		t.Fatalf("ParseConfig: %v", err)
+	}
+	builder, err := promptbuilder.New(config)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	_, err = buildParts(context.Background(), builder, output, noClobber)
+	return err
+}
+
+func writeFile(t *testing.T, path string, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// checkParts checks which parts of output exist, and that no temporary
+// file was left behind.
+func checkParts(t *testing.T, output string, want map[int]bool) {
+	t.Helper()
+	for part, exists := range want {
+		path := promptbuilder.PartPath(output, part)
+		if _, err := os.Stat(path); (err == nil) != exists {
+			t.Errorf("%s exists: %v, want %v", filepath.Base(path), err == nil, exists)
+		}
+	}
+	entries, err := os.ReadDir(filepath.Dir(output))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		if strings.HasSuffix(entry.Name(), ".tmp") {
+			t.Errorf("temporary file %s was left behind", entry.Name())
+		}
+	}
+}
+
+func TestBuildParts(t *testing.T) {
+	base := t.TempDir()
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		writeFile(t, filepath.Join(base, name), strings.Repeat(name+"\n", 20))
+	}
+
+	t.Run("stale parts", func(t *testing.T) {
+		output := filepath.Join(t.TempDir(), "out.txt")
+		for part := 1; part <= 5; part++ {
+			writeFile(t, promptbuilder.PartPath(output, part), "old")
+		}
+		if err := testParts(t, base, output, false); err != nil {
+			t.Fatalf("buildParts: %v", err)
+		}
+		checkParts(t, output, map[int]bool{1: true, 2: true, 3: true, 4: false, 5: false})
+	})
+
+	t.Run("no clobber", func(t *testing.T) {
+		output := filepath.Join(t.TempDir(), "out.txt")
+		writeFile(t, promptbuilder.PartPath(output, 2), "old")
+		if err := testParts(t, base, output, true); !errors.Is(err, errOutputExists) {
+			t.Fatalf("buildParts = %v, want %v", err, errOutputExists)
+		}
+		checkParts(t, output, map[int]bool{1: false, 2: true, 3: false})
+		if content, _ := os.ReadFile(promptbuilder.PartPath(output, 2)); string(content) != "old" {
+			t.Errorf("the existing part was overwritten with %q", content)
+		}
+
+		os.Remove(promptbuilder.PartPath(output, 2))
+		writeFile(t, promptbuilder.PartPath(output, 4), "old")
+		if err := testParts(t, base, output, true); err != nil {
+			t.Fatalf("buildParts: %v", err)
+		}
+		checkParts(t, output, map[int]bool{1: true, 2: true, 3: true, 4: true})
+	})
+
+	t.Run("failed commit", func(t *testing.T) {
+		output := filepath.Join(t.TempDir(), "out.txt")
+		writeFile(t, promptbuilder.PartPath(output, 1), "old")
+		// A directory cannot be replaced by a part
+		if err := os.Mkdir(promptbuilder.PartPath(output, 3), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		writeFile(t, filepath.Join(promptbuilder.PartPath(output, 3), "x"), "")
+		if err := testParts(t, base, output, false); err == nil {
+			t.Fatal("buildParts succeeded")
+		}
+		// Part 1 replaced a file that is gone, part 2 was new
+		checkParts(t, output, map[int]bool{1: true, 2: false})
+		if content, _ := os.ReadFile(promptbuilder.PartPath(output, 1)); string(content) == "old" {
+			t.Error("part 1 was not replaced")
+		}
+	})
+}
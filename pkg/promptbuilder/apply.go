@@ -0,0 +1,210 @@
+package promptbuilder
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// FileChange is a change to a file suggested in a model response: either
+// its complete new content or the hunks of a unified diff.
+type FileChange struct {
+	Path    string
+	Content string
+	Hunks   []Hunk
+	Delete  bool // the diff deletes the file
+}
+
+// IsPatch reports whether the change is a diff rather than a whole file.
+func (c FileChange) IsPatch() bool {
+	return len(c.Hunks) > 0
+}
+
+// pathHeading matches a markdown heading that names a file, such as
+// "# src/main.go" or "## `src/main.go`".
+var pathHeading = regexp.MustCompile("^#{1,6}\\s+[`*]*([^\\s`*]+)[`*]*\\s*$")
+
+// ParseResponse extracts the file changes from a model response written
+// in the markdown layout promptbuilder emits: a "# path" heading followed
+// by a fenced code block holding the complete file. Code blocks holding a
+// unified diff are split into one change per file they touch. Headings
+// that do not look like a path, and other code blocks without a heading,
+// are ignored.
+func ParseResponse(r io.Reader) ([]FileChange, error) {
+	var changes []FileChange
+	var path string
+	var fence, info string
+	var lines []string
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		if fence != "" {
+			if isClosingFence(line, fence) {
+				if isDiff(info, lines) {
+					changes = append(changes, parseDiff(lines, path)...)
+				} else if path != "" {
+					content := strings.Join(lines, "\n")
+					if content != "" && !strings.HasSuffix(content, "\n") {
+						content += "\n"
+					}
+					changes = append(changes, FileChange{Path: path, Content: content})
+				}
+				path, fence, lines = "", "", nil
+				continue
+			}
+			lines = append(lines, line)
+			continue
+		}
+
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "":
+			// Blank lines may separate the heading from its block
+		case openingFence(trimmed) != "":
+			fence = openingFence(trimmed)
+			info = strings.ToLower(strings.TrimSpace(trimmed[len(fence):]))
+		default:
+			path = ""
+			if m := pathHeading.FindStringSubmatch(trimmed); m != nil && strings.ContainsAny(m[1], "./") {
+				path = m[1]
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if fence != "" && path != "" {
+		return nil, fmt.Errorf("unterminated code block for %s", path)
+	}
+
+	return changes, nil
+}
+
+// openingFence returns the fence that opens a code block, such as ``` or
+// ````go, without the info string, or "" when line is not one.
+func openingFence(line string) string {
+	for _, ch := range []string{"`", "~"} {
+		n := len(line) - len(strings.TrimLeft(line, ch))
+		if n >= 3 {
+			return line[:n]
+		}
+	}
+	return ""
+}
+
+// isClosingFence reports whether line closes a block opened with fence: a
+// run of the same character at least as long, and nothing else.
+func isClosingFence(line string, fence string) bool {
+	trimmed := strings.TrimSpace(line)
+	return len(trimmed) >= len(fence) && strings.Trim(trimmed, fence[:1]) == ""
+}
+
+// ResolveChangePath returns the file a change refers to. Absolute paths,
+// as promptbuilder emits them, must lie inside baseDir; relative paths
+// are relative to it. Symlinks are resolved for the check, so that a
+// change cannot be written through a link to outside of baseDir, and
+// paths inside a .git directory are refused.
+func ResolveChangePath(baseDir string, path string) (string, error) {
+	baseDir, err := filepath.Abs(baseDir)
+	if err != nil {
+		return "", err
+	}
+
+	fullPath := filepath.FromSlash(path)
+	if !filepath.IsAbs(fullPath) {
+		fullPath = filepath.Join(baseDir, fullPath)
+	}
+	fullPath = filepath.Clean(fullPath)
+
+	rel, err := filepath.Rel(baseDir, fullPath)
+	if err != nil || !isInside(rel) {
+		return "", fmt.Errorf("%s is outside of basedir", path)
+	}
+	for _, part := range strings.Split(rel, string(filepath.Separator)) {
+		if strings.EqualFold(part, ".git") {
+			return "", fmt.Errorf("%s is inside a .git directory", path)
+		}
+	}
+
+	root, err := filepath.EvalSymlinks(baseDir)
+	if err != nil {
+		return "", err
+	}
+	resolved, err := resolveExisting(fullPath)
+	if err != nil {
+		return "", fmt.Errorf("%s: %v", path, err)
+	}
+	if rel, err := filepath.Rel(root, resolved); err != nil || !isInside(rel) {
+		return "", fmt.Errorf("%s leads outside of basedir through a symlink", path)
+	}
+	return fullPath, nil
+}
+
+// isInside reports whether rel, a path made relative with filepath.Rel,
+// stays inside the directory it is relative to.
+func isInside(rel string) bool {
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// resolveExisting resolves the symlinks of the longest part of path that
+// exists and appends the rest, which ApplyChange would create. A dangling
+// symlink is followed to its target, as writing to it creates the target.
+func resolveExisting(path string) (string, error) {
+	var missing []string
+	for {
+		resolved, err := filepath.EvalSymlinks(path)
+		if err == nil {
+			return filepath.Join(append([]string{resolved}, missing...)...), nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return "", err
+		}
+		if target, lerr := os.Readlink(path); lerr == nil {
+			dir, name := filepath.Dir(path), target
+			if i := strings.LastIndex(target, string(filepath.Separator)); i >= 0 {
+				dir, name = target[:i+1], target[i+1:]
+				if !filepath.IsAbs(target) {
+					dir = filepath.Dir(path) + string(filepath.Separator) + dir
+				}
+			}
+			// Not joined, which would clean "link/.." before link is resolved
+			dir, err := filepath.EvalSymlinks(dir)
+			if err != nil {
+				return "", err
+			}
+			resolved, err := resolveExisting(filepath.Join(dir, name))
+			if err != nil {
+				return "", err
+			}
+			return filepath.Join(append([]string{resolved}, missing...)...), nil
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return "", err
+		}
+		missing = append([]string{filepath.Base(path)}, missing...)
+		path = parent
+	}
+}
+
+// ApplyChange writes the change to fullPath, creating missing parent
+// directories, and keeps the mode of an existing file.
+func ApplyChange(fullPath string, content string) error {
+	mode := os.FileMode(0o644)
+	if info, err := os.Stat(fullPath); err == nil {
+		mode = info.Mode().Perm()
+	}
+	if err := os.MkdirAll(filepath.Dir(fullPath), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(fullPath, []byte(content), mode)
+}
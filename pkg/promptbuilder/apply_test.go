@@ -0,0 +1,69 @@
+package promptbuilder
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResolveChangePath(t *testing.T) {
+	base := t.TempDir()
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"main.go", filepath.Join(base, "main.go")},
+		{"src/a.go", filepath.Join(base, "src", "a.go")},
+		{"src/../b.go", filepath.Join(base, "b.go")},
+		{filepath.Join(base, "c.go"), filepath.Join(base, "c.go")},
+	}
+	for _, test := range tests {
+		got, err := ResolveChangePath(base, test.path)
+		if err != nil || got != test.want {
+			t.Errorf("ResolveChangePath(%q) = %q, %v, want %q", test.path, got, err, test.want)
+		}
+	}
+	for _, path := range []string{"..", "../x.go", "src/../../x.go", filepath.Join(filepath.Dir(base), "x.go"), "/etc/passwd"} {
+		if got, err := ResolveChangePath(base, path); err == nil {
+			t.Errorf("ResolveChangePath(%q) = %q, want an error", path, got)
+		}
+	}
+}
+
+// TestResolveChangePathTraversal checks that a change cannot be written
+// through a symlink to outside of basedir, nor inside a .git directory.
+func TestResolveChangePathTraversal(t *testing.T) {
+	outside := t.TempDir()
+	base := t.TempDir()
+	writeTestFile(t, filepath.Join(outside, "secret.txt"), "secret\n")
+	writeTestFile(t, filepath.Join(base, "src", "a.go"), "package src\n")
+	links := map[string]string{
+		"out":          outside,
+		"up":           "..",
+		"secret.txt":   filepath.Join(outside, "secret.txt"),
+		"dangling.txt": filepath.Join(outside, "new.txt"),
+		"escape.txt":   "src/../../new.txt",
+		"src/inner":    ".",
+		"src/parent":   "inner/../..",
+		"local":        "src",
+		"local.go":     "src/a.go",
+		"new.go":       "src/new.go",
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(base, name)); err != nil {
+			t.Skipf("symlinks are not supported: %v", err)
+		}
+	}
+
+	for _, path := range []string{"out/secret.txt", "out/new/x.go", "up/x.go", "secret.txt", "dangling.txt", "escape.txt", "src/parent/x.go",
+		".git/config", ".git/hooks/pre-commit", "src/.git/config", ".GIT/config", filepath.Join(base, ".git", "HEAD")} {
+		if got, err := ResolveChangePath(base, path); err == nil {
+			t.Errorf("ResolveChangePath(%q) = %q, want an error", path, got)
+		}
+	}
+	for _, path := range []string{"local/a.go", "local/new/b.go", "local.go", "new.go", "src/inner/a.go", "src/.gitignore", "x.git/a.go"} {
+		if _, err := ResolveChangePath(base, path); err != nil {
+			t.Errorf("ResolveChangePath(%q): %v", path, err)
+		}
+	}
+}
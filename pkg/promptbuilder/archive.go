@@ -0,0 +1,224 @@
+package promptbuilder
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// archiveExtensions are the archives accepted as basedir.
+var archiveExtensions = []string{".zip", ".tar", ".tar.gz", ".tgz"}
+
+// isArchive reports whether path names an archive that can be used as
+// basedir.
+func isArchive(path string) bool {
+	lower := strings.ToLower(path)
+	for _, extension := range archiveExtensions {
+		if strings.HasSuffix(lower, extension) {
+			return true
+		}
+	}
+	return false
+}
+
+// extractArchive extracts an archive used as basedir to a directory in the
+// user cache and returns the directory to use as basedir. An archive
+// holding a single top-level folder, as source snapshots usually do, is
+// entered, so includes are relative to that folder. The archive is
+// extracted again whenever its size or modification time changes.
+func extractArchive(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	key := fmt.Sprintf("%s:%d:%d", path, info.Size(), info.ModTime().UnixNano())
+
+	dir, err := extractCached("archives", key, func(target string) error {
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		lower := strings.ToLower(path)
+		switch {
+		case strings.HasSuffix(lower, ".zip"):
+			return extractZip(file, info.Size(), target)
+		case strings.HasSuffix(lower, ".tar"):
+			return extractTar(file, target)
+		default:
+			gz, err := gzip.NewReader(file)
+			if err != nil {
+				return err
+			}
+			defer gz.Close()
+			return extractTar(gz, target)
+		}
+	})
+	if err != nil {
+		return "", fmt.Errorf("cannot extract %s: %v", path, err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err == nil && len(entries) == 1 && entries[0].IsDir() {
+		return filepath.Join(dir, entries[0].Name()), nil
+	}
+	return dir, nil
+}
+
+// extractCached returns the directory of key in the kind folder of the
+// user cache, first filling it with extract when it does not exist yet.
+// extract writes to a temporary directory that is moved in place when it
+// is complete, so that an interrupted run is never taken for a finished
+// one.
+func extractCached(kind string, key string, extract func(dir string) error) (string, error) {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("cannot find the user cache directory: %v", err)
+	}
+	sum := sha256.Sum256([]byte(key))
+	target := filepath.Join(cacheDir, "promptbuilder", kind, hex.EncodeToString(sum[:8]))
+	if _, err := os.Stat(target); err == nil {
+		return target, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return "", err
+	}
+	tmp, err := os.MkdirTemp(filepath.Dir(target), "extract-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmp)
+
+	if err := extract(tmp); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp, target); err != nil {
+		if _, statErr := os.Stat(target); statErr == nil {
+			// Another run extracted the same files meanwhile
+			return target, nil
+		}
+		return "", err
+	}
+	return target, nil
+}
+
+// extractTar writes the files and symlinks of a tar archive to dir.
+// Entries that would land outside of dir are skipped. Symlinks are created
+// once all files are written, so that no file is written through one, and
+// only when they point to a file or directory inside dir.
+func extractTar(r io.Reader, dir string) error {
+	var links []*tar.Header
+	archive := tar.NewReader(r)
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if !filepath.IsLocal(header.Name) {
+			continue
+		}
+		path := filepath.Join(dir, header.Name)
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(path, 0o755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := writeExtracted(path, archive, os.FileMode(header.Mode)); err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			links = append(links, header)
+		}
+	}
+
+	root, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return err
+	}
+	for _, header := range links {
+		path := filepath.Join(dir, header.Name)
+		if filepath.IsAbs(header.Linkname) {
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return err
+		}
+		// Not joined, which would clean "link/.." before link is resolved
+		target, err := filepath.EvalSymlinks(filepath.Dir(path) + string(filepath.Separator) + header.Linkname)
+		if err != nil {
+			continue
+		}
+		if rel, err := filepath.Rel(root, target); err != nil || !filepath.IsLocal(rel) {
+			continue
+		}
+		if err := os.Symlink(header.Linkname, path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// extractZip writes the files of a zip archive to dir. Entries that would
+// land outside of dir are skipped.
+func extractZip(r io.ReaderAt, size int64, dir string) error {
+	archive, err := zip.NewReader(r, size)
+	if err != nil {
+		return err
+	}
+	for _, entry := range archive.File {
+		if !filepath.IsLocal(entry.Name) {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name)
+
+		mode := entry.Mode()
+		switch {
+		case mode.IsDir():
+			if err := os.MkdirAll(path, 0o755); err != nil {
+				return err
+			}
+		case mode.IsRegular():
+			content, err := entry.Open()
+			if err != nil {
+				return err
+			}
+			err = writeExtracted(path, content, mode)
+			content.Close()
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// writeExtracted writes the content of an archive entry to path, creating
+// its parent directories.
+func writeExtracted(path string, content io.Reader, mode os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode.Perm()|0o600)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(file, content)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,159 @@
+package promptbuilder
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// tarEntry is an entry of a test tar archive: a file with content, a
+// directory when name ends with "/", or a symlink when link is set.
+type tarEntry struct {
+	name, content, link string
+}
+
+func writeTestTar(t *testing.T, path string, entries []tarEntry) {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	archive := tar.NewWriter(gz)
+	for _, entry := range entries {
+		header := &tar.Header{Name: entry.name, Mode: 0o644, Typeflag: tar.TypeReg, Size: int64(len(entry.content))}
+		switch {
+		case entry.link != "":
+			header.Typeflag, header.Linkname, header.Size = tar.TypeSymlink, entry.link, 0
+		case entry.name[len(entry.name)-1] == '/':
+			header.Typeflag, header.Mode = tar.TypeDir, 0o755
+		}
+		if err := archive.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := archive.Write([]byte(entry.content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, path, buf.String())
+}
+
+// testCacheHome points the user cache directory to a temporary one.
+func testCacheHome(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("XDG_CACHE_HOME", home)
+	t.Setenv("HOME", home)
+	t.Setenv("LocalAppData", home)
+}
+
+func TestExtractArchive(t *testing.T) {
+	testCacheHome(t)
+	path := filepath.Join(t.TempDir(), "project.tar.gz")
+	writeTestTar(t, path, []tarEntry{
+		{name: "project-1.0/"},
+		{name: "project-1.0/main.go", content: "package main\n"},
+		{name: "project-1.0/docs/readme.md", content: "# Project\n"},
+		{name: "project-1.0/docs/latest", link: "readme.md"},
+	})
+
+	dir, err := extractArchive(path)
+	if err != nil {
+		t.Fatalf("extractArchive: %v", err)
+	}
+	if filepath.Base(dir) != "project-1.0" {
+		t.Errorf("extractArchive = %s, want the single top-level folder", dir)
+	}
+	for name, want := range map[string]string{"main.go": "package main\n", "docs/readme.md": "# Project\n", "docs/latest": "# Project\n"} {
+		if content, err := os.ReadFile(filepath.Join(dir, name)); err != nil || string(content) != want {
+			t.Errorf("%s = %q, %v, want %q", name, content, err, want)
+		}
+	}
+
+	again, err := extractArchive(path)
+	if err != nil || again != dir {
+		t.Errorf("second extractArchive = %s, %v, want the cached %s", again, err, dir)
+	}
+}
+
+// TestExtractTarOutside checks that entries of an archive cannot write or
+// point outside of the extraction directory.
+func TestExtractTarOutside(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "dir")
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "evil.tgz")
+	writeTestTar(t, path, []tarEntry{
+		{name: "../escaped.txt", content: "x"},
+		{name: "/absolute.txt", content: "x"},
+		{name: "up", link: ".."},
+		{name: "abs", link: root},
+		{name: "self", link: "."},
+		{name: "loop", link: "self/.."},
+		{name: "up/escaped.txt", content: "x"},
+		{name: "ok.txt", content: "ok"},
+		{name: "sub/ok.txt", link: "../ok.txt"},
+	})
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := extractTar(gz, dir); err != nil {
+		t.Fatalf("extractTar: %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(root, "escaped.txt")); err == nil {
+		t.Error("an entry was written outside of the directory")
+	}
+	for _, name := range []string{"abs", "loop"} {
+		if _, err := os.Lstat(filepath.Join(dir, name)); err == nil {
+			t.Errorf("symlink %s pointing outside of the directory was created", name)
+		}
+	}
+	for _, name := range []string{"ok.txt", "sub/ok.txt"} {
+		if content, err := os.ReadFile(filepath.Join(dir, name)); err != nil || string(content) != "ok" {
+			t.Errorf("%s = %q, %v", name, content, err)
+		}
+	}
+}
+
+func TestExtractZip(t *testing.T) {
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	for name, content := range map[string]string{"src/main.go": "package main\n", "../escaped.txt": "x"} {
+		w, err := archive.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(content))
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	root := t.TempDir()
+	dir := filepath.Join(root, "dir")
+	if err := extractZip(bytes.NewReader(buf.Bytes()), int64(buf.Len()), dir); err != nil {
+		t.Fatalf("extractZip: %v", err)
+	}
+	if content, err := os.ReadFile(filepath.Join(dir, "src", "main.go")); err != nil || string(content) != "package main\n" {
+		t.Errorf("src/main.go = %q, %v", content, err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "escaped.txt")); err == nil {
+		t.Error("an entry was written outside of the directory")
+	}
+}
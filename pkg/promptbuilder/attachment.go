@@ -0,0 +1,112 @@
+package promptbuilder
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"mime"
+	"path/filepath"
+	"strings"
+)
+
+// Attachment is a binary file embedded in the prompt base64-encoded, set
+// with "includebinary=path as image".
+type Attachment struct {
+	Path string
+	Kind string // attachmentImage or attachmentFile
+}
+
+// Attachment kinds. Request formats send images as image blocks and other
+// files as documents.
+const (
+	attachmentImage = "image"
+	attachmentFile  = "file"
+)
+
+// maxImageTokens is what an image costs at most in the request formats;
+// larger images are scaled down by the provider.
+const maxImageTokens = 1600
+
+// parseAttachment parses "path", "path as image" or "path as file".
+// Without a kind, files with an image media type are images.
+func parseAttachment(value string) (Attachment, error) {
+	attachment := Attachment{Path: value}
+	if path, kind, ok := strings.Cut(value, " as "); ok {
+		attachment.Path = strings.TrimSpace(path)
+		attachment.Kind = strings.ToLower(strings.TrimSpace(kind))
+		if attachment.Kind != attachmentImage && attachment.Kind != attachmentFile {
+			return attachment, fmt.Errorf("unknown kind %q (use image or file)", kind)
+		}
+	}
+	if attachment.Path == "" {
+		return attachment, fmt.Errorf("path is required")
+	}
+	if attachment.Kind == "" {
+		attachment.Kind = attachmentFile
+		if strings.HasPrefix(mediaType(attachment.Path), "image/") {
+			attachment.Kind = attachmentImage
+		}
+	}
+	return attachment, nil
+}
+
+// mediaType returns the media type of a file from its extension.
+func mediaType(path string) string {
+	typ, _, err := mime.ParseMediaType(mime.TypeByExtension(strings.ToLower(filepath.Ext(path))))
+	if err != nil {
+		return "application/octet-stream"
+	}
+	return typ
+}
+
+// attachmentSection reads an attachment and returns it as a section whose
+// content is base64, and its estimated token count.
+func (b *Builder) attachmentSection(attachment Attachment) (extraSection, int, error) {
+	data, err := b.src.readFile(filepath.Join(b.config.BaseDir, attachment.Path))
+	if err != nil {
+		return extraSection{}, 0, err
+	}
+	typ := mediaType(attachment.Path)
+	if attachment.Kind == attachmentImage && !strings.HasPrefix(typ, "image/") {
+		return extraSection{}, 0, fmt.Errorf("%s is not an image", typ)
+	}
+
+	section := extraSection{
+		Name:      "attachment",
+		Title:     filepath.ToSlash(attachment.Path),
+		Language:  typ,
+		Content:   base64.StdEncoding.EncodeToString(data),
+		MediaType: typ,
+		Image:     attachment.Kind == attachmentImage,
+	}
+	if section.Image && IsRequestFormat(b.format) {
+		return section, imageTokens(data), nil
+	}
+	return section, b.tok.countTokens(b.renderer.renderSection(section)), nil
+}
+
+// imageTokens estimates what an image costs a vision model: about one
+// token per 750 pixels, up to maxImageTokens.
+func imageTokens(data []byte) int {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return maxImageTokens
+	}
+	return min(maxImageTokens, max(1, config.Width*config.Height/750))
+}
+
+// splitAttachments separates the attachments from the other sections.
+func splitAttachments(sections []extraSection) (text []extraSection, attachments []extraSection) {
+	for _, section := range sections {
+		if section.MediaType != "" {
+			attachments = append(attachments, section)
+		} else {
+			text = append(text, section)
+		}
+	}
+	return text, attachments
+}
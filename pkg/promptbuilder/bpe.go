@@ -0,0 +1,273 @@
+package promptbuilder
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// vocabulary is the BPE vocabulary of a tiktoken encoding: the file
+// holding its ranks, the checksum of that file, and the pattern that
+// splits text into the pieces the ranks are applied to.
+type vocabulary struct {
+	file    string
+	sha256  string
+	pattern *regexp.Regexp
+}
+
+// spaces is the Unicode White_Space class that \s matches in tiktoken's
+// patterns; \s in Go only matches ASCII whitespace.
+const spaces = `\s\v\x{85}\p{Z}`
+
+// The split patterns of tiktoken, with \s widened to spaces. Go's regexp
+// has no lookahead, so `\s+(?!\S)|\s+` is the capture group at the end,
+// and nextPiece gives back the last space of a match followed by other
+// text, as the lookahead would.
+var (
+	cl100kBase = &vocabulary{
+		file:   "cl100k_base.tiktoken",
+		sha256: "223921b76ee99bde995b7ff738513eef100fb51d18c93597a113bcffe865b2a7",
+		pattern: regexp.MustCompile(`^(?:(?i:'s|'t|'re|'ve|'m|'ll|'d)|[^\r\n\p{L}\p{N}]?\p{L}+|\p{N}{1,3}| ?[^` + spaces + `\p{L}\p{N}]+[\r\n]*|[` +
+			spaces + `]*[\r\n]+|([` + spaces + `]+))`),
+	}
+	o200kBase = &vocabulary{
+		file:   "o200k_base.tiktoken",
+		sha256: "446a9538cb6c348e3516120d7c08b09f57c36495e2acfffe59a5bf8b0cfb1a2d",
+		pattern: regexp.MustCompile(`^(?:[^\r\n\p{L}\p{N}]?[\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}]*[\p{Ll}\p{Lm}\p{Lo}\p{M}]+(?i:'s|'t|'re|'ve|'m|'ll|'d)?` +
+			`|[^\r\n\p{L}\p{N}]?[\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}]+[\p{Ll}\p{Lm}\p{Lo}\p{M}]*(?i:'s|'t|'re|'ve|'m|'ll|'d)?` +
+			`|\p{N}{1,3}| ?[^` + spaces + `\p{L}\p{N}]+[\r\n/]*|[` + spaces + `]*[\r\n]+|([` + spaces + `]+))`),
+	}
+)
+
+// vocabularyURL is where the vocabularies are downloaded from.
+var vocabularyURL = "https://openaipublic.blob.core.windows.net/encodings/"
+
+// vocabularyDir returns the directory the vocabularies are cached in.
+var vocabularyDir = func() (string, error) {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("cannot find the user cache directory: %v", err)
+	}
+	return filepath.Join(cacheDir, "promptbuilder", "tiktoken"), nil
+}
+
+// Limits of downloading a vocabulary, which are a few megabytes.
+const (
+	vocabularyTimeout  = 60 * time.Second
+	vocabularyMaxBytes = 16 << 20
+)
+
+// FetchVocabulary downloads the BPE vocabulary of a model family to the
+// user cache directory, unless it is already there, so that builders
+// count its tokens exactly instead of estimating them. Families without
+// a public vocabulary need nothing and return nil.
+func FetchVocabulary(ctx context.Context, model string) error {
+	t, err := getTokenizer(model)
+	if err != nil || t.vocab == nil {
+		return err
+	}
+	return fetchVocabulary(ctx, t.vocab)
+}
+
+func fetchVocabulary(ctx context.Context, v *vocabulary) error {
+	dir, err := vocabularyDir()
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(dir, v.file)
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, vocabularyTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, vocabularyURL+v.file, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", "promptbuilder")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("downloading %s: server returned %s", v.file, resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, vocabularyMaxBytes+1))
+	if err != nil {
+		return err
+	}
+	if len(data) > vocabularyMaxBytes {
+		return fmt.Errorf("%s is larger than %s", v.file, formatSize(vocabularyMaxBytes))
+	}
+	if err := checkVocabulary(v, data); err != nil {
+		return err
+	}
+
+	// Written under a temporary name, so that a reader never sees half of it
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, "."+v.file+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// checkVocabulary returns an error when data is not the file of v.
+func checkVocabulary(v *vocabulary, data []byte) error {
+	sum := sha256.Sum256(data)
+	if hex.EncodeToString(sum[:]) != v.sha256 {
+		return fmt.Errorf("%s does not match its checksum", v.file)
+	}
+	return nil
+}
+
+// bpeEncoding counts tokens with the ranks of a vocabulary: the byte
+// sequences it has tokens for, where a lower rank is merged first.
+type bpeEncoding struct {
+	ranks   map[string]int
+	pattern *regexp.Regexp
+}
+
+// encodings holds the vocabularies loaded so far, which every builder
+// of their family shares.
+var encodings = struct {
+	sync.Mutex
+	byFile map[string]*bpeEncoding
+}{byFile: map[string]*bpeEncoding{}}
+
+// loadEncoding reads the cached vocabulary v. It fails when the
+// vocabulary has not been downloaded with FetchVocabulary.
+func loadEncoding(v *vocabulary) (*bpeEncoding, error) {
+	encodings.Lock()
+	defer encodings.Unlock()
+	if e, ok := encodings.byFile[v.file]; ok {
+		return e, nil
+	}
+
+	dir, err := vocabularyDir()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(filepath.Join(dir, v.file))
+	if err != nil {
+		return nil, err
+	}
+	if err := checkVocabulary(v, data); err != nil {
+		return nil, err
+	}
+	ranks, err := parseRanks(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", v.file, err)
+	}
+	e := &bpeEncoding{ranks: ranks, pattern: v.pattern}
+	encodings.byFile[v.file] = e
+	return e, nil
+}
+
+// parseRanks reads a .tiktoken file: one token per line, base64 encoded,
+// followed by a space and its rank.
+func parseRanks(data []byte) (map[string]int, error) {
+	ranks := make(map[string]int, bytes.Count(data, []byte("\n")))
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		token, rank, ok := bytes.Cut(scanner.Bytes(), []byte(" "))
+		if !ok {
+			return nil, fmt.Errorf("line %d: missing rank", line)
+		}
+		decoded, err := base64.StdEncoding.DecodeString(string(token))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		n, err := strconv.Atoi(string(rank))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		ranks[string(decoded)] = n
+	}
+	return ranks, scanner.Err()
+}
+
+func (e *bpeEncoding) countTokens(text string) int {
+	count := 0
+	for text != "" {
+		piece := nextPiece(e.pattern, text)
+		count += e.pieceTokens(piece)
+		text = text[len(piece):]
+	}
+	return count
+}
+
+// nextPiece returns the piece of text that pattern splits off its start.
+// A run of spaces matched by the last alternative gives back its last
+// space when other text follows, which then starts the next piece.
+func nextPiece(pattern *regexp.Regexp, text string) string {
+	match := pattern.FindStringSubmatchIndex(text)
+	if match == nil || match[1] == 0 {
+		// Not reached with tiktoken's patterns, which match any rune
+		_, size := utf8.DecodeRuneInString(text)
+		return text[:size]
+	}
+	end := match[1]
+	if match[2] >= 0 && end < len(text) {
+		next, _ := utf8.DecodeRuneInString(text[end:])
+		last, size := utf8.DecodeLastRuneInString(text[:end])
+		if !unicode.IsSpace(next) && unicode.IsSpace(last) && end-size > 0 {
+			end -= size
+		}
+	}
+	return text[:end]
+}
+
+// pieceTokens returns the number of tokens of a piece: its bytes are
+// merged pairwise, the pair with the lowest rank first, until no pair
+// left has a token.
+func (e *bpeEncoding) pieceTokens(piece string) int {
+	if _, ok := e.ranks[piece]; ok {
+		return 1
+	}
+	// bounds are the offsets at which the tokens of the piece start
+	bounds := make([]int, len(piece)+1)
+	for i := range bounds {
+		bounds[i] = i
+	}
+	for len(bounds) > 2 {
+		best, at := math.MaxInt, -1
+		for i := 0; i+2 < len(bounds); i++ {
+			if rank, ok := e.ranks[piece[bounds[i]:bounds[i+2]]]; ok && rank < best {
+				best, at = rank, i
+			}
+		}
+		if at < 0 {
+			break
+		}
+		bounds = append(bounds[:at+1], bounds[at+2:]...)
+	}
+	return len(bounds) - 1
+}
@@ -0,0 +1,193 @@
+package promptbuilder
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testRanks returns ranks with a token for every byte, ranked by value,
+// and then for each of merges, in order.
+func testRanks(merges ...string) map[string]int {
+	ranks := map[string]int{}
+	for b := 0; b < 256; b++ {
+		ranks[string([]byte{byte(b)})] = b
+	}
+	for i, merge := range merges {
+		ranks[merge] = 256 + i
+	}
+	return ranks
+}
+
+// pieces splits text with pattern.
+func pieces(pattern string, text string) []string {
+	v := cl100kBase
+	if pattern == "o200k" {
+		v = o200kBase
+	}
+	var split []string
+	for text != "" {
+		piece := nextPiece(v.pattern, text)
+		split = append(split, piece)
+		text = text[len(piece):]
+	}
+	return split
+}
+
+func TestNextPiece(t *testing.T) {
+	tests := []struct {
+		pattern string
+		text    string
+		want    []string
+	}{
+		{"cl100k", "hello world", []string{"hello", " world"}},
+		{"cl100k", "I'm here", []string{"I", "'m", " here"}},
+		{"cl100k", "12345", []string{"123", "45"}},
+		// The last space of a run starts the next word
+		{"cl100k", "a   b", []string{"a", "  ", " b"}},
+		{"cl100k", "a \tb", []string{"a", " ", "\tb"}},
+		{"cl100k", "x  ", []string{"x", "  "}},
+		{"cl100k", "x   \n\ny", []string{"x", "   \n\n", "y"}},
+		{"cl100k", "if (a) {\n\treturn\n}", []string{"if", " (", "a", ")", " {\n", "\treturn", "\n", "}"}},
+		// Non-breaking spaces are whitespace, not punctuation
+		{"cl100k", "a\u00a0\u00a0b", []string{"a", "\u00a0", "\u00a0b"}},
+		{"o200k", "HelloWorld", []string{"Hello", "World"}},
+		{"o200k", "path/to\n", []string{"path", "/to", "\n"}},
+		{"o200k", "a.b/\n", []string{"a", ".b", "/\n"}},
+		{"o200k", "don't", []string{"don't"}},
+	}
+	for _, test := range tests {
+		if got := pieces(test.pattern, test.text); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s pieces of %q = %q, want %q", test.pattern, test.text, got, test.want)
+		}
+	}
+}
+
+func TestPieceTokens(t *testing.T) {
+	e := &bpeEncoding{ranks: testRanks("ab", "bc", "abc", "cd"), pattern: cl100kBase.pattern}
+	tests := []struct {
+		piece string
+		want  int
+	}{
+		{"a", 1},
+		{"abc", 1},
+		// ab is merged before bc, then abc, then the d stays alone
+		{"abcd", 2},
+		// bc is merged before cd
+		{"bcd", 2},
+		{"xyz", 3},
+		{"", 0},
+	}
+	for _, test := range tests {
+		if got := e.pieceTokens(test.piece); got != test.want {
+			t.Errorf("pieceTokens(%q) = %d, want %d", test.piece, got, test.want)
+		}
+	}
+	if got := e.countTokens("abc abcd"); got != 4 {
+		t.Errorf("countTokens = %d, want 4", got)
+	}
+}
+
+// testVocabulary writes ranks as a .tiktoken file served by a test
+// server, caches vocabularies in a temporary directory, and returns a
+// vocabulary for the file and the directory.
+func testVocabulary(t *testing.T, ranks map[string]int) (*vocabulary, string) {
+	t.Helper()
+	var file strings.Builder
+	for token, rank := range ranks {
+		fmt.Fprintf(&file, "%s %d\n", base64.StdEncoding.EncodeToString([]byte(token)), rank)
+	}
+	data := []byte(file.String())
+	sum := sha256.Sum256(data)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/test.tiktoken" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(data)
+	}))
+	t.Cleanup(server.Close)
+
+	dir := t.TempDir()
+	oldURL, oldDir := vocabularyURL, vocabularyDir
+	vocabularyURL = server.URL + "/"
+	vocabularyDir = func() (string, error) { return dir, nil }
+	t.Cleanup(func() {
+		vocabularyURL, vocabularyDir = oldURL, oldDir
+	})
+	return &vocabulary{file: "test.tiktoken", sha256: hex.EncodeToString(sum[:]), pattern: cl100kBase.pattern}, dir
+}
+
+func TestFetchVocabulary(t *testing.T) {
+	v, dir := testVocabulary(t, testRanks("ab", "bc"))
+	if _, err := loadEncoding(v); err == nil {
+		t.Fatal("loadEncoding read a vocabulary that was not downloaded")
+	}
+	if err := fetchVocabulary(context.Background(), v); err != nil {
+		t.Fatalf("fetchVocabulary: %v", err)
+	}
+	tok := tokenizer{name: "test", charsPerToken: 4, vocab: v}
+	if err := tok.loadVocabulary(); err != nil {
+		t.Fatalf("loadVocabulary: %v", err)
+	}
+	if got := tok.countTokens("abc"); got != 2 {
+		t.Errorf("countTokens = %d, want 2", got)
+	}
+	encodings.Lock()
+	delete(encodings.byFile, v.file)
+	encodings.Unlock()
+
+	// A vocabulary that does not match its checksum is neither cached nor
+	// loaded
+	corrupt := *v
+	corrupt.file, corrupt.sha256 = "corrupt.tiktoken", strings.Repeat("0", 64)
+	if err := os.WriteFile(filepath.Join(dir, corrupt.file), []byte("YQ== 0\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadEncoding(&corrupt); err == nil || !strings.Contains(err.Error(), "checksum") {
+		t.Errorf("loadEncoding of a corrupt file = %v, want a checksum error", err)
+	}
+	wrong := *v
+	wrong.sha256 = strings.Repeat("0", 64)
+	os.Remove(filepath.Join(dir, wrong.file))
+	if err := fetchVocabulary(context.Background(), &wrong); err == nil {
+		t.Error("fetchVocabulary accepted a file that does not match its checksum")
+	}
+	if _, err := os.Stat(filepath.Join(dir, wrong.file)); err == nil {
+		t.Error("a file that does not match its checksum was cached")
+	}
+}
+
+func TestVocabularyModels(t *testing.T) {
+	if got, want := VocabularyModels(), []string{"gpt-4", "gpt-4o"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("VocabularyModels = %q, want %q", got, want)
+	}
+	if err := FetchVocabulary(context.Background(), "claude"); err != nil {
+		t.Errorf("FetchVocabulary(claude) = %v, want nil", err)
+	}
+}
+
+func TestParseRanks(t *testing.T) {
+	ranks, err := parseRanks([]byte("YQ== 0\nYg== 1\nYWI= 2\n"))
+	if err != nil {
+		t.Fatalf("parseRanks: %v", err)
+	}
+	if want := map[string]int{"a": 0, "b": 1, "ab": 2}; !reflect.DeepEqual(ranks, want) {
+		t.Errorf("parseRanks = %v, want %v", ranks, want)
+	}
+	for _, data := range []string{"YQ==\n", "YQ== x\n", "!!! 0\n"} {
+		if _, err := parseRanks([]byte(data)); err == nil {
+			t.Errorf("parseRanks(%q) succeeded", data)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package promptbuilder
+
+import (
+	"path/filepath"
+	"sort"
+)
+
+// fileSection is the rendered output of a single file. Content and Text
+// are only filled in while the file is being written; see document.file.
+type fileSection struct {
+	File    SourceFile
+	Path    string // path as shown in the output
+	Content string
+	Text    string // content rendered in the output format
+	Tokens  int
+	Size    int      // length of Content
+	Lines   int      // lines of Content
+	TextLen int      // length of Text
+	Hash    string   // hash of Content
+	SameAs  string   // earlier file that Content refers to, see dedupeSections
+	Diff    string   // diff from SameAs when the file is only similar to it
+	Simhash uint64   // fingerprint of Content, with nearDuplicates
+	Heading *Section // section the file is grouped under, if any
+}
+
+// treePath returns the path of the file for the directory tree and
+// directory headings: the path shown in the output, or the path relative
+// to basedir when that is a full path.
+func (s fileSection) treePath() string {
+	if filepath.IsAbs(s.Path) {
+		return filepath.ToSlash(s.File.RelPath)
+	}
+	return s.Path
+}
+
+// sectionName returns the name of the heading the file is grouped under,
+// or "".
+func (s fileSection) sectionName() string {
+	if s.Heading == nil {
+		return ""
+	}
+	return s.Heading.Name
+}
+
+func (s fileSection) report() FileReport {
+	return FileReport{
+		Path:   s.File.RelPath,
+		Size:   s.Size,
+		Lines:  s.Lines,
+		Tokens: s.Tokens,
+		Hash:   s.Hash,
+	}
+}
+
+// applyTokenBudget drops sections until the remaining ones fit in budget
+// tokens. Files with the lowest include priority are dropped first; among
+// equal priorities, files later in the output go first. The kept sections
+// retain their original order.
+func applyTokenBudget(sections []fileSection, budget int) (kept []fileSection, omitted []fileSection) {
+	total := 0
+	for _, section := range sections {
+		total += section.Tokens
+	}
+	if total <= budget {
+		return sections, nil
+	}
+
+	order := make([]int, len(sections))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		pa := sections[order[a]].File.Include.Priority
+		pb := sections[order[b]].File.Include.Priority
+		if pa != pb {
+			return pa < pb
+		}
+		return order[a] > order[b]
+	})
+
+	dropped := make(map[int]bool)
+	for _, i := range order {
+		if total <= budget {
+			break
+		}
+		dropped[i] = true
+		total -= sections[i].Tokens
+	}
+
+	for i, section := range sections {
+		if dropped[i] {
+			omitted = append(omitted, section)
+		} else {
+			kept = append(kept, section)
+		}
+	}
+	return kept, omitted
+}
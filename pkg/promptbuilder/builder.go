@@ -0,0 +1,862 @@
+// Package promptbuilder assembles source files into a single prompt for
+// AI tools. It holds the config parsing, file discovery and rendering
+// used by the promptbuilder command, so other programs can embed prompt
+// assembly without shelling out to the binary.
+package promptbuilder
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Builder assembles prompts from a Config.
+type Builder struct {
+	config       *Config
+	format       string
+	model        string
+	requestModel string
+	tok          tokenizer
+	renderer     renderer
+	log          *slog.Logger
+	cache        *fileCache
+	src          sourceFS      // where the files of basedir are read from
+	renames      []renameRule  // applied to the paths and content of the prompt
+	previous     Manifest      // files of a previous prompt, left out when unchanged
+	skipped      []SkippedFile // files left out by the last findFiles
+	warnings     []Warning     // warnings logged by the current build
+	progress     func(Progress)
+	redactions   map[string]int
+	noGit        bool // the Branch and Commit placeholders do not run git
+}
+
+// Option configures a Builder.
+type Option func(*Builder)
+
+// WithFormat selects the output format (see OutputFormats). The default
+// is markdown.
+func WithFormat(format string) Option {
+	return func(b *Builder) {
+		b.format = format
+	}
+}
+
+// WithModel selects the model family used to estimate token counts (see
+// SupportedModels). The default is DefaultModel.
+func WithModel(model string) Option {
+	return func(b *Builder) {
+		b.model = model
+	}
+}
+
+// WithRequestModel sets the model named in the request bodies of the
+// request formats (see IsRequestFormat). By default, the provider's
+// default model is used.
+func WithRequestModel(model string) Option {
+	return func(b *Builder) {
+		b.requestModel = model
+	}
+}
+
+// WithLogger sets where progress and warning messages are written, as
+// plain lines. By default they are discarded.
+func WithLogger(w io.Writer) Option {
+	return func(b *Builder) {
+		b.log = slog.New(NewLogHandler(w, slog.LevelInfo))
+	}
+}
+
+// WithSlog sends progress, warning and debug messages to logger, at their
+// level.
+func WithSlog(logger *slog.Logger) Option {
+	return func(b *Builder) {
+		b.log = logger
+	}
+}
+
+// WithFS reads the files of basedir from fsys instead of the disk, for
+// example an embed.FS, a *zip.Reader or an fstest.MapFS. Names in fsys
+// are relative to basedir, which then only prefixes the paths in the
+// output and may be empty. followSymlinks needs an fsys that can read
+// links. Git features and includeCmd still run in basedir on disk.
+func WithFS(fsys fs.FS) Option {
+	return func(b *Builder) {
+		b.src = sourceFS{fsys: fsys}
+	}
+}
+
+// WithoutGit leaves the {{.Branch}} and {{.Commit}} placeholders of the
+// header and footer empty instead of running git to fill them, for
+// configs that come from an untrusted source.
+func WithoutGit() Option {
+	return func(b *Builder) {
+		b.noGit = true
+	}
+}
+
+// New validates config and returns a Builder for it.
+func New(config *Config, opts ...Option) (*Builder, error) {
+	b := &Builder{
+		config: config,
+		format: FormatMarkdown,
+		model:  DefaultModel,
+		log:    discardLog,
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+
+	if b.src.fsys == nil {
+		if err := config.Validate(); err != nil {
+			return nil, err
+		}
+		b.src = osSourceFS(config.BaseDir)
+	} else {
+		if err := config.validateRules(); err != nil {
+			return nil, err
+		}
+		b.src.baseDir = config.BaseDir
+	}
+
+	b.renames = newRenameRules(config)
+
+	var err error
+	if b.tok, err = getTokenizer(b.model); err != nil {
+		return nil, err
+	}
+	if err := b.tok.loadVocabulary(); err != nil {
+		b.debugf("Estimating token counts, the %s vocabulary is not available: %v", b.tok.name, err)
+	}
+	if b.renderer, err = newRenderer(b.format, config, b.requestModel); err != nil {
+		return nil, err
+	}
+	if config.Cache != "" {
+		if b.cache, err = newFileCache(b.cacheDir(), b); err != nil {
+			return nil, err
+		}
+	}
+
+	return b, nil
+}
+
+// FileReport describes a single file of the prompt: its size and line
+// count after redaction and truncation, and its estimated token count.
+type FileReport struct {
+	Path   string
+	Size   int
+	Lines  int
+	Tokens int
+	Hash   string // hash of the processed content
+}
+
+// SkippedFile is a file or folder left out of the prompt, and the rule
+// that left it out, such as "excludeFolder", "gitignore" or "binary".
+type SkippedFile struct {
+	Path   string
+	Reason string
+}
+
+// Report summarizes a build. Warnings holds the warnings logged during
+// the build by kind, and Redactions the matches replaced by redaction by
+// rule.
+type Report struct {
+	Files       []FileReport
+	Omitted     []FileReport  // files dropped to stay within maxtokens
+	Unchanged   []FileReport  // files left out because they did not change, see WithPrevious
+	Costs       []Cost        // estimated cost of the prompt for the models of costModels
+	Skipped     []SkippedFile // files left out before reading, or unreadable
+	Parts       int           // number of parts written by BuildParts
+	TotalTokens int
+	ExactTokens bool // the tokens were counted with the model's vocabulary, not estimated
+	Warnings    []Warning
+	Redactions  map[string]int
+	Duration    time.Duration // time taken by the build
+
+	started time.Time
+}
+
+// Files returns the files selected by the configuration, without reading
+// them.
+func (b *Builder) Files(ctx context.Context) ([]SourceFile, error) {
+	return b.findFiles(ctx)
+}
+
+// DryRun reads and renders every file exactly like Build, but discards the
+// output. The report tells what a build would contain.
+func (b *Builder) DryRun(ctx context.Context) (*Report, error) {
+	doc, report, err := b.prepare(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	b.finish(report, doc.Sections)
+	return report, nil
+}
+
+// Build writes the complete prompt to w.
+func (b *Builder) Build(ctx context.Context, w io.Writer) (*Report, error) {
+	doc, report, err := b.prepare(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := b.renderer.writeOutput(contextWriter{ctx, w}, doc); err != nil {
+		return nil, fmt.Errorf("error writing output: %w", err)
+	}
+
+	b.finish(report, doc.Sections)
+	return report, nil
+}
+
+// BuildParts writes the prompt split into parts according to the
+// splittokens/splitchars settings of the configuration. create is called
+// once per part, numbered from 1, and the returned writer is closed after
+// the part has been written.
+func (b *Builder) BuildParts(ctx context.Context, create func(part int) (io.WriteCloser, error)) (*Report, error) {
+	doc, report, err := b.prepare(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	sections := doc.Sections
+	parts := [][]fileSection{sections}
+	if b.config.SplitTokens > 0 {
+		parts = splitSections(sections, b.config.SplitTokens, func(s fileSection) int { return s.Tokens })
+	} else if b.config.SplitChars > 0 {
+		parts = splitSections(sections, b.config.SplitChars, func(s fileSection) int { return s.TextLen })
+	}
+
+	for i, part := range parts {
+		partDoc := &document{
+			Header:   partNote(i+1, len(parts)),
+			Sections: part,
+			load:     doc.load,
+		}
+		if i == 0 {
+			if doc.Header != "" {
+				partDoc.Header += "\n\n" + doc.Header
+			}
+			partDoc.Before = doc.Before
+		}
+		if i == len(parts)-1 {
+			partDoc.After = doc.After
+			partDoc.Footer = doc.Footer
+		}
+
+		w, err := create(i + 1)
+		if err != nil {
+			return nil, err
+		}
+		if err := b.renderer.writeOutput(contextWriter{ctx, w}, partDoc); err != nil {
+			w.Close()
+			return nil, fmt.Errorf("error writing part %d: %w", i+1, err)
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+	}
+
+	report.Parts = len(parts)
+	b.finish(report, sections)
+	return report, nil
+}
+
+// contextWriter stops writing the output once ctx is done, so that a
+// cancelled build does not go on reading files for the rest of it.
+type contextWriter struct {
+	ctx context.Context
+	w   io.Writer
+}
+
+func (w contextWriter) Write(p []byte) (int, error) {
+	if err := w.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return w.w.Write(p)
+}
+
+// prepare discovers, reads and renders every file, gathers the extra
+// sections, then applies the token budget.
+func (b *Builder) prepare(ctx context.Context) (*document, *Report, error) {
+	config := b.config
+	report := &Report{started: time.Now(), ExactTokens: b.tok.bpe != nil}
+	doc := &document{Header: config.HeaderText, load: b.reload}
+	b.warnings = nil
+	b.redactions = make(map[string]int)
+
+	for _, unknown := range config.UnknownKeys() {
+		if err := b.warn("Ignoring %s", unknown); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	files, err := b.findFiles(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error finding files: %w", err)
+	}
+
+	if len(files) == 0 {
+		b.warnf("No files found matching the include paths")
+	} else {
+		b.infof("Found %d matching files", len(files))
+	}
+
+	report.TotalTokens += b.tok.countTokens(config.HeaderText) + b.tok.countTokens(config.FooterText)
+
+	if config.Metadata {
+		metadata, err := gitMetadata(ctx, config.gitDir(), config.gitHead())
+		if err != nil {
+			b.warnf("Cannot read git metadata: %v", err)
+		}
+		section := extraSection{
+			Name:    "metadata",
+			Title:   "Metadata",
+			Content: b.anonymize(metadata) + "Generated: " + time.Now().Format(time.RFC3339) + "\n",
+		}
+		doc.Before = append(doc.Before, section)
+		report.TotalTokens += b.tok.countTokens(b.renderer.renderSection(section))
+	}
+
+	if config.GitDiff != "" {
+		base, err := resolveCommit(ctx, config.gitDir(), config.GitDiff)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error running git diff: %v", err)
+		}
+		args := []string{"diff", "--end-of-options", base}
+		if config.GitRef != "" {
+			args = append(args, config.GitRef)
+		}
+		diff, err := runGit(ctx, config.gitDir(), append(args, "--", ".")...)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error running git diff: %v", err)
+		}
+		if diff == "" {
+			b.warnf("git diff against %s is empty", config.GitDiff)
+		} else {
+			section := extraSection{
+				Name:     "git_diff",
+				Title:    "Git diff against " + config.GitDiff,
+				Language: "diff",
+				Content:  b.redact("git diff", diff),
+			}
+			if config.GitDiffPosition == positionAfter {
+				doc.After = append(doc.After, section)
+			} else {
+				doc.Before = append(doc.Before, section)
+			}
+			report.TotalTokens += b.tok.countTokens(b.renderer.renderSection(section))
+		}
+	}
+
+	for _, include := range config.Includes {
+		if !isURL(include.Path) {
+			continue
+		}
+		content, language, err := fetchDocument(ctx, include.Path)
+		if ctx.Err() != nil {
+			return nil, nil, ctx.Err()
+		}
+		if err != nil {
+			if err := b.warn("Cannot fetch %s: %v", include.Path, err); err != nil {
+				return nil, nil, err
+			}
+			continue
+		}
+		b.debugf("Fetched %s", include.Path)
+		section := extraSection{
+			Name:     "document",
+			Title:    include.Path,
+			Language: language,
+			Content:  b.redact(include.Path, content),
+		}
+		doc.Before = append(doc.Before, section)
+		report.TotalTokens += b.tok.countTokens(b.renderer.renderSection(section))
+	}
+
+	for _, command := range config.Commands {
+		stdout, stderr, err := runCommand(ctx, config.BaseDir, command)
+		if ctx.Err() != nil {
+			// The command was killed, not failing
+			return nil, nil, ctx.Err()
+		}
+		title := "$ " + command
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			// A failing command, such as failing tests, is often the point
+			title += fmt.Sprintf(" (exit status %d)", exitErr.ExitCode())
+			b.infof("Command %s exited with status %d", command, exitErr.ExitCode())
+		} else if err != nil {
+			if err := b.warn("Cannot run %s: %v", command, err); err != nil {
+				return nil, nil, err
+			}
+			continue
+		}
+		if stderr != "" {
+			b.debugf("Standard error of %s:\n%s", command, strings.TrimSuffix(stderr, "\n"))
+		}
+		section := extraSection{
+			Name:    "command",
+			Title:   title,
+			Content: b.redact(command, stdout),
+		}
+		doc.Before = append(doc.Before, section)
+		report.TotalTokens += b.tok.countTokens(b.renderer.renderSection(section))
+	}
+
+	for _, attachment := range config.Attachments {
+		section, tokens, err := b.attachmentSection(attachment)
+		if err != nil {
+			if err := b.warn("Cannot attach %s: %v", attachment.Path, err); err != nil {
+				return nil, nil, err
+			}
+			continue
+		}
+		b.debugf("Attached %s as %s (%d estimated tokens)", attachment.Path, attachment.Kind, tokens)
+		doc.Before = append(doc.Before, section)
+		report.TotalTokens += tokens
+	}
+
+	// Only the size and token count of every file are kept here; the
+	// contents are loaded again, one file at a time, while the output is
+	// written
+	var sections []fileSection
+	progress := Progress{Phase: PhaseReading, Total: len(files)}
+	readStart := time.Now()
+	for _, file := range files {
+		if err := ctx.Err(); err != nil {
+			return nil, nil, err
+		}
+
+		section, ok, err := b.loadFile(file, true)
+		if err != nil {
+			return nil, nil, err
+		}
+		if b.progress != nil {
+			progress.Done++
+			progress.Bytes += int64(section.Size)
+			progress.Elapsed = time.Since(readStart)
+			b.progress(progress)
+		}
+		if !ok {
+			continue
+		}
+		if config.NearDuplicates > 0 {
+			section.Simhash = simhash(section.Content)
+		}
+		section.Content, section.Text = "", ""
+		sections = append(sections, section)
+	}
+
+	var previousNote string
+	if b.previous != nil {
+		sections, previousNote = b.dropUnchanged(sections, report)
+		report.TotalTokens += b.tok.countTokens(previousNote)
+	}
+
+	report.Skipped = b.skipped
+
+	if b.cache != nil {
+		b.debugf("Reused %d of %d files from the cache", b.cache.hits, len(sections))
+		if err := b.cache.prune(); err != nil {
+			b.warnf("Cannot prune the cache: %v", err)
+		}
+	}
+
+	b.sortSections(sections)
+
+	if config.GroupBy == groupByDir {
+		var headings []Section
+		sections, headings = groupByDirectory(sections)
+		for _, heading := range headings {
+			report.TotalTokens += b.tok.countTokens(b.renderer.renderHeading(heading))
+		}
+	}
+
+	if len(config.Sections) > 0 {
+		sections = b.groupSections(sections)
+		for _, section := range config.Sections {
+			report.TotalTokens += b.tok.countTokens(b.renderer.renderHeading(section))
+		}
+	}
+
+	var omitted []fileSection
+	if config.MaxTokens > 0 {
+		budget := config.MaxTokens - report.TotalTokens
+		kept, dropped := applyTokenBudget(sections, budget)
+		// The omitted files note grows with every file dropped to make
+		// room for it
+		for reserve := 0; config.OmittedNote; {
+			note, ok := b.omittedSection(dropped)
+			tokens := 0
+			if ok {
+				tokens = b.tok.countTokens(b.renderer.renderSection(note))
+			}
+			if tokens <= reserve {
+				break
+			}
+			reserve = tokens
+			kept, dropped = applyTokenBudget(sections, budget-reserve)
+		}
+		sections, omitted = kept, dropped
+		for _, section := range omitted {
+			report.Omitted = append(report.Omitted, section.report())
+		}
+	}
+	if config.OmittedNote {
+		if section, ok := b.omittedSection(omitted); ok {
+			doc.Before = append(doc.Before, section)
+			report.TotalTokens += b.tok.countTokens(b.renderer.renderSection(section))
+		}
+	}
+
+	if config.Dedupe {
+		sections = b.dedupeSections(sections)
+	}
+	if config.NearDuplicates > 0 {
+		if sections, err = b.collapseNearDuplicates(sections); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if config.Stats {
+		files := make([]FileReport, len(sections))
+		total := report.TotalTokens
+		for i, section := range sections {
+			files[i] = section.report()
+			total += section.Tokens
+		}
+		// The total includes the statistics themselves, which are counted
+		// with a first estimate of the total
+		section := extraSection{Name: "stats", Title: "Statistics", Content: statsTable(files, total)}
+		statsTokens := b.tok.countTokens(b.renderer.renderSection(section))
+		section.Content = statsTable(files, total+statsTokens)
+		doc.After = append(doc.After, section)
+		report.TotalTokens += statsTokens
+	}
+
+	// The header and footer can refer to the final file count and token
+	// total, so they are expanded last
+	textTokens := b.tok.countTokens(config.HeaderText) + b.tok.countTokens(config.FooterText)
+	total := report.TotalTokens
+	for _, section := range sections {
+		total += section.Tokens
+	}
+	header, err := b.expandPlaceholders(ctx, config.HeaderText, len(sections), total)
+	if err != nil {
+		b.warnf("Cannot expand header placeholders, using it as is: %v", err)
+	}
+	footer, err := b.expandPlaceholders(ctx, config.FooterText, len(sections), total)
+	if err != nil {
+		b.warnf("Cannot expand footer placeholders, using it as is: %v", err)
+	}
+	doc.Header = header
+	if previousNote != "" {
+		doc.Header = strings.TrimPrefix(header+"\n\n"+previousNote, "\n\n")
+	}
+	doc.Footer = footer
+	report.TotalTokens += b.tok.countTokens(header) + b.tok.countTokens(footer) - textTokens
+
+	doc.Sections = sections
+	if b.progress != nil {
+		doc.load = b.writeProgress(len(sections))
+	}
+	return doc, report, nil
+}
+
+// writeProgress returns a load function for the document that reports
+// the progress of writing total files.
+func (b *Builder) writeProgress(total int) func(fileSection) (fileSection, error) {
+	progress := Progress{Phase: PhaseWriting, Total: total}
+	start := time.Now()
+	return func(section fileSection) (fileSection, error) {
+		loaded, err := b.reload(section)
+		if err != nil {
+			return loaded, err
+		}
+		progress.Done++
+		progress.Bytes += int64(loaded.Size)
+		progress.Elapsed = time.Since(start)
+		b.progress(progress)
+		return loaded, nil
+	}
+}
+
+// groupSections orders the files by the section of the include that
+// matched them, in the order the sections were declared. Files of includes
+// outside any section come first.
+func (b *Builder) groupSections(sections []fileSection) []fileSection {
+	order := make(map[string]int)
+	headings := make(map[string]*Section)
+	for i := range b.config.Sections {
+		section := &b.config.Sections[i]
+		order[section.Name] = i + 1
+		headings[section.Name] = section
+	}
+
+	for i := range sections {
+		sections[i].Heading = headings[sections[i].File.Include.Section]
+	}
+	sort.SliceStable(sections, func(i, j int) bool {
+		return order[sections[i].File.Include.Section] < order[sections[j].File.Include.Section]
+	})
+	return sections
+}
+
+// loadFile reads a file and turns it into its emitted content: outlined,
+// redacted, stripped of comments, numbered and truncated as configured,
+// then rendered. With count set, the tokens are counted and the result is
+// stored in the cache, if any. ok is false for files that are skipped.
+func (b *Builder) loadFile(file SourceFile, count bool) (section fileSection, ok bool, err error) {
+	config := b.config
+	relPath := file.RelPath
+	fullPath := filepath.Join(config.BaseDir, relPath)
+
+	// Check if file is binary. PDF and Word documents are, but their
+	// text is extracted unless binaryextension says to skip them
+	isBinary, known := binaryRule(fullPath, config)
+	document := isDocument(relPath) && !isBinary
+	if !known && !document {
+		isBinary, err = isBinaryFile(b.src, fullPath, config.BinarySampleSize)
+		if err != nil {
+			b.skip(filepath.ToSlash(relPath), "unreadable")
+			return section, false, b.warn("Error checking if file is binary %s: %v", relPath, err)
+		}
+	}
+	if isBinary {
+		b.skip(filepath.ToSlash(relPath), "binary")
+		if known {
+			b.debugf("Skipping binary file: %s", relPath)
+			return section, false, nil
+		}
+		return section, false, b.warn("Skipping binary file: %s", relPath)
+	}
+
+	content, err := b.src.readFile(fullPath)
+	if err != nil {
+		return section, false, fmt.Errorf("error reading file %s: %v", relPath, err)
+	}
+	// Documents and table previews are truncated by the size of their text
+	size := int64(len(content))
+	var text string
+	if document {
+		if text, err = extractDocument(relPath, content); err != nil {
+			b.skip(filepath.ToSlash(relPath), "document")
+			return section, false, b.warn("Cannot extract the text of %s: %v", relPath, err)
+		}
+		b.debugf("Extracted the text of %s", relPath)
+		size = int64(len(text))
+	} else {
+		var encoding string
+		if text, encoding, ok = decodeText(content, config.Encoding); !ok {
+			b.skip(filepath.ToSlash(relPath), "encoding")
+			return section, false, b.warn("Skipping file that is not UTF-8: %s", relPath)
+		}
+		if encoding != "" {
+			b.debugf("Converted %s from %s", relPath, encoding)
+		}
+	}
+	if config.SkipGenerated && !isReincluded(fullPath, config.BaseDir, concat(config.ReincludeFiles, config.ForceIncludes), config.IgnoreCase) {
+		if reason := generatedContent(relPath, text); reason != "" {
+			b.skip(filepath.ToSlash(relPath), "generated")
+			b.debugf("Skipping generated file: %s (%s)", relPath, reason)
+			return section, false, nil
+		}
+	}
+	if isNotebook(relPath) {
+		if flattened, err := flattenNotebook(text, config.StripOutputs); err == nil {
+			text = flattened
+		} else {
+			b.debugf("Including notebook %s as JSON: %v", relPath, err)
+		}
+	}
+
+	var cacheKey string
+	if b.cache != nil {
+		cacheKey = b.cache.key(file, fullPath, content)
+		if entry, ok := b.cache.get(cacheKey); ok {
+			// The redactions were made when the entry was written, but
+			// count toward this build all the same
+			b.reportRedactions(relPath, entry.Redactions)
+			return newFileSection(file, b.outputPath(relPath), entry.Content, entry.Text, entry.Tokens), true, nil
+		}
+	}
+
+	if file.Include.Mode == modeOutline {
+		text = b.outline(relPath, text)
+	}
+	text, redactions := b.redactCounts(relPath, text)
+	if len(file.Include.Lines) > 0 {
+		// Excerpts keep the numbers of their lines, which stripping
+		// comments would shift
+		text = excerptLines(compactWhitespace(text, relPath, config, true), file.Include.Lines)
+	} else {
+		if config.StripComments {
+			text = stripComments(text, detectLanguage(relPath))
+		}
+		text = compactWhitespace(text, relPath, config, false)
+		if config.LineNumbers {
+			text = numberLines(text)
+		}
+	}
+	if config.CSVPreview > 0 && len(file.Include.Lines) == 0 && isTable(relPath) {
+		text = previewTable(text, config.CSVPreview)
+		size = int64(len(text))
+	}
+	if config.MaxFileSize > 0 && size > config.MaxFileSize {
+		b.infof("Truncating large file: %s (%d bytes)", relPath, size)
+		text = truncateContent(text, config.MaxFileSize, config.TruncateMode)
+	}
+
+	rendered := b.renderer.renderFile(b.outputPath(relPath), text)
+	section = newFileSection(file, b.outputPath(relPath), text, rendered, 0)
+	if count {
+		section.Tokens = b.tok.countTokens(rendered)
+		if b.cache != nil {
+			entry := cacheEntry{Content: text, Text: rendered, Tokens: section.Tokens, Redactions: redactions}
+			if err := b.cache.put(cacheKey, entry); err != nil {
+				b.warnf("Cannot cache %s: %v", relPath, err)
+			}
+		}
+	}
+	return section, true, nil
+}
+
+// outputPath returns the path a file is named by in the output: relative
+// to basedir with forward slashes, so that the prompt does not reveal the
+// layout of the machine, or the full path with absolutePaths unless
+// anonymizePaths is set. Renames apply either way.
+func (b *Builder) outputPath(relPath string) string {
+	if b.config.AbsolutePaths && !b.config.AnonymizePaths {
+		return b.anonymize(filepath.Join(b.config.BaseDir, relPath))
+	}
+	return b.anonymize(filepath.ToSlash(relPath))
+}
+
+func newFileSection(file SourceFile, path string, content string, text string, tokens int) fileSection {
+	return fileSection{
+		File:    file,
+		Path:    path,
+		Content: content,
+		Text:    text,
+		Tokens:  tokens,
+		Size:    len(content),
+		Lines:   countLines(content),
+		TextLen: len(text),
+		Hash:    contentHash(content),
+	}
+}
+
+// cacheDir returns the absolute cache directory.
+func (b *Builder) cacheDir() string {
+	if filepath.IsAbs(b.config.Cache) {
+		return b.config.Cache
+	}
+	return filepath.Join(b.config.BaseDir, b.config.Cache)
+}
+
+// reload fills in the content of a section whose content was dropped by
+// prepare. Warnings were already logged the first time.
+func (b *Builder) reload(section fileSection) (fileSection, error) {
+	if section.SameAs != "" {
+		return b.duplicateSection(section, section.SameAs, section.Diff), nil
+	}
+
+	// Reloading repeats the warnings and redactions already recorded
+	quiet := *b
+	quiet.log = discardLog
+	quiet.warnings = nil
+	quiet.redactions = nil
+
+	loaded, ok, err := quiet.loadFile(section.File, false)
+	if err != nil {
+		return section, err
+	}
+	if !ok {
+		return section, fmt.Errorf("file %s changed while the output was written", section.File.RelPath)
+	}
+	loaded.Tokens = section.Tokens
+	loaded.Heading = section.Heading
+	return loaded, nil
+}
+
+func (b *Builder) finish(report *Report, sections []fileSection) {
+	for _, section := range sections {
+		report.Files = append(report.Files, section.report())
+		report.TotalTokens += section.Tokens
+	}
+	report.Costs = b.costs(report.TotalTokens)
+	report.Warnings = b.warnings
+	report.Redactions = b.redactions
+	report.Duration = time.Since(report.started)
+}
+
+// ErrStrict is wrapped by the error returned when the configuration is
+// strict and a build runs into a warning.
+var ErrStrict = errors.New("strict mode")
+
+// warn logs a warning, or returns it as an error wrapping ErrStrict when
+// the configuration is strict.
+func (b *Builder) warn(format string, args ...any) error {
+	message := fmt.Sprintf(format, args...)
+	if b.config.Strict {
+		return fmt.Errorf("%w: %s", ErrStrict, message)
+	}
+	b.recordWarning(format, message)
+	b.logAt(slog.LevelWarn, "%s", message)
+	return nil
+}
+
+// skip records a file or folder left out of the prompt.
+func (b *Builder) skip(path string, reason string) {
+	b.skipped = append(b.skipped, SkippedFile{Path: path, Reason: reason})
+}
+
+// redact removes secrets and applies the custom redaction rules of the
+// configuration, logging what was replaced, and then the renames.
+func (b *Builder) redact(name string, content string) string {
+	content, _ = b.redactCounts(name, content)
+	return content
+}
+
+// redactCounts is redact, also returning the matches replaced by rule.
+func (b *Builder) redactCounts(name string, content string) (string, map[string]int) {
+	var rules []redactionRule
+	if b.config.RedactSecrets {
+		rules = append(rules, secretRules...)
+	}
+	for _, r := range b.config.Redactions {
+		rules = append(rules, redactionRule{
+			name:        r.Pattern.String(),
+			pattern:     r.Pattern,
+			replacement: r.Replacement,
+		})
+	}
+	if len(rules) == 0 {
+		return b.anonymize(content), nil
+	}
+
+	content, counts := redact(content, rules)
+	b.reportRedactions(name, counts)
+	return b.anonymize(content), counts
+}
+
+// reportRedactions logs and records the matches replaced in name, by rule.
+func (b *Builder) reportRedactions(name string, counts map[string]int) {
+	b.recordRedactions(counts)
+	names := make([]string, 0, len(counts))
+	for rule := range counts {
+		names = append(names, rule)
+	}
+	sort.Strings(names)
+	for _, rule := range names {
+		b.infof("Redacted %d %s match(es) in %s", counts[rule], rule, name)
+	}
+}
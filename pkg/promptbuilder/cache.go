@@ -0,0 +1,206 @@
+package promptbuilder
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// cacheVersion is part of every cache key, so that entries written by an
+// older version of the processing pipeline are never reused.
+const cacheVersion = "2"
+
+// DefaultCacheDir is the cache directory used by "cache=true".
+const DefaultCacheDir = ".promptbuilder-cache"
+
+// The entries are kept in their own folder of the cache directory, which
+// is marked as a cache with a CACHEDIR.TAG file, so that pruning never
+// touches files that promptbuilder did not write.
+const (
+	cacheEntriesDir = "entries"
+	cacheMarker     = "CACHEDIR.TAG"
+	cacheMarkerText = "Signature: 8a477f597d28d172789f06886806bc55\n# This file is a cache directory tag created by promptbuilder.\n"
+)
+
+// fileCache stores the processed and rendered content of files, keyed by
+// a hash of the raw content, the path, the include mode and every setting
+// that affects processing. Unchanged files are then neither redacted nor
+// rendered nor counted again.
+type fileCache struct {
+	dir         string
+	fingerprint string
+	used        map[string]bool
+	hits        int
+}
+
+// cacheEntry is a cached file, stored as <dir>/entries/<key>.json.
+type cacheEntry struct {
+	Content    string         `json:"content"`
+	Text       string         `json:"text"`
+	Tokens     int            `json:"tokens"`
+	Redactions map[string]int `json:"redactions,omitempty"` // matches replaced by rule, replayed on a hit
+}
+
+func newFileCache(dir string, b *Builder) (*fileCache, error) {
+	if err := checkCacheDir(dir, b.config.BaseDir); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("error creating cache directory: %v", err)
+	}
+	entries := filepath.Join(dir, cacheEntriesDir)
+	if _, err := os.Stat(filepath.Join(dir, cacheMarker)); os.IsNotExist(err) {
+		if _, err := os.Stat(entries); err == nil {
+			return nil, fmt.Errorf("%s is not a promptbuilder cache: it has an %s folder but no %s", dir, cacheEntriesDir, cacheMarker)
+		}
+		if err := os.WriteFile(filepath.Join(dir, cacheMarker), []byte(cacheMarkerText), 0o644); err != nil {
+			return nil, fmt.Errorf("error creating cache directory: %v", err)
+		}
+	}
+	if err := os.MkdirAll(entries, 0o755); err != nil {
+		return nil, fmt.Errorf("error creating cache directory: %v", err)
+	}
+
+	fingerprint, err := cacheFingerprint(b)
+	if err != nil {
+		return nil, err
+	}
+
+	return &fileCache{dir: entries, fingerprint: fingerprint, used: make(map[string]bool)}, nil
+}
+
+// checkCacheDir returns an error when the cache directory is basedir or
+// one of its parents, where pruning the cache would reach the project
+// files.
+func checkCacheDir(dir string, baseDir string) error {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	absBase, err := filepath.Abs(baseDir)
+	if err != nil {
+		return err
+	}
+	if rel, err := filepath.Rel(absDir, absBase); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("cache directory %s must not be basedir or contain it, use a folder of its own such as %s", dir, DefaultCacheDir)
+	}
+	return nil
+}
+
+// isCacheKey reports whether name is the file name of a cache entry: a
+// hex encoded SHA-256 key followed by .json.
+func isCacheKey(name string) bool {
+	key, ok := strings.CutSuffix(name, ".json")
+	if !ok || len(key) != 2*sha256.Size {
+		return false
+	}
+	for _, r := range key {
+		if !strings.ContainsRune("0123456789abcdef", r) {
+			return false
+		}
+	}
+	return true
+}
+
+// cacheFingerprint hashes the settings that change how a file is turned
+// into output.
+func cacheFingerprint(b *Builder) (string, error) {
+	config := b.config
+	h := sha256.New()
+	fmt.Fprintf(h, "version=%s\nformat=%s\nmodel=%s\n", cacheVersion, b.format, b.model)
+	fmt.Fprintf(h, "redactsecrets=%t\nstripcomments=%t\nlinenumbers=%t\n", config.RedactSecrets, config.StripComments, config.LineNumbers)
+	fmt.Fprintf(h, "stripnotebookoutputs=%t\n", config.StripOutputs)
+	fmt.Fprintf(h, "maxfilesize=%d\ntruncatemode=%s\nencoding=%s\n", config.MaxFileSize, config.TruncateMode, config.Encoding)
+	fmt.Fprintf(h, "csvpreview=%d\nfileheader=%s\nabsolutepaths=%t\n", config.CSVPreview, config.FileHeader, config.AbsolutePaths)
+	fmt.Fprintf(h, "trimtrailingwhitespace=%t\ncollapseblanklines=%t\ntabwidth=%d\n", config.TrimWhitespace, config.CollapseBlankLines, config.TabWidth)
+	fmt.Fprintf(h, "anonymizepaths=%t\n", config.AnonymizePaths)
+	for _, r := range config.Redactions {
+		fmt.Fprintf(h, "redact=%s=>%s\n", r.Pattern, r.Replacement)
+	}
+	for _, r := range config.Renames {
+		fmt.Fprintf(h, "rename=%s=>%s\n", r.From, r.To)
+	}
+	if config.Template != "" {
+		content, err := os.ReadFile(config.Template)
+		if err != nil {
+			return "", fmt.Errorf("error reading template: %v", err)
+		}
+		h.Write(content)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func (c *fileCache) key(file SourceFile, fullPath string, content []byte) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n%s\n%s\n%v\n", c.fingerprint, fullPath, file.Include.Mode, file.Include.Lines)
+	h.Write(content)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (c *fileCache) path(key string) string {
+	return filepath.Join(c.dir, key+".json")
+}
+
+func (c *fileCache) get(key string) (cacheEntry, bool) {
+	var entry cacheEntry
+	data, err := os.ReadFile(c.path(key))
+	if err != nil || json.Unmarshal(data, &entry) != nil {
+		return entry, false
+	}
+	c.used[key] = true
+	c.hits++
+	return entry, true
+}
+
+func (c *fileCache) put(key string, entry cacheEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so that an interrupted run never
+	// leaves a truncated entry behind
+	tmp, err := os.CreateTemp(c.dir, key+".*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), c.path(key)); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	c.used[key] = true
+	return nil
+}
+
+// prune removes the entries that were not used by this run, which are the
+// files that changed or disappeared since the previous one. Only files
+// named like an entry are removed.
+func (c *fileCache) prune() error {
+	entries, err := os.ReadDir(c.dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() || !isCacheKey(entry.Name()) || c.used[strings.TrimSuffix(entry.Name(), ".json")] {
+			continue
+		}
+		if err := os.Remove(filepath.Join(c.dir, entry.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,229 @@
+package promptbuilder
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Check looks for mistakes in a validated configuration without building
+// a prompt: directives that are not known, includes that match no file,
+// exclude rules that match nothing, and options that contradict each
+// other. It returns a description of every problem found.
+func (b *Builder) Check(ctx context.Context) ([]string, error) {
+	var problems []string
+	for _, unknown := range b.config.UnknownKeys() {
+		problems = append(problems, unknown.String())
+	}
+
+	includes, err := b.checkIncludes(ctx)
+	if err != nil {
+		return nil, err
+	}
+	problems = append(problems, includes...)
+
+	excludes, err := b.checkExcludes(ctx)
+	if err != nil {
+		return nil, err
+	}
+	problems = append(problems, excludes...)
+
+	return append(problems, b.config.conflicts()...), nil
+}
+
+// checkIncludes reports the includes that match no file, because their
+// path does not exist or because the exclude rules leave out everything
+// they match.
+func (b *Builder) checkIncludes(ctx context.Context) ([]string, error) {
+	// Missing paths are reported here rather than failing the discovery,
+	// and only the rules of the configuration decide what is found
+	config := *b.config
+	config.Strict = false
+	config.Changed = ""
+	config.FollowImports = false
+	checker := *b
+	checker.config = &config
+	checker.log = discardLog
+	checker.previous = nil
+
+	files, err := checker.findFiles(ctx)
+	if err != nil {
+		return nil, err
+	}
+	found := make(map[*Include]int)
+	for _, file := range files {
+		found[file.Include]++
+	}
+
+	var problems []string
+	for i := range config.Includes {
+		include := &config.Includes[i]
+		if isURL(include.Path) || found[include] > 0 {
+			continue
+		}
+		if !hasGlobMeta(include.Path) {
+			path := include.Path
+			if !filepath.IsAbs(path) {
+				if config.IgnoreCase {
+					path = resolveCase(b.src, config.BaseDir, path)
+				}
+				path = filepath.Join(config.BaseDir, path)
+			}
+			if _, err := b.src.stat(path); err != nil {
+				problems = append(problems, fmt.Sprintf("include %s does not exist", include.Path))
+				continue
+			}
+		}
+		problems = append(problems, fmt.Sprintf("include %s matches no files that the exclude rules keep", include.Path))
+	}
+	return problems, nil
+}
+
+// checkExcludes reports the exclude rules that match nothing in basedir.
+// The rules of presets are not reported, since they cover every project
+// of an ecosystem.
+func (b *Builder) checkExcludes(ctx context.Context) ([]string, error) {
+	config := b.config
+	fromPreset := presetRules()
+	folders := unmatchedRules(config.ExcludeFolders, fromPreset["excludefolder"])
+	extensions := unmatchedRules(config.ExcludeExtensions, fromPreset["excludeextension"])
+	files := unmatchedRules(config.ExcludeFiles, fromPreset["excludefile"])
+	patterns := make(map[*regexp.Regexp]bool)
+	for _, pattern := range config.ExcludePatterns {
+		patterns[pattern] = true
+	}
+
+	err := b.src.walk(config.BaseDir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if path == config.BaseDir {
+			return nil
+		}
+
+		if entry.IsDir() {
+			excluded := false
+			for rule := range folders {
+				if isExcludedFolder(path, config.BaseDir, []string{rule}, config.IgnoreCase) {
+					delete(folders, rule)
+					excluded = true
+				}
+			}
+			// What an excluded folder holds is never looked at, so the
+			// other rules do not need to match it
+			if excluded || isExcludedFolder(path, config.BaseDir, config.ExcludeFolders, config.IgnoreCase) || entry.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		for rule := range extensions {
+			if isExcludedExtension(path, []string{rule}, config.IgnoreCase) {
+				delete(extensions, rule)
+			}
+		}
+		for rule := range files {
+			if isExcludedFile(path, config.BaseDir, []string{rule}, config.IgnoreCase) {
+				delete(files, rule)
+			}
+		}
+		for pattern := range patterns {
+			if isExcludedPattern(path, config.BaseDir, []*regexp.Regexp{pattern}) {
+				delete(patterns, pattern)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error walking %s: %v", config.BaseDir, err)
+	}
+
+	var problems []string
+	for _, rule := range config.ExcludeFolders {
+		if folders[rule] {
+			problems = append(problems, fmt.Sprintf("excludeFolder=%s matches no folder", rule))
+		}
+	}
+	for _, rule := range config.ExcludeExtensions {
+		if extensions[rule] {
+			problems = append(problems, fmt.Sprintf("excludeExtension=%s matches no file", strings.TrimPrefix(rule, "*.")))
+		}
+	}
+	for _, rule := range config.ExcludeFiles {
+		if files[rule] {
+			problems = append(problems, fmt.Sprintf("excludeFile=%s matches no file", rule))
+		}
+	}
+	for _, pattern := range config.ExcludePatterns {
+		if patterns[pattern] {
+			problems = append(problems, fmt.Sprintf("excludePattern=%s matches no file", pattern))
+		}
+	}
+	return problems, nil
+}
+
+// unmatchedRules returns the set of rules, leaving out those of presets.
+func unmatchedRules(rules []string, fromPreset map[string]bool) map[string]bool {
+	set := make(map[string]bool)
+	for _, rule := range rules {
+		if !fromPreset[rule] {
+			set[rule] = true
+		}
+	}
+	return set
+}
+
+// presetRules returns the exclude rules of every preset, by directive, as
+// they are stored in a Config.
+func presetRules() map[string]map[string]bool {
+	rules := map[string]map[string]bool{
+		"excludefolder":    {},
+		"excludeextension": {},
+		"excludefile":      {},
+	}
+	for _, name := range PresetNames() {
+		var preset Config
+		if err := preset.applyPreset(name); err != nil {
+			continue
+		}
+		for _, rule := range preset.ExcludeFolders {
+			rules["excludefolder"][rule] = true
+		}
+		for _, rule := range preset.ExcludeExtensions {
+			rules["excludeextension"][rule] = true
+		}
+		for _, rule := range preset.ExcludeFiles {
+			rules["excludefile"][rule] = true
+		}
+	}
+	return rules
+}
+
+// conflicts reports options that contradict each other, where one of them
+// has no effect.
+func (c *Config) conflicts() []string {
+	var problems []string
+	if c.SplitTokens > 0 && c.SplitChars > 0 {
+		problems = append(problems, "splitTokens and splitChars are both set; splitChars is ignored")
+	}
+	if c.AbsolutePaths && c.AnonymizePaths {
+		problems = append(problems, "absolutePaths has no effect with anonymizePaths")
+	}
+	if c.MaxFileSize > 0 && c.ExcludeLargerThan > 0 && c.MaxFileSize >= c.ExcludeLargerThan {
+		problems = append(problems, fmt.Sprintf("maxFileSize=%s has no effect, since files larger than excludeLargerThan=%s are left out", formatSize(c.MaxFileSize), formatSize(c.ExcludeLargerThan)))
+	}
+	for _, ext := range c.IncludeExtensions {
+		for _, excluded := range c.ExcludeExtensions {
+			if strings.EqualFold(ext, excluded) {
+				problems = append(problems, fmt.Sprintf("extension %s is both in includeExtension and excludeExtension", strings.TrimPrefix(ext, "*")))
+			}
+		}
+	}
+	return problems
+}
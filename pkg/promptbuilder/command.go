@@ -0,0 +1,26 @@
+package promptbuilder
+
+import (
+	"bytes"
+	"context"
+	"os/exec"
+	"runtime"
+)
+
+// runCommand runs command with the shell in dir and returns its standard
+// output and standard error. A command that fails still returns what it
+// printed, together with an *exec.ExitError.
+func runCommand(ctx context.Context, dir string, command string) (string, string, error) {
+	shell, flag := "sh", "-c"
+	if runtime.GOOS == "windows" {
+		shell, flag = "cmd", "/C"
+	}
+	cmd := exec.CommandContext(ctx, shell, flag, command)
+	cmd.Dir = dir
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	return stdout.String(), stderr.String(), err
+}
@@ -0,0 +1,223 @@
+package promptbuilder
+
+import "strings"
+
+// commentSyntax describes how comments and string literals look in a
+// language, which is all stripComments needs to know.
+type commentSyntax struct {
+	line       []string // line comment markers
+	blockStart string
+	blockEnd   string
+	quotes     string // characters that delimit strings
+	chars      bool   // ' delimits character literals such as 'a' or '\n'
+	triple     bool   // """ and ''' delimit multi-line strings
+	raw        bool   // backslashes do not escape inside backtick strings
+	wordStart  bool   // line comments only start a word: at the start of a line, or after whitespace or ;
+}
+
+var (
+	cSyntax      = commentSyntax{line: []string{"//"}, blockStart: "/*", blockEnd: "*/", quotes: `"`, chars: true}
+	goSyntax     = commentSyntax{line: []string{"//"}, blockStart: "/*", blockEnd: "*/", quotes: "\"`", chars: true, raw: true}
+	jsSyntax     = commentSyntax{line: []string{"//"}, blockStart: "/*", blockEnd: "*/", quotes: "\"'`"}
+	phpSyntax    = commentSyntax{line: []string{"//", "#"}, blockStart: "/*", blockEnd: "*/", quotes: `"'`}
+	cssSyntax    = commentSyntax{blockStart: "/*", blockEnd: "*/", quotes: `"'`}
+	scssSyntax   = commentSyntax{line: []string{"//"}, blockStart: "/*", blockEnd: "*/", quotes: `"'`}
+	pythonSyntax = commentSyntax{line: []string{"#"}, quotes: `"'`, triple: true}
+	shellSyntax  = commentSyntax{line: []string{"#"}, quotes: `"'`, wordStart: true}
+	sqlSyntax    = commentSyntax{line: []string{"--"}, blockStart: "/*", blockEnd: "*/", quotes: `'"`}
+)
+
+// commentSyntaxes maps the languages of detectLanguage to their syntax.
+var commentSyntaxes = map[string]commentSyntax{
+	"c":          cSyntax,
+	"cpp":        cSyntax,
+	"csharp":     cSyntax,
+	"dart":       jsSyntax,
+	"go":         goSyntax,
+	"java":       cSyntax,
+	"javascript": jsSyntax,
+	"jsx":        jsSyntax,
+	"kotlin":     cSyntax,
+	"objectivec": cSyntax,
+	"protobuf":   cSyntax,
+	"rust":       cSyntax,
+	"scala":      cSyntax,
+	"swift":      cSyntax,
+	"typescript": jsSyntax,
+	"tsx":        jsSyntax,
+	"php":        phpSyntax,
+	"css":        cssSyntax,
+	"less":       scssSyntax,
+	"scss":       scssSyntax,
+	"python":     pythonSyntax,
+	"bash":       shellSyntax,
+	"perl":       shellSyntax,
+	"r":          shellSyntax,
+	"ruby":       shellSyntax,
+	"elixir":     shellSyntax,
+	"sql":        sqlSyntax,
+}
+
+// stripComments removes the comments from content according to the
+// language. Lines that only held a comment are dropped, while blank lines
+// of the original are kept. A leading #! line and Go directives such as
+// //go:build are preserved. Content in unsupported languages is returned
+// unchanged.
+func stripComments(content string, language string) string {
+	syntax, ok := commentSyntaxes[language]
+	if !ok {
+		return content
+	}
+
+	var out strings.Builder
+	var line strings.Builder
+	stripped := false // a comment was removed from the current line
+
+	endLine := func() {
+		text := line.String()
+		if stripped {
+			text = strings.TrimRight(text, " \t")
+		}
+		if !stripped || text != "" {
+			out.WriteString(text)
+			out.WriteByte('\n')
+		}
+		line.Reset()
+		stripped = false
+	}
+
+	i := 0
+	if strings.HasPrefix(content, "#!") {
+		end := strings.IndexByte(content, '\n')
+		if end == -1 {
+			return content
+		}
+		out.WriteString(content[:end+1])
+		i = end + 1
+	}
+
+	for i < len(content) {
+		ch := content[i]
+
+		if ch == '\n' {
+			endLine()
+			i++
+			continue
+		}
+
+		if marker := lineCommentAt(content, i, syntax); marker != "" {
+			end := strings.IndexByte(content[i:], '\n')
+			if end == -1 {
+				end = len(content) - i
+			}
+			if language == "go" && strings.HasPrefix(content[i:], "//go:") {
+				line.WriteString(content[i : i+end])
+			} else {
+				stripped = true
+			}
+			i += end
+			continue
+		}
+
+		if syntax.blockStart != "" && strings.HasPrefix(content[i:], syntax.blockStart) {
+			end := strings.Index(content[i+len(syntax.blockStart):], syntax.blockEnd)
+			if end == -1 {
+				end = len(content)
+			} else {
+				end += i + len(syntax.blockStart) + len(syntax.blockEnd)
+			}
+			// A multi-line comment separates what comes before it from
+			// what comes after, as a newline would
+			if strings.Contains(content[i:end], "\n") && strings.TrimSpace(line.String()) != "" {
+				stripped = true
+				endLine()
+			}
+			stripped = true
+			i = end
+			continue
+		}
+
+		if end := stringEnd(content, i, syntax); end > i {
+			line.WriteString(content[i:end])
+			i = end
+			continue
+		}
+
+		line.WriteByte(ch)
+		i++
+	}
+	if line.Len() > 0 || stripped {
+		endLine()
+		if !strings.HasSuffix(content, "\n") {
+			return strings.TrimSuffix(out.String(), "\n")
+		}
+	}
+
+	return out.String()
+}
+
+// lineCommentAt returns the line comment marker at i, or "" when no line
+// comment starts there. In shells and the languages like them, a # within
+// a word, as in ${#var}, $# or a#b, is not a comment.
+func lineCommentAt(content string, i int, syntax commentSyntax) string {
+	if syntax.wordStart && i > 0 && !strings.ContainsRune(" \t\r\n;", rune(content[i-1])) {
+		return ""
+	}
+	for _, marker := range syntax.line {
+		if strings.HasPrefix(content[i:], marker) {
+			return marker
+		}
+	}
+	return ""
+}
+
+// stringEnd returns the index just past the string or character literal
+// starting at i, or i when there is none.
+func stringEnd(content string, i int, syntax commentSyntax) int {
+	ch := content[i]
+
+	if syntax.triple && (strings.HasPrefix(content[i:], `"""`) || strings.HasPrefix(content[i:], "'''")) {
+		delim := content[i : i+3]
+		if end := strings.Index(content[i+3:], delim); end != -1 {
+			return i + 3 + end + 3
+		}
+		return len(content)
+	}
+
+	if ch == '\'' && syntax.chars {
+		// 'a' and '\n' are character literals; anything else, such as a
+		// Rust lifetime, is left alone
+		if i+2 < len(content) && content[i+1] != '\\' && content[i+2] == '\'' {
+			return i + 3
+		}
+		if i+1 < len(content) && content[i+1] == '\\' {
+			if end := strings.IndexByte(content[i+2:], '\''); end != -1 && end < 10 {
+				return i + 2 + end + 1
+			}
+		}
+		return i
+	}
+
+	if !strings.ContainsRune(syntax.quotes, rune(ch)) {
+		return i
+	}
+
+	// Backtick strings are raw in Go and span lines in JavaScript; other
+	// strings end at the closing quote or the end of the line.
+	multiline := ch == '`'
+	for j := i + 1; j < len(content); j++ {
+		switch content[j] {
+		case '\\':
+			if ch != '`' || !syntax.raw {
+				j++
+			}
+		case '\n':
+			if !multiline {
+				return j
+			}
+		case ch:
+			return j + 1
+		}
+	}
+	return len(content)
+}
@@ -0,0 +1,43 @@
+package promptbuilder
+
+import "testing"
+
+func TestStripComments(t *testing.T) {
+	tests := []struct {
+		language string
+		content  string
+		want     string
+	}{
+		// A # within a word is not a comment in shells and their kin
+		{"bash", "echo ${#var}\n", "echo ${#var}\n"},
+		{"bash", "echo $# args\n", "echo $# args\n"},
+		{"bash", "echo a#b\n", "echo a#b\n"},
+		{"bash", "echo a # comment\n", "echo a\n"},
+		{"bash", "echo a;# comment\n", "echo a;\n"},
+		{"bash", "# comment\necho a\n", "echo a\n"},
+		{"bash", "\t# indented\necho a\n", "echo a\n"},
+		{"bash", "echo '# quoted' \"#too\"\n", "echo '# quoted' \"#too\"\n"},
+		{"bash", "#!/bin/sh\n# comment\necho a\n", "#!/bin/sh\necho a\n"},
+		{"perl", "my $n = $#list; # last index\n", "my $n = $#list;\n"},
+		{"r", "x <- a#b\ny <- 1 # one\n", "x <- a#b\ny <- 1\n"},
+		{"ruby", "puts \"#{name}\" # greet\n", "puts \"#{name}\"\n"},
+		{"elixir", "x = ?# # the # character\n", "x = ?#\n"},
+
+		// Python and PHP start a comment at any #
+		{"python", "x = 1#one\n", "x = 1\n"},
+		{"python", "s = '''#\n'''\n", "s = '''#\n'''\n"},
+		{"php", "$a = 1;#one\n", "$a = 1;\n"},
+
+		{"go", "//go:build linux\n\npackage a // the package\n", "//go:build linux\n\npackage a\n"},
+		{"go", "s := `// raw`\n", "s := `// raw`\n"},
+		{"c", "int a; /* one\ntwo */ int b;\n", "int a;\n int b;\n"},
+		{"c", "char c = '\"'; // quote\n", "char c = '\"';\n"},
+		{"sql", "select 1 -- one\n", "select 1\n"},
+		{"markdown", "# Title\n", "# Title\n"},
+	}
+	for _, test := range tests {
+		if got := stripComments(test.content, test.language); got != test.want {
+			t.Errorf("stripComments(%q, %s) = %q, want %q", test.content, test.language, got, test.want)
+		}
+	}
+}
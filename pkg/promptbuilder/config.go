@@ -0,0 +1,1054 @@
+package promptbuilder
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Config describes what goes into a prompt. It is usually read from an
+// input file with ReadConfig, but can also be filled in directly.
+type Config struct {
+	HeaderText         string
+	FooterText         string // appended after all files
+	BaseDir            string
+	Includes           []Include
+	ExcludeFolders     []string
+	ExcludeExtensions  []string
+	ExcludeFiles       []string         // New: list of specific files to exclude
+	IncludeExtensions  []string         // when set, only files with these extensions are included
+	ExcludePatterns    []*regexp.Regexp // matched against the path relative to BaseDir
+	ReincludeFolders   []string         // "!folder" rules that undo folder excludes
+	ReincludeFiles     []string         // "!file" rules that undo any exclude
+	BinarySampleSize   int64            // bytes read to tell binary files from text, 512 when 0
+	TextExtensions     []string         // files with these extensions are always read as text
+	BinaryExtensions   []string         // files with these extensions are always skipped as binary
+	ForceIncludes      []string         // files read even when they look binary or match an exclude rule
+	UseGitignore       bool
+	UsePromptignore    bool // honor .promptignore files, true by default
+	FollowSymlinks     bool // walk symlinked folders and include symlinked files
+	IncludeHidden      bool // include files and folders whose name starts with a dot
+	IgnoreCase         bool // match include and exclude rules regardless of case
+	SkipGenerated      bool // skip lockfiles, source maps, minified and generated files
+	AbsolutePaths      bool // name files by their full path in the output instead of relative to BaseDir
+	AnonymizePaths     bool // replace the locations of BaseDir and the home directory in the output
+	Dedupe             bool // replace files identical to an earlier one with a reference
+	OmittedNote        bool // list the files left out for their content, size or the token budget
+	MaxTokens          int
+	NearDuplicates     float64 // similarity above which a file is shown as a diff against an earlier one
+	DirectoryStructure bool
+	Tree               bool
+	SplitTokens        int
+	SplitChars         int
+	MaxFileSize        int64
+	ExcludeLargerThan  int64 // files above this size are skipped during discovery
+	MaxFiles           int   // files discovery may find before warning, 0 for no limit
+	MaxTotalSize       int64 // bytes discovery may find before warning, 0 for no limit
+	TruncateMode       string
+	CSVPreview         int    // rows kept from the start and the end of CSV and TSV files, 0 for all
+	Encoding           string // what to do with files that are not UTF-8: transcode, replace or skip
+	Changed            string // git ref; only files changed since it are included
+	GitDiff            string // git ref to diff the working tree against
+	GitDiffPosition    string // "before" or "after" the files
+	GitRef             string // git ref the files are read from instead of the working tree
+	Metadata           bool
+	RedactSecrets      bool
+	Redactions         []Redaction
+	Renames            []Rename          // names replaced in paths and content
+	Template           string            // text/template file controlling the output layout
+	FileHeader         string            // text/template of the line before each file in markdown, "# {{.Path}}" by default
+	Vars               map[string]string // user variables for the header, set with "var name=value"
+	Sections           []Section         // named groups of includes, in output order
+	Commands           []string          // shell commands whose output is added as sections, set with includecmd
+	Attachments        []Attachment      // binary files embedded base64-encoded, set with includebinary
+	CostModels         []string          // models the cost of the prompt is estimated for
+	Prices             []Price           // dollars per million input tokens, overriding the built-in prices
+	StripComments      bool
+	TrimWhitespace     bool // remove whitespace at the ends of lines
+	CollapseBlankLines bool // replace runs of blank lines with one
+	TabWidth           int  // spaces that replace a tab, 0 to keep tabs
+	StripOutputs       bool // leave out the outputs of notebook cells
+	LineNumbers        bool
+	Cache              string // directory of the file cache, relative to BaseDir
+	History            string // directory keeping every generation, relative to BaseDir
+	PromptCaching      bool   // mark the context for prompt caching in the anthropic format
+	Sort               string // order of the files: path, size, mtime, extension, tokens or none
+	Reverse            bool   // reverse the order of the files
+	GroupBy            string // "dir" groups the files under a heading per directory
+	Stats              bool   // append a statistics block after the files
+	Strict             bool   // fail on warnings such as a missing include path
+	FollowImports      bool   // add the in-module packages imported by included Go files
+	FollowImportsDepth int    // levels of imports to follow, 0 for all
+
+	repoDir  string // basedir in the working tree when the files come from GitRef
+	noExpand bool   // paths are taken as written, without expanding $NAME and ~
+
+	// While a file is read: its path and the line being applied, and the
+	// files being imported, to detect cycles
+	file    string
+	line    int
+	imports []string
+
+	unknown []UnknownKey // directives that are not known, in the order read
+}
+
+// Redaction is a custom rule, written as "redact=regex=>replacement",
+// that is applied to the content of every file. The replacement may refer
+// to capture groups as $1 or ${name}.
+type Redaction struct {
+	Pattern     *regexp.Regexp
+	Replacement string
+}
+
+// Positions of extra sections relative to the files.
+const (
+	positionBefore = "before"
+	positionAfter  = "after"
+)
+
+// Include is a single include directive together with its options,
+// written as "include=path (key=value, ...)", and its own excludes,
+// written as "include=path { excludeextension=css,map; ... }".
+type Include struct {
+	Path     string
+	Priority int
+	Mode     string      // "full" (the default) or "outline"
+	Lines    []LineRange // parts of the files to include, all of them when empty
+	Section  string      // name of the section the include belongs to, if any
+	MaxDepth int         // levels of folders walked below the include, 0 for all
+	Excludes *Config     // exclude rules that only apply to this include, if any
+}
+
+// LineRange is a range of lines, numbered from 1, including its end.
+type LineRange struct {
+	Start int
+	End   int
+}
+
+// Include modes.
+const (
+	modeFull    = "full"
+	modeOutline = "outline"
+)
+
+// Section is a named part of the prompt, started with "section=Name". The
+// includes that follow it belong to it, and its files are rendered
+// together under a heading, followed by the optional intro text.
+type Section struct {
+	Name  string
+	Intro string
+}
+
+// SourceFile is a discovered file and the include that matched it.
+type SourceFile struct {
+	RelPath string
+	Include *Include
+}
+
+func parseInclude(value string) (Include, error) {
+	var include Include
+
+	if open := strings.Index(value, " {"); open != -1 && strings.HasSuffix(value, "}") {
+		excludes, err := parseIncludeExcludes(value[open+2 : len(value)-1])
+		if err != nil {
+			return include, err
+		}
+		include.Excludes = excludes
+		value = strings.TrimSpace(value[:open])
+	}
+	include.Path = value
+
+	open := strings.LastIndex(value, " (")
+	if open == -1 || !strings.HasSuffix(value, ")") {
+		return include, nil
+	}
+	include.Path = strings.TrimSpace(value[:open])
+
+	for _, option := range strings.Split(value[open+2:len(value)-1], ",") {
+		parts := strings.SplitN(option, "=", 2)
+		if len(parts) != 2 {
+			return include, fmt.Errorf("invalid include option %q", strings.TrimSpace(option))
+		}
+		key := strings.ToLower(strings.TrimSpace(parts[0]))
+		optValue := strings.TrimSpace(parts[1])
+
+		switch key {
+		case "priority":
+			priority, err := strconv.Atoi(optValue)
+			if err != nil {
+				return include, fmt.Errorf("invalid priority %q", optValue)
+			}
+			include.Priority = priority
+		case "mode":
+			mode := strings.ToLower(optValue)
+			if mode != modeFull && mode != modeOutline {
+				return include, fmt.Errorf("invalid mode %q (use full or outline)", optValue)
+			}
+			include.Mode = mode
+		case "lines":
+			lines, err := parseLineRanges(optValue)
+			if err != nil {
+				return include, err
+			}
+			include.Lines = lines
+		case "maxdepth":
+			depth, err := strconv.Atoi(optValue)
+			if err != nil || depth < 1 {
+				return include, fmt.Errorf("invalid maxdepth %q (use a number from 1)", optValue)
+			}
+			include.MaxDepth = depth
+		case "recursive":
+			recursive, err := parseBool(key, optValue)
+			if err != nil {
+				return include, err
+			}
+			include.MaxDepth = 0
+			if !recursive {
+				include.MaxDepth = 1
+			}
+		default:
+			return include, fmt.Errorf("unknown include option %q", key)
+		}
+	}
+
+	return include, nil
+}
+
+// parseLineRanges parses the ranges of the lines option, separated by
+// spaces, such as "10-30 52-60 75".
+func parseLineRanges(value string) ([]LineRange, error) {
+	var ranges []LineRange
+	for _, field := range strings.Fields(value) {
+		startText, endText, isRange := strings.Cut(field, "-")
+		if !isRange {
+			endText = startText
+		}
+		start, err := strconv.Atoi(startText)
+		if err != nil || start < 1 {
+			return nil, fmt.Errorf("invalid line range %q", field)
+		}
+		end, err := strconv.Atoi(endText)
+		if err != nil || end < start {
+			return nil, fmt.Errorf("invalid line range %q", field)
+		}
+		ranges = append(ranges, LineRange{Start: start, End: end})
+	}
+	if len(ranges) == 0 {
+		return nil, fmt.Errorf("lines needs at least one range")
+	}
+	return ranges, nil
+}
+
+// parseIncludeExcludes parses the exclude directives of an include block,
+// separated by semicolons. The folder, extension and file directives take
+// comma-separated lists.
+func parseIncludeExcludes(block string) (*Config, error) {
+	excludes := &Config{}
+	for _, directive := range strings.Split(block, ";") {
+		if strings.TrimSpace(directive) == "" {
+			continue
+		}
+		parts := strings.SplitN(directive, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid include exclude %q", strings.TrimSpace(directive))
+		}
+		key := strings.ToLower(strings.TrimSpace(parts[0]))
+		value := strings.TrimSpace(parts[1])
+
+		switch key {
+		case "excludefolder", "excludeextension", "excludefile":
+			for _, item := range strings.Split(value, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					if err := excludes.applyDirective(key, item); err != nil {
+						return nil, err
+					}
+				}
+			}
+		case "excludepattern":
+			if err := excludes.applyDirective(key, value); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("unknown include exclude %q", key)
+		}
+	}
+	return excludes, nil
+}
+
+// forInclude returns the configuration used to discover the files of an
+// include: c itself, or a copy extended with the include's own excludes.
+func (c *Config) forInclude(include *Include) *Config {
+	if include.Excludes == nil {
+		return c
+	}
+	excludes := include.Excludes
+	merged := *c
+	merged.ExcludeFolders = concat(c.ExcludeFolders, excludes.ExcludeFolders)
+	merged.ExcludeExtensions = concat(c.ExcludeExtensions, excludes.ExcludeExtensions)
+	merged.ExcludeFiles = concat(c.ExcludeFiles, excludes.ExcludeFiles)
+	merged.ExcludePatterns = concat(c.ExcludePatterns, excludes.ExcludePatterns)
+	merged.ReincludeFolders = concat(c.ReincludeFolders, excludes.ReincludeFolders)
+	merged.ReincludeFiles = concat(c.ReincludeFiles, excludes.ReincludeFiles)
+	return &merged
+}
+
+// ignoreCasePatterns returns the patterns made case-insensitive.
+func ignoreCasePatterns(patterns []*regexp.Regexp) []*regexp.Regexp {
+	folded := make([]*regexp.Regexp, len(patterns))
+	for i, pattern := range patterns {
+		if strings.HasPrefix(pattern.String(), "(?i)") {
+			folded[i] = pattern
+		} else {
+			folded[i] = regexp.MustCompile("(?i)" + pattern.String())
+		}
+	}
+	return folded
+}
+
+// concat returns a new slice holding the elements of a followed by b.
+func concat[T any](a, b []T) []T {
+	return append(append([]T(nil), a...), b...)
+}
+
+// Validate checks the configuration and resolves BaseDir to an absolute
+// path. A remote basedir is cloned first, and BaseDir then points to the
+// clone, and an archive is extracted. With GitRef, BaseDir points to the
+// files of that ref, extracted from the repository.
+func (c *Config) Validate() error {
+	return c.ValidateContext(context.Background())
+}
+
+// ValidateContext is Validate with a context that cancels the clone of a
+// remote basedir and the extraction of a git ref.
+func (c *Config) ValidateContext(ctx context.Context) error {
+	if c.BaseDir == "" {
+		return fmt.Errorf("basedir is required")
+	}
+
+	if isRemote(c.BaseDir) {
+		dir, err := cloneRemote(ctx, c.BaseDir)
+		if err != nil {
+			return err
+		}
+		c.BaseDir = dir
+	}
+
+	// Convert to absolute path if relative
+	if !filepath.IsAbs(c.BaseDir) {
+		absPath, err := filepath.Abs(c.BaseDir)
+		if err != nil {
+			return fmt.Errorf("failed to convert basedir to absolute path: %v", err)
+		}
+		c.BaseDir = absPath
+	}
+
+	if _, err := os.Stat(c.BaseDir); os.IsNotExist(err) {
+		return fmt.Errorf("basedir does not exist: %s", c.BaseDir)
+	}
+
+	if isArchive(c.BaseDir) {
+		if info, err := os.Stat(c.BaseDir); err == nil && info.Mode().IsRegular() {
+			dir, err := extractArchive(c.BaseDir)
+			if err != nil {
+				return err
+			}
+			c.BaseDir = dir
+		}
+	}
+
+	if c.GitRef != "" && c.repoDir == "" {
+		dir, err := extractRef(ctx, c.BaseDir, c.GitRef)
+		if err != nil {
+			return err
+		}
+		c.repoDir = c.BaseDir
+		c.BaseDir = dir
+	}
+
+	return c.validateRules()
+}
+
+// validateRules checks the parts of the configuration that do not depend
+// on basedir.
+func (c *Config) validateRules() error {
+	if len(c.Includes) == 0 {
+		return fmt.Errorf("at least one include path is required")
+	}
+
+	if c.GroupBy != "" && len(c.Sections) > 0 {
+		return fmt.Errorf("groupby cannot be combined with sections")
+	}
+
+	if c.IgnoreCase {
+		c.ExcludePatterns = ignoreCasePatterns(c.ExcludePatterns)
+		for i := range c.Includes {
+			if excludes := c.Includes[i].Excludes; excludes != nil {
+				excludes.ExcludePatterns = ignoreCasePatterns(excludes.ExcludePatterns)
+			}
+		}
+	}
+
+	for _, model := range c.CostModels {
+		if _, ok := c.price(model); !ok {
+			return fmt.Errorf("no price known for %s, set one with price=%s=<dollars per million tokens> (known: %s)", model, model, strings.Join(PricedModels(), ", "))
+		}
+	}
+
+	return nil
+}
+
+// ReadConfig reads a configuration from an input file. Files ending in
+// .yaml, .yml, .toml or .json are parsed as such; anything else uses the
+// key=value input file format.
+func ReadConfig(path string) (*Config, error) {
+	config := NewConfig()
+	if abs, err := filepath.Abs(path); err == nil {
+		config.imports = []string{abs}
+	}
+	if err := config.readFile(path, false); err != nil {
+		return nil, err
+	}
+	config.imports = nil
+	return config, nil
+}
+
+// readFile applies the configuration in path, in the format told by its
+// extension, on top of c. A fragment read by an import holds directives
+// only when it is in the input file format, without header and footer.
+func (c *Config) readFile(path string, fragment bool) error {
+	reading := c.file
+	c.file = path
+	defer func() { c.file = reading }()
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json", ".yaml", ".yml", ".toml":
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("error opening file: %v", err)
+		}
+
+		var m *mapping
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".json":
+			m, err = parseJSON(string(data))
+		case ".toml":
+			m, err = parseTOML(string(data))
+		default:
+			m, err = parseYAML(string(data))
+		}
+		if err != nil {
+			return err
+		}
+		return c.applyMapping(m)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("error opening file: %v", err)
+	}
+	defer file.Close()
+
+	return c.parseText(file, !fragment)
+}
+
+// NewConfig returns an empty configuration with default settings.
+func NewConfig() *Config {
+	return &Config{
+		Includes:          make([]Include, 0),
+		ExcludeFolders:    make([]string, 0),
+		ExcludeExtensions: make([]string, 0),
+		ExcludeFiles:      make([]string, 0), // Initialize ExcludeFiles
+		TruncateMode:      truncateHead,
+		Encoding:          encodingTranscode,
+		Sort:              sortPath,
+		GitDiffPosition:   positionBefore,
+		RedactSecrets:     true,
+		UsePromptignore:   true,
+	}
+}
+
+// ParseConfig parses a configuration in the input file format: optional
+// header text, a "---" separator line, key=value directives, and
+// optionally a second "---" line followed by footer text. Blank lines and
+// lines starting with # are skipped among the directives.
+func ParseConfig(r io.Reader) (*Config, error) {
+	config := NewConfig()
+	if err := config.parseText(r, true); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// parseText applies a configuration in the input file format on top of
+// c. Without header, every line up to a "---" line is a directive, and
+// the rest is ignored.
+func (c *Config) parseText(r io.Reader, header bool) error {
+	scanner := bufio.NewScanner(r)
+	headerLines := []string{}
+	var footerLines []string
+	isHeader := header
+	isFooter := false
+	defer func() { c.line = 0 }()
+
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := scanner.Text()
+		c.line = lineNumber
+
+		if line == "---" && !isFooter {
+			if isHeader {
+				isHeader = false
+				c.HeaderText = strings.Join(headerLines, "\n")
+			} else {
+				isFooter = true
+			}
+			continue
+		}
+
+		if isHeader {
+			headerLines = append(headerLines, line)
+		} else if isFooter {
+			footerLines = append(footerLines, line)
+		} else {
+			if trimmed := strings.TrimSpace(line); trimmed == "" || strings.HasPrefix(trimmed, "#") {
+				continue
+			}
+
+			parts := strings.SplitN(line, "=", 2)
+			if len(parts) != 2 {
+				c.unknown = append(c.unknown, UnknownKey{Key: strings.TrimSpace(line), File: c.file, Line: c.line})
+				continue
+			}
+
+			key := strings.ToLower(strings.TrimSpace(parts[0]))
+			value := strings.TrimSpace(parts[1])
+
+			// "var name=value" defines a header variable; the name keeps
+			// its case
+			if strings.HasPrefix(key, "var ") {
+				key, value = "var", strings.TrimSpace(strings.TrimSpace(parts[0])[len("var "):])+"="+value
+			}
+
+			if err := c.applyDirective(key, value); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("error reading file: %v", err)
+	}
+
+	if footer := strings.Trim(strings.Join(footerLines, "\n"), "\n"); footer != "" && header {
+		c.FooterText = footer
+	}
+
+	return nil
+}
+
+// Set applies a single directive, exactly as if "key=value" had been
+// written in the input file.
+func (c *Config) Set(key string, value string) error {
+	return c.applyDirective(strings.ToLower(key), value)
+}
+
+// applyDirective applies a single key=value directive. key must be lower
+// case.
+func (c *Config) applyDirective(key string, value string) error {
+	switch key {
+	case "basedir":
+		dir, err := c.expandPath(value)
+		if err != nil {
+			return fmt.Errorf("invalid value for %s: %v", key, err)
+		}
+		c.BaseDir = dir
+	case "include":
+		include, err := parseInclude(value)
+		if err != nil {
+			return fmt.Errorf("invalid include %s: %v", value, err)
+		}
+		if include.Path, err = c.expandPath(include.Path); err != nil {
+			return fmt.Errorf("invalid include %s: %v", value, err)
+		}
+		if len(c.Sections) > 0 {
+			include.Section = c.Sections[len(c.Sections)-1].Name
+		}
+		c.Includes = append(c.Includes, include)
+	case "includecmd":
+		c.Commands = append(c.Commands, value)
+	case "includebinary":
+		attachment, err := parseAttachment(value)
+		if err != nil {
+			return fmt.Errorf("invalid includebinary %s: %v", value, err)
+		}
+		c.Attachments = append(c.Attachments, attachment)
+	case "section":
+		for _, section := range c.Sections {
+			if section.Name == value {
+				return fmt.Errorf("duplicate section %s", value)
+			}
+		}
+		c.Sections = append(c.Sections, Section{Name: value})
+	case "intro":
+		if len(c.Sections) == 0 {
+			return fmt.Errorf("intro must follow a section directive")
+		}
+		section := &c.Sections[len(c.Sections)-1]
+		if section.Intro != "" {
+			section.Intro += "\n"
+		}
+		section.Intro += strings.TrimRight(value, "\n")
+	case "excludefolder":
+		if rule, ok := strings.CutPrefix(value, "!"); ok {
+			c.ReincludeFolders = append(c.ReincludeFolders, rule)
+		} else {
+			c.ExcludeFolders = append(c.ExcludeFolders, value)
+		}
+	case "excludeextension":
+		ext := value
+		if !strings.HasPrefix(ext, "*.") {
+			ext = "*." + ext
+		}
+		c.ExcludeExtensions = append(c.ExcludeExtensions, ext)
+	case "includeextension":
+		ext := "*." + strings.TrimLeft(value, "*.")
+		c.IncludeExtensions = append(c.IncludeExtensions, ext)
+	case "excludefile":
+		if rule, ok := strings.CutPrefix(value, "!"); ok {
+			c.ReincludeFiles = append(c.ReincludeFiles, rule)
+		} else {
+			c.ExcludeFiles = append(c.ExcludeFiles, value)
+		}
+	case "excludepattern":
+		pattern, err := regexp.Compile(value)
+		if err != nil {
+			return fmt.Errorf("invalid value for %s: %v", key, err)
+		}
+		c.ExcludePatterns = append(c.ExcludePatterns, pattern)
+	case "usegitignore":
+		enabled, err := parseBool(key, value)
+		if err != nil {
+			return err
+		}
+		c.UseGitignore = enabled
+	case "ignorecase":
+		enabled, err := parseBool(key, value)
+		if err != nil {
+			return err
+		}
+		c.IgnoreCase = enabled
+	case "usepromptignore":
+		enabled, err := parseBool(key, value)
+		if err != nil {
+			return err
+		}
+		c.UsePromptignore = enabled
+	case "nearduplicates":
+		switch strings.ToLower(value) {
+		case "false":
+			c.NearDuplicates = 0
+		case "true":
+			c.NearDuplicates = DefaultNearDuplicates
+		default:
+			threshold, err := strconv.ParseFloat(strings.TrimSuffix(value, "%"), 64)
+			if strings.HasSuffix(value, "%") {
+				threshold /= 100
+			}
+			if err != nil || threshold <= 0 || threshold > 1 {
+				return fmt.Errorf("invalid value for %s: %s (use true or a similarity such as 0.95 or 95%%)", key, value)
+			}
+			c.NearDuplicates = threshold
+		}
+	case "dedupe":
+		enabled, err := parseBool(key, value)
+		if err != nil {
+			return err
+		}
+		c.Dedupe = enabled
+	case "omittednote":
+		enabled, err := parseBool(key, value)
+		if err != nil {
+			return err
+		}
+		c.OmittedNote = enabled
+	case "anonymizepaths":
+		enabled, err := parseBool(key, value)
+		if err != nil {
+			return err
+		}
+		c.AnonymizePaths = enabled
+	case "rename":
+		rename, err := parseRename(value)
+		if err != nil {
+			return fmt.Errorf("invalid value for %s: %s (%v)", key, value, err)
+		}
+		c.Renames = append(c.Renames, rename)
+	case "absolutepaths":
+		enabled, err := parseBool(key, value)
+		if err != nil {
+			return err
+		}
+		c.AbsolutePaths = enabled
+	case "skipgenerated":
+		enabled, err := parseBool(key, value)
+		if err != nil {
+			return err
+		}
+		c.SkipGenerated = enabled
+	case "followsymlinks":
+		enabled, err := parseBool(key, value)
+		if err != nil {
+			return err
+		}
+		c.FollowSymlinks = enabled
+	case "includehidden":
+		enabled, err := parseBool(key, value)
+		if err != nil {
+			return err
+		}
+		c.IncludeHidden = enabled
+	case "stripnotebookoutputs":
+		enabled, err := parseBool(key, value)
+		if err != nil {
+			return err
+		}
+		c.StripOutputs = enabled
+	case "directorystructure":
+		enabled, err := parseBool(key, value)
+		if err != nil {
+			return err
+		}
+		c.DirectoryStructure = enabled
+	case "tree":
+		enabled, err := parseBool(key, value)
+		if err != nil {
+			return err
+		}
+		c.Tree = enabled
+	case "maxtokens":
+		maxTokens, err := strconv.Atoi(value)
+		if err != nil || maxTokens < 0 {
+			return fmt.Errorf("invalid value for %s: %s", key, value)
+		}
+		c.MaxTokens = maxTokens
+	case "maxfilesize":
+		size, err := parseSize(value)
+		if err != nil {
+			return fmt.Errorf("invalid value for %s: %v", key, err)
+		}
+		c.MaxFileSize = size
+	case "excludelargerthan":
+		size, err := parseSize(value)
+		if err != nil {
+			return fmt.Errorf("invalid value for %s: %v", key, err)
+		}
+		c.ExcludeLargerThan = size
+	case "maxfiles":
+		maxFiles, err := strconv.Atoi(value)
+		if err != nil || maxFiles < 0 {
+			return fmt.Errorf("invalid value for %s: %s", key, value)
+		}
+		c.MaxFiles = maxFiles
+	case "maxtotalsize":
+		size, err := parseSize(value)
+		if err != nil {
+			return fmt.Errorf("invalid value for %s: %v", key, err)
+		}
+		c.MaxTotalSize = size
+	case "csvpreview":
+		rows, err := strconv.Atoi(value)
+		if err != nil || rows < 0 {
+			return fmt.Errorf("invalid value for %s: %s", key, value)
+		}
+		c.CSVPreview = rows
+	case "truncatemode":
+		mode := strings.ToLower(value)
+		if mode != truncateHead && mode != truncateTail && mode != truncateHeadTail {
+			return fmt.Errorf("invalid value for %s: %s (use head, tail or headtail)", key, value)
+		}
+		c.TruncateMode = mode
+	case "binarysamplesize":
+		size, err := parseSize(value)
+		if err != nil || size <= 0 {
+			return fmt.Errorf("invalid value for %s: %s", key, value)
+		}
+		c.BinarySampleSize = size
+	case "textextension":
+		c.TextExtensions = append(c.TextExtensions, "*."+strings.TrimLeft(value, "*."))
+	case "binaryextension":
+		c.BinaryExtensions = append(c.BinaryExtensions, "*."+strings.TrimLeft(value, "*."))
+	case "forceinclude":
+		c.ForceIncludes = append(c.ForceIncludes, value)
+	case "encoding":
+		mode := strings.ToLower(value)
+		if mode != encodingTranscode && mode != encodingReplace && mode != encodingSkip {
+			return fmt.Errorf("invalid value for %s: %s (use transcode, replace or skip)", key, value)
+		}
+		c.Encoding = mode
+	case "sort":
+		order := strings.ToLower(value)
+		valid := false
+		for _, k := range sortKeys {
+			valid = valid || k == order
+		}
+		if !valid {
+			return fmt.Errorf("invalid value for %s: %s (use %s)", key, value, strings.Join(sortKeys, ", "))
+		}
+		c.Sort = order
+	case "groupby":
+		switch groupBy := strings.ToLower(value); groupBy {
+		case groupByDir:
+			c.GroupBy = groupBy
+		case "", "none":
+			c.GroupBy = ""
+		default:
+			return fmt.Errorf("invalid value for %s: %s (use dir or none)", key, value)
+		}
+	case "stats":
+		enabled, err := parseBool(key, value)
+		if err != nil {
+			return err
+		}
+		c.Stats = enabled
+	case "followimports":
+		// true or false, or the number of levels to follow
+		if depth, err := strconv.Atoi(value); err == nil && depth > 0 {
+			c.FollowImports = true
+			c.FollowImportsDepth = depth
+			break
+		}
+		enabled, err := parseBool(key, value)
+		if err != nil {
+			return err
+		}
+		c.FollowImports = enabled
+		c.FollowImportsDepth = 0
+	case "strict":
+		enabled, err := parseBool(key, value)
+		if err != nil {
+			return err
+		}
+		c.Strict = enabled
+	case "reverse":
+		enabled, err := parseBool(key, value)
+		if err != nil {
+			return err
+		}
+		c.Reverse = enabled
+	case "changed":
+		switch strings.ToLower(value) {
+		case "", "false":
+			c.Changed = ""
+		case "true":
+			c.Changed = "HEAD"
+		default:
+			c.Changed = value
+		}
+	case "metadata":
+		enabled, err := parseBool(key, value)
+		if err != nil {
+			return err
+		}
+		c.Metadata = enabled
+	case "redactsecrets":
+		enabled, err := parseBool(key, value)
+		if err != nil {
+			return err
+		}
+		c.RedactSecrets = enabled
+	case "trimtrailingwhitespace":
+		enabled, err := parseBool(key, value)
+		if err != nil {
+			return err
+		}
+		c.TrimWhitespace = enabled
+	case "collapseblanklines":
+		enabled, err := parseBool(key, value)
+		if err != nil {
+			return err
+		}
+		c.CollapseBlankLines = enabled
+	case "tabwidth":
+		width, err := strconv.Atoi(value)
+		if err != nil || width < 0 {
+			return fmt.Errorf("invalid value for %s: %s", key, value)
+		}
+		c.TabWidth = width
+	case "stripcomments":
+		enabled, err := parseBool(key, value)
+		if err != nil {
+			return err
+		}
+		c.StripComments = enabled
+	case "linenumbers":
+		enabled, err := parseBool(key, value)
+		if err != nil {
+			return err
+		}
+		c.LineNumbers = enabled
+	case "promptcaching":
+		enabled, err := parseBool(key, value)
+		if err != nil {
+			return err
+		}
+		c.PromptCaching = enabled
+	case "cache":
+		switch strings.ToLower(value) {
+		case "", "false":
+			c.Cache = ""
+		case "true":
+			c.Cache = DefaultCacheDir
+		default:
+			c.Cache = value
+		}
+	case "history":
+		switch strings.ToLower(value) {
+		case "", "false":
+			c.History = ""
+		case "true":
+			c.History = DefaultHistoryDir
+		default:
+			c.History = value
+		}
+	case "preset":
+		if err := c.applyPreset(value); err != nil {
+			return err
+		}
+	case "import":
+		if err := c.importFile(value); err != nil {
+			return err
+		}
+	case "redact":
+		expr, replacement := value, "[REDACTED]"
+		if i := strings.LastIndex(value, "=>"); i != -1 {
+			expr, replacement = strings.TrimSpace(value[:i]), strings.TrimSpace(value[i+2:])
+		}
+		pattern, err := regexp.Compile(expr)
+		if err != nil {
+			return fmt.Errorf("invalid value for %s: %v", key, err)
+		}
+		c.Redactions = append(c.Redactions, Redaction{Pattern: pattern, Replacement: replacement})
+	case "footer":
+		c.FooterText = value
+	case "footerfile":
+		path, err := c.expandPath(value)
+		if err != nil {
+			return fmt.Errorf("invalid value for %s: %v", key, err)
+		}
+		if !filepath.IsAbs(path) {
+			// Relative to the config file, like imports
+			path = filepath.Join(filepath.Dir(c.file), path)
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("error reading footer file: %v", err)
+		}
+		c.FooterText = strings.TrimRight(string(content), "\n")
+	case "template":
+		c.Template = value
+	case "fileheader":
+		if _, err := parseFileHeader(value); err != nil {
+			return fmt.Errorf("invalid value for %s: %v", key, err)
+		}
+		c.FileHeader = value
+	case "cost":
+		for _, model := range strings.Split(value, ",") {
+			if model = strings.ToLower(strings.TrimSpace(model)); model != "" {
+				c.CostModels = append(c.CostModels, model)
+			}
+		}
+	case "price":
+		price, err := parsePrice(value)
+		if err != nil {
+			return fmt.Errorf("invalid value for %s: %s (%v)", key, value, err)
+		}
+		c.Prices = append(c.Prices, price)
+	case "var":
+		name, varValue, ok := strings.Cut(value, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return fmt.Errorf("invalid value for %s: %s (use name=value)", key, value)
+		}
+		if c.Vars == nil {
+			c.Vars = make(map[string]string)
+		}
+		c.Vars[name] = strings.TrimSpace(varValue)
+	case "gitdiff":
+		c.GitDiff = value
+	case "gitref":
+		c.GitRef = value
+	case "gitdiffposition":
+		position := strings.ToLower(value)
+		if position != positionBefore && position != positionAfter {
+			return fmt.Errorf("invalid value for %s: %s (use before or after)", key, value)
+		}
+		c.GitDiffPosition = position
+	case "splittokens", "splitchars":
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 0 {
+			return fmt.Errorf("invalid value for %s: %s", key, value)
+		}
+		if key == "splittokens" {
+			c.SplitTokens = limit
+		} else {
+			c.SplitChars = limit
+		}
+	default:
+		c.unknown = append(c.unknown, UnknownKey{Key: key, File: c.file, Line: c.line})
+	}
+
+	return nil
+}
+
+// ExpandPath expands environment variables, written as $NAME or ${NAME},
+// and a leading ~ for the home directory in a path, so that a shared
+// configuration does not depend on where each machine keeps the files.
+// A variable that is not set is an error rather than an empty string,
+// which would silently change the path. $$ stands for a literal $.
+func ExpandPath(path string) (string, error) {
+	var missing []string
+	path = os.Expand(path, func(name string) string {
+		if name == "$" {
+			return "$"
+		}
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			missing = append(missing, name)
+		}
+		return value
+	})
+	if len(missing) > 0 {
+		return "", fmt.Errorf("environment variable %s is not set", strings.Join(missing, ", "))
+	}
+
+	if path == "~" || strings.HasPrefix(path, "~/") || strings.HasPrefix(path, "~"+string(filepath.Separator)) {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		path = filepath.Join(home, path[1:])
+	}
+	return path, nil
+}
+
+// expandPath expands path with ExpandPath, unless the config was parsed
+// WithoutExpansion.
+func (c *Config) expandPath(path string) (string, error) {
+	if c.noExpand {
+		return path, nil
+	}
+	return ExpandPath(path)
+}
+
+func parseBool(key string, value string) (bool, error) {
+	enabled, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid value for %s: %s", key, value)
+	}
+	return enabled, nil
+}
@@ -0,0 +1,160 @@
+package promptbuilder
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseConfig(t *testing.T) {
+	input := `Review this code.
+---
+basedir = /project
+# comments and blank lines are skipped
+
+include=src
+include=docs/api.md (priority=10, mode=outline)
+include=server/handler.go (lines=40-80 120)
+include=web (maxdepth=2) { excludeextension=css; excludefolder=dist }
+excludefolder=node_modules
+excludefolder=!node_modules/keep
+excludeextension=map
+excludeextension=*.min.js
+includeextension=.go
+excludefile=!src/generated.go
+maxfilesize=1.5kb
+usegitignore=true
+var Team Name=Platform
+---
+Answer in English.
+`
+	config, err := ParseConfig(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("ParseConfig: %v", err)
+	}
+
+	if config.HeaderText != "Review this code." || config.FooterText != "Answer in English." {
+		t.Errorf("header %q and footer %q", config.HeaderText, config.FooterText)
+	}
+	if config.BaseDir != "/project" {
+		t.Errorf("BaseDir = %q", config.BaseDir)
+	}
+	if len(config.Includes) != 4 {
+		t.Fatalf("got %d includes, want 4", len(config.Includes))
+	}
+	if include := config.Includes[1]; include.Path != "docs/api.md" || include.Priority != 10 || include.Mode != modeOutline {
+		t.Errorf("include with options = %+v", include)
+	}
+	if lines := config.Includes[2].Lines; !reflect.DeepEqual(lines, []LineRange{{40, 80}, {120, 120}}) {
+		t.Errorf("lines = %v", lines)
+	}
+	web := config.Includes[3]
+	if web.Path != "web" || web.MaxDepth != 2 || web.Excludes == nil ||
+		!reflect.DeepEqual(web.Excludes.ExcludeExtensions, []string{"*.css"}) || !reflect.DeepEqual(web.Excludes.ExcludeFolders, []string{"dist"}) {
+		t.Errorf("include with excludes = %+v, excludes %+v", web, web.Excludes)
+	}
+	if !reflect.DeepEqual(config.ExcludeFolders, []string{"node_modules"}) || !reflect.DeepEqual(config.ReincludeFolders, []string{"node_modules/keep"}) {
+		t.Errorf("folders = %q, reincluded %q", config.ExcludeFolders, config.ReincludeFolders)
+	}
+	if !reflect.DeepEqual(config.ExcludeExtensions, []string{"*.map", "*.min.js"}) || !reflect.DeepEqual(config.IncludeExtensions, []string{"*.go"}) {
+		t.Errorf("extensions = %q, included %q", config.ExcludeExtensions, config.IncludeExtensions)
+	}
+	if !reflect.DeepEqual(config.ReincludeFiles, []string{"src/generated.go"}) {
+		t.Errorf("reincluded files = %q", config.ReincludeFiles)
+	}
+	if config.MaxFileSize != 1536 {
+		t.Errorf("MaxFileSize = %d", config.MaxFileSize)
+	}
+	if !config.UseGitignore {
+		t.Error("UseGitignore not set")
+	}
+	if config.Vars["Team Name"] != "Platform" {
+		t.Errorf("Vars = %v", config.Vars)
+	}
+}
+
+func TestParseConfigErrors(t *testing.T) {
+	tests := []struct {
+		directive string
+		err       string
+	}{
+		{"usegitignore=maybe", "invalid value for usegitignore"},
+		{"maxfilesize=lots", `invalid size "lots"`},
+		{"excludepattern=([", "invalid value for excludepattern"},
+		{"include=src (priority=high)", `invalid priority "high"`},
+		{"include=src (mode=summary)", `invalid mode "summary"`},
+		{"include=src (lines=30-10)", `invalid line range "30-10"`},
+		{"include=src (maxdepth=0)", `invalid maxdepth "0"`},
+		{"include=src (depth=1)", `unknown include option "depth"`},
+		{"intro=text", "intro must follow a section directive"},
+	}
+	for _, test := range tests {
+		_, err := ParseConfig(strings.NewReader("---\n" + test.directive + "\n"))
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: error %v, want %q", test.directive, err, test.err)
+		}
+	}
+}
+
+// TestFooter checks that footer is text in every format, and that
+// footerFile is read relative to the config file.
+func TestFooter(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "prompts", "question.md"), "Why is it slow?\n")
+	writeTestFile(t, filepath.Join(dir, "prompts", "input.txt"), "---\nbasedir=.\nfooterFile=question.md\n")
+	writeTestFile(t, filepath.Join(dir, "text.txt"), "---\nbasedir=.\nfooter=question.md\n")
+	writeTestFile(t, filepath.Join(dir, "config.yaml"), "basedir: .\nfooter: question.md\n")
+	writeTestFile(t, filepath.Join(dir, "file.yaml"), "basedir: .\nfooterFile: prompts/question.md\n")
+
+	for name, want := range map[string]string{
+		"prompts/input.txt": "Why is it slow?",
+		"text.txt":          "question.md",
+		"config.yaml":       "question.md",
+		"file.yaml":         "Why is it slow?",
+	} {
+		config, err := ReadConfig(filepath.Join(dir, name))
+		if err != nil {
+			t.Errorf("ReadConfig(%s): %v", name, err)
+			continue
+		}
+		if config.FooterText != want {
+			t.Errorf("%s: footer %q, want %q", name, config.FooterText, want)
+		}
+	}
+}
+
+func TestWithoutExpansion(t *testing.T) {
+	t.Setenv("PB_TEST_DIR", "expanded")
+	data := []byte(`{"basedir": "~/$PB_TEST_DIR", "include": ["$PB_TEST_DIR/a", "${PB_MISSING}"]}`)
+	if _, err := ParseConfigJSON(data); err == nil {
+		t.Error("ParseConfigJSON expanded a variable that is not set")
+	}
+	config, err := ParseConfigJSON(data, WithoutExpansion())
+	if err != nil {
+		t.Fatalf("ParseConfigJSON: %v", err)
+	}
+	if config.BaseDir != "~/$PB_TEST_DIR" {
+		t.Errorf("basedir %q was expanded", config.BaseDir)
+	}
+	if got := []string{config.Includes[0].Path, config.Includes[1].Path}; got[0] != "$PB_TEST_DIR/a" || got[1] != "${PB_MISSING}" {
+		t.Errorf("includes %q were expanded", got)
+	}
+}
+
+func TestUnknownKeys(t *testing.T) {
+	config, err := ParseConfig(strings.NewReader("---\ninclude=src\nexcludefolders=dist\nnot a directive\n"))
+	if err != nil {
+		t.Fatalf("ParseConfig: %v", err)
+	}
+	unknown := config.UnknownKeys()
+	if len(unknown) != 2 {
+		t.Fatalf("got %d unknown keys, want 2: %v", len(unknown), unknown)
+	}
+	if unknown[0].Key != "excludefolders" || unknown[0].Line != 3 || unknown[0].Suggestion() != "excludefolder" {
+		t.Errorf("unknown key = %+v, suggestion %q", unknown[0], unknown[0].Suggestion())
+	}
+	if unknown[1].Key != "not a directive" || unknown[1].Suggestion() != "" {
+		t.Errorf("unknown line = %+v, suggestion %q", unknown[1], unknown[1].Suggestion())
+	}
+}
@@ -0,0 +1,39 @@
+package promptbuilder
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// importFile applies the directives of another configuration file where
+// the import directive stands, so that shared excludes and presets can be
+// kept in one place. Directives after the import override those of the
+// imported file. A relative path is relative to the importing file.
+func (c *Config) importFile(value string) error {
+	path, err := c.expandPath(value)
+	if err != nil {
+		return fmt.Errorf("invalid value for import: %v", err)
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(filepath.Dir(c.file), path)
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+
+	for i, imported := range c.imports {
+		if imported == abs {
+			cycle := append(append([]string(nil), c.imports[i:]...), abs)
+			return fmt.Errorf("import cycle: %s", strings.Join(cycle, " -> "))
+		}
+	}
+	c.imports = append(c.imports, abs)
+	defer func() { c.imports = c.imports[:len(c.imports)-1] }()
+
+	if err := c.readFile(path, true); err != nil {
+		return fmt.Errorf("error importing %s: %w", value, err)
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+package promptbuilder
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Price is what a model charges for a million input tokens, in dollars.
+// It is set with "price=model=dollars".
+type Price struct {
+	Model      string
+	PerMillion float64
+}
+
+// Cost is the estimated price of sending the prompt to a model.
+type Cost struct {
+	Model      string
+	Tokens     int // tokens of the prompt for the model's tokenizer
+	PerMillion float64
+	Dollars    float64
+}
+
+// modelPrice is a known price, with the model family whose tokenizer
+// approximates the model's.
+type modelPrice struct {
+	family     string
+	perMillion float64
+}
+
+// defaultPrices are the list prices of input tokens when this table was
+// last updated. Prices change; "price=model=dollars" overrides them and
+// adds other models.
+var defaultPrices = map[string]modelPrice{
+	"gpt-4o":           {"gpt-4o", 2.50},
+	"gpt-4o-mini":      {"gpt-4o", 0.15},
+	"gpt-4.1":          {"gpt-4o", 2.00},
+	"gpt-4.1-mini":     {"gpt-4o", 0.40},
+	"gpt-4.1-nano":     {"gpt-4o", 0.10},
+	"gpt-5":            {"gpt-4o", 1.25},
+	"gpt-5-mini":       {"gpt-4o", 0.25},
+	"o3":               {"gpt-4o", 2.00},
+	"o4-mini":          {"gpt-4o", 1.10},
+	"gpt-4-turbo":      {"gpt-4", 10.00},
+	"claude-opus":      {"claude", 15.00},
+	"claude-sonnet":    {"claude", 3.00},
+	"claude-haiku":     {"claude", 1.00},
+	"gemini-2.5-pro":   {"gpt-4o", 1.25},
+	"gemini-2.5-flash": {"gpt-4o", 0.30},
+}
+
+// PricedModels returns the models with a built-in price.
+func PricedModels() []string {
+	models := make([]string, 0, len(defaultPrices))
+	for model := range defaultPrices {
+		models = append(models, model)
+	}
+	sort.Strings(models)
+	return models
+}
+
+func parsePrice(value string) (Price, error) {
+	model, dollars, ok := strings.Cut(value, "=")
+	model = strings.ToLower(strings.TrimSpace(model))
+	if !ok || model == "" {
+		return Price{}, fmt.Errorf("use model=dollars")
+	}
+	perMillion, err := strconv.ParseFloat(strings.TrimPrefix(strings.TrimSpace(dollars), "$"), 64)
+	if err != nil || perMillion < 0 {
+		return Price{}, fmt.Errorf("the price must be a number of dollars per million tokens")
+	}
+	return Price{Model: model, PerMillion: perMillion}, nil
+}
+
+// price returns the price of model: the last "price" directive for it, or
+// the built-in one.
+func (c *Config) price(model string) (modelPrice, bool) {
+	for i := len(c.Prices) - 1; i >= 0; i-- {
+		if c.Prices[i].Model == model {
+			return modelPrice{family: tokenFamily(model), perMillion: c.Prices[i].PerMillion}, true
+		}
+	}
+	price, ok := defaultPrices[model]
+	return price, ok
+}
+
+// tokenFamily guesses the model family whose tokenizer approximates a
+// model without a built-in price, or "" when the name does not tell.
+func tokenFamily(model string) string {
+	if price, ok := defaultPrices[model]; ok {
+		return price.family
+	}
+	if _, ok := tokenizers[model]; ok {
+		return model
+	}
+	for _, prefix := range []string{"gpt-4o", "gpt-4.1", "gpt-5", "o1", "o3", "o4"} {
+		if strings.HasPrefix(model, prefix) {
+			return "gpt-4o"
+		}
+	}
+	for _, family := range []string{"gpt-4", "claude", "llama"} {
+		if strings.HasPrefix(model, family) {
+			return family
+		}
+	}
+	return ""
+}
+
+// costs estimates what sending a prompt of the given tokens costs with
+// each model of the costModels setting. The tokens were counted for the
+// model family of the build, and are converted to the family of each
+// model by their average characters per token.
+func (b *Builder) costs(tokens int) []Cost {
+	var costs []Cost
+	for _, model := range b.config.CostModels {
+		price, ok := b.config.price(model)
+		if !ok {
+			continue
+		}
+		modelTokens := tokens
+		if family, ok := tokenizers[price.family]; ok && family.name != b.tok.name {
+			modelTokens = int(math.Round(float64(tokens) * b.tok.charsPerToken / family.charsPerToken))
+		}
+		costs = append(costs, Cost{
+			Model:      model,
+			Tokens:     modelTokens,
+			PerMillion: price.perMillion,
+			Dollars:    float64(modelTokens) * price.perMillion / 1e6,
+		})
+	}
+	return costs
+}
+
+// FormatDollars formats an amount with enough decimals to tell small
+// prompts apart: $0.0123, $1.23.
+func FormatDollars(dollars float64) string {
+	if dollars >= 1 {
+		return fmt.Sprintf("$%.2f", dollars)
+	}
+	return fmt.Sprintf("$%.4f", dollars)
+}
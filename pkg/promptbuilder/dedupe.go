@@ -0,0 +1,156 @@
+package promptbuilder
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/bits"
+	"strings"
+)
+
+// DefaultNearDuplicates is the similarity used by "nearduplicates=true".
+const DefaultNearDuplicates = 0.95
+
+// dedupeSections replaces every file whose content is identical to a file
+// earlier in the output with a reference to that file, as with copied
+// fixtures and vendored duplicates. Files are only replaced when the
+// reference is shorter than the content.
+func (b *Builder) dedupeSections(sections []fileSection) []fileSection {
+	first := make(map[string]string, len(sections))
+	var count, saved int
+	for i, section := range sections {
+		original, ok := first[section.Hash]
+		if !ok {
+			first[section.Hash] = section.Path
+			continue
+		}
+		duplicate := b.duplicateSection(section, original, "")
+		if duplicate.Tokens >= section.Tokens {
+			continue
+		}
+		b.debugf("%s is identical to %s", section.Path, original)
+		count++
+		saved += section.Tokens - duplicate.Tokens
+		duplicate.Content, duplicate.Text = "", ""
+		sections[i] = duplicate
+	}
+	if count > 0 {
+		b.infof("Replaced %d duplicate files with a reference, saving %d estimated tokens", count, saved)
+	}
+	return sections
+}
+
+// collapseNearDuplicates replaces every file that is at least
+// nearDuplicates similar to a file earlier in the output with a diff
+// against it, as with golden files of a test suite. Candidates are found
+// by the simhash of their lines, then compared line by line. Files are
+// only replaced when the diff is shorter than the content.
+func (b *Builder) collapseNearDuplicates(sections []fileSection) ([]fileSection, error) {
+	threshold := b.config.NearDuplicates
+	maxDistance := int(math.Ceil(2 * 64 * math.Acos(threshold) / math.Pi))
+
+	var representatives []int
+	var count, saved int
+	for i, section := range sections {
+		if section.SameAs != "" || section.Size == 0 {
+			continue
+		}
+
+		collapsed := false
+		for _, r := range representatives {
+			if bits.OnesCount64(sections[r].Simhash^section.Simhash) > maxDistance {
+				continue
+			}
+			original, err := b.reload(sections[r])
+			if err != nil {
+				return nil, err
+			}
+			current, err := b.reload(section)
+			if err != nil {
+				return nil, err
+			}
+			if similarity(original.Content, current.Content) < threshold {
+				continue
+			}
+
+			diff := UnifiedDiff(original.Path, section.Path, original.Content, current.Content)
+			near := b.duplicateSection(section, original.Path, diff)
+			if near.Tokens >= section.Tokens {
+				continue
+			}
+			b.debugf("%s is similar to %s", section.Path, original.Path)
+			count++
+			saved += section.Tokens - near.Tokens
+			near.Content, near.Text = "", ""
+			sections[i] = near
+			collapsed = true
+			break
+		}
+		if !collapsed {
+			representatives = append(representatives, i)
+		}
+	}
+	if count > 0 {
+		b.infof("Replaced %d near-duplicate files with a diff, saving %d estimated tokens", count, saved)
+	}
+	return sections, nil
+}
+
+// duplicateSection returns section with its content replaced by a
+// reference to the file original, followed by the diff from original to
+// the file when they are only similar.
+func (b *Builder) duplicateSection(section fileSection, original string, diff string) fileSection {
+	content := fmt.Sprintf("[identical to %s]", original)
+	if diff != "" {
+		content = fmt.Sprintf("[differs from %s only by this diff]\n%s", original, strings.TrimSuffix(diff, "\n"))
+	}
+	text := b.renderer.renderFile(section.Path, content)
+	duplicate := newFileSection(section.File, section.Path, content, text, b.tok.countTokens(text))
+	duplicate.Hash = section.Hash
+	duplicate.Heading = section.Heading
+	duplicate.SameAs = original
+	duplicate.Diff = diff
+	return duplicate
+}
+
+// simhash fingerprints content by its lines, so that files sharing most
+// of their lines have fingerprints that differ in few bits.
+func simhash(content string) uint64 {
+	var weights [64]int
+	for _, line := range splitLines(content) {
+		h := fnv.New64a()
+		h.Write([]byte(strings.TrimSpace(line)))
+		sum := h.Sum64()
+		for bit := range weights {
+			if sum&(1<<bit) != 0 {
+				weights[bit]++
+			} else {
+				weights[bit]--
+			}
+		}
+	}
+
+	var fingerprint uint64
+	for bit, weight := range weights {
+		if weight > 0 {
+			fingerprint |= 1 << bit
+		}
+	}
+	return fingerprint
+}
+
+// similarity returns the share of the lines of a and b that they have in
+// common, from 0 to 1.
+func similarity(a string, b string) float64 {
+	linesA, linesB := splitLines(a), splitLines(b)
+	if len(linesA)+len(linesB) == 0 {
+		return 1
+	}
+	same := 0
+	for _, op := range diffLines(linesA, linesB) {
+		if op.kind == ' ' {
+			same++
+		}
+	}
+	return 2 * float64(same) / float64(len(linesA)+len(linesB))
+}
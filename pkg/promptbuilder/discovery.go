@@ -0,0 +1,871 @@
+package promptbuilder
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// defaultBinarySampleSize is the number of bytes read from the start of
+// a file to tell whether it is binary, unless binarySampleSize is set.
+const defaultBinarySampleSize = 512
+
+func isBinaryFile(src sourceFS, path string, sampleSize int64) (bool, error) {
+	file, err := src.open(path)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	if sampleSize <= 0 {
+		sampleSize = defaultBinarySampleSize
+	}
+	buf := make([]byte, sampleSize)
+	n, err := io.ReadFull(file, buf)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return false, err
+	}
+	return isBinary(buf[:n]), nil
+}
+
+// binaryRule reports whether the configuration decides that a file is
+// binary, without looking at its content: forceInclude and textExtension
+// files are text, and binaryExtension files are binary. known is false
+// when no rule applies.
+func binaryRule(path string, config *Config) (binary bool, known bool) {
+	switch {
+	case isReincluded(path, config.BaseDir, config.ForceIncludes, config.IgnoreCase):
+		return false, true
+	case isExcludedExtension(path, config.TextExtensions, config.IgnoreCase):
+		return false, true
+	case isExcludedExtension(path, config.BinaryExtensions, config.IgnoreCase):
+		return true, true
+	}
+	return false, false
+}
+
+// isBinary reports whether a sample of the start of a file is binary data.
+// UTF-16 and legacy 8-bit encodings count as text, which decodeText
+// converts.
+func isBinary(sample []byte) bool {
+	if _, _, ok := detectUTF16(sample); ok {
+		return false
+	}
+	if bytes.IndexByte(sample, 0) != -1 {
+		return true
+	}
+
+	// The sample may end in the middle of a character
+	valid := sample
+	for i := len(valid) - 1; i >= 0 && i >= len(valid)-3; i-- {
+		if utf8.RuneStart(valid[i]) {
+			if !utf8.FullRune(valid[i:]) {
+				valid = valid[:i]
+			}
+			break
+		}
+	}
+	if utf8.Valid(valid) {
+		return false
+	}
+
+	// Legacy encodings use the bytes above 0x7F for letters, while binary
+	// data is full of control characters
+	controls := 0
+	for _, c := range sample {
+		if c < 0x20 && c != '\t' && c != '\n' && c != '\r' && c != '\f' && c != 0x1b {
+			controls++
+		}
+	}
+	return controls*20 > len(sample)
+}
+
+func isExcludedFolder(path string, baseDir string, excludeFolders []string, ignoreCase bool) bool {
+	relPath, err := filepath.Rel(baseDir, path)
+	if err != nil {
+		return false
+	}
+	relPath = foldCase(filepath.ToSlash(relPath), ignoreCase)
+	name := foldCase(filepath.Base(path), ignoreCase)
+
+	for _, folder := range excludeFolders {
+		folder = foldCase(folder, ignoreCase)
+		if hasGlobMeta(folder) {
+			if matchesGlobRule(folder, relPath) {
+				return true
+			}
+			continue
+		}
+		rule := strings.TrimSuffix(filepath.ToSlash(folder), "/")
+		if strings.Contains(rule, "/") {
+			// A path relative to basedir excludes that folder only, and
+			// everything below it
+			rule = strings.TrimPrefix(strings.TrimPrefix(rule, "./"), "/")
+			if relPath == rule || strings.HasPrefix(relPath, rule+"/") {
+				return true
+			}
+			continue
+		}
+		if name == rule {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesGlobRule matches a glob rule against a path relative to basedir.
+// Rules without a slash are matched against the base name only, so
+// "test*" behaves like "**/test*".
+func matchesGlobRule(rule string, relPath string) bool {
+	rule = filepath.ToSlash(rule)
+	if !strings.Contains(rule, "/") {
+		rule = "**/" + rule
+	}
+	return matchGlob(rule, relPath)
+}
+
+func isExcludedExtension(path string, excludeExtensions []string, ignoreCase bool) bool {
+	ext := foldCase(filepath.Ext(path), ignoreCase)
+	if ext == "" {
+		return false
+	}
+
+	for _, pattern := range excludeExtensions {
+		if foldCase(pattern, ignoreCase) == "*"+ext {
+			return true
+		}
+	}
+	return false
+}
+
+func isIncludedExtension(path string, includeExtensions []string, ignoreCase bool) bool {
+	if len(includeExtensions) == 0 {
+		return true
+	}
+
+	ext := foldCase(filepath.Ext(path), ignoreCase)
+	if ext == "" {
+		return false
+	}
+
+	for _, pattern := range includeExtensions {
+		if foldCase(pattern, ignoreCase) == "*"+ext {
+			return true
+		}
+	}
+	return false
+}
+
+func isExcludedFile(path string, baseDir string, excludeFiles []string, ignoreCase bool) bool {
+	// Get the relative path from baseDir
+	relPath, err := filepath.Rel(baseDir, path)
+	if err != nil {
+		return false
+	}
+
+	// Convert to forward slashes for consistency
+	relPath = foldCase(filepath.ToSlash(relPath), ignoreCase)
+	name := foldCase(filepath.Base(path), ignoreCase)
+
+	for _, excludeFile := range excludeFiles {
+		// Convert exclude pattern to forward slashes
+		excludePattern := foldCase(filepath.ToSlash(excludeFile), ignoreCase)
+
+		if hasGlobMeta(excludePattern) {
+			if matchesGlobRule(excludePattern, relPath) {
+				return true
+			}
+			continue
+		}
+
+		// Try both exact match and filename-only match
+		if relPath == excludePattern || name == excludePattern {
+			return true
+		}
+	}
+	return false
+}
+
+// isExcludedPattern reports whether the path relative to baseDir, with
+// forward slashes, matches one of the patterns.
+func isExcludedPattern(path string, baseDir string, patterns []*regexp.Regexp) bool {
+	if len(patterns) == 0 {
+		return false
+	}
+
+	relPath, err := filepath.Rel(baseDir, path)
+	if err != nil {
+		return false
+	}
+	relPath = filepath.ToSlash(relPath)
+
+	for _, pattern := range patterns {
+		if pattern.MatchString(relPath) {
+			return true
+		}
+	}
+	return false
+}
+
+// isExcluded reports whether a file is excluded by the folder, extension,
+// file or pattern rules, and not re-included by a "!" rule.
+func isExcluded(path string, config *Config, inExcludedFolder bool) bool {
+	return excludeReason(path, config, inExcludedFolder) != ""
+}
+
+// excludeReason returns the rule that excludes a file, or "" when it is
+// not excluded.
+func excludeReason(path string, config *Config, inExcludedFolder bool) string {
+	var reason string
+	switch {
+	case inExcludedFolder:
+		reason = "excludeFolder"
+	case isExcludedExtension(path, config.ExcludeExtensions, config.IgnoreCase):
+		reason = "excludeExtension"
+	case isExcludedFile(path, config.BaseDir, config.ExcludeFiles, config.IgnoreCase):
+		reason = "excludeFile"
+	case isExcludedPattern(path, config.BaseDir, config.ExcludePatterns):
+		reason = "excludePattern"
+	case config.SkipGenerated && generatedName(path) != "":
+		reason = "generated"
+	}
+	if reason != "" && (isReincluded(path, config.BaseDir, config.ReincludeFiles, config.IgnoreCase) || isReincluded(path, config.BaseDir, config.ForceIncludes, config.IgnoreCase)) {
+		return ""
+	}
+	return reason
+}
+
+// isReincluded matches "!" rules the same way excludeFile rules are
+// matched: by relative path, by name, or as a glob.
+func isReincluded(path string, baseDir string, rules []string, ignoreCase bool) bool {
+	return len(rules) > 0 && isExcludedFile(path, baseDir, rules, ignoreCase)
+}
+
+// mayReinclude reports whether a "!" rule could match something below the
+// excluded directory dir, in which case the walk has to descend into it.
+func mayReinclude(dir string, config *Config) bool {
+	relDir, err := filepath.Rel(config.BaseDir, dir)
+	if err != nil {
+		return false
+	}
+	relDir = foldCase(filepath.ToSlash(relDir), config.IgnoreCase)
+
+	for _, rule := range concat(concat(config.ReincludeFiles, config.ReincludeFolders), config.ForceIncludes) {
+		rule = foldCase(filepath.ToSlash(rule), config.IgnoreCase)
+		if !strings.Contains(rule, "/") {
+			// Rules without a slash match at any depth
+			return true
+		}
+		base := globBase(rule)
+		if base == "" || base == relDir || strings.HasPrefix(base, relDir+"/") || strings.HasPrefix(relDir, base+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// collectFiles walks path in src and returns the files that pass the
+// rules of config, relative to path. maxDepth, if not 0, limits the walk
+// to that many levels of folders: 1 only takes the files directly in
+// path. skip, if not nil, is called with every file or folder left out
+// and the reason.
+func collectFiles(ctx context.Context, src sourceFS, path string, config *Config, maxDepth int, skip func(path string, reason string)) ([]string, error) {
+	var files []string
+	excludedDirs := make(map[string]bool)
+	if skip == nil {
+		skip = func(string, string) {}
+	}
+	relPath := func(p string) string {
+		rel, err := filepath.Rel(config.BaseDir, p)
+		if err != nil {
+			return p
+		}
+		return filepath.ToSlash(rel)
+	}
+
+	var gitignore, promptignore *ignoreMatcher
+	if config.UseGitignore {
+		gitignore = newIgnoreMatcher(src, config.BaseDir, ".gitignore")
+		if err := gitignore.loadParents(filepath.Dir(path)); err != nil {
+			return nil, err
+		}
+	}
+	if config.UsePromptignore {
+		promptignore = newIgnoreMatcher(src, config.BaseDir, PromptignoreFile)
+		if err := promptignore.loadParents(filepath.Dir(path)); err != nil {
+			return nil, err
+		}
+	}
+
+	// Real paths of the walked folder and of the symlinked folders being
+	// walked, which links must not lead back into
+	var followed []string
+	if config.FollowSymlinks {
+		if real, err := src.realPath(path); err == nil {
+			followed = append(followed, real)
+		}
+	}
+
+	var visit func(currentPath string, entry fs.DirEntry, err error) error
+	visit = func(currentPath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		// Dotfiles are left out unless asked for, and .env files unless
+		// named by an include. The walked folder itself was named by one
+		if currentPath != path {
+			if reason := hiddenReason(entry.Name(), entry.IsDir(), config); reason != "" {
+				skip(relPath(currentPath), reason)
+				if entry.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+		}
+
+		// Continue with the target of a symlink, as if it were here
+		symlink := entry.Type()&fs.ModeSymlink != 0
+		if symlink {
+			if !config.FollowSymlinks {
+				skip(relPath(currentPath), "symlink")
+				return nil
+			}
+			target, reason := followSymlink(src, currentPath, followed)
+			if reason != "" {
+				skip(relPath(currentPath), reason)
+				return nil
+			}
+			entry = fs.FileInfoToDirEntry(target)
+		}
+
+		// Stop at the depth limit of the include
+		if maxDepth > 0 && entry.IsDir() && currentPath != path {
+			rel, err := filepath.Rel(path, currentPath)
+			if err != nil {
+				return err
+			}
+			if strings.Count(filepath.ToSlash(rel), "/")+1 >= maxDepth {
+				skip(relPath(currentPath), "maxDepth")
+				return filepath.SkipDir
+			}
+		}
+
+		// Skip excluded folders, unless a "!" rule may re-include something
+		// below them
+		if entry.IsDir() {
+			excluded := excludedDirs[filepath.Dir(currentPath)] ||
+				isExcludedFolder(currentPath, config.BaseDir, config.ExcludeFolders, config.IgnoreCase)
+			if excluded && isReincluded(currentPath, config.BaseDir, config.ReincludeFolders, config.IgnoreCase) {
+				excluded = false
+			}
+			if excluded && !mayReinclude(currentPath, config) {
+				skip(relPath(currentPath), "excludeFolder")
+				return filepath.SkipDir
+			}
+			excludedDirs[currentPath] = excluded
+		}
+
+		// Skip paths ignored by git or by .promptignore files
+		if gitignore != nil && entry.IsDir() && entry.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		for _, ignore := range []struct {
+			matcher *ignoreMatcher
+			reason  string
+		}{{gitignore, "gitignore"}, {promptignore, "promptignore"}} {
+			if ignore.matcher == nil {
+				continue
+			}
+			rel, err := filepath.Rel(config.BaseDir, currentPath)
+			if err != nil {
+				return err
+			}
+			if currentPath != path && ignore.matcher.isIgnored(filepath.ToSlash(rel), entry.IsDir()) {
+				skip(filepath.ToSlash(rel), ignore.reason)
+				if entry.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if entry.IsDir() {
+				if err := ignore.matcher.loadDir(currentPath); err != nil {
+					return err
+				}
+			}
+		}
+
+		// Skip directories, excluded extensions, and excluded files
+		if entry.IsDir() {
+			if symlink {
+				real, err := src.realPath(currentPath)
+				if err != nil {
+					return err
+				}
+				followed = append(followed, real)
+				err = src.walk(currentPath, visit)
+				followed = followed[:len(followed)-1]
+				return err
+			}
+			return nil
+		}
+		if !isIncludedExtension(currentPath, config.IncludeExtensions, config.IgnoreCase) {
+			skip(relPath(currentPath), "includeExtension")
+			return nil
+		}
+		if reason := excludeReason(currentPath, config, excludedDirs[filepath.Dir(currentPath)]); reason != "" {
+			skip(relPath(currentPath), reason)
+			return nil
+		}
+		rel, err := filepath.Rel(path, currentPath)
+		if err != nil {
+			return err
+		}
+		files = append(files, rel)
+
+		return nil
+	}
+
+	if err := src.walk(path, visit); err != nil {
+		return nil, err
+	}
+
+	return files, nil
+}
+
+// hiddenReason returns why a file or folder found in an included folder
+// is left out for its name: "envFile" for .env files, which hold secrets,
+// and "hidden" for other names starting with a dot, unless IncludeHidden
+// is set.
+func hiddenReason(name string, isDir bool, config *Config) string {
+	if !isDir && isEnvFile(name) {
+		return "envFile"
+	}
+	if strings.HasPrefix(name, ".") && !config.IncludeHidden {
+		return "hidden"
+	}
+	return ""
+}
+
+// isEnvFile reports whether name is a dotenv file, such as .env,
+// .env.production, prod.env or .envrc.
+func isEnvFile(name string) bool {
+	return name == ".env" || name == ".envrc" || strings.HasPrefix(name, ".env.") || strings.HasSuffix(name, ".env")
+}
+
+// followSymlink returns what the symlink at path points to, or the reason
+// it is left out: "symlink" for a broken link, and "symlinkCycle" for a
+// link to a folder that contains the link or one of the followed folders,
+// which would be walked forever.
+func followSymlink(src sourceFS, path string, followed []string) (fs.FileInfo, string) {
+	target, err := src.stat(path)
+	if err != nil {
+		return nil, "symlink"
+	}
+	if !target.IsDir() {
+		return target, ""
+	}
+
+	real, err := src.realPath(path)
+	if err != nil {
+		return nil, "symlink"
+	}
+	parent, err := src.realPath(filepath.Dir(path))
+	if err != nil {
+		return nil, "symlink"
+	}
+	for _, dir := range append(followed, parent) {
+		if dir == real || strings.HasPrefix(dir, real+string(filepath.Separator)) {
+			return nil, "symlinkCycle"
+		}
+	}
+	return target, ""
+}
+
+// collectGlobFiles walks the static prefix of a glob include and returns
+// the files, relative to basedir, whose path matches the pattern. maxDepth
+// counts the levels of folders below the static prefix.
+func collectGlobFiles(ctx context.Context, src sourceFS, pattern string, config *Config, maxDepth int, skip func(path string, reason string)) ([]string, error) {
+	pattern = filepath.ToSlash(pattern)
+	base := filepath.FromSlash(globBase(pattern))
+	if config.IgnoreCase {
+		base = resolveCase(src, config.BaseDir, base)
+	}
+	root := filepath.Join(config.BaseDir, base)
+	if _, err := src.stat(root); errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+
+	// Only report what the pattern would have matched
+	matchingSkip := func(path string, reason string) {
+		if skip != nil && matchGlob(foldCase(pattern, config.IgnoreCase), foldCase(path, config.IgnoreCase)) {
+			skip(path, reason)
+		}
+	}
+	files, err := collectFiles(ctx, src, root, config, maxDepth, matchingSkip)
+	if err != nil {
+		return nil, err
+	}
+
+	var matched []string
+	for _, f := range files {
+		relPath, err := filepath.Rel(config.BaseDir, filepath.Join(root, f))
+		if err != nil {
+			return nil, err
+		}
+		if matchGlob(foldCase(pattern, config.IgnoreCase), foldCase(filepath.ToSlash(relPath), config.IgnoreCase)) {
+			matched = append(matched, relPath)
+		}
+	}
+
+	return matched, nil
+}
+
+// resolveCase returns rel, a path relative to baseDir, with every segment
+// that does not exist replaced by an entry whose name only differs in
+// case, if there is one.
+func resolveCase(src sourceFS, baseDir string, rel string) string {
+	if rel == "" {
+		return rel
+	}
+	dir := baseDir
+	var resolved []string
+	for _, name := range strings.Split(filepath.ToSlash(rel), "/") {
+		if _, err := src.stat(filepath.Join(dir, name)); err != nil {
+			entries, _ := src.readDir(dir)
+			for _, entry := range entries {
+				if strings.EqualFold(entry.Name(), name) {
+					name = entry.Name()
+					break
+				}
+			}
+		}
+		dir = filepath.Join(dir, name)
+		resolved = append(resolved, name)
+	}
+	return filepath.Join(resolved...)
+}
+
+// includeRoot splits an include path that points outside basedir, given
+// as an absolute path or through "..", into the directory its files are
+// collected from and the path relative to it: the directory itself, the
+// folder of a file, or the fixed part of a glob. outside is false for
+// paths within basedir.
+func includeRoot(src sourceFS, baseDir string, includePath string) (root string, rel string, outside bool) {
+	fullPath := includePath
+	if !filepath.IsAbs(fullPath) {
+		fullPath = filepath.Join(baseDir, fullPath)
+	}
+	fullPath, err := filepath.Abs(fullPath)
+	if err != nil {
+		return "", "", false
+	}
+	if !isOutside(baseDir, fullPath) {
+		return "", "", false
+	}
+
+	if hasGlobMeta(fullPath) {
+		root = fullPath
+		for hasGlobMeta(root) {
+			root = filepath.Dir(root)
+		}
+	} else if info, err := src.stat(fullPath); err != nil || info.IsDir() {
+		root = fullPath
+	} else {
+		root = filepath.Dir(fullPath)
+	}
+	rel, err = filepath.Rel(root, fullPath)
+	if err != nil {
+		return "", "", false
+	}
+	return root, rel, true
+}
+
+// isOutside reports whether path lies outside the directory dir.
+func isOutside(dir string, path string) bool {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return false
+	}
+	rel, err := filepath.Rel(dir, path)
+	return err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// relativeTo returns path relative to dir, or path itself when it cannot
+// be expressed that way.
+func relativeTo(dir string, path string) string {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return path
+	}
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return path
+	}
+	return rel
+}
+
+// findFiles resolves the includes of the configuration into the list of
+// files to emit, relative to basedir.
+func (b *Builder) findFiles(ctx context.Context) ([]SourceFile, error) {
+	config := b.config
+	var allFiles []SourceFile
+	b.skipped = nil
+
+	for i := range b.config.Includes {
+		include := &b.config.Includes[i]
+		if isURL(include.Path) {
+			// Fetched by prepare
+			continue
+		}
+		includePath := include.Path
+		config := b.config.forInclude(include)
+
+		// An include outside basedir is collected from its own directory,
+		// which takes the place of basedir for the exclude rules and
+		// .gitignore, and its files are then made relative to basedir
+		toBase := func(path string) string { return path }
+		skip := b.skip
+		if filepath.IsAbs(includePath) {
+			includePath = relativeTo(config.BaseDir, includePath)
+		}
+		if root, rel, outside := includeRoot(b.src, config.BaseDir, includePath); outside {
+			rooted := *config
+			rooted.BaseDir = root
+			config = &rooted
+			includePath = rel
+			toBase = func(path string) string {
+				return relativeTo(b.config.BaseDir, filepath.Join(root, path))
+			}
+			skip = func(path string, reason string) {
+				b.skip(filepath.ToSlash(toBase(path)), reason)
+			}
+		}
+
+		if hasGlobMeta(includePath) {
+			files, err := collectGlobFiles(ctx, b.src, includePath, config, include.MaxDepth, skip)
+			if err != nil {
+				return nil, fmt.Errorf("error collecting files from %s: %v", include.Path, err)
+			}
+			if len(files) == 0 {
+				if err := b.warn("No files match pattern %s", include.Path); err != nil {
+					return nil, err
+				}
+			}
+			for _, f := range files {
+				allFiles = append(allFiles, SourceFile{RelPath: toBase(f), Include: include})
+			}
+			continue
+		}
+
+		if config.IgnoreCase {
+			includePath = resolveCase(b.src, config.BaseDir, includePath)
+		}
+		fullPath := filepath.Join(config.BaseDir, includePath)
+		fileInfo, err := b.src.stat(fullPath)
+		if err != nil {
+			b.skip(filepath.ToSlash(include.Path), "not found")
+			if err := b.warn("Cannot access path %s: %v", include.Path, err); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if fileInfo.IsDir() {
+			// If it's a directory, collect all files recursively
+			files, err := collectFiles(ctx, b.src, fullPath, config, include.MaxDepth, skip)
+			if err != nil {
+				return nil, fmt.Errorf("error collecting files from %s: %v", include.Path, err)
+			}
+
+			// Add directory prefix to found files
+			for _, f := range files {
+				allFiles = append(allFiles, SourceFile{RelPath: toBase(filepath.Join(includePath, f)), Include: include})
+			}
+		} else {
+			// If it's a file and not excluded
+			if !isIncludedExtension(fullPath, config.IncludeExtensions, config.IgnoreCase) {
+				skip(filepath.ToSlash(includePath), "includeExtension")
+			} else if reason := excludeReason(fullPath, config, false); reason != "" {
+				skip(filepath.ToSlash(includePath), reason)
+			} else {
+				allFiles = append(allFiles, SourceFile{RelPath: toBase(includePath), Include: include})
+			}
+		}
+	}
+
+	skippedBy := make(map[string]int)
+	for _, skipped := range b.skipped {
+		skippedBy[skipped.Reason]++
+	}
+	if n := skippedBy["symlink"]; n > 0 && !config.FollowSymlinks {
+		b.infof("Skipped %d symlinks, set followSymlinks=true to follow them", n)
+	} else if n > 0 {
+		b.infof("Skipped %d broken symlinks", n)
+	}
+	if n := skippedBy["symlinkCycle"]; n > 0 {
+		b.infof("Skipped %d symlinks to a folder containing them", n)
+	}
+	if n := skippedBy["envFile"]; n > 0 {
+		b.infof("Skipped %d .env files, which are only included when named by an include", n)
+	}
+	if n := skippedBy["generated"]; n > 0 {
+		b.infof("Skipped %d lockfiles, source maps and minified files", n)
+	}
+	if n := skippedBy["hidden"]; n > 0 {
+		b.debugf("Skipped %d hidden files and folders, set includeHidden=true to include them", n)
+	}
+
+	allFiles = dedupeFiles(allFiles)
+
+	if config.ExcludeLargerThan > 0 {
+		allFiles = b.excludeLargeFiles(allFiles)
+	}
+
+	// Never include the cache or the history themselves
+	if config.Cache != "" {
+		allFiles = excludeDir(allFiles, config.BaseDir, b.cacheDir())
+	}
+	if config.History != "" {
+		allFiles = excludeDir(allFiles, config.BaseDir, config.HistoryDir())
+	}
+
+	if config.Changed != "" {
+		changed, err := changedFiles(ctx, config.gitDir(), config.Changed, config.gitHead())
+		if err != nil {
+			return nil, fmt.Errorf("error listing changed files: %v", err)
+		}
+
+		var kept []SourceFile
+		for _, file := range allFiles {
+			if changed[filepath.Clean(file.RelPath)] {
+				kept = append(kept, file)
+			} else {
+				b.skip(filepath.ToSlash(file.RelPath), "unchanged")
+			}
+		}
+		allFiles = kept
+	}
+
+	if config.FollowImports {
+		allFiles = b.followImports(allFiles)
+	}
+
+	if err := b.checkLimits(allFiles); err != nil {
+		return nil, err
+	}
+
+	return allFiles, nil
+}
+
+// checkLimits warns, or fails in strict mode, when discovery found more
+// files than maxfiles or more bytes than maxtotalsize, which usually
+// means that an exclude rule is missing or mistyped. The largest files
+// are listed to help find it.
+func (b *Builder) checkLimits(files []SourceFile) error {
+	config := b.config
+	if config.MaxFiles > 0 && len(files) > config.MaxFiles {
+		if err := b.warn("Found %d files, more than maxFiles=%d; check the include and exclude rules", len(files), config.MaxFiles); err != nil {
+			return err
+		}
+	}
+	if config.MaxTotalSize <= 0 {
+		return nil
+	}
+
+	var total int64
+	sizes := make([]int64, len(files))
+	for i, file := range files {
+		if info, err := b.src.stat(filepath.Join(config.BaseDir, file.RelPath)); err == nil {
+			sizes[i] = info.Size()
+			total += info.Size()
+		}
+	}
+	if total <= config.MaxTotalSize {
+		return nil
+	}
+
+	largest := make([]int, len(files))
+	for i := range largest {
+		largest[i] = i
+	}
+	sort.SliceStable(largest, func(i, j int) bool {
+		return sizes[largest[i]] > sizes[largest[j]]
+	})
+	var message strings.Builder
+	fmt.Fprintf(&message, "The %d files found take %s, more than maxTotalSize=%s; check the include and exclude rules. The largest are:",
+		len(files), formatSize(total), formatSize(config.MaxTotalSize))
+	for _, i := range largest[:min(5, len(largest))] {
+		fmt.Fprintf(&message, "\n  %10s  %s", formatSize(sizes[i]), files[i].RelPath)
+	}
+	return b.warn("%s", message.String())
+}
+
+// dedupeFiles drops repeated files. A file matched by several includes
+// keeps its first position but takes the options of the last include, so
+// "include=. (mode=outline)" followed by "include=src/core" shows
+// src/core in full.
+func dedupeFiles(files []SourceFile) []SourceFile {
+	index := make(map[string]int, len(files))
+	var unique []SourceFile
+	for _, file := range files {
+		relPath := filepath.Clean(file.RelPath)
+		if i, ok := index[relPath]; ok {
+			unique[i].Include = file.Include
+			continue
+		}
+		index[relPath] = len(unique)
+		unique = append(unique, file)
+	}
+	return unique
+}
+
+// excludeLargeFiles drops the files larger than excludelargerthan and lists
+// them with their sizes.
+func (b *Builder) excludeLargeFiles(files []SourceFile) []SourceFile {
+	var kept, skipped []SourceFile
+	var sizes []int64
+	for _, file := range files {
+		info, err := b.src.stat(filepath.Join(b.config.BaseDir, file.RelPath))
+		if err == nil && info.Size() > b.config.ExcludeLargerThan {
+			skipped = append(skipped, file)
+			sizes = append(sizes, info.Size())
+			b.skip(filepath.ToSlash(file.RelPath), "excludeLargerThan")
+			continue
+		}
+		kept = append(kept, file)
+	}
+
+	if len(skipped) > 0 {
+		var message strings.Builder
+		fmt.Fprintf(&message, "Skipping %d files larger than %s:", len(skipped), formatSize(b.config.ExcludeLargerThan))
+		for i, file := range skipped {
+			fmt.Fprintf(&message, "\n  %10s  %s", formatSize(sizes[i]), file.RelPath)
+		}
+		b.warnf("%s", message.String())
+	}
+	return kept
+}
+
+// excludeDir drops the files that lie inside dir.
+func excludeDir(files []SourceFile, baseDir string, dir string) []SourceFile {
+	var kept []SourceFile
+	for _, file := range files {
+		rel, err := filepath.Rel(dir, filepath.Join(baseDir, file.RelPath))
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			kept = append(kept, file)
+		}
+	}
+	return kept
+}
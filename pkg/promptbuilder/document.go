@@ -0,0 +1,189 @@
+package promptbuilder
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// isDocument reports whether the text of a file is extracted by
+// extractDocument instead of the file being skipped as binary.
+func isDocument(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".pdf", ".docx":
+		return true
+	}
+	return false
+}
+
+// extractDocument returns the text of a PDF or Word document.
+func extractDocument(path string, content []byte) (string, error) {
+	if strings.EqualFold(filepath.Ext(path), ".pdf") {
+		return extractPDF(content)
+	}
+	return extractDOCX(content)
+}
+
+// extractDOCX returns the text of a Word document as markdown: headings
+// get their level of #, list items a dash and tables become markdown
+// tables. Headers, footers, comments and deleted changes are left out.
+func extractDOCX(content []byte) (string, error) {
+	archive, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		return "", err
+	}
+	f, err := archive.Open("word/document.xml")
+	if err != nil {
+		return "", errors.New("no word/document.xml, not a Word document")
+	}
+	defer f.Close()
+
+	var (
+		out      strings.Builder
+		para     strings.Builder // text of the current paragraph
+		prefix   string          // "# " for headings, "- " for list items
+		inRun    bool
+		inText   bool
+		lastList bool // the last paragraph written was a list item
+		cell     strings.Builder
+		row      []string // cells of the current table row
+		cells    int      // depth of table cells, > 0 inside a table
+		rows     int      // rows written of the current table
+	)
+	separate := func(sep string) {
+		if out.Len() > 0 {
+			out.WriteString(sep)
+		}
+	}
+
+	decoder := xml.NewDecoder(f)
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "p":
+				para.Reset()
+				prefix = ""
+			case "pStyle":
+				if level := headingLevel(xmlAttr(t, "val")); level > 0 {
+					prefix = strings.Repeat("#", level) + " "
+				}
+			case "numPr":
+				if prefix == "" {
+					prefix = "- "
+				}
+			case "r":
+				inRun = true
+			case "t":
+				inText = true
+			case "tab":
+				if inRun {
+					para.WriteByte('\t')
+				}
+			case "br", "cr":
+				if inRun {
+					para.WriteByte('\n')
+				}
+			case "tbl":
+				if cells == 0 {
+					rows = 0
+				}
+			case "tc":
+				if cells == 0 {
+					cell.Reset()
+				}
+				cells++
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "r":
+				inRun = false
+			case "t":
+				inText = false
+			case "p":
+				text := strings.TrimSpace(para.String())
+				if text == "" {
+					continue
+				}
+				if cells > 0 {
+					if cell.Len() > 0 {
+						cell.WriteByte(' ')
+					}
+					cell.WriteString(strings.ReplaceAll(text, "\n", " "))
+					continue
+				}
+				list := prefix == "- "
+				if list && lastList {
+					separate("\n")
+				} else {
+					separate("\n\n")
+				}
+				out.WriteString(prefix + text)
+				lastList = list
+			case "tc":
+				cells--
+				if cells == 0 {
+					row = append(row, strings.ReplaceAll(cell.String(), "|", `\|`))
+				}
+			case "tr":
+				if cells > 0 || len(row) == 0 {
+					continue
+				}
+				if rows == 0 {
+					separate("\n\n")
+				} else {
+					out.WriteByte('\n')
+				}
+				out.WriteString("| " + strings.Join(row, " | ") + " |")
+				if rows == 0 {
+					out.WriteString("\n|" + strings.Repeat(" --- |", len(row)))
+				}
+				rows++
+				row = nil
+				lastList = false
+			}
+		case xml.CharData:
+			if inText {
+				para.Write(t)
+			}
+		}
+	}
+	if out.Len() == 0 {
+		return "", errors.New("no text found")
+	}
+	return out.String() + "\n", nil
+}
+
+// headingLevel returns the level of a built-in heading style such as
+// Heading2, or 0 for other styles.
+func headingLevel(style string) int {
+	if style == "Title" {
+		return 1
+	}
+	var level int
+	if _, err := fmt.Sscanf(style, "Heading%d", &level); err != nil || level < 1 || level > 6 {
+		return 0
+	}
+	return level
+}
+
+func xmlAttr(element xml.StartElement, name string) string {
+	for _, attr := range element.Attr {
+		if attr.Name.Local == name {
+			return attr.Value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,206 @@
+package promptbuilder
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"strings"
+	"unicode"
+)
+
+// ProviderLocal is the built-in embedding, computed without a model.
+const ProviderLocal = "local"
+
+// EmbeddingProviders lists the providers that can embed text.
+var EmbeddingProviders = []string{ProviderLocal, ProviderOpenAI, ProviderOllama}
+
+// embeddingModels are the default embedding models of the providers.
+var embeddingModels = map[string]string{
+	ProviderOpenAI: "text-embedding-3-small",
+	ProviderOllama: "nomic-embed-text",
+}
+
+// embedBatchSize is the number of texts sent in one embedding request.
+const embedBatchSize = 64
+
+// Embedder turns texts into vectors whose cosine similarity reflects how
+// close their meaning is.
+type Embedder interface {
+	Embed(ctx context.Context, texts []string) ([][]float64, error)
+}
+
+// NewEmbedder returns the embedder of a provider. The local provider
+// needs no model or network access; the others take their endpoint and
+// API key from the environment like NewClient. An empty model selects the
+// provider's default embedding model.
+func NewEmbedder(provider string, model string) (Embedder, error) {
+	if provider == ProviderLocal {
+		return LocalEmbedder{}, nil
+	}
+	defaultModel, ok := embeddingModels[provider]
+	if !ok {
+		return nil, fmt.Errorf("provider %q cannot embed text (supported: %s)", provider, strings.Join(EmbeddingProviders, ", "))
+	}
+	if model == "" {
+		model = defaultModel
+	}
+	return NewClient(provider, model)
+}
+
+// Embed returns the embeddings of texts from the provider's embeddings
+// API, using the client's model.
+func (c *Client) Embed(ctx context.Context, texts []string) ([][]float64, error) {
+	var vectors [][]float64
+	for start := 0; start < len(texts); start += embedBatchSize {
+		batch := texts[start:min(start+embedBatchSize, len(texts))]
+
+		switch c.Provider {
+		case ProviderOpenAI:
+			var response struct {
+				Data []struct {
+					Index     int       `json:"index"`
+					Embedding []float64 `json:"embedding"`
+				} `json:"data"`
+			}
+			request := map[string]any{"model": c.Model, "input": batch}
+			headers := map[string]string{"Authorization": "Bearer " + c.APIKey}
+			if err := c.post(ctx, "/embeddings", headers, request, &response); err != nil {
+				return nil, err
+			}
+			if len(response.Data) != len(batch) {
+				return nil, fmt.Errorf("openai returned %d embeddings for %d texts", len(response.Data), len(batch))
+			}
+			embeddings := make([][]float64, len(batch))
+			for _, item := range response.Data {
+				if item.Index < 0 || item.Index >= len(batch) {
+					return nil, fmt.Errorf("openai returned an embedding for unknown index %d", item.Index)
+				}
+				embeddings[item.Index] = item.Embedding
+			}
+			vectors = append(vectors, embeddings...)
+
+		case ProviderOllama:
+			var response struct {
+				Embeddings [][]float64 `json:"embeddings"`
+			}
+			request := map[string]any{"model": c.Model, "input": batch}
+			if err := c.post(ctx, "/api/embed", nil, request, &response); err != nil {
+				return nil, err
+			}
+			if len(response.Embeddings) != len(batch) {
+				return nil, fmt.Errorf("ollama returned %d embeddings for %d texts", len(response.Embeddings), len(batch))
+			}
+			vectors = append(vectors, response.Embeddings...)
+
+		default:
+			return nil, fmt.Errorf("provider %q cannot embed text", c.Provider)
+		}
+	}
+	return vectors, nil
+}
+
+// localDimensions is the size of the vectors of LocalEmbedder.
+const localDimensions = 1024
+
+// LocalEmbedder embeds text as hashed word counts. Identifiers are split
+// into their words, so "refreshToken" and "refresh_token" both match a
+// query about refreshing tokens. It finds files that use the words of the
+// query rather than ones that mean the same, but needs no model.
+type LocalEmbedder struct{}
+
+func (LocalEmbedder) Embed(ctx context.Context, texts []string) ([][]float64, error) {
+	vectors := make([][]float64, len(texts))
+	for i, text := range texts {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		counts := make(map[int]int)
+		for _, word := range splitWords(text) {
+			if stopWords[word] {
+				continue
+			}
+			h := fnv.New32a()
+			h.Write([]byte(stem(word)))
+			counts[int(h.Sum32()%localDimensions)]++
+		}
+
+		vector := make([]float64, localDimensions)
+		for dim, n := range counts {
+			// Dampen repetition so that one word cannot dominate a chunk
+			vector[dim] = 1 + math.Log(float64(n))
+		}
+		vectors[i] = vector
+	}
+	return vectors, nil
+}
+
+// splitWords returns the lowercase words of text, splitting identifiers
+// at underscores, digits and lower-to-upper case changes.
+func splitWords(text string) []string {
+	var words []string
+	var word []rune
+	flush := func() {
+		if len(word) > 1 {
+			words = append(words, strings.ToLower(string(word)))
+		}
+		word = word[:0]
+	}
+
+	var prev rune
+	for _, r := range text {
+		switch {
+		case !unicode.IsLetter(r):
+			flush()
+		case unicode.IsUpper(r) && unicode.IsLower(prev):
+			flush()
+			word = append(word, r)
+		default:
+			word = append(word, r)
+		}
+		prev = r
+	}
+	flush()
+	return words
+}
+
+// stem strips common English suffixes, so that "refreshing", "refreshed"
+// and "refreshes" count as the same word.
+func stem(word string) string {
+	for _, suffix := range []string{"ing", "ed", "es", "s"} {
+		if len(word) > len(suffix)+2 && strings.HasSuffix(word, suffix) {
+			return word[:len(word)-len(suffix)]
+		}
+	}
+	return word
+}
+
+// stopWords are words too common in questions and code to tell files
+// apart.
+var stopWords = map[string]bool{
+	"a": true, "an": true, "and": true, "are": true, "as": true, "at": true, "be": true,
+	"by": true, "do": true, "does": true, "for": true, "from": true, "how": true, "if": true,
+	"in": true, "is": true, "it": true, "of": true, "on": true, "or": true, "the": true,
+	"this": true, "to": true, "what": true, "when": true, "where": true, "which": true,
+	"why": true, "with": true, "work": true, "works": true,
+	"const": true, "else": true, "err": true, "func": true, "function": true, "import": true,
+	"nil": true, "null": true, "return": true, "self": true, "var": true,
+}
+
+// cosine returns the cosine similarity of two vectors, or 0 when either
+// is zero or their lengths differ.
+func cosine(a []float64, b []float64) float64 {
+	if len(a) != len(b) {
+		return 0
+	}
+	var dot, normA, normB float64
+	for i := range a {
+		dot += a[i] * b[i]
+		normA += a[i] * a[i]
+		normB += b[i] * b[i]
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / math.Sqrt(normA*normB)
+}
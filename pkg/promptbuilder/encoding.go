@@ -0,0 +1,109 @@
+package promptbuilder
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Values of the encoding directive, which decides what happens to files
+// that are not UTF-8.
+const (
+	encodingTranscode = "transcode" // detect the encoding and convert to UTF-8
+	encodingReplace   = "replace"   // replace invalid bytes with U+FFFD
+	encodingSkip      = "skip"      // leave the file out
+)
+
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+// windows1252 maps the bytes 0x80 to 0x9F of Windows-1252 to their runes.
+// Other bytes are the same as in Latin-1, which it extends, so legacy
+// files in either encoding decode correctly.
+var windows1252 = [32]rune{
+	'€', 0x81, '‚', 'ƒ', '„', '…', '†', '‡', 'ˆ', '‰', 'Š', '‹', 'Œ', 0x8D, 'Ž', 0x8F,
+	0x90, '‘', '’', '“', '”', '•', '–', '—', '˜', '™', 'š', '›', 'œ', 0x9D, 'ž', 'Ÿ',
+}
+
+// detectUTF16 reports whether data is UTF-16, from its byte order mark or,
+// without one, from the zero high bytes of ASCII characters, and returns
+// its byte order and the length of the mark.
+func detectUTF16(data []byte) (order binary.ByteOrder, bomLen int, ok bool) {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xFF, 0xFE}):
+		return binary.LittleEndian, 2, true
+	case bytes.HasPrefix(data, []byte{0xFE, 0xFF}):
+		return binary.BigEndian, 2, true
+	}
+
+	sample := data[:min(len(data), 512)&^1]
+	if len(sample) < 4 {
+		return nil, 0, false
+	}
+	evenZeros, oddZeros := 0, 0
+	for i := 0; i < len(sample); i += 2 {
+		if sample[i] == 0 {
+			evenZeros++
+		}
+		if sample[i+1] == 0 {
+			oddZeros++
+		}
+	}
+	pairs := len(sample) / 2
+	switch {
+	case oddZeros*10 >= pairs*4 && evenZeros*20 < pairs:
+		return binary.LittleEndian, 0, true
+	case evenZeros*10 >= pairs*4 && oddZeros*20 < pairs:
+		return binary.BigEndian, 0, true
+	}
+	return nil, 0, false
+}
+
+// decodeUTF16 converts UTF-16 data without its byte order mark to a
+// string. A trailing odd byte is dropped.
+func decodeUTF16(data []byte, order binary.ByteOrder) string {
+	units := make([]uint16, len(data)/2)
+	for i := range units {
+		units[i] = order.Uint16(data[2*i:])
+	}
+	return string(utf16.Decode(units))
+}
+
+func decodeWindows1252(data []byte) string {
+	var b strings.Builder
+	b.Grow(len(data) + len(data)/4)
+	for _, c := range data {
+		if c >= 0x80 && c < 0xA0 {
+			b.WriteRune(windows1252[c-0x80])
+		} else {
+			b.WriteRune(rune(c))
+		}
+	}
+	return b.String()
+}
+
+// decodeText returns the content of a file as UTF-8, and the encoding it
+// was converted from, or "" when it was UTF-8 already. A UTF-8 byte order
+// mark is dropped. With mode skip, ok is false for any other encoding.
+// Otherwise UTF-16 is converted, and other content that is not valid
+// UTF-8 is read as Windows-1252 by transcode, while replace replaces its
+// invalid bytes with U+FFFD.
+func decodeText(content []byte, mode string) (text string, from string, ok bool) {
+	content = bytes.TrimPrefix(content, utf8BOM)
+	order, bomLen, isUTF16 := detectUTF16(content)
+	switch {
+	case isUTF16 && mode == encodingSkip:
+		return "", "UTF-16", false
+	case isUTF16:
+		return decodeUTF16(content[bomLen:], order), "UTF-16", true
+	case utf8.Valid(content):
+		return string(content), "", true
+	case mode == encodingSkip:
+		return "", "", false
+	case mode == encodingReplace:
+		return strings.ToValidUTF8(string(content), "\uFFFD"), "", true
+	default:
+		return decodeWindows1252(content), "Windows-1252", true
+	}
+}
@@ -0,0 +1,57 @@
+package promptbuilder
+
+import (
+	"bytes"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// ReadFileList reads a list of paths, one per line as printed by
+// git diff --name-only or rg -l, or separated by NUL bytes as printed by
+// git ls-files -z or find -print0. Blank lines are skipped.
+func ReadFileList(r io.Reader) ([]string, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	sep := []byte("\n")
+	if bytes.IndexByte(data, 0) != -1 {
+		sep = []byte{0}
+	}
+
+	var paths []string
+	for _, entry := range bytes.Split(data, sep) {
+		path := strings.TrimSpace(strings.TrimSuffix(string(entry), "\r"))
+		if path != "" {
+			paths = append(paths, path)
+		}
+	}
+	return paths, nil
+}
+
+// UseFileList replaces the includes, and the sections they belong to, with
+// one include per path. Relative paths are relative to BaseDir; absolute
+// paths must lie inside it. The exclude rules still apply.
+func (c *Config) UseFileList(paths []string) error {
+	baseDir, err := filepath.Abs(c.BaseDir)
+	if err != nil {
+		return err
+	}
+
+	c.Includes = nil
+	c.Sections = nil
+	for _, path := range paths {
+		fullPath, err := ResolveChangePath(baseDir, path)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(baseDir, fullPath)
+		if err != nil {
+			return err
+		}
+		c.Includes = append(c.Includes, Include{Path: rel})
+	}
+	return nil
+}
@@ -0,0 +1,431 @@
+package promptbuilder
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"strings"
+	"text/template"
+)
+
+// Output formats supported by WithFormat.
+const (
+	FormatMarkdown = "markdown"
+	FormatXML      = "xml"
+	FormatJSON     = "json"
+
+	// FormatOpenAIChat is a request body for the OpenAI chat completions
+	// API.
+	FormatOpenAIChat = "openai-chat"
+
+	// FormatAnthropic is a request body for the Anthropic Messages API.
+	FormatAnthropic = "anthropic"
+)
+
+// OutputFormats lists the supported output formats.
+var OutputFormats = []string{FormatMarkdown, FormatXML, FormatJSON, FormatOpenAIChat, FormatAnthropic}
+
+// IsRequestFormat reports whether format produces an API request body.
+// Such formats split the prompt into several messages of one request
+// rather than into several outputs.
+func IsRequestFormat(format string) bool {
+	format = strings.ToLower(format)
+	return format == FormatOpenAIChat || format == FormatAnthropic
+}
+
+// renderer turns a document into the final output. renderFile,
+// renderSection and renderHeading are also used up front to estimate the
+// tokens a file, section or heading will cost in the chosen format.
+type renderer interface {
+	renderFile(path string, content string) string
+	renderSection(section extraSection) string
+	renderHeading(section Section) string
+	writeOutput(w io.Writer, doc *document) error
+}
+
+// document is everything that goes into one output file.
+type document struct {
+	Header   string
+	Before   []extraSection // rendered between the header and the files
+	Sections []fileSection
+	After    []extraSection // rendered after the files
+	Footer   string
+
+	// load reads the content of a section. Files are loaded one at a time
+	// while the output is written, so memory use is bounded by the
+	// largest file rather than the whole prompt.
+	load func(fileSection) (fileSection, error)
+}
+
+// file returns section with its content loaded.
+func (d *document) file(section fileSection) (fileSection, error) {
+	if d.load == nil {
+		return section, nil
+	}
+	return d.load(section)
+}
+
+// extraSection is a block of content that is not a file from basedir,
+// such as a git diff.
+type extraSection struct {
+	Name     string // identifier, used as the XML tag
+	Title    string
+	Language string
+	Content  string
+
+	// MediaType is set for attachments, whose Content is base64. Request
+	// formats send them as image or document blocks instead of text
+	MediaType string
+	Image     bool
+}
+
+func newRenderer(format string, config *Config, requestModel string) (renderer, error) {
+	if config.Template != "" {
+		return newTemplateRenderer(config.Template, config)
+	}
+
+	fileHeader, err := parseFileHeader(config.FileHeader)
+	if err != nil {
+		return nil, fmt.Errorf("invalid file header: %v", err)
+	}
+	markdown := markdownRenderer{tree: config.Tree, fileHeader: fileHeader, baseDir: config.BaseDir}
+
+	switch strings.ToLower(format) {
+	case FormatMarkdown, "md":
+		return markdown, nil
+	case FormatXML:
+		return xmlRenderer{directoryStructure: config.DirectoryStructure || config.Tree}, nil
+	case FormatJSON:
+		return jsonRenderer{}, nil
+	case FormatOpenAIChat:
+		if requestModel == "" {
+			requestModel = providers[ProviderOpenAI].model
+		}
+		return openAIChatRenderer{
+			markdownRenderer: markdown,
+			model:            requestModel,
+			splitTokens:      config.SplitTokens,
+			splitChars:       config.SplitChars,
+		}, nil
+	case FormatAnthropic:
+		if requestModel == "" {
+			requestModel = providers[ProviderAnthropic].model
+		}
+		return anthropicRenderer{
+			xmlRenderer:   xmlRenderer{directoryStructure: config.DirectoryStructure || config.Tree},
+			model:         requestModel,
+			splitTokens:   config.SplitTokens,
+			splitChars:    config.SplitChars,
+			promptCaching: config.PromptCaching,
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown output format %q (supported: %s)", format, strings.Join(OutputFormats, ", "))
+}
+
+// headingGroups splits sections into consecutive runs of files that share
+// a heading.
+func headingGroups(sections []fileSection) [][]fileSection {
+	var groups [][]fileSection
+	for i, section := range sections {
+		if i == 0 || section.Heading != sections[i-1].Heading {
+			groups = append(groups, nil)
+		}
+		groups[len(groups)-1] = append(groups[len(groups)-1], section)
+	}
+	return groups
+}
+
+type markdownRenderer struct {
+	tree       bool
+	fileHeader *template.Template // replaces the "# path" line, if set
+	baseDir    string
+}
+
+func (r markdownRenderer) renderFile(path string, content string) string {
+	fence := codeFence(content)
+	return fmt.Sprintf("%s\n%s%s\n%s\n%s\n\n", r.fileHeading(path, content), fence, detectLanguage(path), content, fence)
+}
+
+func (r markdownRenderer) fileHeading(path string, content string) string {
+	if r.fileHeader == nil {
+		return "# " + path
+	}
+	var b strings.Builder
+	if err := r.fileHeader.Execute(&b, newTemplateFile(r.baseDir, 0, path, content)); err != nil {
+		return "# " + path
+	}
+	return b.String()
+}
+
+// codeFence returns a backtick fence longer than any backtick run inside
+// content, so that files which contain ``` themselves cannot close the
+// block early.
+func codeFence(content string) string {
+	longest, run := 0, 0
+	for i := 0; i < len(content); i++ {
+		if content[i] == '`' {
+			run++
+			if run > longest {
+				longest = run
+			}
+		} else {
+			run = 0
+		}
+	}
+	return strings.Repeat("`", max(3, longest+1))
+}
+
+func (markdownRenderer) renderSection(section extraSection) string {
+	fence := codeFence(section.Content)
+	return fmt.Sprintf("# %s\n%s%s\n%s\n%s\n\n", section.Title, fence, section.Language, strings.TrimSuffix(section.Content, "\n"), fence)
+}
+
+func (markdownRenderer) renderHeading(section Section) string {
+	if section.Intro == "" {
+		return "# " + section.Name + "\n\n"
+	}
+	return "# " + section.Name + "\n\n" + section.Intro + "\n\n"
+}
+
+func (r markdownRenderer) writeOutput(w io.Writer, doc *document) error {
+	b := bufio.NewWriter(w)
+	if doc.Header != "" {
+		b.WriteString(doc.Header + "\n\n")
+	}
+	if r.tree {
+		b.WriteString("# Directory Structure\n```\n" + renderTree(sectionPaths(doc.Sections)) + "```\n\n")
+	}
+	for _, section := range doc.Before {
+		b.WriteString(r.renderSection(section))
+	}
+	for _, group := range headingGroups(doc.Sections) {
+		if heading := group[0].Heading; heading != nil {
+			b.WriteString(r.renderHeading(*heading))
+		}
+		for _, section := range group {
+			section, err := doc.file(section)
+			if err != nil {
+				return err
+			}
+			b.WriteString(section.Text)
+		}
+	}
+	for _, section := range doc.After {
+		b.WriteString(r.renderSection(section))
+	}
+	if doc.Footer != "" {
+		b.WriteString(doc.Footer + "\n")
+	}
+
+	return b.Flush()
+}
+
+// xmlRenderer wraps every file in <file path="..."> tags inside a single
+// <repository> element. File contents are emitted verbatim so the model
+// sees the code exactly as it is on disk.
+type xmlRenderer struct {
+	directoryStructure bool
+}
+
+func (xmlRenderer) renderFile(path string, content string) string {
+	return fmt.Sprintf("<file path=\"%s\">\n%s\n</file>\n", html.EscapeString(path), content)
+}
+
+func (xmlRenderer) renderSection(section extraSection) string {
+	return fmt.Sprintf("<%s title=\"%s\">\n%s\n</%s>\n", section.Name, html.EscapeString(section.Title), strings.TrimSuffix(section.Content, "\n"), section.Name)
+}
+
+// renderHeading opens a <section> element; writeOutput closes it after the
+// files of the section.
+func (xmlRenderer) renderHeading(section Section) string {
+	if section.Intro == "" {
+		return fmt.Sprintf("<section name=\"%s\">\n", html.EscapeString(section.Name))
+	}
+	return fmt.Sprintf("<section name=\"%s\">\n%s\n", html.EscapeString(section.Name), section.Intro)
+}
+
+func (r xmlRenderer) writeOutput(w io.Writer, doc *document) error {
+	b := bufio.NewWriter(w)
+	if doc.Header != "" {
+		b.WriteString(doc.Header + "\n\n")
+	}
+	for _, section := range doc.Before {
+		b.WriteString(r.renderSection(section))
+	}
+	b.WriteString("<repository>\n")
+
+	if r.directoryStructure {
+		b.WriteString("<directory_structure>\n")
+		b.WriteString(renderTree(sectionPaths(doc.Sections)))
+		b.WriteString("</directory_structure>\n")
+	}
+
+	for _, group := range headingGroups(doc.Sections) {
+		heading := group[0].Heading
+		if heading != nil {
+			b.WriteString(r.renderHeading(*heading))
+		}
+		for _, section := range group {
+			section, err := doc.file(section)
+			if err != nil {
+				return err
+			}
+			b.WriteString(section.Text)
+		}
+		if heading != nil {
+			b.WriteString("</section>\n")
+		}
+	}
+	b.WriteString("</repository>\n")
+	for _, section := range doc.After {
+		b.WriteString(r.renderSection(section))
+	}
+	if doc.Footer != "" {
+		b.WriteString("\n" + doc.Footer + "\n")
+	}
+
+	return b.Flush()
+}
+
+// jsonRenderer emits a single JSON document so that prompts can be post
+// processed programmatically.
+type jsonRenderer struct{}
+
+type jsonDocument struct {
+	Header   string        `json:"header"`
+	Sections []jsonSection `json:"sections,omitempty"`
+	Headings []jsonHeading `json:"headings,omitempty"`
+	Files    []jsonFile    `json:"files"`
+	Footer   string        `json:"footer,omitempty"`
+	Summary  jsonSummary   `json:"summary"`
+}
+
+type jsonSection struct {
+	Name      string `json:"name"`
+	Title     string `json:"title"`
+	Position  string `json:"position"`
+	MediaType string `json:"media_type,omitempty"` // set for attachments, whose content is base64
+	Content   string `json:"content"`
+}
+
+type jsonHeading struct {
+	Name  string `json:"name"`
+	Intro string `json:"intro,omitempty"`
+}
+
+type jsonFile struct {
+	Path     string `json:"path"`
+	Section  string `json:"section,omitempty"`
+	Language string `json:"language"`
+	Size     int    `json:"size"`
+	Lines    int    `json:"lines"`
+	Tokens   int    `json:"tokens"`
+	Content  string `json:"content"`
+}
+
+type jsonSummary struct {
+	Files  int `json:"files"`
+	Size   int `json:"size"`
+	Lines  int `json:"lines"`
+	Tokens int `json:"tokens"`
+}
+
+func (jsonRenderer) renderFile(path string, content string) string {
+	return content
+}
+
+func (jsonRenderer) renderSection(section extraSection) string {
+	return section.Content
+}
+
+func (jsonRenderer) renderHeading(section Section) string {
+	return section.Name + "\n" + section.Intro
+}
+
+// writeOutput marshals the document without its files, then streams the
+// files into the "files" array one at a time.
+func (jsonRenderer) writeOutput(w io.Writer, d *document) error {
+	doc := jsonDocument{
+		Header: d.Header,
+		Files:  []jsonFile{},
+		Footer: d.Footer,
+	}
+
+	for _, section := range d.Before {
+		doc.Sections = append(doc.Sections, jsonSection{Name: section.Name, Title: section.Title, Position: "before", MediaType: section.MediaType, Content: section.Content})
+	}
+	for _, section := range d.After {
+		doc.Sections = append(doc.Sections, jsonSection{Name: section.Name, Title: section.Title, Position: "after", Content: section.Content})
+	}
+
+	for _, group := range headingGroups(d.Sections) {
+		if heading := group[0].Heading; heading != nil {
+			doc.Headings = append(doc.Headings, jsonHeading{Name: heading.Name, Intro: heading.Intro})
+		}
+	}
+
+	for _, section := range d.Sections {
+		doc.Summary.Files++
+		doc.Summary.Size += section.Size
+		doc.Summary.Lines += section.Lines
+		doc.Summary.Tokens += section.Tokens
+	}
+
+	frame, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return err
+	}
+	// String values are escaped, so the only unescaped occurrence is the
+	// key itself
+	const filesKey = `"files": []`
+	split := bytes.Index(frame, []byte(filesKey)) + len(filesKey) - 1
+
+	b := bufio.NewWriter(w)
+	b.Write(frame[:split])
+	for i, section := range d.Sections {
+		section, err := d.file(section)
+		if err != nil {
+			return err
+		}
+		data, err := json.MarshalIndent(jsonFile{
+			Path:     section.Path,
+			Section:  section.sectionName(),
+			Language: detectLanguage(section.Path),
+			Size:     section.Size,
+			Lines:    section.Lines,
+			Tokens:   section.Tokens,
+			Content:  section.Content,
+		}, "    ", "  ")
+		if err != nil {
+			return err
+		}
+		if i > 0 {
+			b.WriteString(",")
+		}
+		b.WriteString("\n    ")
+		b.Write(data)
+	}
+	if len(d.Sections) > 0 {
+		b.WriteString("\n  ")
+	}
+	b.Write(frame[split:])
+	b.WriteString("\n")
+
+	return b.Flush()
+}
+
+// countLines returns the number of lines in content, counting a final
+// line without a trailing newline.
+func countLines(content string) int {
+	if content == "" {
+		return 0
+	}
+	lines := strings.Count(content, "\n")
+	if !strings.HasSuffix(content, "\n") {
+		lines++
+	}
+	return lines
+}
@@ -0,0 +1,78 @@
+package promptbuilder
+
+import (
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// lockfiles are the dependency lock files of package managers, which list
+// every transitive dependency with its checksum.
+var lockfiles = map[string]bool{
+	"bun.lock":            true,
+	"bun.lockb":           true,
+	"cargo.lock":          true,
+	"composer.lock":       true,
+	"flake.lock":          true,
+	"gemfile.lock":        true,
+	"go.sum":              true,
+	"go.work.sum":         true,
+	"mix.lock":            true,
+	"npm-shrinkwrap.json": true,
+	"package-lock.json":   true,
+	"packages.lock.json":  true,
+	"pdm.lock":            true,
+	"pipfile.lock":        true,
+	"pnpm-lock.yaml":      true,
+	"podfile.lock":        true,
+	"poetry.lock":         true,
+	"pubspec.lock":        true,
+	"uv.lock":             true,
+	"yarn.lock":           true,
+}
+
+var (
+	sourceMapName = regexp.MustCompile(`\.(css|[cm]?js|tsx?)\.map$`)
+	minifiedName  = regexp.MustCompile(`[.-]min\.(css|[cm]?js)$`)
+
+	// generatedHeader matches the markers that code generators put at the
+	// top of their output: Go's "Code generated by X. DO NOT EDIT.",
+	// @generated and .NET's <auto-generated>.
+	generatedHeader = regexp.MustCompile(`(?m)^\W*(Code generated .*DO NOT EDIT|@generated\b|<auto-generated)`)
+)
+
+// generatedHeaderSize is how much of the start of a file is searched for a
+// generated header, which comes before the code.
+const generatedHeaderSize = 2048
+
+// generatedName returns why a file is generated judging by its name, or ""
+// when its name does not tell.
+func generatedName(path string) string {
+	name := strings.ToLower(filepath.Base(path))
+	switch {
+	case lockfiles[name]:
+		return "lockfile"
+	case sourceMapName.MatchString(name):
+		return "source map"
+	case minifiedName.MatchString(name):
+		return "minified"
+	}
+	return ""
+}
+
+// generatedContent returns why a file is generated judging by its content,
+// or "" when it looks written by hand. JavaScript and CSS files are
+// minified when their lines are hundreds of characters long on average.
+func generatedContent(path string, text string) string {
+	if generatedHeader.MatchString(text[:min(len(text), generatedHeaderSize)]) {
+		return "generated header"
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".js", ".mjs", ".cjs", ".css":
+		lines := strings.Count(strings.TrimRight(text, "\n"), "\n") + 1
+		if len(text) > 1024 && len(text)/lines > 300 {
+			return "minified"
+		}
+	}
+	return ""
+}
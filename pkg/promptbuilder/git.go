@@ -0,0 +1,210 @@
+package promptbuilder
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// runGit runs git in dir and returns its standard output.
+func runGit(ctx context.Context, dir string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			msg = err.Error()
+		}
+		return "", fmt.Errorf("git %s: %s", strings.Join(args, " "), msg)
+	}
+	return stdout.String(), nil
+}
+
+// resolveCommit returns the hash of the commit that ref names in the
+// repository of dir. Refs come from input files, so one starting with "-",
+// which git would take for an option, is rejected.
+func resolveCommit(ctx context.Context, dir string, ref string) (string, error) {
+	if strings.HasPrefix(ref, "-") {
+		return "", fmt.Errorf("invalid git ref %q", ref)
+	}
+	commit, err := runGit(ctx, dir, "rev-parse", "--verify", "--quiet", "--end-of-options", ref+"^{commit}")
+	if err != nil {
+		return "", fmt.Errorf("unknown git ref %s", ref)
+	}
+	return strings.TrimSpace(commit), nil
+}
+
+// changedFiles returns the paths, relative to baseDir, of the files that
+// differ from ref, including untracked files. For a ref other than HEAD the diff is
+// taken against the merge base, so "main" means "changed on this branch
+// since it left main". When head is not HEAD, the files come from that
+// commit rather than the working tree, and the diff is taken up to it.
+func changedFiles(ctx context.Context, baseDir string, ref string, head string) (map[string]bool, error) {
+	root, err := runGit(ctx, baseDir, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return nil, err
+	}
+	root = strings.TrimSpace(root)
+	// git reports paths relative to the top of the repository, with
+	// symlinks resolved, so they are matched to baseDir through its prefix
+	prefix, err := runGit(ctx, baseDir, "rev-parse", "--show-prefix")
+	if err != nil {
+		return nil, err
+	}
+	prefix = filepath.FromSlash(strings.TrimSpace(prefix))
+
+	if head != "HEAD" {
+		if head, err = resolveCommit(ctx, baseDir, head); err != nil {
+			return nil, err
+		}
+	}
+	base := ref
+	if ref != "HEAD" {
+		commit, err := resolveCommit(ctx, baseDir, ref)
+		if err != nil {
+			return nil, err
+		}
+		mergeBase, err := runGit(ctx, baseDir, "merge-base", "--end-of-options", commit, head)
+		if err != nil {
+			return nil, err
+		}
+		base = strings.TrimSpace(mergeBase)
+	}
+
+	var diff, untracked string
+	if head == "HEAD" {
+		if diff, err = runGit(ctx, root, "diff", "--name-only", "--end-of-options", base); err != nil {
+			return nil, err
+		}
+		if untracked, err = runGit(ctx, root, "ls-files", "--others", "--exclude-standard"); err != nil {
+			return nil, err
+		}
+	} else if diff, err = runGit(ctx, root, "diff", "--name-only", "--end-of-options", base, head); err != nil {
+		return nil, err
+	}
+
+	files := make(map[string]bool)
+	for _, name := range strings.Split(diff+untracked, "\n") {
+		if name = strings.TrimSpace(name); name != "" {
+			rel, err := filepath.Rel(prefix, filepath.FromSlash(name))
+			if err != nil {
+				return nil, err
+			}
+			files[rel] = true
+		}
+	}
+	return files, nil
+}
+
+// gitMetadata describes the state of the repository that contains dir, at
+// head: HEAD with the working tree, or the ref the files come from.
+func gitMetadata(ctx context.Context, dir string, head string) (string, error) {
+	root, err := runGit(ctx, dir, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return "", err
+	}
+	branch, err := gitBranch(ctx, dir, head)
+	if err != nil {
+		return "", err
+	}
+	commit, err := runGit(ctx, dir, "rev-parse", head)
+	if err != nil {
+		return "", err
+	}
+
+	state := "clean"
+	if head == "HEAD" {
+		changes, err := runGit(ctx, dir, "status", "--porcelain")
+		if err != nil {
+			return "", err
+		}
+		if strings.TrimSpace(changes) != "" {
+			state = "dirty (uncommitted changes)"
+		}
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Repository: %s\n", filepath.Base(strings.TrimSpace(root)))
+	fmt.Fprintf(&b, "Branch: %s\n", branch)
+	fmt.Fprintf(&b, "Commit: %s\n", strings.TrimSpace(commit))
+	fmt.Fprintf(&b, "Status: %s\n", state)
+	return b.String(), nil
+}
+
+// gitBranch returns the name of the branch checked out in dir, or for a
+// head other than HEAD the ref itself.
+func gitBranch(ctx context.Context, dir string, head string) (string, error) {
+	if head != "HEAD" {
+		return head, nil
+	}
+	branch, err := runGit(ctx, dir, "rev-parse", "--abbrev-ref", "HEAD")
+	return strings.TrimSpace(branch), err
+}
+
+// gitDir returns the directory git commands run in: basedir, or with
+// GitRef the basedir in the working tree the files were extracted from.
+func (c *Config) gitDir() string {
+	if c.repoDir != "" {
+		return c.repoDir
+	}
+	return c.BaseDir
+}
+
+// gitHead returns the commit the files come from, GitRef or HEAD.
+func (c *Config) gitHead() string {
+	if c.GitRef != "" {
+		return c.GitRef
+	}
+	return "HEAD"
+}
+
+// extractRef writes the files that dir holds at ref to a directory in the
+// user cache and returns its path, leaving the working tree alone. The
+// directory is named after the commit, so a ref is extracted once per
+// commit it points to.
+func extractRef(ctx context.Context, dir string, ref string) (string, error) {
+	commit, err := resolveCommit(ctx, dir, ref)
+	if err != nil {
+		return "", err
+	}
+	root, err := runGit(ctx, dir, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return "", err
+	}
+	prefix, err := runGit(ctx, dir, "rev-parse", "--show-prefix")
+	if err != nil {
+		return "", err
+	}
+	tree := commit + ":" + strings.TrimSpace(prefix)
+
+	return extractCached("refs", tree, func(target string) error {
+		cmd := exec.CommandContext(ctx, "git", "archive", "--format=tar", tree)
+		cmd.Dir = strings.TrimSpace(root)
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		archive, err := cmd.StdoutPipe()
+		if err != nil {
+			return err
+		}
+		if err := cmd.Start(); err != nil {
+			return err
+		}
+		extractErr := extractTar(archive, target)
+		io.Copy(io.Discard, archive)
+		if err := cmd.Wait(); err != nil {
+			return fmt.Errorf("git archive %s: %s", tree, strings.TrimSpace(stderr.String()))
+		}
+		if extractErr != nil {
+			return fmt.Errorf("cannot extract the files of %s: %v", ref, extractErr)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,175 @@
+package promptbuilder
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// testRepo returns a git repository with a.txt committed on main, and
+// a.txt changed and b.txt added in the working tree.
+func testRepo(t *testing.T) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir := t.TempDir()
+	git := func(args ...string) {
+		t.Helper()
+		args = append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)
+		if _, err := runGit(context.Background(), dir, args...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	git("init", "--quiet", "--initial-branch=main")
+	writeTestFile(t, filepath.Join(dir, "a.txt"), "a\n")
+	git("add", "a.txt")
+	git("commit", "--quiet", "-m", "first")
+	writeTestFile(t, filepath.Join(dir, "a.txt"), "a\nchanged\n")
+	writeTestFile(t, filepath.Join(dir, "b.txt"), "b\n")
+	return dir
+}
+
+func writeTestFile(t *testing.T, path string, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// testConfig parses directives, one per line, into a config.
+func testConfig(t *testing.T, directives ...string) *Config {
+	t.Helper()
+	config, err := ParseConfig(strings.NewReader("---\n" + strings.Join(directives, "\n") + "\n"))
+	if err != nil {
+		t.Fatalf("ParseConfig: %v", err)
+	}
+	return config
+}
+
+func TestResolveCommit(t *testing.T) {
+	repo := testRepo(t)
+	ctx := context.Background()
+
+	head, err := resolveCommit(ctx, repo, "HEAD")
+	if err != nil || len(head) != 40 {
+		t.Fatalf("resolveCommit(HEAD) = %q, %v", head, err)
+	}
+	for _, ref := range []string{"main", "main~0", head[:12]} {
+		if got, err := resolveCommit(ctx, repo, ref); err != nil || got != head {
+			t.Errorf("resolveCommit(%q) = %q, %v, want %q", ref, got, err, head)
+		}
+	}
+	for _, ref := range []string{"missing", "main~5", "--output=x", "-p"} {
+		if got, err := resolveCommit(ctx, repo, ref); err == nil {
+			t.Errorf("resolveCommit(%q) = %q, want an error", ref, got)
+		}
+	}
+}
+
+func TestChangedFiles(t *testing.T) {
+	repo := testRepo(t)
+	want := []string{"a.txt", "b.txt"}
+	for _, ref := range []string{"HEAD", "main"} {
+		files, err := changedFiles(context.Background(), repo, ref, "HEAD")
+		if err != nil {
+			t.Fatalf("changedFiles(%s): %v", ref, err)
+		}
+		var got []string
+		for path := range files {
+			got = append(got, path)
+		}
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("changedFiles(%s) = %q, want %q", ref, got, want)
+		}
+	}
+
+	// From a subdirectory reached through a symlink, the paths are
+	// relative to the link
+	writeTestFile(t, filepath.Join(repo, "sub", "c.txt"), "c\n")
+	link := filepath.Join(t.TempDir(), "link")
+	if err := os.Symlink(filepath.Join(repo, "sub"), link); err != nil {
+		t.Skipf("cannot create symlinks: %v", err)
+	}
+	files, err := changedFiles(context.Background(), link, "HEAD", "HEAD")
+	if err != nil {
+		t.Fatalf("changedFiles: %v", err)
+	}
+	want = []string{filepath.Join("..", "a.txt"), filepath.Join("..", "b.txt"), "c.txt"}
+	var got []string
+	for path := range files {
+		got = append(got, path)
+	}
+	sort.Strings(got)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("changedFiles from a link = %q, want %q", got, want)
+	}
+}
+
+// TestGitRefOptions checks that refs of the input file which git would
+// take for options are rejected, rather than write a file.
+func TestGitRefOptions(t *testing.T) {
+	repo := testRepo(t)
+	ctx := context.Background()
+	written := filepath.Join(t.TempDir(), "WRITTEN")
+	option := "--output=" + written
+
+	if _, err := changedFiles(ctx, repo, option, "HEAD"); err == nil || !strings.Contains(err.Error(), "invalid git ref") {
+		t.Errorf("changedFiles = %v, want an invalid ref error", err)
+	}
+	if _, err := changedFiles(ctx, repo, "main", option); err == nil {
+		t.Error("changedFiles accepted an option as head")
+	}
+
+	config := testConfig(t, "basedir="+repo, "include=a.txt", "changed="+option)
+	builder, err := New(config)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if _, err := builder.Build(ctx, &bytes.Buffer{}); err == nil || !strings.Contains(err.Error(), "invalid git ref") {
+		t.Errorf("Build with changed = %v, want an invalid ref error", err)
+	}
+
+	config = testConfig(t, "basedir="+repo, "include=a.txt", "gitdiff="+option)
+	if builder, err = New(config); err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if _, err := builder.Build(ctx, &bytes.Buffer{}); err == nil || !strings.Contains(err.Error(), "invalid git ref") {
+		t.Errorf("Build with gitdiff = %v, want an invalid ref error", err)
+	}
+
+	config = testConfig(t, "basedir="+repo, "include=a.txt", "gitref="+option)
+	if _, err := New(config); err == nil || !strings.Contains(err.Error(), "invalid git ref") {
+		t.Errorf("New with gitref = %v, want an invalid ref error", err)
+	}
+
+	if _, err := os.Stat(written); err == nil {
+		t.Error("a ref was passed to git as an option")
+	}
+}
+
+func TestGitDiffSection(t *testing.T) {
+	repo := testRepo(t)
+	config := testConfig(t, "basedir="+repo, "include=b.txt", "gitdiff=main")
+	builder, err := New(config)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	var output bytes.Buffer
+	if _, err := builder.Build(context.Background(), &output); err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	if !strings.Contains(output.String(), "# Git diff against main") || !strings.Contains(output.String(), "+changed") {
+		t.Errorf("output has no diff against main:\n%s", output.String())
+	}
+}
@@ -0,0 +1,164 @@
+package promptbuilder
+
+import (
+	"bufio"
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"strings"
+)
+
+// PromptignoreFile is the name of the files, written in .gitignore syntax,
+// that leave paths out of every prompt built from their directory.
+const PromptignoreFile = ".promptignore"
+
+// ignoreRule is a single pattern line from a .gitignore file.
+type ignoreRule struct {
+	base     string // directory of the ignore file, relative to basedir
+	pattern  string
+	negate   bool
+	dirOnly  bool
+	anchored bool
+}
+
+// ignoreMatcher holds the rules of every ignore file seen so far. Rules
+// only apply below the directory they were read from, so rules of
+// sibling directories never interfere with each other.
+type ignoreMatcher struct {
+	src      sourceFS
+	baseDir  string
+	fileName string
+	rules    []ignoreRule
+	loaded   map[string]bool
+}
+
+func newIgnoreMatcher(src sourceFS, baseDir string, fileName string) *ignoreMatcher {
+	return &ignoreMatcher{
+		src:      src,
+		baseDir:  baseDir,
+		fileName: fileName,
+		loaded:   make(map[string]bool),
+	}
+}
+
+// loadParents reads the ignore files of every directory from basedir
+// down to and including dir, so that a walk starting below basedir still
+// sees the rules declared above it.
+func (m *ignoreMatcher) loadParents(dir string) error {
+	relDir, err := filepath.Rel(m.baseDir, dir)
+	if err != nil {
+		return err
+	}
+
+	current := m.baseDir
+	if err := m.loadDir(current); err != nil {
+		return err
+	}
+	for _, segment := range splitPath(filepath.ToSlash(relDir)) {
+		if segment == ".." {
+			return nil
+		}
+		current = filepath.Join(current, segment)
+		if err := m.loadDir(current); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadDir reads the ignore file in dir, if there is one.
+func (m *ignoreMatcher) loadDir(dir string) error {
+	if m.loaded[dir] {
+		return nil
+	}
+	m.loaded[dir] = true
+
+	file, err := m.src.open(filepath.Join(dir, m.fileName))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	defer file.Close()
+
+	relDir, err := filepath.Rel(m.baseDir, dir)
+	if err != nil {
+		return err
+	}
+	relDir = filepath.ToSlash(relDir)
+	if relDir == "." {
+		relDir = ""
+	}
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if rule, ok := parseIgnoreLine(scanner.Text()); ok {
+			rule.base = relDir
+			m.rules = append(m.rules, rule)
+		}
+	}
+	return scanner.Err()
+}
+
+func parseIgnoreLine(line string) (ignoreRule, bool) {
+	line = strings.TrimRight(line, " \t\r")
+	if line == "" || strings.HasPrefix(line, "#") {
+		return ignoreRule{}, false
+	}
+
+	var rule ignoreRule
+	if strings.HasPrefix(line, "!") {
+		rule.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, `\`) {
+		// "\#" and "\!" escape a leading special character
+		line = line[1:]
+	}
+
+	if strings.HasSuffix(line, "/") {
+		rule.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+
+	// A slash anywhere but at the end anchors the pattern to the
+	// directory of the ignore file.
+	if strings.Contains(line, "/") {
+		rule.anchored = true
+		line = strings.TrimPrefix(line, "/")
+	}
+
+	if line == "" {
+		return ignoreRule{}, false
+	}
+	rule.pattern = line
+	return rule, true
+}
+
+// isIgnored reports whether the path (relative to basedir, slash
+// separated) is ignored. As in git, the last matching rule wins.
+func (m *ignoreMatcher) isIgnored(relPath string, isDir bool) bool {
+	ignored := false
+	for _, rule := range m.rules {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+
+		subPath := relPath
+		if rule.base != "" {
+			if !strings.HasPrefix(relPath, rule.base+"/") {
+				continue
+			}
+			subPath = strings.TrimPrefix(relPath, rule.base+"/")
+		}
+
+		pattern := rule.pattern
+		if !rule.anchored {
+			pattern = "**/" + pattern
+		}
+		if matchGlob(pattern, subPath) {
+			ignored = !rule.negate
+		}
+	}
+	return ignored
+}
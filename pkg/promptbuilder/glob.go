@@ -0,0 +1,81 @@
+package promptbuilder
+
+import (
+	"path"
+	"strings"
+)
+
+// hasGlobMeta reports whether pattern contains any glob metacharacters.
+func hasGlobMeta(pattern string) bool {
+	return strings.ContainsAny(pattern, "*?[")
+}
+
+// foldCase returns s in lower case when ignoreCase is set, so that rules
+// and paths compare regardless of case.
+func foldCase(s string, ignoreCase bool) string {
+	if ignoreCase {
+		return strings.ToLower(s)
+	}
+	return s
+}
+
+// matchGlob matches a slash-separated path against a glob pattern.
+// Besides the usual path.Match syntax, a "**" segment matches zero or
+// more directories, so "src/**/*.go" matches both "src/main.go" and
+// "src/a/b/main.go".
+func matchGlob(pattern, name string) bool {
+	return matchSegments(splitPath(pattern), splitPath(name))
+}
+
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			// Collapse consecutive "**" segments
+			for len(pattern) > 0 && pattern[0] == "**" {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 0 {
+				return true
+			}
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern, name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+
+		if len(name) == 0 {
+			return false
+		}
+		ok, err := path.Match(pattern[0], name[0])
+		if err != nil || !ok {
+			return false
+		}
+		pattern = pattern[1:]
+		name = name[1:]
+	}
+
+	return len(name) == 0
+}
+
+// globBase returns the leading part of pattern that contains no glob
+// metacharacters, which is the directory a walk has to start from.
+func globBase(pattern string) string {
+	var base []string
+	for _, segment := range splitPath(pattern) {
+		if hasGlobMeta(segment) {
+			break
+		}
+		base = append(base, segment)
+	}
+	return strings.Join(base, "/")
+}
+
+func splitPath(p string) []string {
+	p = strings.Trim(p, "/")
+	if p == "" || p == "." {
+		return nil
+	}
+	return strings.Split(p, "/")
+}
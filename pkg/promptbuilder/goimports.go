@@ -0,0 +1,210 @@
+package promptbuilder
+
+import (
+	"bufio"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// goModule is the Go module that basedir belongs to.
+type goModule struct {
+	path string // module path declared in go.mod
+	dir  string // directory holding go.mod
+}
+
+// findGoModule looks for the go.mod of dir in dir and its parents.
+func findGoModule(src sourceFS, dir string) (goModule, bool) {
+	for {
+		if path := readModulePath(src, filepath.Join(dir, "go.mod")); path != "" {
+			return goModule{path: path, dir: dir}, true
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return goModule{}, false
+		}
+		dir = parent
+	}
+}
+
+// readModulePath returns the module path declared in a go.mod file, or ""
+// when the file does not exist or declares none.
+func readModulePath(src sourceFS, goMod string) string {
+	file, err := src.open(goMod)
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == "module" {
+			if path, err := strconv.Unquote(fields[1]); err == nil {
+				return path
+			}
+			return fields[1]
+		}
+	}
+	return ""
+}
+
+// packageDir returns the directory of an import path of the module, or
+// false for imports of other modules and the standard library.
+func (m goModule) packageDir(importPath string) (string, bool) {
+	if importPath == m.path {
+		return m.dir, true
+	}
+	if rest, ok := strings.CutPrefix(importPath, m.path+"/"); ok {
+		return filepath.Join(m.dir, filepath.FromSlash(rest)), true
+	}
+	return "", false
+}
+
+// isGoSource reports whether path is a Go file that is part of its
+// package's build, rather than a test.
+func isGoSource(path string) bool {
+	return strings.HasSuffix(path, ".go") && !strings.HasSuffix(path, "_test.go")
+}
+
+// goImports returns the import paths of the Go files, parsing only their
+// import declarations.
+func goImports(src sourceFS, paths []string) []string {
+	seen := make(map[string]bool)
+	var imports []string
+	fset := token.NewFileSet()
+	for _, path := range paths {
+		content, err := src.readFile(path)
+		if err != nil {
+			continue
+		}
+		file, err := parser.ParseFile(fset, path, content, parser.ImportsOnly)
+		if err != nil {
+			continue
+		}
+		for _, spec := range file.Imports {
+			importPath, err := strconv.Unquote(spec.Path.Value)
+			if err == nil && !seen[importPath] {
+				seen[importPath] = true
+				imports = append(imports, importPath)
+			}
+		}
+	}
+	return imports
+}
+
+// packageFiles returns the non-test Go files of the package in dir.
+func packageFiles(src sourceFS, dir string) []string {
+	entries, err := src.readDir(dir)
+	if err != nil {
+		return nil
+	}
+	var files []string
+	for _, entry := range entries {
+		if !entry.IsDir() && isGoSource(entry.Name()) {
+			files = append(files, filepath.Join(dir, entry.Name()))
+		}
+	}
+	return files
+}
+
+// followImports adds the Go packages of the module that the included Go
+// files import, directly or, up to FollowImportsDepth levels, through
+// other packages of the module. Packages outside basedir, and files
+// excluded by the exclude rules, are left out. Added files belong to the
+// include of the file that first imported them.
+func (b *Builder) followImports(files []SourceFile) []SourceFile {
+	config := b.config
+	module, ok := findGoModule(b.src, config.BaseDir)
+	if !ok {
+		b.warnf("followImports needs a go.mod in basedir or one of its parents")
+		return files
+	}
+	baseDir := config.BaseDir
+
+	included := make(map[string]bool, len(files))
+	for _, file := range files {
+		included[filepath.Join(baseDir, file.RelPath)] = true
+	}
+
+	// The included files start the walk; every level then follows the
+	// imports of all files of the packages found on the previous one
+	type pending struct {
+		paths   []string
+		include *Include
+	}
+	var level []pending
+	for _, file := range files {
+		if isGoSource(file.RelPath) {
+			level = append(level, pending{[]string{filepath.Join(baseDir, file.RelPath)}, file.Include})
+		}
+	}
+
+	visited := make(map[string]bool)
+	var added []SourceFile
+	for depth := 1; len(level) > 0 && (config.FollowImportsDepth == 0 || depth <= config.FollowImportsDepth); depth++ {
+		var next []pending
+		for _, p := range level {
+			for _, importPath := range goImports(b.src, p.paths) {
+				dir, ok := module.packageDir(importPath)
+				if !ok || visited[dir] {
+					continue
+				}
+				visited[dir] = true
+
+				rel, err := filepath.Rel(baseDir, dir)
+				if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+					continue
+				}
+				pkgFiles := packageFiles(b.src, dir)
+				inExcludedFolder := b.inExcludedFolder(rel)
+				for _, path := range pkgFiles {
+					relPath := filepath.Join(rel, filepath.Base(path))
+					if included[path] || excludeReason(filepath.Join(config.BaseDir, relPath), config, inExcludedFolder) != "" {
+						continue
+					}
+					included[path] = true
+					added = append(added, SourceFile{RelPath: relPath, Include: p.include})
+				}
+				next = append(next, pending{pkgFiles, p.include})
+			}
+		}
+		level = next
+	}
+
+	if len(added) == 0 {
+		return files
+	}
+	sort.SliceStable(added, func(i, j int) bool {
+		return added[i].RelPath < added[j].RelPath
+	})
+	b.infof("Following imports added %d files", len(added))
+	if config.ExcludeLargerThan > 0 {
+		added = b.excludeLargeFiles(added)
+	}
+	return append(files, added...)
+}
+
+// inExcludedFolder reports whether the folder at rel, relative to basedir,
+// or one of its parents is excluded and not re-included.
+func (b *Builder) inExcludedFolder(rel string) bool {
+	config := b.config
+	excluded := false
+	dir := config.BaseDir
+	for _, name := range strings.Split(filepath.ToSlash(rel), "/") {
+		if name == "." {
+			continue
+		}
+		dir = filepath.Join(dir, name)
+		if isExcludedFolder(dir, config.BaseDir, config.ExcludeFolders, config.IgnoreCase) {
+			excluded = true
+		}
+		if excluded && isReincluded(dir, config.BaseDir, config.ReincludeFolders, config.IgnoreCase) {
+			excluded = false
+		}
+	}
+	return excluded
+}
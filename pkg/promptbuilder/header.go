@@ -0,0 +1,92 @@
+package promptbuilder
+
+import (
+	"context"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// expandPlaceholders replaces placeholders such as {{.Date}} or
+// {{.FileCount}} in the header or footer text, along with the variables
+// defined with "var". Text without "{{" is returned unchanged.
+func (b *Builder) expandPlaceholders(ctx context.Context, text string, fileCount int, totalTokens int) (string, error) {
+	if !strings.Contains(text, "{{") {
+		return text, nil
+	}
+
+	tmpl, err := template.New("text").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return text, err
+	}
+
+	now := time.Now()
+	data := map[string]any{}
+	for name, value := range b.config.Vars {
+		data[name] = value
+	}
+	data["Date"] = now.Format(time.DateOnly)
+	data["Time"] = now.Format(time.RFC3339)
+	data["FileCount"] = fileCount
+	data["TotalTokens"] = totalTokens
+	data["Model"] = b.model
+	data["Branch"] = ""
+	data["Commit"] = ""
+	if !b.noGit {
+		if branch, err := gitBranch(ctx, b.config.gitDir(), b.config.gitHead()); err == nil {
+			data["Branch"] = branch
+		}
+		if commit, err := runGit(ctx, b.config.gitDir(), "rev-parse", "--short", b.config.gitHead()); err == nil {
+			data["Commit"] = strings.TrimSpace(commit)
+		}
+	}
+
+	var out strings.Builder
+	if err := tmpl.Execute(&out, data); err != nil {
+		return text, err
+	}
+	return out.String(), nil
+}
+
+// OutputPath expands placeholders in the path of the output file, such as
+// prompts/{{.Profile}}-{{.Date}}-{{.ShortHash}}.md, so that every
+// generation is archived under its own name. Profile is the name of the
+// input file without its extension. There is no {{.Time}}, which is
+// RFC 3339 in the header and has colons that file names cannot hold;
+// {{.Timestamp}} names a file by the second. Paths without "{{" are
+// returned unchanged.
+func (b *Builder) OutputPath(ctx context.Context, pattern string, profile string) (string, error) {
+	if !strings.Contains(pattern, "{{") {
+		return pattern, nil
+	}
+
+	tmpl, err := template.New("output").Option("missingkey=error").Parse(pattern)
+	if err != nil {
+		return pattern, err
+	}
+
+	now := time.Now()
+	data := map[string]any{}
+	for name, value := range b.config.Vars {
+		data[name] = value
+	}
+	data["Profile"] = profile
+	data["Date"] = now.Format(time.DateOnly)
+	data["Timestamp"] = now.Format("20060102-150405")
+	data["Model"] = b.model
+	data["Branch"] = ""
+	data["ShortHash"] = ""
+	if branch, err := gitBranch(ctx, b.config.gitDir(), b.config.gitHead()); err == nil {
+		// Branches such as feature/login would otherwise add a directory
+		data["Branch"] = strings.ReplaceAll(branch, "/", "-")
+	}
+	if commit, err := runGit(ctx, b.config.gitDir(), "rev-parse", "--short", b.config.gitHead()); err == nil {
+		data["ShortHash"] = strings.TrimSpace(commit)
+	}
+
+	var out strings.Builder
+	if err := tmpl.Execute(&out, data); err != nil {
+		return pattern, err
+	}
+	return out.String(), nil
+}
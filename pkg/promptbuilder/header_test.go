@@ -0,0 +1,42 @@
+package promptbuilder
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTimePlaceholders(t *testing.T) {
+	config := testConfig(t, "basedir="+t.TempDir(), "include=.")
+	builder, err := New(config)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	ctx := context.Background()
+
+	header, err := builder.expandPlaceholders(ctx, "{{.Date}} {{.Time}}", 0, 0)
+	if err != nil {
+		t.Fatalf("expandPlaceholders: %v", err)
+	}
+	date, clock, _ := strings.Cut(header, " ")
+	if _, err := time.Parse(time.DateOnly, date); err != nil {
+		t.Errorf("{{.Date}} of the header = %q: %v", date, err)
+	}
+	if _, err := time.Parse(time.RFC3339, clock); err != nil {
+		t.Errorf("{{.Time}} of the header = %q: %v", clock, err)
+	}
+
+	path, err := builder.OutputPath(ctx, "out/{{.Profile}}-{{.Date}}-{{.Timestamp}}.md", "review")
+	if err != nil {
+		t.Fatalf("OutputPath: %v", err)
+	}
+	if !regexp.MustCompile(`^out/review-\d{4}-\d\d-\d\d-\d{8}-\d{6}\.md$`).MatchString(path) {
+		t.Errorf("OutputPath = %q", path)
+	}
+	// {{.Time}} would put colons in the file name
+	if path, err := builder.OutputPath(ctx, "out-{{.Time}}.md", "review"); err == nil {
+		t.Errorf("OutputPath with {{.Time}} = %q, want an error", path)
+	}
+}
@@ -0,0 +1,296 @@
+package promptbuilder
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultHistoryDir is the history directory used by "history=true".
+const DefaultHistoryDir = ".promptbuilder-history"
+
+// historyManifest is the file list of a generation, stored as files.json
+// in its directory of the history.
+const historyManifest = "files.json"
+
+// historyStamp names the directory of a generation, so that the
+// directories sort by the time they were written.
+const historyStamp = "20060102-150405.000"
+
+type historyFile struct {
+	Path   string `json:"path"`
+	Hash   string `json:"hash"`
+	Tokens int    `json:"tokens"`
+}
+
+type historyEntry struct {
+	GeneratedAt string        `json:"generatedAt"`
+	Outputs     []string      `json:"outputs"`
+	TotalTokens int           `json:"totalTokens"`
+	Files       []historyFile `json:"files"`
+}
+
+// HistoryDiff tells which files changed between two generations kept in
+// the history. The paths are relative to basedir.
+type HistoryDiff struct {
+	From      string // directory of the older generation
+	To        string // directory of the newer generation
+	Added     []string
+	Removed   []string
+	Changed   []string
+	Unchanged int
+	Tokens    int // tokens of the newer generation minus the older one
+}
+
+// Manifest holds the hash of the processed content of every file of a
+// generation, by path relative to basedir.
+type Manifest map[string]string
+
+// ReadManifest reads the file list of a generation kept in the history:
+// path is its files.json, its directory, or the history directory, which
+// stands for the latest generation.
+func ReadManifest(path string) (Manifest, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	dir := filepath.Dir(path)
+	if info.IsDir() {
+		dir = path
+		if _, err := os.Stat(filepath.Join(dir, historyManifest)); err != nil {
+			generations, err := historyGenerations(dir)
+			if err != nil {
+				return nil, err
+			}
+			if len(generations) == 0 {
+				return nil, fmt.Errorf("%s holds no generations", dir)
+			}
+			dir = filepath.Join(dir, generations[len(generations)-1])
+		}
+	}
+
+	entry, err := readHistoryEntry(dir)
+	if err != nil {
+		return nil, err
+	}
+	manifest := make(Manifest, len(entry.Files))
+	for _, f := range entry.Files {
+		manifest[f.Path] = f.Hash
+	}
+	return manifest, nil
+}
+
+// WithPrevious leaves out the files whose content is the same as in
+// manifest, so that the prompt only holds what changed since a previous
+// one. A note before the files says so, and names the files of manifest
+// that are no longer included.
+func WithPrevious(manifest Manifest) Option {
+	return func(b *Builder) {
+		b.previous = manifest
+	}
+}
+
+// contentHash identifies the processed content of a file, so that the
+// history can tell which files changed between two generations.
+func contentHash(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:8])
+}
+
+// HistoryDir returns the absolute history directory, or "" when the
+// history is off.
+func (c *Config) HistoryDir() string {
+	if c.History == "" || filepath.IsAbs(c.History) {
+		return c.History
+	}
+	return filepath.Join(c.BaseDir, c.History)
+}
+
+// SaveHistory keeps a generation in the history directory of the
+// configuration: the list of files of the report with a hash of their
+// content, and a copy of the output files. outputs is empty when the
+// prompt went to stdout. It returns the directory of the generation.
+func (b *Builder) SaveHistory(report *Report, outputs []string) (string, error) {
+	now := time.Now()
+	dir := filepath.Join(b.config.HistoryDir(), now.Format(historyStamp))
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", fmt.Errorf("error creating history directory: %v", err)
+	}
+
+	var names []string
+	for _, output := range outputs {
+		name := filepath.Base(output)
+		if err := copyFile(output, filepath.Join(dir, name)); err != nil {
+			return "", fmt.Errorf("error copying output to the history: %v", err)
+		}
+		names = append(names, name)
+	}
+	if err := report.writeManifest(dir, now, names); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+// WriteManifest writes the list of files of the report, with a hash of
+// their content, as files.json in dir, where ReadManifest finds it.
+func (r *Report) WriteManifest(dir string) error {
+	return r.writeManifest(dir, time.Now(), nil)
+}
+
+func (r *Report) writeManifest(dir string, now time.Time, outputs []string) error {
+	entry := historyEntry{
+		GeneratedAt: now.Format(time.RFC3339),
+		Outputs:     append([]string{}, outputs...),
+		TotalTokens: r.TotalTokens,
+		Files:       []historyFile{},
+	}
+	// Files left out by WithPrevious are still part of the generation
+	for _, f := range append(r.Files, r.Unchanged...) {
+		entry.Files = append(entry.Files, historyFile{Path: f.Path, Hash: f.Hash, Tokens: f.Tokens})
+	}
+
+	data, err := json.MarshalIndent(entry, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, historyManifest), append(data, '\n'), 0o644)
+}
+
+func copyFile(src string, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// DiffHistory compares the last two generations kept in dir.
+func DiffHistory(dir string) (*HistoryDiff, error) {
+	generations, err := historyGenerations(dir)
+	if err != nil {
+		return nil, err
+	}
+	if len(generations) < 2 {
+		return nil, fmt.Errorf("%s holds %d generations, at least two are needed", dir, len(generations))
+	}
+
+	from, err := readHistoryEntry(filepath.Join(dir, generations[len(generations)-2]))
+	if err != nil {
+		return nil, err
+	}
+	to, err := readHistoryEntry(filepath.Join(dir, generations[len(generations)-1]))
+	if err != nil {
+		return nil, err
+	}
+
+	diff := &HistoryDiff{
+		From:   generations[len(generations)-2],
+		To:     generations[len(generations)-1],
+		Tokens: to.TotalTokens - from.TotalTokens,
+	}
+	old := make(map[string]string, len(from.Files))
+	for _, f := range from.Files {
+		old[f.Path] = f.Hash
+	}
+	for _, f := range to.Files {
+		hash, ok := old[f.Path]
+		switch {
+		case !ok:
+			diff.Added = append(diff.Added, f.Path)
+		case hash != f.Hash:
+			diff.Changed = append(diff.Changed, f.Path)
+		default:
+			diff.Unchanged++
+		}
+		delete(old, f.Path)
+	}
+	for path := range old {
+		diff.Removed = append(diff.Removed, path)
+	}
+	sort.Strings(diff.Added)
+	sort.Strings(diff.Removed)
+	sort.Strings(diff.Changed)
+	return diff, nil
+}
+
+// historyGenerations returns the directories of the generations kept in
+// dir, oldest first.
+func historyGenerations(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var generations []string
+	for _, entry := range entries {
+		if _, err := os.Stat(filepath.Join(dir, entry.Name(), historyManifest)); entry.IsDir() && err == nil {
+			generations = append(generations, entry.Name())
+		}
+	}
+	sort.Strings(generations)
+	return generations, nil
+}
+
+func readHistoryEntry(dir string) (*historyEntry, error) {
+	path := filepath.Join(dir, historyManifest)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var entry historyEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, fmt.Errorf("error parsing %s: %v", path, err)
+	}
+	return &entry, nil
+}
+
+// dropUnchanged removes the sections whose content is the same as in the
+// previous manifest and returns the rest, with the note that tells the
+// model which files follow.
+func (b *Builder) dropUnchanged(sections []fileSection, report *Report) ([]fileSection, string) {
+	var kept []fileSection
+	current := make(map[string]bool, len(sections))
+	for _, section := range sections {
+		current[section.File.RelPath] = true
+		if b.previous[section.File.RelPath] == section.Hash {
+			report.Unchanged = append(report.Unchanged, section.report())
+			b.skip(filepath.ToSlash(section.File.RelPath), "unchanged")
+			continue
+		}
+		kept = append(kept, section)
+	}
+	b.infof("Left out %d files unchanged since the previous prompt", len(report.Unchanged))
+
+	var deleted []string
+	for path := range b.previous {
+		if !current[path] {
+			deleted = append(deleted, b.outputPath(path))
+		}
+	}
+	sort.Strings(deleted)
+
+	note := "Updated files since the previous context. Files not shown here are unchanged."
+	if len(kept) == 0 {
+		note = "No files changed since the previous context."
+	}
+	if len(deleted) > 0 {
+		note += "\nNo longer part of the context: " + strings.Join(deleted, ", ")
+	}
+	return kept, note
+}
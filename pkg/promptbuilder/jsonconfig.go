@@ -0,0 +1,97 @@
+package promptbuilder
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ParseConfigJSON parses a configuration written as a JSON object. Keys
+// work like the YAML and TOML keys: every key is the directive of the same
+// name, arrays repeat it, and "header" and "footer" hold the header and
+// footer text.
+func ParseConfigJSON(data []byte, opts ...ParseOption) (*Config, error) {
+	m, err := parseJSON(string(data))
+	if err != nil {
+		return nil, err
+	}
+	return configFromMapping(m, opts...)
+}
+
+// ParseOption configures how a config is parsed.
+type ParseOption func(*Config)
+
+// WithoutExpansion takes paths as written instead of expanding $NAME and
+// a leading ~, for configs that come from an untrusted source, which must
+// not read the environment of the process.
+func WithoutExpansion() ParseOption {
+	return func(c *Config) {
+		c.noExpand = true
+	}
+}
+
+// parseJSON parses a JSON object into a mapping, keeping the order of the
+// keys. Numbers and booleans become strings, like unquoted YAML scalars.
+func parseJSON(data string) (*mapping, error) {
+	dec := json.NewDecoder(strings.NewReader(data))
+	dec.UseNumber()
+
+	value, err := jsonValue(dec)
+	if err != nil {
+		return nil, fmt.Errorf("json: %v", err)
+	}
+	m, ok := value.(*mapping)
+	if !ok {
+		return nil, fmt.Errorf("json: config must be an object")
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, fmt.Errorf("json: unexpected content after the config")
+	}
+	return m, nil
+}
+
+func jsonValue(dec *json.Decoder) (any, error) {
+	token, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch t := token.(type) {
+	case json.Delim:
+		if t == '{' {
+			m := newMapping()
+			for dec.More() {
+				key, err := dec.Token()
+				if err != nil {
+					return nil, err
+				}
+				value, err := jsonValue(dec)
+				if err != nil {
+					return nil, err
+				}
+				m.set(key.(string), value)
+			}
+			_, err := dec.Token()
+			return m, err
+		}
+
+		var list []any
+		for dec.More() {
+			value, err := jsonValue(dec)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, value)
+		}
+		_, err := dec.Token()
+		return list, err
+	case string:
+		return t, nil
+	case json.Number:
+		return t.String(), nil
+	case bool:
+		return fmt.Sprint(t), nil
+	}
+	return nil, fmt.Errorf("null values are not supported")
+}
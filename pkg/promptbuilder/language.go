@@ -0,0 +1,93 @@
+package promptbuilder
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// languagesByExtension maps file extensions to the language names used
+// in markdown code fences.
+var languagesByExtension = map[string]string{
+	".bash":       "bash",
+	".bat":        "batch",
+	".c":          "c",
+	".cc":         "cpp",
+	".cjs":        "javascript",
+	".clj":        "clojure",
+	".cpp":        "cpp",
+	".cs":         "csharp",
+	".css":        "css",
+	".csproj":     "xml",
+	".dart":       "dart",
+	".dockerfile": "dockerfile",
+	".docx":       "markdown",
+	".ex":         "elixir",
+	".exs":        "elixir",
+	".fs":         "fsharp",
+	".go":         "go",
+	".gradle":     "groovy",
+	".graphql":    "graphql",
+	".h":          "c",
+	".hpp":        "cpp",
+	".hs":         "haskell",
+	".html":       "html",
+	".ini":        "ini",
+	".ipynb":      "markdown",
+	".java":       "java",
+	".js":         "javascript",
+	".json":       "json",
+	".jsx":        "jsx",
+	".kt":         "kotlin",
+	".kts":        "kotlin",
+	".less":       "less",
+	".lua":        "lua",
+	".m":          "objectivec",
+	".md":         "markdown",
+	".mjs":        "javascript",
+	".pdf":        "text",
+	".php":        "php",
+	".pl":         "perl",
+	".proto":      "protobuf",
+	".ps1":        "powershell",
+	".py":         "python",
+	".r":          "r",
+	".rb":         "ruby",
+	".rs":         "rust",
+	".sass":       "sass",
+	".scala":      "scala",
+	".scss":       "scss",
+	".sh":         "bash",
+	".sql":        "sql",
+	".svelte":     "svelte",
+	".swift":      "swift",
+	".tf":         "hcl",
+	".toml":       "toml",
+	".ts":         "typescript",
+	".tsx":        "tsx",
+	".vue":        "vue",
+	".xml":        "xml",
+	".yaml":       "yaml",
+	".yml":        "yaml",
+	".zig":        "zig",
+	".zsh":        "bash",
+}
+
+// languagesByName covers well-known files that have no extension.
+var languagesByName = map[string]string{
+	"dockerfile":  "dockerfile",
+	"makefile":    "makefile",
+	"gnumakefile": "makefile",
+	"jenkinsfile": "groovy",
+	"go.mod":      "go",
+	"go.sum":      "text",
+}
+
+// detectLanguage returns the language of a file based on its name, or an
+// empty string if it is not known.
+func detectLanguage(path string) string {
+	name := strings.ToLower(filepath.Base(path))
+	if lang, ok := languagesByName[name]; ok {
+		return lang
+	}
+	return languagesByExtension[strings.ToLower(filepath.Ext(name))]
+}
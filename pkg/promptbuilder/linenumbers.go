@@ -0,0 +1,76 @@
+package promptbuilder
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// numberLines prefixes every line of content with its number, padded to
+// the width of the largest one, followed by "| ".
+func numberLines(content string) string {
+	if content == "" {
+		return content
+	}
+
+	lines := strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+	width := len(strconv.Itoa(len(lines)))
+
+	var b strings.Builder
+	for i, line := range lines {
+		fmt.Fprintf(&b, "%*d| %s\n", width, i+1, line)
+	}
+
+	if !strings.HasSuffix(content, "\n") {
+		return strings.TrimSuffix(b.String(), "\n")
+	}
+	return b.String()
+}
+
+// excerptLines keeps the lines of content in ranges, prefixed with their
+// numbers like numberLines, and marks the lines left out between and
+// around them with "...". Overlapping ranges are merged.
+func excerptLines(content string, ranges []LineRange) string {
+	lines := strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+	ranges = append([]LineRange(nil), ranges...)
+	sort.Slice(ranges, func(i, j int) bool {
+		return ranges[i].Start < ranges[j].Start
+	})
+
+	var merged []LineRange
+	for _, r := range ranges {
+		r.End = min(r.End, len(lines))
+		if r.Start > r.End {
+			continue
+		}
+		if n := len(merged); n > 0 && r.Start <= merged[n-1].End+1 {
+			merged[n-1].End = max(merged[n-1].End, r.End)
+			continue
+		}
+		merged = append(merged, r)
+	}
+	if len(merged) == 0 {
+		if content == "" {
+			return ""
+		}
+		return "...\n"
+	}
+
+	width := len(strconv.Itoa(merged[len(merged)-1].End))
+	var b strings.Builder
+	next := 1
+	for _, r := range merged {
+		if r.Start > next {
+			b.WriteString("...\n")
+		}
+		for i := r.Start; i <= r.End; i++ {
+			fmt.Fprintf(&b, "%*d| %s\n", width, i, lines[i-1])
+		}
+		next = r.End + 1
+	}
+	if next <= len(lines) {
+		b.WriteString("...\n")
+	}
+	return b.String()
+}
@@ -0,0 +1,226 @@
+package promptbuilder
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// Model providers supported by Client.
+const (
+	ProviderOpenAI    = "openai"
+	ProviderAnthropic = "anthropic"
+	ProviderOllama    = "ollama"
+)
+
+// Providers lists the supported model providers.
+var Providers = []string{ProviderOpenAI, ProviderAnthropic, ProviderOllama}
+
+// providerDefaults holds the defaults of a provider: its API endpoint,
+// the environment variables overriding it and holding the API key, its
+// default model, and the model family used to estimate its token counts.
+type providerDefaults struct {
+	baseURL    string
+	baseURLEnv string
+	keyEnv     string
+	model      string
+	tokens     string
+}
+
+var providers = map[string]providerDefaults{
+	ProviderOpenAI:    {"https://api.openai.com/v1", "OPENAI_BASE_URL", "OPENAI_API_KEY", "gpt-4o", "gpt-4o"},
+	ProviderAnthropic: {"https://api.anthropic.com/v1", "ANTHROPIC_BASE_URL", "ANTHROPIC_API_KEY", "claude-sonnet-4-5", "claude"},
+	ProviderOllama:    {"http://localhost:11434", "OLLAMA_HOST", "", "llama3.1", "llama"},
+}
+
+// anthropicMaxTokens is the response limit sent to Anthropic, whose API
+// requires one.
+const anthropicMaxTokens = 8192
+
+// Message is a chat message. Role is "system", "user" or "assistant".
+type Message struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// Client calls the chat API of a model provider.
+type Client struct {
+	Provider   string
+	Model      string
+	APIKey     string
+	BaseURL    string
+	HTTPClient *http.Client
+}
+
+// NewClient returns a client for the provider, with its API key and
+// endpoint read from the environment (OPENAI_API_KEY, ANTHROPIC_API_KEY,
+// OPENAI_BASE_URL, ANTHROPIC_BASE_URL, OLLAMA_HOST). An empty model
+// selects the provider's default model.
+func NewClient(provider string, model string) (*Client, error) {
+	defaults, ok := providers[provider]
+	if !ok {
+		return nil, fmt.Errorf("unknown provider %q (supported: %s)", provider, strings.Join(Providers, ", "))
+	}
+
+	client := &Client{
+		Provider:   provider,
+		Model:      model,
+		BaseURL:    defaults.baseURL,
+		HTTPClient: http.DefaultClient,
+	}
+	if client.Model == "" {
+		client.Model = defaults.model
+	}
+	if baseURL := os.Getenv(defaults.baseURLEnv); baseURL != "" {
+		if !strings.Contains(baseURL, "://") {
+			baseURL = "http://" + baseURL
+		}
+		client.BaseURL = strings.TrimRight(baseURL, "/")
+	}
+	if defaults.keyEnv != "" {
+		client.APIKey = os.Getenv(defaults.keyEnv)
+		if client.APIKey == "" {
+			return nil, fmt.Errorf("%s is not set", defaults.keyEnv)
+		}
+	}
+
+	return client, nil
+}
+
+// ProviderTokenModel returns the model family used to estimate the token
+// counts of a provider's models.
+func ProviderTokenModel(provider string) string {
+	if defaults, ok := providers[provider]; ok {
+		return defaults.tokens
+	}
+	return DefaultModel
+}
+
+// Chat sends the messages and returns the text of the model's reply.
+func (c *Client) Chat(ctx context.Context, messages []Message) (string, error) {
+	switch c.Provider {
+	case ProviderOpenAI:
+		var response struct {
+			Choices []struct {
+				Message Message `json:"message"`
+			} `json:"choices"`
+		}
+		request := map[string]any{"model": c.Model, "messages": messages}
+		headers := map[string]string{"Authorization": "Bearer " + c.APIKey}
+		if err := c.post(ctx, "/chat/completions", headers, request, &response); err != nil {
+			return "", err
+		}
+		if len(response.Choices) == 0 {
+			return "", fmt.Errorf("openai returned no choices")
+		}
+		return response.Choices[0].Message.Content, nil
+
+	case ProviderAnthropic:
+		var response struct {
+			Content []struct {
+				Type string `json:"type"`
+				Text string `json:"text"`
+			} `json:"content"`
+		}
+		// System messages go in a separate field
+		var system []string
+		var chat []Message
+		for _, message := range messages {
+			if message.Role == "system" {
+				system = append(system, message.Content)
+			} else {
+				chat = append(chat, message)
+			}
+		}
+		request := map[string]any{"model": c.Model, "max_tokens": anthropicMaxTokens, "messages": chat}
+		if len(system) > 0 {
+			request["system"] = strings.Join(system, "\n\n")
+		}
+		headers := map[string]string{"x-api-key": c.APIKey, "anthropic-version": "2023-06-01"}
+		if err := c.post(ctx, "/messages", headers, request, &response); err != nil {
+			return "", err
+		}
+		var text strings.Builder
+		for _, block := range response.Content {
+			if block.Type == "text" {
+				text.WriteString(block.Text)
+			}
+		}
+		return text.String(), nil
+
+	case ProviderOllama:
+		var response struct {
+			Message Message `json:"message"`
+		}
+		request := map[string]any{"model": c.Model, "messages": messages, "stream": false}
+		if err := c.post(ctx, "/api/chat", nil, request, &response); err != nil {
+			return "", err
+		}
+		return response.Message.Content, nil
+	}
+
+	return "", fmt.Errorf("unknown provider %q", c.Provider)
+}
+
+// post sends request as JSON to the endpoint and decodes the JSON response
+// into response.
+func (c *Client) post(ctx context.Context, endpoint string, headers map[string]string, request any, response any) error {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.BaseURL+endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("error calling %s: %v", c.Provider, err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("error reading %s response: %v", c.Provider, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %s: %s", c.Provider, resp.Status, apiErrorMessage(data))
+	}
+	if err := json.Unmarshal(data, response); err != nil {
+		return fmt.Errorf("invalid %s response: %v", c.Provider, err)
+	}
+	return nil
+}
+
+// apiErrorMessage extracts the message of an API error response, which is
+// {"error": {"message": ...}} for OpenAI and Anthropic and
+// {"error": "..."} for Ollama.
+func apiErrorMessage(data []byte) string {
+	var body struct {
+		Error json.RawMessage `json:"error"`
+	}
+	if json.Unmarshal(data, &body) == nil && len(body.Error) > 0 {
+		var message string
+		if json.Unmarshal(body.Error, &message) == nil {
+			return message
+		}
+		var nested struct {
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(body.Error, &nested) == nil && nested.Message != "" {
+			return nested.Message
+		}
+	}
+	return strings.TrimSpace(string(data))
+}
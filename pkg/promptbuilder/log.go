@@ -0,0 +1,80 @@
+package promptbuilder
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+)
+
+// discardLog drops every message.
+var discardLog = slog.New(NewLogHandler(io.Discard, slog.LevelError+1))
+
+// logHandler writes log records as plain lines, the way promptbuilder has
+// always printed its messages: warnings and errors get a "Warning: " or
+// "Error: " prefix, other messages are written as they are. Attributes
+// are left out; use a JSON handler to get them.
+type logHandler struct {
+	mu    *sync.Mutex
+	w     io.Writer
+	level slog.Leveler
+}
+
+// NewLogHandler returns a slog.Handler that writes the messages of the
+// records at or above level to w, one per line.
+func NewLogHandler(w io.Writer, level slog.Leveler) slog.Handler {
+	if level == nil {
+		level = slog.LevelInfo
+	}
+	return &logHandler{mu: &sync.Mutex{}, w: w, level: level}
+}
+
+func (h *logHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+func (h *logHandler) Handle(_ context.Context, r slog.Record) error {
+	var prefix string
+	switch {
+	case r.Level >= slog.LevelError:
+		prefix = "Error: "
+	case r.Level >= slog.LevelWarn:
+		prefix = "Warning: "
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := io.WriteString(h.w, prefix+strings.TrimSuffix(r.Message, "\n")+"\n")
+	return err
+}
+
+func (h *logHandler) WithAttrs([]slog.Attr) slog.Handler {
+	return h
+}
+
+func (h *logHandler) WithGroup(string) slog.Handler {
+	return h
+}
+
+// debugf, infof and warnf log a formatted message at their level.
+func (b *Builder) debugf(format string, args ...any) {
+	b.logAt(slog.LevelDebug, format, args...)
+}
+
+func (b *Builder) infof(format string, args ...any) {
+	b.logAt(slog.LevelInfo, format, args...)
+}
+
+func (b *Builder) warnf(format string, args ...any) {
+	b.recordWarning(format, fmt.Sprintf(format, args...))
+	b.logAt(slog.LevelWarn, format, args...)
+}
+
+func (b *Builder) logAt(level slog.Level, format string, args ...any) {
+	ctx := context.Background()
+	if b.log.Enabled(ctx, level) {
+		b.log.Log(ctx, level, fmt.Sprintf(format, args...))
+	}
+}
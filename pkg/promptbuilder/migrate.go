@@ -0,0 +1,581 @@
+package promptbuilder
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+)
+
+// Tools whose settings can be converted into an input file.
+const (
+	ToolRepomix       = "repomix"
+	ToolFilesToPrompt = "files-to-prompt"
+	ToolCode2Prompt   = "code2prompt"
+)
+
+// Directive is a key=value line of an input file.
+type Directive struct {
+	Key   string
+	Value string
+}
+
+// Migration is an input file converted from the settings of another tool.
+type Migration struct {
+	// Tool is the tool the settings come from.
+	Tool string
+	// Header is the header text of the input file, if any.
+	Header string
+	// Directives are the converted settings, in order.
+	Directives []Directive
+	// Flags are the flags to run promptbuilder with for the settings that
+	// have no directive, such as the output file and format.
+	Flags []string
+	// Notes describe the settings that were left out or only approximated.
+	Notes []string
+	// DefaultExcludes is set when the tool excluded the usual dependency
+	// and build folders on its own, which presets do in promptbuilder.
+	DefaultExcludes bool
+}
+
+func (m *Migration) add(key, value string) {
+	m.Directives = append(m.Directives, Directive{Key: key, Value: value})
+}
+
+func (m *Migration) note(format string, args ...any) {
+	m.Notes = append(m.Notes, fmt.Sprintf(format, args...))
+}
+
+// IsTool reports whether name is a command whose arguments MigrateCommand
+// converts.
+func IsTool(name string) bool {
+	name = path.Base(name)
+	return name == ToolFilesToPrompt || name == ToolCode2Prompt
+}
+
+// MigrateRepomix converts a repomix.config.json file.
+func MigrateRepomix(data []byte) (*Migration, error) {
+	var config struct {
+		Input struct {
+			MaxFileSize int64 `json:"maxFileSize"`
+		} `json:"input"`
+		Output struct {
+			FilePath            string `json:"filePath"`
+			Style               string `json:"style"`
+			HeaderText          string `json:"headerText"`
+			InstructionFilePath string `json:"instructionFilePath"`
+			FileSummary         *bool  `json:"fileSummary"`
+			DirectoryStructure  *bool  `json:"directoryStructure"`
+			RemoveComments      bool   `json:"removeComments"`
+			RemoveEmptyLines    bool   `json:"removeEmptyLines"`
+			ShowLineNumbers     bool   `json:"showLineNumbers"`
+			CopyToClipboard     bool   `json:"copyToClipboard"`
+			Git                 struct {
+				SortByChanges bool `json:"sortByChanges"`
+				IncludeDiffs  bool `json:"includeDiffs"`
+			} `json:"git"`
+		} `json:"output"`
+		Include []string `json:"include"`
+		Ignore  struct {
+			UseGitignore       *bool    `json:"useGitignore"`
+			UseDefaultPatterns *bool    `json:"useDefaultPatterns"`
+			CustomPatterns     []string `json:"customPatterns"`
+		} `json:"ignore"`
+		Security struct {
+			EnableSecurityCheck *bool `json:"enableSecurityCheck"`
+		} `json:"security"`
+		TokenCount struct {
+			Encoding string `json:"encoding"`
+		} `json:"tokenCount"`
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("invalid repomix config: %v", err)
+	}
+
+	m := &Migration{Tool: ToolRepomix}
+	output := config.Output
+	m.Header = strings.TrimRight(output.HeaderText, "\n")
+
+	m.add("basedir", ".")
+	m.addIncludes(config.Include)
+	for _, pattern := range config.Ignore.CustomPatterns {
+		m.addExclude(pattern)
+	}
+	// repomix honors .gitignore and its default patterns unless told not to
+	if config.Ignore.UseGitignore == nil || *config.Ignore.UseGitignore {
+		m.add("useGitignore", "true")
+	}
+	m.DefaultExcludes = config.Ignore.UseDefaultPatterns == nil || *config.Ignore.UseDefaultPatterns
+	if config.Input.MaxFileSize > 0 {
+		m.add("excludeLargerThan", fmt.Sprint(config.Input.MaxFileSize))
+	}
+
+	if output.DirectoryStructure == nil || *output.DirectoryStructure {
+		m.add("tree", "true")
+	}
+	if output.RemoveComments {
+		m.add("stripComments", "true")
+	}
+	if output.RemoveEmptyLines {
+		m.add("collapseBlankLines", "true")
+		m.note("removeEmptyLines is converted to collapseBlankLines, which keeps single blank lines")
+	}
+	if output.ShowLineNumbers {
+		m.add("lineNumbers", "true")
+	}
+	if output.Git.IncludeDiffs {
+		m.add("gitDiff", "HEAD")
+	}
+	if output.Git.SortByChanges {
+		m.add("sort", "mtime")
+		m.add("reverse", "true")
+		m.note("git.sortByChanges is converted to sort=mtime, which puts the most recently modified files first")
+	}
+	if output.InstructionFilePath != "" {
+		m.add("footerFile", output.InstructionFilePath)
+	}
+	if config.Security.EnableSecurityCheck != nil && !*config.Security.EnableSecurityCheck {
+		m.add("redactSecrets", "false")
+	}
+
+	switch output.Style {
+	case "":
+	case "xml", "markdown", "json":
+		m.Flags = append(m.Flags, "-format", output.Style)
+	case "plain":
+		m.note("output.style=plain has no equivalent; the default markdown format is used")
+	default:
+		m.note("output.style=%s is not known", output.Style)
+	}
+	if output.FilePath != "" {
+		m.Flags = append(m.Flags, "-output", output.FilePath)
+	}
+	if output.FileSummary == nil || *output.FileSummary {
+		m.note("the file summary of repomix has no equivalent; describe the task in the header instead")
+	}
+	if output.CopyToClipboard {
+		m.note("output.copyToClipboard has no equivalent; use -output - and a clipboard command")
+	}
+	if config.TokenCount.Encoding != "" {
+		m.note("tokenCount.encoding is not converted; token counts follow the -model flag")
+	}
+	return m, nil
+}
+
+// MigrateCommand converts the arguments of a files-to-prompt or
+// code2prompt command line, args[0] being the command.
+func MigrateCommand(args []string) (*Migration, error) {
+	if len(args) == 0 || !IsTool(args[0]) {
+		return nil, fmt.Errorf("not a %s or %s command", ToolFilesToPrompt, ToolCode2Prompt)
+	}
+	if path.Base(args[0]) == ToolFilesToPrompt {
+		return migrateFilesToPrompt(args[1:])
+	}
+	return migrateCode2Prompt(args[1:])
+}
+
+// MigrateScript converts the first files-to-prompt or code2prompt command
+// of a shell script, such as a Makefile recipe or a CI step. A redirection
+// of its output becomes the -output flag.
+func MigrateScript(data []byte) (*Migration, error) {
+	script := strings.ReplaceAll(string(data), "\\\n", " ")
+	for _, line := range strings.Split(script, "\n") {
+		words, err := shellWords(line)
+		if err != nil {
+			return nil, err
+		}
+		for i, word := range words {
+			if !IsTool(word) {
+				continue
+			}
+			args := []string{word}
+			redirect := ""
+			for j := i + 1; j < len(words); j++ {
+				if words[j] == ">" || words[j] == ">>" {
+					if j+1 < len(words) {
+						redirect = words[j+1]
+					}
+					break
+				}
+				if isShellOperator(words[j]) {
+					break
+				}
+				args = append(args, words[j])
+			}
+
+			m, err := MigrateCommand(args)
+			if err != nil {
+				return nil, err
+			}
+			if redirect != "" {
+				m.Flags = append(m.Flags, "-output", redirect)
+			}
+			return m, nil
+		}
+	}
+	return nil, fmt.Errorf("no %s or %s command found", ToolFilesToPrompt, ToolCode2Prompt)
+}
+
+func migrateFilesToPrompt(args []string) (*Migration, error) {
+	options, paths, err := commandOptions(args, map[string]bool{
+		"-e": true, "--extension": true, "--ignore": true, "-o": true, "--output": true,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Migration{Tool: ToolFilesToPrompt}
+	m.add("basedir", ".")
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("%s: no paths given", ToolFilesToPrompt)
+	}
+	for _, p := range paths {
+		m.add("include", p)
+	}
+
+	useGitignore := true
+	filesOnly := false
+	var ignores []string
+	for _, option := range options {
+		switch option.name {
+		case "-e", "--extension":
+			m.add("includeExtension", strings.TrimPrefix(option.value, "."))
+		case "--include-hidden":
+			m.add("includeHidden", "true")
+		case "--ignore-gitignore":
+			useGitignore = false
+		case "--ignore-files-only":
+			filesOnly = true
+		case "--ignore":
+			ignores = append(ignores, option.value)
+		case "-n", "--line-numbers":
+			m.add("lineNumbers", "true")
+		case "-c", "--cxml":
+			m.Flags = append(m.Flags, "-format", FormatXML)
+		case "-m", "--markdown":
+			m.Flags = append(m.Flags, "-format", FormatMarkdown)
+		case "-o", "--output":
+			m.Flags = append(m.Flags, "-output", option.value)
+		case "-0", "--null":
+		default:
+			m.note("option %s has no equivalent", option.name)
+		}
+	}
+	// --ignore matches the names of files, and of folders too unless
+	// --ignore-files-only is given
+	for _, pattern := range ignores {
+		m.add("excludeFile", pattern)
+		if !filesOnly {
+			m.add("excludeFolder", pattern)
+		}
+	}
+	if useGitignore {
+		m.add("useGitignore", "true")
+	}
+	return m, nil
+}
+
+func migrateCode2Prompt(args []string) (*Migration, error) {
+	options, paths, err := commandOptions(args, map[string]bool{
+		"-i": true, "--include": true, "-e": true, "--exclude": true,
+		"-o": true, "--output": true, "-O": true, "--output-file": true,
+		"-F": true, "--output-format": true, "-t": true, "--template": true,
+		"--encoding": true, "--sort": true, "--tokens": true,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Migration{Tool: ToolCode2Prompt}
+	switch len(paths) {
+	case 0:
+		m.add("basedir", ".")
+	case 1:
+		m.add("basedir", paths[0])
+	default:
+		return nil, fmt.Errorf("%s: more than one path given", ToolCode2Prompt)
+	}
+
+	useGitignore := true
+	var includes, excludes []string
+	var settings []Directive
+	for _, option := range options {
+		switch option.name {
+		case "-i", "--include":
+			// In code2prompt, * also matches slashes
+			for _, pattern := range splitList(option.value) {
+				if hasGlobMeta(pattern) && !strings.Contains(pattern, "/") {
+					pattern = "**/" + pattern
+				}
+				includes = append(includes, pattern)
+			}
+		case "-e", "--exclude":
+			excludes = append(excludes, splitList(option.value)...)
+		case "--hidden":
+			settings = append(settings, Directive{"includeHidden", "true"})
+		case "--no-ignore":
+			useGitignore = false
+		case "-l", "--line-numbers", "--line-number":
+			settings = append(settings, Directive{"lineNumbers", "true"})
+		case "--absolute-paths":
+			settings = append(settings, Directive{"absolutePaths", "true"})
+		case "-d", "--diff":
+			settings = append(settings, Directive{"gitDiff", "HEAD"})
+		case "--sort":
+			switch option.value {
+			case "name_asc":
+				settings = append(settings, Directive{"sort", "path"})
+			case "name_desc":
+				settings = append(settings, Directive{"sort", "path"}, Directive{"reverse", "true"})
+			case "date_asc":
+				settings = append(settings, Directive{"sort", "mtime"})
+			case "date_desc":
+				settings = append(settings, Directive{"sort", "mtime"}, Directive{"reverse", "true"})
+			default:
+				m.note("--sort=%s is not known", option.value)
+			}
+		case "-o", "--output", "-O", "--output-file":
+			m.Flags = append(m.Flags, "-output", option.value)
+		case "-F", "--output-format":
+			m.Flags = append(m.Flags, "-format", option.value)
+		case "--json":
+			m.Flags = append(m.Flags, "-format", FormatJSON)
+		case "-t", "--template":
+			m.note("the template %s is a handlebars template, which cannot be converted; see -template", option.value)
+		case "-c", "--tokens", "--encoding", "--no-clipboard", "--exclude-from-tree", "--relative-paths":
+		default:
+			m.note("option %s has no equivalent", option.name)
+		}
+	}
+
+	m.addIncludes(includes)
+	for _, pattern := range excludes {
+		m.addExclude(pattern)
+	}
+	m.Directives = append(m.Directives, settings...)
+	if useGitignore {
+		m.add("useGitignore", "true")
+	}
+	return m, nil
+}
+
+// addIncludes converts glob patterns of the files to include. Patterns
+// such as "**/*.go" become includeExtension when all of them are of that
+// form, since includeExtension applies to every include.
+func (m *Migration) addIncludes(patterns []string) {
+	var extensions []string
+	for _, pattern := range patterns {
+		ext, ok := extensionGlob(pattern)
+		if !ok {
+			extensions = nil
+			break
+		}
+		extensions = append(extensions, ext)
+	}
+	if len(extensions) > 0 {
+		m.add("include", ".")
+		for _, ext := range extensions {
+			m.add("includeExtension", ext)
+		}
+		return
+	}
+
+	added := false
+	for _, pattern := range patterns {
+		pattern = strings.TrimPrefix(pattern, "./")
+		switch {
+		case pattern == "**" || pattern == "**/*" || pattern == "*" || pattern == ".":
+			pattern = "."
+		case strings.HasSuffix(pattern, "/**/*") && !hasGlobMeta(strings.TrimSuffix(pattern, "/**/*")):
+			pattern = strings.TrimSuffix(pattern, "/**/*")
+		case strings.HasSuffix(pattern, "/**") && !hasGlobMeta(strings.TrimSuffix(pattern, "/**")):
+			pattern = strings.TrimSuffix(pattern, "/**")
+		}
+		m.add("include", strings.TrimSuffix(pattern, "/"))
+		added = true
+	}
+	if !added {
+		m.add("include", ".")
+	}
+}
+
+// addExclude converts a gitignore-style pattern of paths to leave out.
+func (m *Migration) addExclude(pattern string) {
+	negate := strings.HasPrefix(pattern, "!")
+	rule := strings.TrimPrefix(strings.TrimPrefix(pattern, "!"), "/")
+	rule = strings.TrimPrefix(rule, "./")
+	prefix := ""
+	if negate {
+		prefix = "!"
+	}
+
+	folder, isFolder := strings.CutSuffix(rule, "/**")
+	if !isFolder {
+		folder, isFolder = strings.CutSuffix(rule, "/")
+	}
+	if isFolder {
+		if name := strings.TrimPrefix(folder, "**/"); !strings.Contains(name, "/") {
+			folder = name
+		}
+		m.add("excludeFolder", prefix+folder)
+		return
+	}
+
+	if ext, ok := extensionGlob(rule); ok && !negate {
+		m.add("excludeExtension", ext)
+		return
+	}
+	m.add("excludeFile", prefix+rule)
+}
+
+// extensionGlob returns the extension of patterns like "*.go" and
+// "**/*.go".
+func extensionGlob(pattern string) (string, bool) {
+	ext, ok := strings.CutPrefix(strings.TrimPrefix(pattern, "**/"), "*.")
+	if !ok || ext == "" || hasGlobMeta(ext) || strings.ContainsAny(ext, "/.") {
+		return "", false
+	}
+	return ext, true
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+type commandOption struct {
+	name  string
+	value string
+}
+
+// commandOptions splits command-line arguments into options, with their
+// value for those in takesValue, and positional arguments.
+func commandOptions(args []string, takesValue map[string]bool) ([]commandOption, []string, error) {
+	var options []commandOption
+	var positional []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			positional = append(positional, args[i+1:]...)
+			break
+		}
+		if !strings.HasPrefix(arg, "-") || arg == "-" {
+			positional = append(positional, arg)
+			continue
+		}
+
+		name, value, hasValue := strings.Cut(arg, "=")
+		if takesValue[name] && !hasValue {
+			if i+1 >= len(args) {
+				return nil, nil, fmt.Errorf("option %s needs a value", name)
+			}
+			i++
+			value = args[i]
+		}
+		options = append(options, commandOption{name: name, value: value})
+	}
+	return options, positional, nil
+}
+
+// shellWords splits a line of a shell script into words, removing quotes
+// and escapes. Operators such as | and > are words of their own, and a #
+// starting a word ends the line.
+func shellWords(line string) ([]string, error) {
+	var words []string
+	var word strings.Builder
+	inWord := false
+	flush := func() {
+		if inWord {
+			words = append(words, word.String())
+			word.Reset()
+			inWord = false
+		}
+	}
+
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\r':
+			flush()
+		case c == '#' && !inWord:
+			return words, nil
+		case c == '\\' && i+1 < len(line):
+			i++
+			word.WriteByte(line[i])
+			inWord = true
+		case c == '\'':
+			end := strings.IndexByte(line[i+1:], '\'')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated quote in %q", line)
+			}
+			word.WriteString(line[i+1 : i+1+end])
+			i += end + 1
+			inWord = true
+		case c == '"':
+			i++
+			for ; i < len(line) && line[i] != '"'; i++ {
+				if line[i] == '\\' && i+1 < len(line) && strings.IndexByte("\"\\$`", line[i+1]) >= 0 {
+					i++
+				}
+				word.WriteByte(line[i])
+			}
+			if i >= len(line) {
+				return nil, fmt.Errorf("unterminated quote in %q", line)
+			}
+			inWord = true
+		case strings.IndexByte("|&;<>", c) >= 0:
+			flush()
+			op := string(c)
+			if i+1 < len(line) && line[i+1] == c {
+				op += string(c)
+				i++
+			}
+			words = append(words, op)
+		default:
+			word.WriteByte(c)
+			inWord = true
+		}
+	}
+	flush()
+	return words, nil
+}
+
+func isShellOperator(word string) bool {
+	return word != "" && strings.IndexByte("|&;<>", word[0]) >= 0
+}
+
+// WriteConfig writes the migration as an input file, with the flags and
+// notes as comments. source is the file the settings were read from, or ""
+// for a command line.
+func (m *Migration) WriteConfig(w io.Writer, source string) error {
+	var b strings.Builder
+	if m.Header != "" {
+		b.WriteString(m.Header + "\n")
+	} else {
+		b.WriteString("Describe what you want the model to do with these files.\n")
+	}
+	b.WriteString("---\n")
+	if source != "" {
+		fmt.Fprintf(&b, "# Converted from the %s settings in %s by promptbuilder import.\n", m.Tool, source)
+	} else {
+		fmt.Fprintf(&b, "# Converted from a %s command line by promptbuilder import.\n", m.Tool)
+	}
+	if len(m.Flags) > 0 {
+		fmt.Fprintf(&b, "# Run promptbuilder with: %s\n", strings.Join(m.Flags, " "))
+	}
+	for _, note := range m.Notes {
+		fmt.Fprintf(&b, "# Note: %s\n", note)
+	}
+	for _, d := range m.Directives {
+		fmt.Fprintf(&b, "%s=%s\n", d.Key, d.Value)
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
@@ -0,0 +1,137 @@
+package promptbuilder
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// notebookOutputLines is the number of lines kept of a single cell output.
+// Training logs and large data frames would otherwise fill the prompt.
+const notebookOutputLines = 50
+
+// ansiEscape matches the color codes of tracebacks.
+var ansiEscape = regexp.MustCompile(`\x1b\[[0-9;]*[A-Za-z]`)
+
+// notebook is the part of the Jupyter notebook format (nbformat 4) that
+// flattenNotebook reads.
+type notebook struct {
+	Cells []struct {
+		CellType string           `json:"cell_type"`
+		Source   notebookText     `json:"source"`
+		Outputs  []notebookOutput `json:"outputs"`
+	} `json:"cells"`
+	Metadata struct {
+		LanguageInfo struct {
+			Name string `json:"name"`
+		} `json:"language_info"`
+		Kernelspec struct {
+			Language string `json:"language"`
+		} `json:"kernelspec"`
+	} `json:"metadata"`
+}
+
+type notebookOutput struct {
+	OutputType string                  `json:"output_type"`
+	Text       notebookText            `json:"text"`
+	Data       map[string]notebookText `json:"data"`
+	Ename      string                  `json:"ename"`
+	Evalue     string                  `json:"evalue"`
+	Traceback  []string                `json:"traceback"`
+}
+
+// notebookText is a multiline string, stored either as a string or as a
+// list of lines.
+type notebookText string
+
+func (t *notebookText) UnmarshalJSON(data []byte) error {
+	var lines []string
+	if err := json.Unmarshal(data, &lines); err == nil {
+		*t = notebookText(strings.Join(lines, ""))
+		return nil
+	}
+	var text string
+	if err := json.Unmarshal(data, &text); err != nil {
+		return err
+	}
+	*t = notebookText(text)
+	return nil
+}
+
+func isNotebook(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), ".ipynb")
+}
+
+// flattenNotebook converts the JSON of a Jupyter notebook to markdown:
+// markdown cells as they are, code cells as fenced code, followed by their
+// text outputs unless stripOutputs is set. Images and HTML outputs are
+// left out.
+func flattenNotebook(content string, stripOutputs bool) (string, error) {
+	var nb notebook
+	if err := json.Unmarshal([]byte(content), &nb); err != nil {
+		return "", err
+	}
+	if nb.Cells == nil {
+		return "", fmt.Errorf("no cells, only nbformat 4 is supported")
+	}
+	language := nb.Metadata.LanguageInfo.Name
+	if language == "" {
+		language = nb.Metadata.Kernelspec.Language
+	}
+
+	var b strings.Builder
+	for _, cell := range nb.Cells {
+		source := strings.TrimRight(string(cell.Source), "\n")
+		if source == "" && len(cell.Outputs) == 0 {
+			continue
+		}
+		switch cell.CellType {
+		case "code":
+			fence := codeFence(source)
+			fmt.Fprintf(&b, "%s%s\n%s\n%s\n\n", fence, language, source, fence)
+			if stripOutputs {
+				continue
+			}
+			for _, output := range cell.Outputs {
+				if text := notebookOutputText(output); text != "" {
+					fence := codeFence(text)
+					fmt.Fprintf(&b, "Output:\n%s\n%s\n%s\n\n", fence, text, fence)
+				}
+			}
+		default:
+			// Markdown and raw cells
+			b.WriteString(source + "\n\n")
+		}
+	}
+	return strings.TrimRight(b.String(), "\n") + "\n", nil
+}
+
+// notebookOutputText returns the text of a cell output, shortened to
+// notebookOutputLines, or "" for outputs without text.
+func notebookOutputText(output notebookOutput) string {
+	var text string
+	switch output.OutputType {
+	case "stream":
+		text = string(output.Text)
+	case "execute_result", "display_data":
+		text = string(output.Data["text/plain"])
+	case "error":
+		text = ansiEscape.ReplaceAllString(strings.Join(output.Traceback, "\n"), "")
+		if text == "" {
+			text = output.Ename + ": " + output.Evalue
+		}
+	}
+	text = strings.TrimRight(text, "\n")
+	if text == "" {
+		return ""
+	}
+
+	lines := strings.Split(text, "\n")
+	if len(lines) > notebookOutputLines {
+		omitted := len(lines) - notebookOutputLines
+		lines = append(lines[:notebookOutputLines], fmt.Sprintf("[... %d more lines ...]", omitted))
+	}
+	return strings.Join(lines, "\n")
+}
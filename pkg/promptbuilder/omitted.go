@@ -0,0 +1,41 @@
+package promptbuilder
+
+import (
+	"fmt"
+	"strings"
+)
+
+// omittedReasons are the skip reasons of the files listed by omittedNote,
+// with how the note describes them. Files left out by the exclude rules
+// are not listed: they were left out on purpose and are rarely relevant.
+var omittedReasons = map[string]string{
+	"binary":            "binary",
+	"encoding":          "not UTF-8",
+	"document":          "text could not be extracted",
+	"excludeLargerThan": "too large",
+	"maxTokens":         "token budget",
+}
+
+// omittedSection lists the files that exist but were left out for their
+// content, their size or the token budget, so that the model does not
+// guess at what they hold. ok is false when there are none.
+func (b *Builder) omittedSection(omitted []fileSection) (section extraSection, ok bool) {
+	var lines strings.Builder
+	for _, skipped := range b.skipped {
+		if reason, listed := omittedReasons[skipped.Reason]; listed {
+			fmt.Fprintf(&lines, "- %s (%s)\n", b.outputPath(skipped.Path), reason)
+		}
+	}
+	for _, s := range omitted {
+		fmt.Fprintf(&lines, "- %s (%s)\n", s.Path, omittedReasons["maxTokens"])
+	}
+	if lines.Len() == 0 {
+		return extraSection{}, false
+	}
+
+	return extraSection{
+		Name:    "omitted_files",
+		Title:   "Omitted files",
+		Content: "The following files exist but were not included:\n" + lines.String(),
+	}, true
+}
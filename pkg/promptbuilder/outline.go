@@ -0,0 +1,60 @@
+package promptbuilder
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"strings"
+)
+
+// outliners reduce a source file to its declarations, by file extension.
+var outliners = map[string]func(content string) (string, error){
+	".go": outlineGo,
+}
+
+// outline returns the outline of a file included with mode=outline. Files
+// in languages without an outliner, or that fail to parse, are kept in
+// full.
+func (b *Builder) outline(path string, content string) string {
+	outliner, ok := outliners[strings.ToLower(filepath.Ext(path))]
+	if !ok {
+		b.warnf("Outline mode is not supported for %s, including it in full", path)
+		return content
+	}
+
+	outlined, err := outliner(content)
+	if err != nil {
+		b.warnf("Cannot outline %s, including it in full: %v", path, err)
+		return content
+	}
+	return outlined
+}
+
+// outlineGo keeps the package clause, imports, type, const and var
+// declarations and function signatures of a Go file, with their doc
+// comments, and replaces every function body with { ... }.
+func outlineGo(content string) (string, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", content, parser.ParseComments|parser.SkipObjectResolution)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	last := 0
+	for _, decl := range file.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok || fn.Body == nil {
+			continue
+		}
+		start := fset.Position(fn.Body.Lbrace).Offset
+		end := fset.Position(fn.Body.Rbrace).Offset + 1
+		b.WriteString(content[last:start])
+		b.WriteString("{ ... }")
+		last = end
+	}
+	b.WriteString(content[last:])
+
+	return b.String(), nil
+}
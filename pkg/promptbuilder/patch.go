@@ -0,0 +1,242 @@
+package promptbuilder
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// maxFuzz is the number of context lines that may be ignored at each end
+// of a hunk that does not match as given, as patch does.
+const maxFuzz = 2
+
+// Hunk is a hunk of a unified diff. Lines keep their ' ', '-' or '+'
+// prefix.
+type Hunk struct {
+	OldStart int // line the hunk starts at in the original, 0 if unknown
+	Lines    []string
+}
+
+var hunkHeader = regexp.MustCompile(`^@@ -(\d+)(?:,\d+)? \+\d+(?:,\d+)? @@`)
+
+// isDiff reports whether a code block holds a unified diff: it is tagged
+// as one or starts like one, and has at least one hunk.
+func isDiff(info string, lines []string) bool {
+	hasHunk := false
+	for _, line := range lines {
+		if strings.HasPrefix(line, "@@") {
+			hasHunk = true
+			break
+		}
+	}
+	if !hasHunk {
+		return false
+	}
+
+	if info == "diff" || info == "patch" {
+		return true
+	}
+	for _, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		return strings.HasPrefix(line, "--- ") || strings.HasPrefix(line, "diff --git ") || strings.HasPrefix(line, "@@")
+	}
+	return false
+}
+
+// parseDiff splits a unified diff into one change per file. Hunks that
+// come before any file header belong to path. Line counts in hunk headers
+// are ignored, since models often get them wrong.
+func parseDiff(lines []string, path string) []FileChange {
+	var changes []FileChange
+	var current *FileChange
+	var hunk *Hunk
+	oldPath := ""
+
+	for _, line := range lines {
+		switch {
+		case strings.HasPrefix(line, "diff --git "), strings.HasPrefix(line, "index "):
+			hunk = nil
+		case strings.HasPrefix(line, "--- ") && (hunk == nil || strings.HasPrefix(line, "--- a/") || strings.HasPrefix(line, "--- /dev/null")):
+			oldPath = diffPath(line[4:])
+			hunk = nil
+		case strings.HasPrefix(line, "+++ ") && hunk == nil:
+			newPath := diffPath(line[4:])
+			change := FileChange{Path: newPath}
+			if newPath == "/dev/null" {
+				change = FileChange{Path: oldPath, Delete: true}
+			}
+			changes = append(changes, change)
+			current = &changes[len(changes)-1]
+		case strings.HasPrefix(line, "@@"):
+			if current == nil {
+				if path == "" {
+					continue
+				}
+				changes = append(changes, FileChange{Path: path})
+				current = &changes[len(changes)-1]
+			}
+			start := 0
+			if m := hunkHeader.FindStringSubmatch(line); m != nil {
+				start, _ = strconv.Atoi(m[1])
+			}
+			current.Hunks = append(current.Hunks, Hunk{OldStart: start})
+			hunk = &current.Hunks[len(current.Hunks)-1]
+		case hunk != nil:
+			if strings.HasPrefix(line, `\`) {
+				// "\ No newline at end of file"
+				continue
+			}
+			if line == "" {
+				// Editors and models drop the space of empty context lines
+				line = " "
+			}
+			if line[0] == ' ' || line[0] == '-' || line[0] == '+' {
+				hunk.Lines = append(hunk.Lines, line)
+			}
+		}
+	}
+
+	return changes
+}
+
+// diffPath returns the path of a ---/+++ line without the a/ or b/ prefix
+// and any trailing timestamp.
+func diffPath(value string) string {
+	if i := strings.IndexByte(value, '\t'); i != -1 {
+		value = value[:i]
+	}
+	value = strings.TrimSpace(value)
+	if value == "/dev/null" {
+		return value
+	}
+	if strings.HasPrefix(value, "a/") || strings.HasPrefix(value, "b/") {
+		return value[2:]
+	}
+	return value
+}
+
+// Patch applies the hunks of a change to content. A hunk is located near
+// its line number first, then anywhere in the file, ignoring differences
+// in whitespace and, if needed, a few lines of context at its ends. Hunks
+// that cannot be located are written as conflict markers at their line
+// number; the second result counts them.
+func (c FileChange) Patch(content string) (string, int) {
+	lines := splitLines(content)
+	offset := 0
+	conflicts := 0
+
+	for i, hunk := range c.Hunks {
+		var oldBlock, newBlock []string
+		for _, line := range hunk.Lines {
+			text := line[1:]
+			if line[0] != '+' {
+				oldBlock = append(oldBlock, text)
+			}
+			if line[0] != '-' {
+				newBlock = append(newBlock, text)
+			}
+		}
+
+		expected := min(max(hunk.OldStart-1+offset, 0), len(lines))
+		pos, oldBlock, newBlock := locateHunk(lines, oldBlock, newBlock, expected)
+		if pos == -1 {
+			conflict := []string{fmt.Sprintf("<<<<<<< original (hunk %d did not apply)", i+1)}
+			conflict = append(conflict, oldBlock...)
+			conflict = append(conflict, "=======")
+			conflict = append(conflict, newBlock...)
+			conflict = append(conflict, ">>>>>>> patch")
+			lines = splice(lines, expected, 0, conflict)
+			offset += len(conflict)
+			conflicts++
+			continue
+		}
+
+		lines = splice(lines, pos, len(oldBlock), newBlock)
+		if hunk.OldStart > 0 {
+			offset = pos - (hunk.OldStart - 1) + len(newBlock) - len(oldBlock)
+		}
+	}
+
+	if len(lines) == 0 {
+		return "", conflicts
+	}
+	return strings.Join(lines, "\n") + "\n", conflicts
+}
+
+// locateHunk finds where oldBlock is in lines, trying an exact match, a
+// match ignoring whitespace, and then the same with up to maxFuzz context
+// lines dropped from each end. It returns the position and the blocks as
+// matched, or -1.
+func locateHunk(lines []string, oldBlock []string, newBlock []string, expected int) (int, []string, []string) {
+	exact := func(a, b string) bool { return a == b }
+	loose := func(a, b string) bool {
+		return strings.Join(strings.Fields(a), " ") == strings.Join(strings.Fields(b), " ")
+	}
+
+	for fuzz := 0; fuzz <= maxFuzz; fuzz++ {
+		oldTrimmed, newTrimmed, ok := trimContext(oldBlock, newBlock, fuzz)
+		if !ok {
+			break
+		}
+		for _, equal := range []func(a, b string) bool{exact, loose} {
+			if pos := findBlock(lines, oldTrimmed, expected, equal); pos != -1 {
+				return pos, oldTrimmed, newTrimmed
+			}
+		}
+	}
+	return -1, oldBlock, newBlock
+}
+
+// trimContext drops n lines from each end of the blocks, provided they are
+// context lines, which appear at the same ends of both blocks.
+func trimContext(oldBlock []string, newBlock []string, n int) ([]string, []string, bool) {
+	if n == 0 {
+		return oldBlock, newBlock, true
+	}
+	if len(oldBlock) < 2*n+1 || len(newBlock) < 2*n {
+		return nil, nil, false
+	}
+	for i := 0; i < n; i++ {
+		if oldBlock[i] != newBlock[i] || oldBlock[len(oldBlock)-1-i] != newBlock[len(newBlock)-1-i] {
+			return nil, nil, false
+		}
+	}
+	return oldBlock[n : len(oldBlock)-n], newBlock[n : len(newBlock)-n], true
+}
+
+// findBlock returns the position of block in lines closest to expected,
+// or -1.
+func findBlock(lines []string, block []string, expected int, equal func(a, b string) bool) int {
+	if len(block) == 0 {
+		return expected
+	}
+	last := len(lines) - len(block)
+	for d := 0; expected-d >= 0 || expected+d <= last; d++ {
+		for _, pos := range []int{expected - d, expected + d} {
+			if pos >= 0 && pos <= last && blockAt(lines, block, pos, equal) {
+				return pos
+			}
+		}
+	}
+	return -1
+}
+
+func blockAt(lines []string, block []string, pos int, equal func(a, b string) bool) bool {
+	for i, line := range block {
+		if !equal(lines[pos+i], line) {
+			return false
+		}
+	}
+	return true
+}
+
+// splice replaces n lines at pos with replacement.
+func splice(lines []string, pos int, n int, replacement []string) []string {
+	result := make([]string, 0, len(lines)-n+len(replacement))
+	result = append(result, lines[:pos]...)
+	result = append(result, replacement...)
+	return append(result, lines[pos+n:]...)
+}
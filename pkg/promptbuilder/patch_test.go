@@ -0,0 +1,101 @@
+package promptbuilder
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseDiff(t *testing.T) {
+	diff := `diff --git a/main.go b/main.go
+index 83db48f..bf269f4 100644
+--- a/main.go
++++ b/main.go
+@@ -1,3 +1,3 @@
+ package main
+-var x = 1
++var x = 2
+
+--- a/old.go
++++ /dev/null
+@@ -1 +0,0 @@
+-package old
+\ No newline at end of file`
+	changes := parseDiff(strings.Split(diff, "\n"), "")
+	want := []FileChange{
+		{Path: "main.go", Hunks: []Hunk{{OldStart: 1, Lines: []string{" package main", "-var x = 1", "+var x = 2", " "}}}},
+		{Path: "old.go", Delete: true, Hunks: []Hunk{{OldStart: 1, Lines: []string{"-package old"}}}},
+	}
+	if !reflect.DeepEqual(changes, want) {
+		t.Errorf("parseDiff =\n%+v\nwant\n%+v", changes, want)
+	}
+
+	// Hunks without file headers belong to the path of the heading
+	changes = parseDiff([]string{"@@ -2 +2 @@", "-b", "+B"}, "notes.txt")
+	if len(changes) != 1 || changes[0].Path != "notes.txt" || len(changes[0].Hunks) != 1 {
+		t.Errorf("parseDiff without headers = %+v", changes)
+	}
+}
+
+func TestPatch(t *testing.T) {
+	original := "package main\n\nfunc a() {\n\treturn\n}\n\nfunc b() {\n\treturn\n}\n"
+	tests := []struct {
+		name      string
+		hunk      Hunk
+		want      string
+		conflicts int
+	}{
+		{
+			name: "exact",
+			hunk: Hunk{OldStart: 7, Lines: []string{" func b() {", "-\treturn", "+\tpanic(1)", " }"}},
+			want: "package main\n\nfunc a() {\n\treturn\n}\n\nfunc b() {\n\tpanic(1)\n}\n",
+		},
+		{
+			name: "wrong line number",
+			hunk: Hunk{OldStart: 1, Lines: []string{" func b() {", "-\treturn", "+\tpanic(1)", " }"}},
+			want: "package main\n\nfunc a() {\n\treturn\n}\n\nfunc b() {\n\tpanic(1)\n}\n",
+		},
+		{
+			name: "closest match",
+			hunk: Hunk{OldStart: 3, Lines: []string{"-\treturn", "+\tpanic(1)"}},
+			want: "package main\n\nfunc a() {\n\tpanic(1)\n}\n\nfunc b() {\n\treturn\n}\n",
+		},
+		{
+			name: "whitespace",
+			hunk: Hunk{OldStart: 7, Lines: []string{" func b()  {", "-    return", "+\tpanic(1)", " }"}},
+			want: "package main\n\nfunc a() {\n\treturn\n}\n\nfunc b()  {\n\tpanic(1)\n}\n",
+		},
+		{
+			name: "fuzz",
+			hunk: Hunk{OldStart: 7, Lines: []string{" func renamed() {", "-\treturn", "+\tpanic(1)", " } // end"}},
+			want: "package main\n\nfunc a() {\n\treturn\n}\n\nfunc b() {\n\tpanic(1)\n}\n",
+		},
+		{
+			name:      "conflict",
+			hunk:      Hunk{OldStart: 3, Lines: []string{"-func c() {", "+func d() {"}},
+			want:      "package main\n\n<<<<<<< original (hunk 1 did not apply)\nfunc c() {\n=======\nfunc d() {\n>>>>>>> patch\nfunc a() {\n\treturn\n}\n\nfunc b() {\n\treturn\n}\n",
+			conflicts: 1,
+		},
+	}
+	for _, test := range tests {
+		change := FileChange{Path: "main.go", Hunks: []Hunk{test.hunk}}
+		got, conflicts := change.Patch(original)
+		if got != test.want || conflicts != test.conflicts {
+			t.Errorf("%s: Patch =\n%s(%d conflicts), want\n%s(%d conflicts)", test.name, got, conflicts, test.want, test.conflicts)
+		}
+	}
+}
+
+// TestPatchOffset checks that a hunk is looked for where the previous
+// hunks moved the lines to.
+func TestPatchOffset(t *testing.T) {
+	original := "a\nx\nb\nc\nx\nd\n"
+	change := FileChange{Hunks: []Hunk{
+		{OldStart: 1, Lines: []string{" a", "+a2", "+a3"}},
+		{OldStart: 5, Lines: []string{"-x", "+y"}},
+	}}
+	got, conflicts := change.Patch(original)
+	if want := "a\na2\na3\nx\nb\nc\ny\nd\n"; got != want || conflicts != 0 {
+		t.Errorf("Patch = %q (%d conflicts), want %q", got, conflicts, want)
+	}
+}
@@ -0,0 +1,756 @@
+package promptbuilder
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// This is a small PDF reader that gets the text out of the documents that
+// office suites, LaTeX and browsers produce: it reads the objects, also
+// from object streams, inflates Flate streams, and maps the strings drawn
+// by the pages to text with the ToUnicode maps of their fonts. Encrypted
+// and scanned documents have no text it can read.
+
+// PDF values besides numbers (float64), arrays and dictionaries.
+type (
+	pdfName    string // /Name, without the slash
+	pdfString  string // the bytes of a literal or hex string
+	pdfKeyword string // operators, "obj", "R" and the delimiters "[", "<<", ...
+	pdfRef     int    // an indirect reference, by object number
+	pdfArray   []any
+	pdfDict    map[pdfName]any
+)
+
+type pdfStream struct {
+	dict pdfDict
+	data []byte // still encoded
+}
+
+// pdfMaxDepth bounds the nesting of page trees and form XObjects, which
+// broken files may make circular.
+const pdfMaxDepth = 32
+
+var pdfObjectStart = regexp.MustCompile(`(\d+)\s+\d+\s+obj\b`)
+
+// extractPDF returns the text of a PDF document, page by page.
+func extractPDF(content []byte) (string, error) {
+	r, err := readPDF(content)
+	if err != nil {
+		return "", err
+	}
+	root := r.catalog()
+	if root == nil {
+		return "", errors.New("no document catalog")
+	}
+
+	var b strings.Builder
+	page := 0
+	r.walkPages(r.dict(root["Pages"]), nil, 0, func(p, resources pdfDict) {
+		page++
+		text := cleanPDFText(r.contentText(r.pageContent(p), resources, 0))
+		if text == "" {
+			return
+		}
+		if b.Len() > 0 {
+			b.WriteString("\n\n")
+		}
+		fmt.Fprintf(&b, "[Page %d]\n%s", page, text)
+	})
+	if b.Len() == 0 {
+		return "", errors.New("no text found, the document may be scanned")
+	}
+	return b.String() + "\n", nil
+}
+
+type pdfReader struct {
+	objects map[int]any
+	fonts   map[pdfRef]*pdfFont
+}
+
+func readPDF(data []byte) (*pdfReader, error) {
+	if !bytes.HasPrefix(bytes.TrimLeft(data, " \t\r\n"), []byte("%PDF-")) {
+		return nil, errors.New("not a PDF file")
+	}
+	if bytes.Contains(data, []byte("/Encrypt")) {
+		return nil, errors.New("encrypted documents are not supported")
+	}
+
+	r := &pdfReader{objects: map[int]any{}, fonts: map[pdfRef]*pdfFont{}}
+	for pos := 0; ; {
+		loc := pdfObjectStart.FindSubmatchIndex(data[pos:])
+		if loc == nil {
+			break
+		}
+		num, _ := strconv.Atoi(string(data[pos+loc[2] : pos+loc[3]]))
+		l := &pdfLexer{data: data, pos: pos + loc[1]}
+		value := l.value(l.token())
+		if dict, ok := value.(pdfDict); ok && l.token() == pdfKeyword("stream") {
+			stream, end := readStream(data, l.pos, dict)
+			value = stream
+			l.pos = end
+		}
+		// Later definitions are updates that replace earlier ones
+		r.objects[num] = value
+		pos = l.pos
+	}
+	if len(r.objects) == 0 {
+		return nil, errors.New("no objects found")
+	}
+	r.readObjectStreams()
+	return r, nil
+}
+
+// readStream returns the stream whose data starts after the stream keyword
+// at pos, and the position after its data.
+func readStream(data []byte, pos int, dict pdfDict) (*pdfStream, int) {
+	if pos < len(data) && data[pos] == '\r' {
+		pos++
+	}
+	if pos < len(data) && data[pos] == '\n' {
+		pos++
+	}
+	if length, ok := dict["Length"].(float64); ok && length >= 0 && pos+int(length) <= len(data) {
+		end := pos + int(length)
+		if bytes.HasPrefix(bytes.TrimLeft(data[end:], " \r\n"), []byte("endstream")) {
+			return &pdfStream{dict: dict, data: data[pos:end]}, end
+		}
+	}
+	// The length is indirect or wrong
+	end := bytes.Index(data[pos:], []byte("endstream"))
+	if end < 0 {
+		return &pdfStream{dict: dict, data: data[pos:]}, len(data)
+	}
+	return &pdfStream{dict: dict, data: bytes.TrimRight(data[pos:pos+end], "\r\n")}, pos + end
+}
+
+// readObjectStreams adds the objects stored in object streams, which
+// documents since PDF 1.5 use for most of their dictionaries.
+func (r *pdfReader) readObjectStreams() {
+	for _, num := range r.objectNumbers() {
+		stream, ok := r.objects[num].(*pdfStream)
+		if !ok || stream.dict["Type"] != pdfName("ObjStm") {
+			continue
+		}
+		data, err := r.decode(stream)
+		if err != nil {
+			continue
+		}
+		count, _ := r.resolve(stream.dict["N"]).(float64)
+		first, _ := r.resolve(stream.dict["First"]).(float64)
+		header := &pdfLexer{data: data}
+		for i := 0; i < int(count); i++ {
+			num, ok1 := header.token().(float64)
+			offset, ok2 := header.token().(float64)
+			if !ok1 || !ok2 {
+				break
+			}
+			if _, exists := r.objects[int(num)]; exists {
+				continue
+			}
+			l := &pdfLexer{data: data, pos: int(first) + int(offset)}
+			if l.pos < len(data) {
+				r.objects[int(num)] = l.value(l.token())
+			}
+		}
+	}
+}
+
+func (r *pdfReader) objectNumbers() []int {
+	nums := make([]int, 0, len(r.objects))
+	for num := range r.objects {
+		nums = append(nums, num)
+	}
+	sort.Ints(nums)
+	return nums
+}
+
+// catalog returns the document catalog, the root of the page tree.
+func (r *pdfReader) catalog() pdfDict {
+	var catalog pdfDict
+	for _, num := range r.objectNumbers() {
+		if dict, ok := r.objects[num].(pdfDict); ok && dict["Type"] == pdfName("Catalog") {
+			catalog = dict
+		}
+	}
+	return catalog
+}
+
+func (r *pdfReader) resolve(v any) any {
+	for i := 0; i < pdfMaxDepth; i++ {
+		ref, ok := v.(pdfRef)
+		if !ok {
+			return v
+		}
+		v = r.objects[int(ref)]
+	}
+	return nil
+}
+
+// dict returns a dictionary, or the dictionary of a stream.
+func (r *pdfReader) dict(v any) pdfDict {
+	switch v := r.resolve(v).(type) {
+	case pdfDict:
+		return v
+	case *pdfStream:
+		return v.dict
+	}
+	return nil
+}
+
+// decode returns the data of a stream with its filters undone. Only
+// FlateDecode, used by nearly all text content, is supported.
+func (r *pdfReader) decode(stream *pdfStream) ([]byte, error) {
+	var filters pdfArray
+	switch filter := r.resolve(stream.dict["Filter"]).(type) {
+	case pdfName:
+		filters = pdfArray{filter}
+	case pdfArray:
+		filters = filter
+	}
+	data := stream.data
+	for _, filter := range filters {
+		if r.resolve(filter) != pdfName("FlateDecode") {
+			return nil, fmt.Errorf("unsupported filter %v", filter)
+		}
+		zr, err := zlib.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		// Streams with a broken end often still hold all of their text
+		decoded, err := io.ReadAll(zr)
+		if err != nil && len(decoded) == 0 {
+			return nil, err
+		}
+		data = decoded
+	}
+	return data, nil
+}
+
+// walkPages calls visit for the pages under a node of the page tree, in
+// order, with the resources they define or inherit.
+func (r *pdfReader) walkPages(node, resources pdfDict, depth int, visit func(page, resources pdfDict)) {
+	if node == nil || depth > pdfMaxDepth {
+		return
+	}
+	if own := r.dict(node["Resources"]); own != nil {
+		resources = own
+	}
+	kids, ok := r.resolve(node["Kids"]).(pdfArray)
+	if !ok {
+		visit(node, resources)
+		return
+	}
+	for _, kid := range kids {
+		r.walkPages(r.dict(kid), resources, depth+1, visit)
+	}
+}
+
+// pageContent returns the content streams of a page, joined.
+func (r *pdfReader) pageContent(page pdfDict) []byte {
+	var streams pdfArray
+	switch contents := r.resolve(page["Contents"]).(type) {
+	case *pdfStream:
+		streams = pdfArray{contents}
+	case pdfArray:
+		streams = contents
+	}
+	var content []byte
+	for _, s := range streams {
+		stream, ok := r.resolve(s).(*pdfStream)
+		if !ok {
+			continue
+		}
+		if data, err := r.decode(stream); err == nil {
+			content = append(content, data...)
+			content = append(content, '\n')
+		}
+	}
+	return content
+}
+
+// contentText returns the text drawn by a content stream. Lines are
+// broken where the text moves down, and words are separated where the
+// text moves right or a TJ array leaves a gap.
+func (r *pdfReader) contentText(content []byte, resources pdfDict, depth int) string {
+	var b strings.Builder
+	newline := func() {
+		if b.Len() > 0 && !strings.HasSuffix(b.String(), "\n") {
+			b.WriteByte('\n')
+		}
+	}
+	space := func() {
+		if s := b.String(); s != "" && !strings.HasSuffix(s, " ") && !strings.HasSuffix(s, "\n") {
+			b.WriteByte(' ')
+		}
+	}
+
+	fonts := r.dict(resources["Font"])
+	font := &pdfFont{codeLen: 1}
+	var fontSize, lineY float64
+	var operands []any
+	l := &pdfLexer{data: content}
+	for token := l.token(); token != nil; token = l.token() {
+		op, ok := pdfOperator(token)
+		if !ok {
+			operands = append(operands, l.value(token))
+			continue
+		}
+		switch op {
+		case "BI":
+			l.skipInlineImage()
+		case "Tf":
+			if len(operands) >= 2 {
+				if name, ok := operands[len(operands)-2].(pdfName); ok {
+					font = r.font(fonts[name])
+				}
+				fontSize, _ = operands[len(operands)-1].(float64)
+			}
+		case "Td", "TD":
+			// Moves of less than half a line are sub- and superscripts
+			if len(operands) >= 2 {
+				if ty, _ := operands[1].(float64); math.Abs(ty) > fontSize/2 {
+					newline()
+				} else {
+					space()
+				}
+			}
+		case "Tm":
+			if len(operands) >= 6 {
+				scale, _ := operands[3].(float64)
+				if y, _ := operands[5].(float64); math.Abs(y-lineY) > math.Abs(fontSize*scale)/2 {
+					newline()
+				} else {
+					space()
+				}
+				lineY, _ = operands[5].(float64)
+			}
+		case "T*":
+			newline()
+		case "Tj", "'", `"`:
+			if op != "Tj" {
+				newline()
+			}
+			if len(operands) > 0 {
+				if s, ok := operands[len(operands)-1].(pdfString); ok {
+					b.WriteString(font.decode(s))
+				}
+			}
+		case "TJ":
+			if len(operands) == 0 {
+				break
+			}
+			array, _ := operands[len(operands)-1].(pdfArray)
+			for _, item := range array {
+				switch item := item.(type) {
+				case pdfString:
+					b.WriteString(font.decode(item))
+				case float64:
+					// Gaps are in thousandths of the font size
+					if item < -200 {
+						space()
+					}
+				}
+			}
+		case "Do":
+			if len(operands) == 0 || depth >= pdfMaxDepth {
+				break
+			}
+			name, _ := operands[len(operands)-1].(pdfName)
+			form, ok := r.resolve(r.dict(resources["XObject"])[name]).(*pdfStream)
+			if !ok || form.dict["Subtype"] != pdfName("Form") {
+				break
+			}
+			data, err := r.decode(form)
+			if err != nil {
+				break
+			}
+			formResources := r.dict(form.dict["Resources"])
+			if formResources == nil {
+				formResources = resources
+			}
+			newline()
+			b.WriteString(r.contentText(data, formResources, depth+1))
+			newline()
+		}
+		operands = operands[:0]
+	}
+	return b.String()
+}
+
+// cleanPDFText drops control characters and the spaces at the ends of
+// lines.
+func cleanPDFText(text string) string {
+	text = strings.Map(func(r rune) rune {
+		if r == '\n' || r == '\t' || !unicode.IsControl(r) {
+			return r
+		}
+		return -1
+	}, text)
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSpace(line)
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
+
+// pdfFont maps the character codes of the strings drawn with a font to
+// text.
+type pdfFont struct {
+	toUnicode map[string]string // nil without a ToUnicode map
+	codeLen   int               // bytes per character code
+}
+
+func (r *pdfReader) font(v any) *pdfFont {
+	ref, isRef := v.(pdfRef)
+	if font, ok := r.fonts[ref]; isRef && ok {
+		return font
+	}
+	dict := r.dict(v)
+	font := &pdfFont{codeLen: 1}
+	if dict["Subtype"] == pdfName("Type0") {
+		font.codeLen = 2
+	}
+	if stream, ok := r.resolve(dict["ToUnicode"]).(*pdfStream); ok {
+		if data, err := r.decode(stream); err == nil {
+			font.readCMap(data)
+		}
+	}
+	if isRef {
+		r.fonts[ref] = font
+	}
+	return font
+}
+
+// readCMap reads the bfchar and bfrange mappings of a ToUnicode CMap.
+func (f *pdfFont) readCMap(data []byte) {
+	f.toUnicode = map[string]string{}
+	var operands []any
+	l := &pdfLexer{data: data}
+	for token := l.token(); token != nil; token = l.token() {
+		op, ok := pdfOperator(token)
+		if !ok {
+			operands = append(operands, l.value(token))
+			continue
+		}
+		switch op {
+		case "endcodespacerange":
+			if len(operands) > 0 {
+				if low, ok := operands[0].(pdfString); ok && len(low) > 0 {
+					f.codeLen = len(low)
+				}
+			}
+		case "endbfchar":
+			for i := 0; i+1 < len(operands); i += 2 {
+				code, ok1 := operands[i].(pdfString)
+				text, ok2 := operands[i+1].(pdfString)
+				if ok1 && ok2 {
+					f.toUnicode[string(code)] = decodeUTF16([]byte(text), binary.BigEndian)
+				}
+			}
+		case "endbfrange":
+			for i := 0; i+2 < len(operands); i += 3 {
+				low, ok1 := operands[i].(pdfString)
+				high, ok2 := operands[i+1].(pdfString)
+				if !ok1 || !ok2 || len(low) != len(high) || len(low) == 0 || len(low) > 4 {
+					continue
+				}
+				start, end := pdfCode(low), pdfCode(high)
+				if end < start || end-start > 0xFFFF {
+					continue
+				}
+				switch text := operands[i+2].(type) {
+				case pdfString:
+					// Consecutive codes map to consecutive characters
+					runes := []rune(decodeUTF16([]byte(text), binary.BigEndian))
+					if len(runes) == 0 {
+						continue
+					}
+					for code := start; code <= end; code++ {
+						mapped := append([]rune(nil), runes...)
+						mapped[len(mapped)-1] += rune(code - start)
+						f.toUnicode[pdfCodeString(code, len(low))] = string(mapped)
+					}
+				case pdfArray:
+					for j, item := range text {
+						if s, ok := item.(pdfString); ok && start+uint32(j) <= end {
+							f.toUnicode[pdfCodeString(start+uint32(j), len(low))] = decodeUTF16([]byte(s), binary.BigEndian)
+						}
+					}
+				}
+			}
+		}
+		operands = operands[:0]
+	}
+}
+
+func pdfCode(s pdfString) uint32 {
+	var code uint32
+	for i := 0; i < len(s); i++ {
+		code = code<<8 | uint32(s[i])
+	}
+	return code
+}
+
+func pdfCodeString(code uint32, n int) string {
+	b := make([]byte, n)
+	for i := n - 1; i >= 0; i-- {
+		b[i] = byte(code)
+		code >>= 8
+	}
+	return string(b)
+}
+
+// decode maps a string to text. Without a ToUnicode map, the codes of
+// simple fonts are read as Windows-1252, close to the standard encodings
+// of PDF, while those of composite fonts cannot be mapped.
+func (f *pdfFont) decode(s pdfString) string {
+	if f.toUnicode == nil {
+		if f.codeLen > 1 {
+			return ""
+		}
+		return decodeWindows1252([]byte(s))
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); {
+		matched := false
+		for n := 1; n <= 4 && i+n <= len(s); n++ {
+			if text, ok := f.toUnicode[string(s[i:i+n])]; ok {
+				b.WriteString(text)
+				i += n
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			if f.codeLen == 1 {
+				b.WriteString(decodeWindows1252([]byte{s[i]}))
+			}
+			i += f.codeLen
+		}
+	}
+	return b.String()
+}
+
+// pdfLexer reads the tokens and values of PDF files, content streams and
+// CMaps.
+type pdfLexer struct {
+	data []byte
+	pos  int
+}
+
+func isPDFSpace(c byte) bool {
+	return c == 0 || c == '\t' || c == '\n' || c == '\f' || c == '\r' || c == ' '
+}
+
+func isPDFDelimiter(c byte) bool {
+	return strings.IndexByte("()<>[]{}/%", c) >= 0
+}
+
+// token returns the next token, or nil at the end of the data.
+func (l *pdfLexer) token() any {
+	for l.pos < len(l.data) {
+		if c := l.data[l.pos]; c == '%' {
+			for l.pos < len(l.data) && l.data[l.pos] != '\n' && l.data[l.pos] != '\r' {
+				l.pos++
+			}
+		} else if !isPDFSpace(c) {
+			break
+		}
+		l.pos++
+	}
+	if l.pos >= len(l.data) {
+		return nil
+	}
+
+	switch c := l.data[l.pos]; c {
+	case '/':
+		l.pos++
+		return pdfName(l.word())
+	case '(':
+		return l.literalString()
+	case '<':
+		if l.pos+1 < len(l.data) && l.data[l.pos+1] == '<' {
+			l.pos += 2
+			return pdfKeyword("<<")
+		}
+		return l.hexString()
+	case '>':
+		if l.pos+1 < len(l.data) && l.data[l.pos+1] == '>' {
+			l.pos += 2
+			return pdfKeyword(">>")
+		}
+		l.pos++
+		return pdfKeyword(">")
+	case '[', ']', '{', '}', ')':
+		l.pos++
+		return pdfKeyword(string(c))
+	case '+', '-', '.', '0', '1', '2', '3', '4', '5', '6', '7', '8', '9':
+		word := l.word()
+		if n, err := strconv.ParseFloat(word, 64); err == nil {
+			return n
+		}
+		return pdfKeyword(word)
+	}
+	return pdfKeyword(l.word())
+}
+
+// pdfOperator returns the operator of a content stream or CMap that a
+// token is, if it is one and not the start of an operand.
+func pdfOperator(token any) (pdfKeyword, bool) {
+	op, ok := token.(pdfKeyword)
+	if !ok || op == "[" || op == "<<" {
+		return "", false
+	}
+	return op, true
+}
+
+func (l *pdfLexer) word() string {
+	start := l.pos
+	for l.pos < len(l.data) && !isPDFSpace(l.data[l.pos]) && !isPDFDelimiter(l.data[l.pos]) {
+		l.pos++
+	}
+	return string(l.data[start:l.pos])
+}
+
+// value reads the value that starts with token: an array, a dictionary,
+// a reference ("12 0 R") or the token itself.
+func (l *pdfLexer) value(token any) any {
+	switch token {
+	case pdfKeyword("["):
+		array := pdfArray{}
+		for t := l.token(); t != nil && t != pdfKeyword("]"); t = l.token() {
+			array = append(array, l.value(t))
+		}
+		return array
+	case pdfKeyword("<<"):
+		dict := pdfDict{}
+		for t := l.token(); t != nil && t != pdfKeyword(">>"); t = l.token() {
+			if key, ok := t.(pdfName); ok {
+				dict[key] = l.value(l.token())
+			}
+		}
+		return dict
+	}
+	if num, ok := token.(float64); ok {
+		pos := l.pos
+		if _, ok := l.token().(float64); ok && l.token() == pdfKeyword("R") {
+			return pdfRef(num)
+		}
+		l.pos = pos
+	}
+	return token
+}
+
+func (l *pdfLexer) literalString() pdfString {
+	l.pos++
+	var b []byte
+	depth := 1
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		l.pos++
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return pdfString(b)
+			}
+		case '\\':
+			if l.pos >= len(l.data) {
+				break
+			}
+			c = l.data[l.pos]
+			l.pos++
+			switch c {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case 'f':
+				c = '\f'
+			case '\r', '\n':
+				// A line continuation
+				if c == '\r' && l.pos < len(l.data) && l.data[l.pos] == '\n' {
+					l.pos++
+				}
+				continue
+			case '0', '1', '2', '3', '4', '5', '6', '7':
+				n := int(c - '0')
+				for i := 0; i < 2 && l.pos < len(l.data) && l.data[l.pos] >= '0' && l.data[l.pos] <= '7'; i++ {
+					n = n*8 + int(l.data[l.pos]-'0')
+					l.pos++
+				}
+				c = byte(n)
+			}
+		}
+		b = append(b, c)
+	}
+	return pdfString(b)
+}
+
+func (l *pdfLexer) hexString() pdfString {
+	l.pos++
+	var b []byte
+	var high byte
+	odd := false
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		l.pos++
+		if c == '>' {
+			break
+		}
+		var v byte
+		switch {
+		case c >= '0' && c <= '9':
+			v = c - '0'
+		case c >= 'a' && c <= 'f':
+			v = c - 'a' + 10
+		case c >= 'A' && c <= 'F':
+			v = c - 'A' + 10
+		default:
+			continue
+		}
+		if odd {
+			b = append(b, high<<4|v)
+		} else {
+			high = v
+		}
+		odd = !odd
+	}
+	if odd {
+		b = append(b, high<<4)
+	}
+	return pdfString(b)
+}
+
+// skipInlineImage skips the data of an inline image, from after its BI
+// operator to after its EI operator.
+func (l *pdfLexer) skipInlineImage() {
+	id := bytes.Index(l.data[l.pos:], []byte("ID"))
+	if id < 0 {
+		l.pos = len(l.data)
+		return
+	}
+	for i := l.pos + id + 3; i+2 <= len(l.data); i++ {
+		if l.data[i] == 'E' && l.data[i+1] == 'I' && isPDFSpace(l.data[i-1]) && (i+2 == len(l.data) || isPDFSpace(l.data[i+2])) {
+			l.pos = i + 2
+			return
+		}
+	}
+	l.pos = len(l.data)
+}
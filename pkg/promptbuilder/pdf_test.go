@@ -0,0 +1,101 @@
+package promptbuilder
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// testPDF returns a PDF file holding objects, numbered from 1. The
+// reader does not need a cross-reference table, so none is written.
+func testPDF(objects ...string) []byte {
+	var b bytes.Buffer
+	b.WriteString("%PDF-1.7\n")
+	for i, object := range objects {
+		fmt.Fprintf(&b, "%d 0 obj\n%s\nendobj\n", i+1, object)
+	}
+	b.WriteString("trailer\n<< /Root 1 0 R >>\n%%EOF\n")
+	return b.Bytes()
+}
+
+// pdfStreamObject returns a stream object, compressed with Flate when
+// flate is set.
+func pdfStreamObject(dict string, data string, flate bool) string {
+	if flate {
+		var compressed bytes.Buffer
+		w := zlib.NewWriter(&compressed)
+		w.Write([]byte(data))
+		w.Close()
+		data = compressed.String()
+		dict += " /Filter /FlateDecode"
+	}
+	return fmt.Sprintf("<< %s /Length %d >>\nstream\n%s\nendstream", dict, len(data), data)
+}
+
+func TestExtractPDF(t *testing.T) {
+	page1 := "BT /F1 12 Tf 72 720 Td (Hello) Tj [(Wor) -20 (ld) -400 (again)] TJ 0 -14 Td (Second \\(line\\)) Tj T* (\\101\\102C) Tj ET"
+	page2 := "BT /F1 12 Tf 1 0 0 1 72 700 Tm (Page two) Tj 1 0 0 1 200 700 Tm (same line) Tj ET"
+	pdf := testPDF(
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R 4 0 R] /Count 2 /Resources << /Font << /F1 5 0 R >> >> >>",
+		"<< /Type /Page /Parent 2 0 R /Contents 6 0 R >>",
+		"<< /Type /Page /Parent 2 0 R /Contents [7 0 R] >>",
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>",
+		pdfStreamObject("", page1, false),
+		pdfStreamObject("", page2, true),
+	)
+	text, err := extractPDF(pdf)
+	if err != nil {
+		t.Fatalf("extractPDF: %v", err)
+	}
+	want := "[Page 1]\nHelloWorld again\nSecond (line)\nABC\n\n[Page 2]\nPage two same line\n"
+	if text != want {
+		t.Errorf("extractPDF =\n%q\nwant\n%q", text, want)
+	}
+}
+
+// TestExtractPDFToUnicode checks that the two-byte codes of a composite
+// font are mapped with its ToUnicode CMap.
+func TestExtractPDFToUnicode(t *testing.T) {
+	cmap := `/CIDInit /ProcSet findresource begin
+begincmap
+1 begincodespacerange <0000> <FFFF> endcodespacerange
+2 beginbfchar <0003> <0020> <0010> <00E9> endbfchar
+1 beginbfrange <0020> <0022> <0061> endbfrange
+endcmap`
+	pdf := testPDF(
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /Contents 4 0 R /Resources << /Font << /F1 5 0 R >> >> >>",
+		pdfStreamObject("", "BT /F1 10 Tf <002000210022000300100010> Tj ET", true),
+		"<< /Type /Font /Subtype /Type0 /BaseFont /Custom /ToUnicode 6 0 R >>",
+		pdfStreamObject("", cmap, true),
+	)
+	text, err := extractPDF(pdf)
+	if err != nil {
+		t.Fatalf("extractPDF: %v", err)
+	}
+	if want := "[Page 1]\nabc éé\n"; text != want {
+		t.Errorf("extractPDF = %q, want %q", text, want)
+	}
+}
+
+func TestExtractPDFErrors(t *testing.T) {
+	tests := []struct {
+		content []byte
+		err     string
+	}{
+		{[]byte("PK\x03\x04"), "not a PDF file"},
+		{testPDF("<< /Type /Catalog /Pages 2 0 R >>", "<< /Encrypt 3 0 R >>"), "encrypted documents are not supported"},
+		{[]byte("%PDF-1.4\n%%EOF\n"), "no objects found"},
+		{testPDF("<< /Type /Pages /Kids [] >>"), "no document catalog"},
+		{testPDF("<< /Type /Catalog /Pages 2 0 R >>", "<< /Type /Pages /Kids [3 0 R] >>", "<< /Type /Page /Contents 4 0 R >>", pdfStreamObject("", "q 1 0 0 1 0 0 cm Q", false)), "no text found"},
+	}
+	for _, test := range tests {
+		if _, err := extractPDF(test.content); err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("extractPDF = %v, want %q", err, test.err)
+		}
+	}
+}
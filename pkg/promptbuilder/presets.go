@@ -0,0 +1,156 @@
+package promptbuilder
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// directive is a single key=value config line.
+type directive struct {
+	key   string
+	value string
+}
+
+// presets bundle the excludes every project of an ecosystem needs. They
+// are applied with "preset=<name>" and expand to ordinary directives.
+var presets = map[string][]directive{
+	"node": {
+		{"excludefolder", ".git"},
+		{"excludefolder", "node_modules"},
+		{"excludefolder", "dist"},
+		{"excludefolder", "build"},
+		{"excludefolder", "coverage"},
+		{"excludefolder", ".next"},
+		{"excludefolder", ".nuxt"},
+		{"excludefolder", ".cache"},
+		{"excludefile", "package-lock.json"},
+		{"excludefile", "yarn.lock"},
+		{"excludefile", "pnpm-lock.yaml"},
+		{"excludefile", "*.min.js"},
+		{"excludefile", "*.min.css"},
+		{"excludeextension", "map"},
+		{"excludeextension", "log"},
+	},
+	"go": {
+		{"excludefolder", ".git"},
+		{"excludefolder", "vendor"},
+		{"excludefolder", "bin"},
+		{"excludefile", "go.sum"},
+		{"excludeextension", "exe"},
+		{"excludeextension", "test"},
+		{"excludeextension", "out"},
+	},
+	"python": {
+		{"excludefolder", ".git"},
+		{"excludefolder", "__pycache__"},
+		{"excludefolder", ".venv"},
+		{"excludefolder", "venv"},
+		{"excludefolder", ".tox"},
+		{"excludefolder", ".mypy_cache"},
+		{"excludefolder", ".pytest_cache"},
+		{"excludefolder", ".ruff_cache"},
+		{"excludefolder", "*.egg-info"},
+		{"excludefolder", "build"},
+		{"excludefolder", "dist"},
+		{"excludefile", "poetry.lock"},
+		{"excludefile", "Pipfile.lock"},
+		{"excludefile", "uv.lock"},
+		{"excludeextension", "pyc"},
+		{"excludeextension", "pyo"},
+	},
+	"dotnet": {
+		{"excludefolder", ".git"},
+		{"excludefolder", "bin"},
+		{"excludefolder", "obj"},
+		{"excludefolder", ".vs"},
+		{"excludefolder", "packages"},
+		{"excludefolder", "TestResults"},
+		{"excludefile", "packages.lock.json"},
+		{"excludeextension", "dll"},
+		{"excludeextension", "pdb"},
+		{"excludeextension", "exe"},
+		{"excludeextension", "nupkg"},
+		{"excludeextension", "user"},
+	},
+}
+
+// presetMarkers are the files whose presence in basedir identifies the
+// ecosystem of a project. Markers may be glob patterns.
+var presetMarkers = []struct {
+	preset  string
+	markers []string
+}{
+	{"go", []string{"go.mod"}},
+	{"node", []string{"package.json"}},
+	{"python", []string{"pyproject.toml", "setup.py", "setup.cfg", "requirements.txt", "Pipfile"}},
+	{"dotnet", []string{"*.sln", "*.csproj", "*.fsproj", "*.vbproj"}},
+}
+
+// DetectPresets returns the presets whose marker files exist in dir. A
+// repository can match several, e.g. a Go backend with a package.json for
+// its frontend tooling.
+func DetectPresets(dir string) []string {
+	var detected []string
+	for _, p := range presetMarkers {
+		for _, marker := range p.markers {
+			if matches, _ := filepath.Glob(filepath.Join(dir, marker)); len(matches) > 0 {
+				detected = append(detected, p.preset)
+				break
+			}
+		}
+	}
+	return detected
+}
+
+// AutoDetect applies the presets detected in basedir and fills in what a
+// config without an input file is missing: basedir defaults to the current
+// directory, the whole of it is included, and .gitignore is honored when
+// present. It returns the applied presets.
+func (c *Config) AutoDetect() ([]string, error) {
+	if c.BaseDir == "" {
+		c.BaseDir = "."
+	}
+
+	detected := DetectPresets(c.BaseDir)
+	for _, name := range detected {
+		if err := c.applyPreset(name); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(c.Includes) == 0 {
+		c.Includes = append(c.Includes, Include{Path: "."})
+	}
+	if _, err := os.Stat(filepath.Join(c.BaseDir, ".gitignore")); err == nil {
+		c.UseGitignore = true
+	}
+
+	return detected, nil
+}
+
+// PresetNames returns the names of the built-in presets.
+func PresetNames() []string {
+	names := make([]string, 0, len(presets))
+	for name := range presets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (c *Config) applyPreset(name string) error {
+	directives, ok := presets[strings.ToLower(name)]
+	if !ok {
+		return fmt.Errorf("unknown preset %q (available: %s)", name, strings.Join(PresetNames(), ", "))
+	}
+
+	for _, d := range directives {
+		if err := c.applyDirective(d.key, d.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package promptbuilder
+
+import (
+	"fmt"
+	"time"
+)
+
+// Phases of a build reported by Progress.
+const (
+	PhaseReading = "reading" // files are read and their tokens counted
+	PhaseWriting = "writing" // the output is written
+)
+
+// Progress is the state of a build while its files are read or written,
+// passed to the function given to WithProgress.
+type Progress struct {
+	Phase   string
+	Done    int   // files done so far in this phase
+	Total   int   // files of the phase
+	Bytes   int64 // size of the files done so far
+	Elapsed time.Duration
+}
+
+// WithProgress calls fn after every file a build reads, then after every
+// file it writes; the last call of a phase has Done equal to Total. fn
+// runs on the goroutine of the build.
+func WithProgress(fn func(Progress)) Option {
+	return func(b *Builder) {
+		b.progress = fn
+	}
+}
+
+// ETA estimates the time left in the phase from the rate of the files
+// done so far. It is 0 until the first file is done.
+func (p Progress) ETA() time.Duration {
+	if p.Done == 0 || p.Done >= p.Total {
+		return 0
+	}
+	return p.Elapsed / time.Duration(p.Done) * time.Duration(p.Total-p.Done)
+}
+
+// String formats the progress as
+// "reading 1,234/5,000 files  12.3 MB  ETA 0:42".
+func (p Progress) String() string {
+	eta := p.ETA().Round(time.Second)
+	return fmt.Sprintf("%s %s/%s files  %s  ETA %d:%02d", p.Phase, formatThousands(p.Done), formatThousands(p.Total),
+		formatSize(p.Bytes), int(eta.Minutes()), int(eta.Seconds())%60)
+}
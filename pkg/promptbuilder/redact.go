@@ -0,0 +1,105 @@
+package promptbuilder
+
+import (
+	"math"
+	"regexp"
+	"strings"
+)
+
+// redactionRule replaces matches of pattern with replacement, or with a
+// [REDACTED:name] marker when replacement is empty. When group is non-zero
+// only that capture group is replaced, so "password = hunter2" keeps its
+// key. Matches whose replaced text has a Shannon entropy below minEntropy bits
+// per character are left alone, which keeps placeholders such as
+// "password = changeme" out of the way.
+type redactionRule struct {
+	name        string
+	pattern     *regexp.Regexp
+	group       int
+	minEntropy  float64
+	replacement string
+}
+
+// secretRules are the built-in secret detectors. More specific rules come
+// first so that, for example, an Anthropic key is not reported as an
+// OpenAI key.
+var secretRules = []redactionRule{
+	{name: "private-key", pattern: regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`)},
+	{name: "aws-key", pattern: regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`)},
+	{name: "aws-secret", pattern: regexp.MustCompile(`(?i)aws_?secret_?access_?key["']?\s*[:=]\s*["']?([A-Za-z0-9/+=]{40})`), group: 1},
+	{name: "github-token", pattern: regexp.MustCompile(`\b(?:gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{22,})\b`)},
+	{name: "slack-token", pattern: regexp.MustCompile(`\bxox[abprs]-[A-Za-z0-9-]{10,}`)},
+	{name: "stripe-key", pattern: regexp.MustCompile(`\b[rs]k_(?:live|test)_[A-Za-z0-9]{24,}`)},
+	{name: "google-api-key", pattern: regexp.MustCompile(`\bAIza[0-9A-Za-z_-]{35}`)},
+	{name: "anthropic-key", pattern: regexp.MustCompile(`\bsk-ant-[A-Za-z0-9_-]{20,}`)},
+	{name: "openai-key", pattern: regexp.MustCompile(`\bsk-(?:proj-)?[A-Za-z0-9_-]{20,}`)},
+	{name: "jwt", pattern: regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{10,}\.eyJ[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,}`)},
+	{name: "password", pattern: regexp.MustCompile(`\b[a-zA-Z][a-zA-Z0-9+.-]*://[^\s:/@]+:([^\s@/]+)@`), group: 1},
+	{
+		name:       "secret",
+		pattern:    regexp.MustCompile(`(?i)(?:password|passwd|secret|token|api[_-]?key|access[_-]?key|client[_-]?secret)["']?\s*[:=]\s*["']([^"'\s]{8,})["']`),
+		group:      1,
+		minEntropy: 3.0,
+	},
+}
+
+// redact applies rules to content in order and returns the result along
+// with the number of replacements per rule name.
+func redact(content string, rules []redactionRule) (string, map[string]int) {
+	var counts map[string]int
+
+	for _, rule := range rules {
+		matches := rule.pattern.FindAllStringSubmatchIndex(content, -1)
+		if len(matches) == 0 {
+			continue
+		}
+
+		var b strings.Builder
+		last := 0
+		for _, m := range matches {
+			start, end := m[2*rule.group], m[2*rule.group+1]
+			if start < 0 || shannonEntropy(content[start:end]) < rule.minEntropy {
+				continue
+			}
+
+			replacement := "[REDACTED:" + rule.name + "]"
+			if rule.replacement != "" {
+				replacement = string(rule.pattern.ExpandString(nil, rule.replacement, content, m))
+			}
+
+			b.WriteString(content[last:start])
+			b.WriteString(replacement)
+			last = end
+
+			if counts == nil {
+				counts = make(map[string]int)
+			}
+			counts[rule.name]++
+		}
+		b.WriteString(content[last:])
+		content = b.String()
+	}
+
+	return content, counts
+}
+
+// shannonEntropy returns the entropy of s in bits per character.
+func shannonEntropy(s string) float64 {
+	if s == "" {
+		return 0
+	}
+
+	freq := make(map[rune]int)
+	total := 0
+	for _, r := range s {
+		freq[r]++
+		total++
+	}
+
+	entropy := 0.0
+	for _, n := range freq {
+		p := float64(n) / float64(total)
+		entropy -= p * math.Log2(p)
+	}
+	return entropy
+}
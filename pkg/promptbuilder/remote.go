@@ -0,0 +1,141 @@
+package promptbuilder
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// remoteRefreshAfter is how long a cached clone is used before it is
+// fetched again. Clones of a commit are never fetched again.
+const remoteRefreshAfter = time.Hour
+
+// isRemote reports whether basedir names a git repository to clone rather
+// than a local directory.
+func isRemote(baseDir string) bool {
+	for _, prefix := range []string{"https://", "http://", "ssh://", "git://", "git@", "file://"} {
+		if strings.HasPrefix(baseDir, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// splitRemote splits "url@ref" into the repository URL and the ref, which
+// is "HEAD" when none is given. The @ of user names, as in
+// git@github.com:org/repo, belongs to the URL.
+func splitRemote(remote string) (url string, ref string) {
+	pathStart := 0
+	if i := strings.Index(remote, "://"); i >= 0 {
+		if j := strings.Index(remote[i+3:], "/"); j >= 0 {
+			pathStart = i + 3 + j
+		}
+	} else if i := strings.Index(remote, ":"); i >= 0 {
+		pathStart = i
+	}
+	if i := strings.LastIndex(remote, "@"); i > pathStart {
+		return remote[:i], remote[i+1:]
+	}
+	return remote, "HEAD"
+}
+
+// isCommit reports whether ref is a full commit hash, which never moves.
+func isCommit(ref string) bool {
+	if len(ref) != 40 {
+		return false
+	}
+	for _, r := range ref {
+		if !strings.ContainsRune("0123456789abcdef", r) {
+			return false
+		}
+	}
+	return true
+}
+
+// checkRemoteRef returns an error unless ref is a commit hash or a valid
+// ref name. The ref comes after the last @ of basedir and is passed to git
+// fetch, which would take one starting with "-" for an option.
+func checkRemoteRef(ctx context.Context, ref string) error {
+	if strings.HasPrefix(ref, "-") {
+		return fmt.Errorf("invalid git ref %q", ref)
+	}
+	if isCommit(ref) {
+		return nil
+	}
+	if _, err := runGit(ctx, "", "check-ref-format", "--allow-onelevel", ref); err != nil {
+		return fmt.Errorf("invalid git ref %q", ref)
+	}
+	return nil
+}
+
+// cloneRemote makes a shallow clone of a remote basedir, "url" or
+// "url@ref", in the user cache directory and returns its path. A clone
+// made earlier is reused, and fetched again once it is older than
+// remoteRefreshAfter.
+func cloneRemote(ctx context.Context, remote string) (string, error) {
+	url, ref := splitRemote(remote)
+	if err := checkRemoteRef(ctx, ref); err != nil {
+		return "", fmt.Errorf("cannot clone %s: %v", remote, err)
+	}
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("cannot find a directory for the clone of %s: %v", remote, err)
+	}
+	sum := sha256.Sum256([]byte(url + "@" + ref))
+	dir := filepath.Join(cacheDir, "promptbuilder", "repos", hex.EncodeToString(sum[:8]))
+
+	if info, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+		if isCommit(ref) || time.Since(info.ModTime()) < remoteRefreshAfter {
+			return dir, nil
+		}
+		if err := fetchRef(ctx, dir, url, ref); err != nil {
+			return "", fmt.Errorf("cannot update the clone of %s: %v", remote, err)
+		}
+		// The mtime of .git records when the clone was last fetched
+		now := time.Now()
+		os.Chtimes(filepath.Join(dir, ".git"), now, now)
+		return dir, nil
+	}
+
+	// Clone next to the cache entry and move it in place when complete, so
+	// that an interrupted clone is never taken for a cached one
+	if err := os.MkdirAll(filepath.Dir(dir), 0o755); err != nil {
+		return "", err
+	}
+	tmp, err := os.MkdirTemp(filepath.Dir(dir), "clone-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmp)
+
+	if _, err := runGit(ctx, tmp, "init", "--quiet"); err != nil {
+		return "", fmt.Errorf("cannot clone %s: %v", remote, err)
+	}
+	if err := fetchRef(ctx, tmp, url, ref); err != nil {
+		return "", fmt.Errorf("cannot clone %s: %v", remote, err)
+	}
+	if err := os.Rename(tmp, dir); err != nil {
+		if _, statErr := os.Stat(filepath.Join(dir, ".git")); statErr == nil {
+			// Another run cloned the same repository meanwhile
+			return dir, nil
+		}
+		return "", err
+	}
+	return dir, nil
+}
+
+// fetchRef fetches the single commit of ref from url into the repository
+// in dir and checks it out. Fetching works for branches, tags and commit
+// hashes alike, where "git clone --branch" does not take hashes.
+func fetchRef(ctx context.Context, dir string, url string, ref string) error {
+	if _, err := runGit(ctx, dir, "fetch", "--quiet", "--depth", "1", "--end-of-options", url, ref); err != nil {
+		return err
+	}
+	_, err := runGit(ctx, dir, "checkout", "--quiet", "--force", "--detach", "FETCH_HEAD")
+	return err
+}
@@ -0,0 +1,85 @@
+package promptbuilder
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestIsRemote(t *testing.T) {
+	for _, dir := range []string{"https://github.com/org/repo", "git@github.com:org/repo.git", "ssh://host/repo", "file:///srv/repo"} {
+		if !isRemote(dir) {
+			t.Errorf("isRemote(%q) = false", dir)
+		}
+	}
+	for _, dir := range []string{".", "/srv/repo", "repo.zip", "github.com/org/repo"} {
+		if isRemote(dir) {
+			t.Errorf("isRemote(%q) = true", dir)
+		}
+	}
+}
+
+func TestSplitRemote(t *testing.T) {
+	tests := []struct {
+		remote string
+		url    string
+		ref    string
+	}{
+		{"https://github.com/org/repo", "https://github.com/org/repo", "HEAD"},
+		{"https://github.com/org/repo@v1.2.0", "https://github.com/org/repo", "v1.2.0"},
+		{"https://user@github.com/org/repo", "https://user@github.com/org/repo", "HEAD"},
+		{"https://user@github.com/org/repo@main", "https://user@github.com/org/repo", "main"},
+		{"git@github.com:org/repo.git", "git@github.com:org/repo.git", "HEAD"},
+		{"git@github.com:org/repo.git@feature/x", "git@github.com:org/repo.git", "feature/x"},
+		{"file:///srv/repo@--upload-pack=touch /tmp/x", "file:///srv/repo", "--upload-pack=touch /tmp/x"},
+	}
+	for _, test := range tests {
+		url, ref := splitRemote(test.remote)
+		if url != test.url || ref != test.ref {
+			t.Errorf("splitRemote(%q) = %q, %q, want %q, %q", test.remote, url, ref, test.url, test.ref)
+		}
+	}
+}
+
+func TestCheckRemoteRef(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	ctx := context.Background()
+	for _, ref := range []string{"HEAD", "main", "v1.2.0", "feature/x", strings.Repeat("a1", 20)} {
+		if err := checkRemoteRef(ctx, ref); err != nil {
+			t.Errorf("checkRemoteRef(%q) = %v", ref, err)
+		}
+	}
+	for _, ref := range []string{"--upload-pack=touch /tmp/x", "-q", "main..other", "a b", "refs/heads/x.lock", ""} {
+		if err := checkRemoteRef(ctx, ref); err == nil {
+			t.Errorf("checkRemoteRef(%q) accepted the ref", ref)
+		}
+	}
+}
+
+func TestCloneRemoteRejectsOptions(t *testing.T) {
+	repo := testRepo(t)
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	marker := filepath.Join(t.TempDir(), "PWNED")
+
+	_, err := cloneRemote(context.Background(), "file://"+repo+"@--upload-pack=touch "+marker)
+	if err == nil || !strings.Contains(err.Error(), "invalid git ref") {
+		t.Errorf("cloneRemote = %v, want an invalid ref error", err)
+	}
+	if _, err := os.Stat(marker); err == nil {
+		t.Error("the option given as ref ran a command")
+	}
+
+	dir, err := cloneRemote(context.Background(), "file://"+repo+"@main")
+	if err != nil {
+		t.Fatalf("cloneRemote: %v", err)
+	}
+	if content, err := os.ReadFile(filepath.Join(dir, "a.txt")); err != nil || string(content) != "a\n" {
+		t.Errorf("clone holds a.txt = %q, %v", content, err)
+	}
+}
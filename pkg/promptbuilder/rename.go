@@ -0,0 +1,176 @@
+package promptbuilder
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Rename replaces a name, such as that of a customer or an internal
+// project, wherever it appears in paths and content. It is written as
+// "rename=old=>new".
+type Rename struct {
+	From string
+	To   string
+}
+
+func parseRename(value string) (Rename, error) {
+	from, to, ok := strings.Cut(value, "=>")
+	rename := Rename{From: strings.TrimSpace(from), To: strings.TrimSpace(to)}
+	if !ok || rename.From == "" || rename.To == "" {
+		return rename, fmt.Errorf("use old=>new")
+	}
+	return rename, nil
+}
+
+type renameRule struct {
+	pattern     *regexp.Regexp
+	replacement string
+}
+
+// newRenameRules compiles the renames of config, longest name first so
+// that "acme-billing=>a" wins over "acme=>b". With anonymizePaths, the
+// location of basedir becomes "." and the home directory "~" first.
+func newRenameRules(config *Config) []renameRule {
+	var rules []renameRule
+	if config.AnonymizePaths {
+		locations := []Rename{{From: config.BaseDir, To: "."}}
+		if real, err := filepath.EvalSymlinks(config.BaseDir); err == nil && real != config.BaseDir {
+			locations = append(locations, Rename{From: real, To: "."})
+		}
+		if home, err := os.UserHomeDir(); err == nil && len(home) > 1 {
+			locations = append(locations, Rename{From: home, To: "~"})
+		}
+		for _, location := range locations {
+			rules = append(rules, renameRule{wordPattern(location.From), location.To})
+		}
+	}
+
+	renames := append([]Rename(nil), config.Renames...)
+	sort.SliceStable(renames, func(i, j int) bool {
+		return len(renames[i].From) > len(renames[j].From)
+	})
+	for _, rename := range renames {
+		rules = append(rules, renameRule{wordPattern(rename.From), rename.To})
+	}
+	return rules
+}
+
+// wordPattern matches s where it is not part of a longer word, so that
+// renaming "acme" leaves "acmecorp" alone but changes "acme-billing".
+func wordPattern(s string) *regexp.Regexp {
+	pattern := regexp.QuoteMeta(s)
+	if r, _ := utf8.DecodeRuneInString(s); isWordRune(r) {
+		pattern = `\b` + pattern
+	}
+	if r, _ := utf8.DecodeLastRuneInString(s); isWordRune(r) {
+		pattern += `\b`
+	}
+	return regexp.MustCompile(pattern)
+}
+
+func isWordRune(r rune) bool {
+	return r == '_' || r < utf8.RuneSelf && (unicode.IsLetter(r) || unicode.IsDigit(r))
+}
+
+func applyRenames(rules []renameRule, s string) string {
+	for _, rule := range rules {
+		s = rule.pattern.ReplaceAllLiteralString(s, rule.replacement)
+	}
+	return s
+}
+
+// PathMap maps the names that rename directives put into a prompt back to
+// the original ones. It is saved next to the output so that the paths and
+// code of a model response can be restored before they are applied.
+type PathMap map[string]string
+
+// PathMapPath returns the path of the path map written alongside
+// outputPath: output.txt becomes output.pathmap.json.
+func PathMapPath(outputPath string) string {
+	return strings.TrimSuffix(outputPath, filepath.Ext(outputPath)) + ".pathmap.json"
+}
+
+// ReadPathMap reads a path map saved with Write.
+func ReadPathMap(path string) (PathMap, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var pathMap PathMap
+	if err := json.Unmarshal(data, &pathMap); err != nil {
+		return nil, fmt.Errorf("error parsing path map %s: %v", path, err)
+	}
+	return pathMap, nil
+}
+
+// Write saves the path map as JSON.
+func (m PathMap) Write(path string) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+// Restore replaces the new names in s with the original ones.
+func (m PathMap) Restore(s string) string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if len(names[i]) != len(names[j]) {
+			return len(names[i]) > len(names[j])
+		}
+		return names[i] < names[j]
+	})
+	rules := make([]renameRule, len(names))
+	for i, name := range names {
+		rules[i] = renameRule{wordPattern(name), m[name]}
+	}
+	return applyRenames(rules, s)
+}
+
+// RestoreChange restores the original names in the path and content of a
+// change parsed from a response.
+func (m PathMap) RestoreChange(change FileChange) FileChange {
+	if len(m) == 0 {
+		return change
+	}
+	change.Path = m.Restore(change.Path)
+	change.Content = m.Restore(change.Content)
+	hunks := make([]Hunk, len(change.Hunks))
+	for i, hunk := range change.Hunks {
+		hunks[i] = Hunk{OldStart: hunk.OldStart, Lines: make([]string, len(hunk.Lines))}
+		for j, line := range hunk.Lines {
+			hunks[i].Lines[j] = m.Restore(line)
+		}
+	}
+	change.Hunks = hunks
+	return change
+}
+
+// PathMap returns the reverse of the rename directives of the
+// configuration, or nil when there are none.
+func (b *Builder) PathMap() PathMap {
+	if len(b.config.Renames) == 0 {
+		return nil
+	}
+	pathMap := make(PathMap, len(b.config.Renames))
+	for _, rename := range b.config.Renames {
+		pathMap[rename.To] = rename.From
+	}
+	return pathMap
+}
+
+// anonymize applies the renames to text that goes into the prompt.
+func (b *Builder) anonymize(text string) string {
+	return applyRenames(b.renames, text)
+}
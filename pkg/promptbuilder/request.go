@@ -0,0 +1,247 @@
+package promptbuilder
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+)
+
+// openAIChatRenderer writes an OpenAI chat completions request body: the
+// header becomes the system message and the files, rendered as markdown,
+// one or more user messages. With splittokens or splitchars, every part
+// gets a user message of its own within the same request.
+type openAIChatRenderer struct {
+	markdownRenderer
+	model       string
+	splitTokens int
+	splitChars  int
+}
+
+func (r openAIChatRenderer) writeOutput(w io.Writer, doc *document) error {
+	b := bufio.NewWriter(w)
+	fmt.Fprintf(b, "{\n  \"model\": %s,\n  \"messages\": [", jsonQuote(r.model))
+
+	sep := "\n"
+	if doc.Header != "" {
+		b.WriteString(sep + "    {\n      \"role\": \"system\",\n      \"content\": \"")
+		io.WriteString(jsonStringWriter{b}, doc.Header)
+		b.WriteString("\"\n    }")
+		sep = ",\n"
+	}
+
+	// Attachments turn the content of the first message into a list of
+	// parts, ahead of the text
+	before, attachments := splitAttachments(doc.Before)
+	textDoc := *doc
+	textDoc.Before = before
+
+	parts := messageParts(doc.Sections, r.splitTokens, r.splitChars)
+	for i, part := range parts {
+		b.WriteString(sep + "    {\n      \"role\": \"user\",\n      \"content\": ")
+		if i == 0 && len(attachments) > 0 {
+			b.WriteString("[")
+			for _, attachment := range attachments {
+				b.WriteString("\n        ")
+				b.Write(openAIAttachment(attachment))
+				b.WriteString(",")
+			}
+			b.WriteString("\n        {\n          \"type\": \"text\",\n          \"text\": \"")
+			if err := r.writeContext(jsonStringWriter{b}, &textDoc, part, true, i == len(parts)-1); err != nil {
+				return err
+			}
+			b.WriteString("\"\n        }\n      ]\n    }")
+		} else {
+			b.WriteString("\"")
+			if err := r.writeContext(jsonStringWriter{b}, &textDoc, part, i == 0, i == len(parts)-1); err != nil {
+				return err
+			}
+			b.WriteString("\"\n    }")
+		}
+		sep = ",\n"
+	}
+
+	b.WriteString("\n  ]\n}\n")
+	return b.Flush()
+}
+
+// writeContext writes one part of the files as markdown, preceded by the
+// tree and the sections before the files in the first part, and followed
+// by the sections after the files and the footer in the last part.
+func (r markdownRenderer) writeContext(w io.Writer, doc *document, part []fileSection, first bool, last bool) error {
+	partDoc := &document{Sections: part, load: doc.load}
+	if first {
+		if r.tree {
+			io.WriteString(w, "# Directory Structure\n```\n"+renderTree(sectionPaths(doc.Sections))+"```\n\n")
+		}
+		partDoc.Before = doc.Before
+	}
+	if last {
+		partDoc.After = doc.After
+		partDoc.Footer = doc.Footer
+	}
+	return markdownRenderer{}.writeOutput(w, partDoc)
+}
+
+// anthropicRenderer writes an Anthropic Messages API request body: the
+// header goes in the system field and the files, wrapped in XML tags, in
+// the text blocks of a single user message, one block per part. The
+// footer follows in a block of its own, so that with prompt caching the
+// context stays cached while the question changes.
+type anthropicRenderer struct {
+	xmlRenderer
+	model         string
+	splitTokens   int
+	splitChars    int
+	promptCaching bool
+}
+
+func (r anthropicRenderer) writeOutput(w io.Writer, doc *document) error {
+	b := bufio.NewWriter(w)
+	fmt.Fprintf(b, "{\n  \"model\": %s,\n  \"max_tokens\": %d,\n", jsonQuote(r.model), anthropicMaxTokens)
+	if doc.Header != "" {
+		b.WriteString("  \"system\": \"")
+		io.WriteString(jsonStringWriter{b}, doc.Header)
+		b.WriteString("\",\n")
+	}
+	b.WriteString("  \"messages\": [\n    {\n      \"role\": \"user\",\n      \"content\": [")
+
+	// Attachments come first, as the API documentation recommends for
+	// images
+	before, attachments := splitAttachments(doc.Before)
+	textDoc := *doc
+	textDoc.Before = before
+	for _, attachment := range attachments {
+		b.WriteString("\n        ")
+		b.Write(anthropicAttachment(attachment))
+		b.WriteString(",")
+	}
+
+	parts := messageParts(doc.Sections, r.splitTokens, r.splitChars)
+	for i, part := range parts {
+		if i > 0 {
+			b.WriteString(",")
+		}
+		b.WriteString("\n        {\n          \"type\": \"text\",\n          \"text\": \"")
+		if err := r.writeContext(jsonStringWriter{b}, &textDoc, part, i == 0, i == len(parts)-1); err != nil {
+			return err
+		}
+		b.WriteString("\"")
+		if r.promptCaching && i == len(parts)-1 {
+			b.WriteString(",\n          \"cache_control\": {\"type\": \"ephemeral\"}")
+		}
+		b.WriteString("\n        }")
+	}
+	if doc.Footer != "" {
+		b.WriteString(",\n        {\n          \"type\": \"text\",\n          \"text\": \"")
+		io.WriteString(jsonStringWriter{b}, doc.Footer)
+		b.WriteString("\"\n        }")
+	}
+
+	b.WriteString("\n      ]\n    }\n  ]\n}\n")
+	return b.Flush()
+}
+
+// writeContext writes one part of the files as XML. The first part starts
+// with the directory structure of all files and the sections before the
+// files; the last part ends with the sections after the files.
+func (r xmlRenderer) writeContext(w io.Writer, doc *document, part []fileSection, first bool, last bool) error {
+	partDoc := &document{Sections: part, load: doc.load}
+	if first {
+		if r.directoryStructure {
+			io.WriteString(w, "<directory_structure>\n"+renderTree(sectionPaths(doc.Sections))+"</directory_structure>\n")
+		}
+		partDoc.Before = doc.Before
+	}
+	if last {
+		partDoc.After = doc.After
+	}
+	return xmlRenderer{}.writeOutput(w, partDoc)
+}
+
+// openAIAttachment returns the content part of an attachment in a chat
+// completions message: an image_url for images, a file otherwise.
+func openAIAttachment(section extraSection) []byte {
+	url := "data:" + section.MediaType + ";base64," + section.Content
+	var part any
+	if section.Image {
+		part = map[string]any{"type": "image_url", "image_url": map[string]string{"url": url}}
+	} else {
+		part = map[string]any{"type": "file", "file": map[string]string{"filename": path.Base(section.Title), "file_data": url}}
+	}
+	data, _ := json.Marshal(part)
+	return data
+}
+
+// anthropicAttachment returns the content block of an attachment in a
+// Messages API request: an image block for images, a document otherwise.
+func anthropicAttachment(section extraSection) []byte {
+	source := map[string]string{"type": "base64", "media_type": section.MediaType, "data": section.Content}
+	var block any
+	if section.Image {
+		block = map[string]any{"type": "image", "source": source}
+	} else {
+		block = map[string]any{"type": "document", "source": source, "title": section.Title}
+	}
+	data, _ := json.Marshal(block)
+	return data
+}
+
+// messageParts splits sections into the parts sent as separate messages,
+// with the same limits as BuildParts.
+func messageParts(sections []fileSection, splitTokens int, splitChars int) [][]fileSection {
+	switch {
+	case splitTokens > 0:
+		return splitSections(sections, splitTokens, func(s fileSection) int { return s.Tokens })
+	case splitChars > 0:
+		return splitSections(sections, splitChars, func(s fileSection) int { return s.TextLen })
+	}
+	return [][]fileSection{sections}
+}
+
+// jsonStringWriter escapes what is written to it for use inside a JSON
+// string. Bytes outside ASCII are passed through, so a multi-byte
+// character split across two writes stays intact.
+type jsonStringWriter struct {
+	w io.Writer
+}
+
+func (j jsonStringWriter) Write(p []byte) (int, error) {
+	start := 0
+	for i, c := range p {
+		var escaped string
+		switch {
+		case c == '"':
+			escaped = `\"`
+		case c == '\\':
+			escaped = `\\`
+		case c == '\n':
+			escaped = `\n`
+		case c == '\r':
+			escaped = `\r`
+		case c == '\t':
+			escaped = `\t`
+		case c < 0x20:
+			escaped = fmt.Sprintf(`\u%04x`, c)
+		default:
+			continue
+		}
+		if _, err := j.w.Write(p[start:i]); err != nil {
+			return 0, err
+		}
+		if _, err := io.WriteString(j.w, escaped); err != nil {
+			return 0, err
+		}
+		start = i + 1
+	}
+	if _, err := j.w.Write(p[start:]); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func jsonQuote(s string) string {
+	data, _ := json.Marshal(s)
+	return string(data)
+}
@@ -0,0 +1,196 @@
+package promptbuilder
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Config file formats written by WriteConfig.
+const (
+	ConfigFormatText = "txt"
+	ConfigFormatYAML = "yaml"
+)
+
+// dataLanguages are languages that do not count when looking for the main
+// language of a project.
+var dataLanguages = map[string]bool{
+	"csv":      true,
+	"ini":      true,
+	"json":     true,
+	"markdown": true,
+	"text":     true,
+	"toml":     true,
+	"xml":      true,
+	"yaml":     true,
+}
+
+// scaffoldSkip are the files promptbuilder itself reads and writes, which
+// are never proposed as includes.
+var scaffoldSkip = map[string]bool{
+	"input.txt":          true,
+	"output.txt":         true,
+	"promptbuilder.yaml": true,
+	"promptbuilder.yml":  true,
+	"promptbuilder.toml": true,
+}
+
+// Suggestion is a starter config proposed for a directory.
+type Suggestion struct {
+	// Presets are the presets detected from marker files.
+	Presets []string
+	// Language is the most common programming language, if any.
+	Language string
+	// Includes are the top-level paths that contain code in Language, or
+	// "." when no language stands out.
+	Includes []string
+	// Others are the remaining top-level paths with files, offered as
+	// commented-out includes.
+	Others []string
+	// UseGitignore is set when the directory has a .gitignore file.
+	UseGitignore bool
+}
+
+// Suggest walks dir, honoring .gitignore and the detected presets, and
+// proposes includes focused on the dominant language.
+func Suggest(ctx context.Context, dir string) (*Suggestion, error) {
+	baseDir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	config := NewConfig()
+	config.BaseDir = baseDir
+	presets, err := config.AutoDetect()
+	if err != nil {
+		return nil, err
+	}
+	config.ExcludeFolders = append(config.ExcludeFolders, ".git")
+
+	files, err := collectFiles(ctx, osSourceFS(baseDir), baseDir, config, 0, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int)
+	for _, file := range files {
+		if lang := detectLanguage(file); lang != "" && !dataLanguages[lang] {
+			counts[lang]++
+		}
+	}
+	language := ""
+	for lang, n := range counts {
+		if n > counts[language] || (n == counts[language] && lang < language) {
+			language = lang
+		}
+	}
+
+	// Group the files by their top-level entry
+	withLanguage := make(map[string]bool)
+	seen := make(map[string]bool)
+	var top []string
+	for _, file := range files {
+		parts := splitPath(filepath.ToSlash(file))
+		entry := parts[0]
+		if scaffoldSkip[entry] {
+			continue
+		}
+		if !seen[entry] {
+			seen[entry] = true
+			top = append(top, entry)
+		}
+		if language != "" && detectLanguage(file) == language {
+			withLanguage[entry] = true
+		}
+	}
+	sort.Strings(top)
+
+	s := &Suggestion{
+		Presets:      presets,
+		Language:     language,
+		UseGitignore: config.UseGitignore,
+	}
+	for _, entry := range top {
+		if withLanguage[entry] {
+			s.Includes = append(s.Includes, entry)
+		} else {
+			s.Others = append(s.Others, entry)
+		}
+	}
+	if len(s.Includes) == 0 {
+		s.Includes = []string{"."}
+		s.Others = nil
+	}
+
+	return s, nil
+}
+
+// WriteConfig writes the suggestion as a commented starter config in the
+// given format.
+func (s *Suggestion) WriteConfig(w io.Writer, format string) error {
+	var b strings.Builder
+
+	switch format {
+	case ConfigFormatText:
+		b.WriteString("Describe what you want the model to do with these files.\n")
+		b.WriteString("---\n")
+		s.writeComments(&b)
+		b.WriteString("basedir=.\n")
+		for _, include := range s.Includes {
+			fmt.Fprintf(&b, "include=%s\n", include)
+		}
+		for _, other := range s.Others {
+			fmt.Fprintf(&b, "# include=%s\n", other)
+		}
+		for _, preset := range s.Presets {
+			fmt.Fprintf(&b, "preset=%s\n", preset)
+		}
+		if s.UseGitignore {
+			b.WriteString("useGitignore=true\n")
+		}
+		b.WriteString("# excludeFolder=testdata\n")
+		b.WriteString("# maxTokens=100000\n")
+	case ConfigFormatYAML:
+		s.writeComments(&b)
+		b.WriteString("header: |\n")
+		b.WriteString("  Describe what you want the model to do with these files.\n")
+		b.WriteString("basedir: .\n")
+		b.WriteString("include:\n")
+		for _, include := range s.Includes {
+			fmt.Fprintf(&b, "  - %s\n", include)
+		}
+		for _, other := range s.Others {
+			fmt.Fprintf(&b, "  # - %s\n", other)
+		}
+		if len(s.Presets) > 0 {
+			fmt.Fprintf(&b, "preset: [%s]\n", strings.Join(s.Presets, ", "))
+		}
+		if s.UseGitignore {
+			b.WriteString("useGitignore: true\n")
+		}
+		b.WriteString("# excludeFolder: [testdata]\n")
+		b.WriteString("# maxTokens: 100000\n")
+	default:
+		return fmt.Errorf("unsupported config format: %s", format)
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func (s *Suggestion) writeComments(b *strings.Builder) {
+	b.WriteString("# Starter config written by promptbuilder init. Review the includes\n")
+	b.WriteString("# and excludes, then run promptbuilder to generate the prompt.\n")
+	if s.Language != "" {
+		fmt.Fprintf(b, "# Most files are %s; the includes below are the paths that contain them.\n", s.Language)
+	}
+	if len(s.Others) > 0 {
+		b.WriteString("# Uncomment other paths to add them to the prompt.\n")
+	}
+	if len(s.Presets) > 0 {
+		b.WriteString("# Presets add the usual excludes of the detected ecosystems.\n")
+	}
+}
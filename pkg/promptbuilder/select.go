@@ -0,0 +1,156 @@
+package promptbuilder
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Files are embedded in chunks of at most chunkLines lines and chunkChars
+// characters, so that a relevant function in a long file is not drowned
+// out by the rest of it, and every chunk fits the input of an embedding
+// model.
+const (
+	chunkLines = 60
+	chunkChars = 4000
+)
+
+// ScoredFile is a file ranked by Rank, with the similarity of its closest
+// chunk to the query.
+type ScoredFile struct {
+	Path  string
+	Score float64
+}
+
+// Rank embeds the query and the files selected by the configuration, and
+// returns the files ordered by how similar their closest chunk is to the
+// query, most similar first. Binary files are skipped.
+func (b *Builder) Rank(ctx context.Context, query string, embedder Embedder) ([]ScoredFile, error) {
+	files, err := b.findFiles(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error finding files: %w", err)
+	}
+
+	texts := []string{query}
+	var owners []int // index into paths of the file of each chunk
+	var paths []string
+	for _, file := range files {
+		fullPath := filepath.Join(b.config.BaseDir, file.RelPath)
+		isBinary, known := binaryRule(fullPath, b.config)
+		document := isDocument(fullPath) && !isBinary
+		if !known && !document {
+			var err error
+			if isBinary, err = isBinaryFile(b.src, fullPath, b.config.BinarySampleSize); err != nil {
+				continue
+			}
+		}
+		if isBinary {
+			continue
+		}
+		content, err := b.src.readFile(fullPath)
+		if err != nil {
+			return nil, fmt.Errorf("error reading file %s: %v", file.RelPath, err)
+		}
+
+		var text string
+		if document {
+			if text, err = extractDocument(fullPath, content); err != nil {
+				continue
+			}
+		} else {
+			var ok bool
+			if text, _, ok = decodeText(content, b.config.Encoding); !ok {
+				continue
+			}
+		}
+
+		path := filepath.ToSlash(file.RelPath)
+		paths = append(paths, path)
+		for _, chunk := range chunkText(text) {
+			// The path tells what the chunk is about as much as its code
+			texts = append(texts, path+"\n"+chunk)
+			owners = append(owners, len(paths)-1)
+		}
+	}
+	b.infof("Embedding %d chunks of %d files", len(texts)-1, len(paths))
+
+	vectors, err := embedder.Embed(ctx, texts)
+	if err != nil {
+		return nil, fmt.Errorf("error embedding files: %w", err)
+	}
+	if len(vectors) != len(texts) {
+		return nil, fmt.Errorf("got %d embeddings for %d texts", len(vectors), len(texts))
+	}
+
+	scores := make([]ScoredFile, len(paths))
+	for i, path := range paths {
+		scores[i] = ScoredFile{Path: path, Score: -1}
+	}
+	for i, vector := range vectors[1:] {
+		owner := owners[i]
+		scores[owner].Score = max(scores[owner].Score, cosine(vectors[0], vector))
+	}
+
+	sort.SliceStable(scores, func(i, j int) bool {
+		if scores[i].Score != scores[j].Score {
+			return scores[i].Score > scores[j].Score
+		}
+		return scores[i].Path < scores[j].Path
+	})
+	return scores, nil
+}
+
+// chunkText splits content into chunks of at most chunkLines lines and
+// chunkChars characters. Empty files give a single empty chunk, so that
+// they can still be ranked by their path.
+func chunkText(content string) []string {
+	lines := splitLines(content)
+	if len(lines) == 0 {
+		return []string{""}
+	}
+
+	var chunks []string
+	var chunk strings.Builder
+	n := 0
+	for _, line := range lines {
+		for len(line) > chunkChars {
+			// Minified code and data can have a single huge line
+			chunks = append(chunks, line[:chunkChars])
+			line = line[chunkChars:]
+		}
+		if n == chunkLines || chunk.Len()+len(line) > chunkChars {
+			chunks = append(chunks, chunk.String())
+			chunk.Reset()
+			n = 0
+		}
+		chunk.WriteString(line)
+		chunk.WriteByte('\n')
+		n++
+	}
+	if chunk.Len() > 0 {
+		chunks = append(chunks, chunk.String())
+	}
+	return chunks
+}
+
+// UseRanking replaces the includes with the first top files of a ranking.
+// Better ranked files get a higher include priority, so that maxtokens
+// drops the least similar files first.
+func (c *Config) UseRanking(ranked []ScoredFile, top int) error {
+	if top > 0 && len(ranked) > top {
+		ranked = ranked[:top]
+	}
+	paths := make([]string, len(ranked))
+	for i, file := range ranked {
+		paths[i] = file.Path
+	}
+	if err := c.UseFileList(paths); err != nil {
+		return err
+	}
+	for i := range c.Includes {
+		c.Includes[i].Priority = len(c.Includes) - i
+	}
+	return nil
+}
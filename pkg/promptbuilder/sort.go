@@ -0,0 +1,175 @@
+package promptbuilder
+
+import (
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// File orders supported by the sort directive.
+const (
+	sortPath      = "path"
+	sortSize      = "size"
+	sortMtime     = "mtime"
+	sortExtension = "extension"
+	sortTokens    = "tokens"
+	sortDeps      = "deps"
+	sortNone      = "none"
+)
+
+// groupByDir groups the files by directory.
+const groupByDir = "dir"
+
+var sortKeys = []string{sortPath, sortSize, sortMtime, sortExtension, sortTokens, sortDeps, sortNone}
+
+// sortSections orders the files by the sort setting of the configuration,
+// breaking ties by path so that the order never depends on the file
+// system. With sort=none the files keep the order of the includes.
+func (b *Builder) sortSections(sections []fileSection) {
+	key := b.config.Sort
+	if key == sortNone {
+		return
+	}
+
+	var mtimes map[string]int64
+	if key == sortMtime {
+		mtimes = make(map[string]int64, len(sections))
+		for _, section := range sections {
+			if info, err := b.src.stat(filepath.Join(b.config.BaseDir, section.File.RelPath)); err == nil {
+				mtimes[section.Path] = info.ModTime().UnixNano()
+			}
+		}
+	}
+
+	var ranks map[string]int
+	if key == sortDeps {
+		ranks = b.dependencyRanks(sections)
+	}
+
+	// compare returns a negative number when a comes first by key alone
+	compare := func(a, c fileSection) int {
+		switch key {
+		case sortSize:
+			return a.Size - c.Size
+		case sortTokens:
+			return a.Tokens - c.Tokens
+		case sortMtime:
+			switch ma, mc := mtimes[a.Path], mtimes[c.Path]; {
+			case ma < mc:
+				return -1
+			case ma > mc:
+				return 1
+			}
+		case sortDeps:
+			return depRank(ranks, b.config.BaseDir, a) - depRank(ranks, b.config.BaseDir, c)
+		case sortExtension:
+			return strings.Compare(strings.ToLower(filepath.Ext(a.File.RelPath)), strings.ToLower(filepath.Ext(c.File.RelPath)))
+		}
+		return 0
+	}
+
+	sort.SliceStable(sections, func(i, j int) bool {
+		a, c := sections[i], sections[j]
+		if b.config.Reverse {
+			a, c = c, a
+		}
+		if n := compare(a, c); n != 0 {
+			return n < 0
+		}
+		return filepath.ToSlash(a.File.RelPath) < filepath.ToSlash(c.File.RelPath)
+	})
+}
+
+// dependencyRanks returns the position of every Go package directory of
+// sections in a topological order of their imports, packages before the
+// packages that import them. Independent packages are ordered by path,
+// and import cycles, which only test packages can form, are broken at
+// the package that comes first by path.
+func (b *Builder) dependencyRanks(sections []fileSection) map[string]int {
+	module, ok := findGoModule(b.src, b.config.BaseDir)
+	if !ok {
+		b.warnf("sort=deps needs a go.mod in basedir or one of its parents, sorting by path")
+		return nil
+	}
+
+	files := make(map[string][]string) // package directory -> its files
+	for _, section := range sections {
+		if strings.HasSuffix(section.File.RelPath, ".go") {
+			path := filepath.Join(b.config.BaseDir, section.File.RelPath)
+			files[filepath.Dir(path)] = append(files[filepath.Dir(path)], path)
+		}
+	}
+
+	// deps[dir] are the included packages that dir imports
+	deps := make(map[string]map[string]bool, len(files))
+	var pending []string
+	for dir, paths := range files {
+		deps[dir] = make(map[string]bool)
+		for _, importPath := range goImports(b.src, paths) {
+			if dep, ok := module.packageDir(importPath); ok && dep != dir && files[dep] != nil {
+				deps[dir][dep] = true
+			}
+		}
+		pending = append(pending, dir)
+	}
+	sort.Strings(pending)
+
+	ranks := make(map[string]int, len(pending))
+	for len(pending) > 0 {
+		next := 0 // first package by path, used when all are in a cycle
+		for i, dir := range pending {
+			if len(deps[dir]) == 0 {
+				next = i
+				break
+			}
+		}
+		dir := pending[next]
+		pending = append(pending[:next], pending[next+1:]...)
+		ranks[dir] = len(ranks)
+		for _, other := range pending {
+			delete(deps[other], dir)
+		}
+	}
+	return ranks
+}
+
+// depRank returns the rank of the package of a Go file, and places other
+// files after all packages.
+func depRank(ranks map[string]int, baseDir string, section fileSection) int {
+	if strings.HasSuffix(section.File.RelPath, ".go") {
+		if dir, err := filepath.Abs(filepath.Dir(filepath.Join(baseDir, section.File.RelPath))); err == nil {
+			if rank, ok := ranks[dir]; ok {
+				return rank
+			}
+		}
+	}
+	return len(ranks)
+}
+
+// groupByDirectory gathers the files of each directory under a heading
+// named after it, such as "internal/server/". Directories appear in the
+// order of their first file, and files keep their order within them. The
+// headings are returned for token counting.
+func groupByDirectory(sections []fileSection) ([]fileSection, []Section) {
+	var dirs []string
+	groups := make(map[string][]fileSection)
+	for _, section := range sections {
+		dir := path.Dir(section.treePath()) + "/"
+		if _, ok := groups[dir]; !ok {
+			dirs = append(dirs, dir)
+		}
+		groups[dir] = append(groups[dir], section)
+	}
+
+	headings := make([]Section, len(dirs))
+	grouped := make([]fileSection, 0, len(sections))
+	for i, dir := range dirs {
+		headings[i] = Section{Name: dir}
+		for _, section := range groups[dir] {
+			section.Heading = &headings[i]
+			grouped = append(grouped, section)
+		}
+	}
+	return grouped, headings
+}
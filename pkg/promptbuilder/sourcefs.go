@@ -0,0 +1,190 @@
+package promptbuilder
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// sourceFS is where the files of basedir are read from. Discovery works
+// on paths joined to baseDir, as they appear in the output; sourceFS maps
+// them to names in fsys.
+type sourceFS struct {
+	fsys    fs.FS
+	baseDir string
+	local   bool // fsys is the directory baseDir on disk, so paths outside of it can be read too
+}
+
+// osSourceFS reads the files of baseDir from disk.
+func osSourceFS(baseDir string) sourceFS {
+	return sourceFS{fsys: os.DirFS(baseDir), baseDir: baseDir, local: true}
+}
+
+// lookup returns the file system holding path and the name of path in it.
+// Paths outside baseDir, such as includes of another repository, are
+// only found on disk.
+func (s sourceFS) lookup(path string) (fs.FS, string, error) {
+	if rel, err := filepath.Rel(s.baseDir, path); err == nil {
+		if name := filepath.ToSlash(rel); fs.ValidPath(name) {
+			return s.fsys, name, nil
+		}
+	}
+	if !s.local {
+		return nil, "", &fs.PathError{Op: "open", Path: path, Err: fs.ErrNotExist}
+	}
+
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, "", err
+	}
+	volume := filepath.VolumeName(abs)
+	root := os.DirFS(volume + string(filepath.Separator))
+	name := filepath.ToSlash(strings.TrimLeft(abs[len(volume):], string(filepath.Separator)))
+	if name == "" {
+		name = "."
+	}
+	return root, name, nil
+}
+
+func (s sourceFS) open(path string) (fs.File, error) {
+	fsys, name, err := s.lookup(path)
+	if err != nil {
+		return nil, err
+	}
+	result, err := fsys.Open(name)
+	return result, withPath(err, path)
+}
+
+func (s sourceFS) stat(path string) (fs.FileInfo, error) {
+	fsys, name, err := s.lookup(path)
+	if err != nil {
+		return nil, err
+	}
+	result, err := fs.Stat(fsys, name)
+	return result, withPath(err, path)
+}
+
+func (s sourceFS) readFile(path string) ([]byte, error) {
+	fsys, name, err := s.lookup(path)
+	if err != nil {
+		return nil, err
+	}
+	result, err := fs.ReadFile(fsys, name)
+	return result, withPath(err, path)
+}
+
+func (s sourceFS) readDir(path string) ([]fs.DirEntry, error) {
+	fsys, name, err := s.lookup(path)
+	if err != nil {
+		return nil, err
+	}
+	result, err := fs.ReadDir(fsys, name)
+	return result, withPath(err, path)
+}
+
+// withPath puts path back in the errors of fsys, which name the file
+// relative to the root of fsys.
+func withPath(err error, path string) error {
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) {
+		return &fs.PathError{Op: pathErr.Op, Path: path, Err: pathErr.Err}
+	}
+	return err
+}
+
+// readLinkFS is a file system with symlinks, such as fstest.MapFS. It is
+// fs.ReadLinkFS of newer Go versions.
+type readLinkFS interface {
+	fs.FS
+	ReadLink(name string) (string, error)
+	Lstat(name string) (fs.FileInfo, error)
+}
+
+// maxSymlinks limits the links followed to resolve a path, since a cycle
+// of links never resolves.
+const maxSymlinks = 255
+
+// realPath returns path with every symlink resolved, to tell whether two
+// paths are the same folder. Paths in an fs.FS resolve to a path rooted at
+// the top of it, which is only comparable to other real paths, and need
+// an fs.FS that can read links.
+func (s sourceFS) realPath(path string) (string, error) {
+	if s.local {
+		return filepath.EvalSymlinks(path)
+	}
+	fsys, name, err := s.lookup(path)
+	if err != nil {
+		return "", err
+	}
+	links, ok := fsys.(readLinkFS)
+	if !ok {
+		return "", &fs.PathError{Op: "readlink", Path: path, Err: errors.ErrUnsupported}
+	}
+	real, err := resolveLinks(links, name)
+	if err != nil {
+		return "", withPath(err, path)
+	}
+	return filepath.Join(string(filepath.Separator), filepath.FromSlash(real)), nil
+}
+
+// resolveLinks returns name, a path in fsys, with every symlink resolved.
+// Links that lead out of fsys cannot be resolved.
+func resolveLinks(fsys readLinkFS, name string) (string, error) {
+	resolved := "."
+	rest := strings.Split(name, "/")
+	for followed := 0; len(rest) > 0; {
+		part := rest[0]
+		rest = rest[1:]
+		if part == "." {
+			continue
+		}
+		current := path.Join(resolved, part)
+		info, err := fsys.Lstat(current)
+		if err != nil {
+			return "", err
+		}
+		if info.Mode()&fs.ModeSymlink == 0 {
+			resolved = current
+			continue
+		}
+
+		if followed++; followed > maxSymlinks {
+			return "", &fs.PathError{Op: "readlink", Path: name, Err: errors.New("too many links")}
+		}
+		target, err := fsys.ReadLink(current)
+		if err != nil {
+			return "", err
+		}
+		// A relative target starts in the folder of the link
+		target = path.Join(resolved, target)
+		if path.IsAbs(target) || !fs.ValidPath(target) {
+			return "", &fs.PathError{Op: "readlink", Path: current, Err: fs.ErrInvalid}
+		}
+		rest = append(strings.Split(target, "/"), rest...)
+		resolved = "."
+	}
+	return resolved, nil
+}
+
+// walk walks the tree at root like fs.WalkDir, calling fn with paths
+// joined to root the way filepath.WalkDir does.
+func (s sourceFS) walk(root string, fn func(path string, entry fs.DirEntry, err error) error) error {
+	fsys, name, err := s.lookup(root)
+	if err != nil {
+		return fn(root, nil, err)
+	}
+	return fs.WalkDir(fsys, name, func(current string, entry fs.DirEntry, err error) error {
+		path := root
+		if current != name {
+			rel := current
+			if name != "." {
+				rel = current[len(name)+1:]
+			}
+			path = filepath.Join(root, filepath.FromSlash(rel))
+		}
+		return fn(path, entry, withPath(err, path))
+	})
+}
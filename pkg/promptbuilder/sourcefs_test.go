@@ -0,0 +1,265 @@
+package promptbuilder
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// testFiles returns the paths of the files a build of config reads from
+// fsys, sorted.
+func testFiles(t *testing.T, fsys fs.FS, config *Config) []string {
+	t.Helper()
+	builder, err := New(config, WithFS(fsys))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	files, err := builder.Files(context.Background())
+	if err != nil {
+		t.Fatalf("Files: %v", err)
+	}
+	paths := make([]string, 0, len(files))
+	for _, file := range files {
+		paths = append(paths, filepath.ToSlash(file.RelPath))
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// testSkipped walks the whole of fsys with collectFiles and returns the
+// reasons files and folders were left out, by path.
+func testSkipped(t *testing.T, fsys fs.FS, config *Config) map[string]string {
+	t.Helper()
+	src := sourceFS{fsys: fsys, baseDir: config.BaseDir}
+	skipped := make(map[string]string)
+	_, err := collectFiles(context.Background(), src, config.BaseDir, config, 0, func(path string, reason string) {
+		skipped[path] = reason
+	})
+	if err != nil {
+		t.Fatalf("collectFiles: %v", err)
+	}
+	return skipped
+}
+
+func testProject() fstest.MapFS {
+	return fstest.MapFS{
+		"main.go":                 {Data: []byte("package main\n")},
+		"README.md":               {Data: []byte("# Project\n")},
+		"internal/server/api.go":  {Data: []byte("package server\n")},
+		"internal/server/keep.md": {Data: []byte("keep\n")},
+		"internal/legacy/old.go":  {Data: []byte("package legacy\n")},
+		"node_modules/lib/x.js":   {Data: []byte("x()\n")},
+		"web/app.js":              {Data: []byte("app()\n")},
+		"web/App.test.JS":         {Data: []byte("test()\n")},
+		"build/out.go":            {Data: []byte("package out\n")},
+		"debug.log":               {Data: []byte("log\n")},
+		".env":                    {Data: []byte("SECRET=1\n")},
+		".github/ci.yml":          {Data: []byte("on: push\n")},
+		".gitignore":              {Data: []byte("*.log\nbuild/\n")},
+	}
+}
+
+func TestCollectFiles(t *testing.T) {
+	tests := []struct {
+		name       string
+		directives []string
+		want       []string
+	}{
+		{
+			name:       "everything but hidden files",
+			directives: []string{"include=."},
+			want: []string{"README.md", "build/out.go", "debug.log", "internal/legacy/old.go", "internal/server/api.go",
+				"internal/server/keep.md", "main.go", "node_modules/lib/x.js", "web/App.test.JS", "web/app.js"},
+		},
+		{
+			name:       "exclude folders by name and by path",
+			directives: []string{"include=.", "excludefolder=node_modules", "excludefolder=internal/legacy", "excludefolder=build", "excludefolder=web"},
+			want:       []string{"README.md", "debug.log", "internal/server/api.go", "internal/server/keep.md", "main.go"},
+		},
+		{
+			name:       "exclude extensions and files",
+			directives: []string{"include=internal", "include=main.go", "include=README.md", "excludeextension=md", "excludefile=internal/legacy/old.go"},
+			want:       []string{"internal/server/api.go", "main.go"},
+		},
+		{
+			name:       "reinclude a file of an excluded extension",
+			directives: []string{"include=internal", "excludeextension=md", "excludefile=!internal/server/keep.md"},
+			want:       []string{"internal/legacy/old.go", "internal/server/api.go", "internal/server/keep.md"},
+		},
+		{
+			name:       "reinclude a folder below an excluded one",
+			directives: []string{"include=internal", "excludefolder=internal", "excludefolder=!internal/server"},
+			want:       []string{"internal/server/api.go", "internal/server/keep.md"},
+		},
+		{
+			name:       "include extensions",
+			directives: []string{"include=.", "includeextension=go", "excludefolder=node_modules"},
+			want:       []string{"build/out.go", "internal/legacy/old.go", "internal/server/api.go", "main.go"},
+		},
+		{
+			name:       "gitignore",
+			directives: []string{"include=.", "usegitignore=true", "excludefolder=node_modules", "excludefolder=internal", "excludefolder=web"},
+			want:       []string{"README.md", "main.go"},
+		},
+		{
+			name:       "hidden files",
+			directives: []string{"include=.", "includehidden=true", "excludefolder=node_modules", "excludefolder=internal", "excludefolder=web", "excludefolder=build"},
+			want:       []string{".github/ci.yml", ".gitignore", "README.md", "debug.log", "main.go"},
+		},
+		{
+			name:       "glob",
+			directives: []string{"include=internal/**/*.go"},
+			want:       []string{"internal/legacy/old.go", "internal/server/api.go"},
+		},
+		{
+			name:       "ignore case",
+			directives: []string{"include=WEB", "excludeextension=js", "excludefile=!web/app.JS", "ignorecase=true"},
+			want:       []string{"web/app.js"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := testConfig(t, append([]string{"basedir=/project"}, test.directives...)...)
+			if got := testFiles(t, testProject(), config); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("files = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestCollectFilesSkipReasons(t *testing.T) {
+	config := testConfig(t, "basedir=/project", "include=.", "usegitignore=true", "excludefolder=node_modules", "excludeextension=md")
+	skipped := testSkipped(t, testProject(), config)
+	want := map[string]string{
+		".env":         "envFile",
+		".github":      "hidden",
+		".gitignore":   "hidden",
+		"node_modules": "excludeFolder",
+		"build":        "gitignore",
+		"debug.log":    "gitignore",
+		"README.md":    "excludeExtension",
+	}
+	for path, reason := range want {
+		if skipped[path] != reason {
+			t.Errorf("%s skipped for %q, want %q", path, skipped[path], reason)
+		}
+	}
+}
+
+func TestWithFSBuild(t *testing.T) {
+	config := testConfig(t, "basedir=project", "include=main.go")
+	builder, err := New(config, WithFS(testProject()))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	var output bytes.Buffer
+	report, err := builder.Build(context.Background(), &output)
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	if !strings.Contains(output.String(), "# main.go\n```go\npackage main\n") {
+		t.Errorf("output does not hold main.go:\n%s", output.String())
+	}
+	if len(report.Files) != 1 || report.TotalTokens == 0 {
+		t.Errorf("report has %d files and %d tokens", len(report.Files), report.TotalTokens)
+	}
+}
+
+func TestWithFSMissingInclude(t *testing.T) {
+	config := testConfig(t, "basedir=/project", "include=missing.go", "strict=true")
+	builder, err := New(config, WithFS(testProject()))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if _, err := builder.Files(context.Background()); !errors.Is(err, ErrStrict) {
+		t.Errorf("Files = %v, want a strict error", err)
+	}
+}
+
+// symlinkProject has a symlinked folder, a symlinked file, a link back to
+// the top and a broken link.
+func symlinkProject(t *testing.T) fstest.MapFS {
+	fsys := fstest.MapFS{
+		"src/a.go":      {Data: []byte("package src\n")},
+		"lib":           {Data: []byte("src"), Mode: fs.ModeSymlink},
+		"main.go":       {Data: []byte("src/a.go"), Mode: fs.ModeSymlink},
+		"src/loop":      {Data: []byte(".."), Mode: fs.ModeSymlink},
+		"src/broken.go": {Data: []byte("missing.go"), Mode: fs.ModeSymlink},
+	}
+	if _, ok := any(fsys).(readLinkFS); !ok {
+		t.Skip("fstest.MapFS cannot read links before Go 1.25")
+	}
+	return fsys
+}
+
+func TestWithFSSymlinks(t *testing.T) {
+	config := testConfig(t, "basedir=/project", "include=.")
+	if got, want := testFiles(t, symlinkProject(t), config), []string{"src/a.go"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("files without followsymlinks = %q, want %q", got, want)
+	}
+	skipped := testSkipped(t, symlinkProject(t), config)
+	for _, path := range []string{"lib", "main.go", "src/loop"} {
+		if skipped[path] != "symlink" {
+			t.Errorf("%s skipped for %q, want symlink", path, skipped[path])
+		}
+	}
+
+	config = testConfig(t, "basedir=/project", "include=.", "followsymlinks=true")
+	want := []string{"lib/a.go", "main.go", "src/a.go"}
+	if got := testFiles(t, symlinkProject(t), config); !reflect.DeepEqual(got, want) {
+		t.Errorf("files with followsymlinks = %q, want %q", got, want)
+	}
+	skipped = testSkipped(t, symlinkProject(t), config)
+	if skipped["src/loop"] != "symlinkCycle" {
+		t.Errorf("src/loop skipped for %q, want symlinkCycle", skipped["src/loop"])
+	}
+	if skipped["src/broken.go"] != "symlink" {
+		t.Errorf("src/broken.go skipped for %q, want symlink", skipped["src/broken.go"])
+	}
+}
+
+func TestResolveLinks(t *testing.T) {
+	fsys := symlinkProject(t)
+	fsys["a"] = &fstest.MapFile{Data: []byte("b"), Mode: fs.ModeSymlink}
+	fsys["b"] = &fstest.MapFile{Data: []byte("lib/../lib"), Mode: fs.ModeSymlink}
+	fsys["out"] = &fstest.MapFile{Data: []byte("../etc"), Mode: fs.ModeSymlink}
+	fsys["abs"] = &fstest.MapFile{Data: []byte("/etc"), Mode: fs.ModeSymlink}
+	fsys["self"] = &fstest.MapFile{Data: []byte("self"), Mode: fs.ModeSymlink}
+
+	tests := []struct {
+		name string
+		want string
+	}{
+		{".", "."},
+		{"src/a.go", "src/a.go"},
+		{"lib", "src"},
+		{"lib/a.go", "src/a.go"},
+		{"a/a.go", "src/a.go"},
+		{"src/loop/lib", "src"},
+	}
+	for _, test := range tests {
+		got, err := resolveLinks(fsys, test.name)
+		if err != nil || got != test.want {
+			t.Errorf("resolveLinks(%q) = %q, %v, want %q", test.name, got, err, test.want)
+		}
+	}
+	for _, name := range []string{"out", "abs", "self", "missing"} {
+		if got, err := resolveLinks(fsys, name); err == nil {
+			t.Errorf("resolveLinks(%q) = %q, want an error", name, got)
+		}
+	}
+}
+
+func TestRealPathWithoutLinks(t *testing.T) {
+	src := sourceFS{fsys: fs.FS(struct{ fs.FS }{testProject()}), baseDir: "/project"}
+	if _, err := src.realPath("/project/main.go"); !errors.Is(err, errors.ErrUnsupported) {
+		t.Errorf("realPath = %v, want ErrUnsupported for an fs.FS that cannot read links", err)
+	}
+}
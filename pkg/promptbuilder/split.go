@@ -0,0 +1,47 @@
+package promptbuilder
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// splitSections groups sections into consecutive parts whose size, as
+// measured by size, stays within limit. Files are never cut in two, so a
+// single file larger than limit gets a part of its own.
+func splitSections(sections []fileSection, limit int, size func(fileSection) int) [][]fileSection {
+	var parts [][]fileSection
+	var current []fileSection
+	currentSize := 0
+
+	for _, section := range sections {
+		n := size(section)
+		if len(current) > 0 && currentSize+n > limit {
+			parts = append(parts, current)
+			current, currentSize = nil, 0
+		}
+		current = append(current, section)
+		currentSize += n
+	}
+	if len(current) > 0 || len(parts) == 0 {
+		parts = append(parts, current)
+	}
+
+	return parts
+}
+
+// PartPath inserts the part number before the extension of outputPath,
+// e.g. output.txt becomes output.part2.txt.
+func PartPath(outputPath string, part int) string {
+	ext := filepath.Ext(outputPath)
+	return fmt.Sprintf("%s.part%d%s", strings.TrimSuffix(outputPath, ext), part, ext)
+}
+
+// partNote tells the model where a part sits in the sequence so it waits
+// for the last one before answering.
+func partNote(part int, total int) string {
+	if part == total {
+		return fmt.Sprintf("This is part %d of %d, and this is the last part. You now have the complete context.", part, total)
+	}
+	return fmt.Sprintf("This is part %d of %d, more parts will follow. Do not answer yet; reply only with \"Received part %d of %d\".", part, total, part, total)
+}
@@ -0,0 +1,141 @@
+package promptbuilder
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// StackFrame is a file and line referenced by a stack trace.
+type StackFrame struct {
+	Path string
+	Line int
+}
+
+// stackFramePatterns find the file and line of a frame in a line of a
+// stack trace. The first pattern that matches a line wins.
+var stackFramePatterns = []*regexp.Regexp{
+	// Python: File "/app/handlers.py", line 42, in handle
+	regexp.MustCompile(`File "([^"]+)", line (\d+)`),
+	// JavaScript: at handle (/app/handlers.js:42:7), at /app/handlers.js:42:7
+	regexp.MustCompile(`\bat (?:[^()]*\()?(?:file://)?([^\s()]+?):(\d+):\d+\)?`),
+	// Go, and path:line anywhere else: /app/handlers.go:42 +0x1d
+	regexp.MustCompile(`((?:[A-Za-z]:)?[\w./\\@+-]*\.[A-Za-z0-9]+):(\d+)`),
+}
+
+// ParseStackTrace returns the frames of the Go panics, Python tracebacks
+// and JavaScript stack traces in r, in the order they appear. Lines
+// without a frame are skipped, so a whole log can be passed.
+func ParseStackTrace(r io.Reader) ([]StackFrame, error) {
+	var frames []StackFrame
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		for _, pattern := range stackFramePatterns {
+			match := pattern.FindStringSubmatch(scanner.Text())
+			if match == nil {
+				continue
+			}
+			line, err := strconv.Atoi(match[2])
+			if err == nil && line > 0 {
+				frames = append(frames, StackFrame{Path: match[1], Line: line})
+			}
+			break
+		}
+	}
+	return frames, scanner.Err()
+}
+
+// UseStackTrace replaces the includes, and the sections they belong to,
+// with the files of the frames found in BaseDir. Frame paths are often
+// absolute paths on another machine, so the longest trailing part of the
+// path that exists in BaseDir is used, or else the only file in BaseDir
+// with that name. Frames of files outside of it, such as the standard
+// library, are dropped. Files higher in the trace get a higher priority.
+// With context above 0, only the lines within context lines of a frame
+// are included.
+func (c *Config) UseStackTrace(frames []StackFrame, context int) error {
+	baseDir, err := filepath.Abs(c.BaseDir)
+	if err != nil {
+		return err
+	}
+
+	resolver := frameResolver{baseDir: baseDir}
+	var order []string
+	lines := make(map[string][]LineRange)
+	for _, frame := range frames {
+		rel, ok := resolver.resolve(frame.Path)
+		if !ok {
+			continue
+		}
+		if _, seen := lines[rel]; !seen {
+			order = append(order, rel)
+			lines[rel] = nil
+		}
+		if context > 0 {
+			lines[rel] = append(lines[rel], LineRange{Start: max(1, frame.Line-context), End: frame.Line + context})
+		}
+	}
+	if len(order) == 0 {
+		return fmt.Errorf("none of the %d frames of the stack trace is a file in basedir", len(frames))
+	}
+
+	c.Includes = nil
+	c.Sections = nil
+	for i, rel := range order {
+		c.Includes = append(c.Includes, Include{Path: rel, Priority: len(order) - i, Lines: lines[rel]})
+	}
+	return nil
+}
+
+// frameResolver finds the files of stack frames in baseDir.
+type frameResolver struct {
+	baseDir string
+	byName  map[string][]string // relative paths of the files in baseDir by name, read when first needed
+}
+
+func (r *frameResolver) resolve(path string) (string, bool) {
+	parts := strings.Split(strings.ReplaceAll(path, `\`, "/"), "/")
+	if len(parts) > 0 && filepath.VolumeName(parts[0]) != "" {
+		parts = parts[1:]
+	}
+	for i := range parts {
+		rel := filepath.Join(parts[i:]...)
+		if !filepath.IsLocal(rel) {
+			continue
+		}
+		if info, err := os.Stat(filepath.Join(r.baseDir, rel)); err == nil && info.Mode().IsRegular() {
+			return rel, true
+		}
+	}
+
+	// Test output such as "handler_test.go:42" is relative to its package
+	if r.byName == nil {
+		r.byName = make(map[string][]string)
+		filepath.WalkDir(r.baseDir, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return nil
+			}
+			if entry.IsDir() {
+				if path != r.baseDir && (strings.HasPrefix(entry.Name(), ".") || entry.Name() == "node_modules") {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if rel, err := filepath.Rel(r.baseDir, path); err == nil {
+				r.byName[entry.Name()] = append(r.byName[entry.Name()], rel)
+			}
+			return nil
+		})
+	}
+	if matches := r.byName[parts[len(parts)-1]]; len(matches) == 1 {
+		return matches[0], true
+	}
+	return "", false
+}
@@ -0,0 +1,117 @@
+package promptbuilder
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// statsTopFiles is the number of largest files listed in the statistics.
+const statsTopFiles = 10
+
+// StatsTable returns the statistics of the build as a plain text table:
+// the file count, total lines, bytes and tokens, and the largest files.
+func (r *Report) StatsTable() string {
+	return statsTable(r.Files, r.TotalTokens)
+}
+
+func statsTable(files []FileReport, totalTokens int) string {
+	var lines, size int
+	for _, f := range files {
+		lines += f.Lines
+		size += f.Size
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Files:  %s\n", formatThousands(len(files)))
+	fmt.Fprintf(&b, "Lines:  %s\n", formatThousands(lines))
+	fmt.Fprintf(&b, "Bytes:  %s (%s)\n", formatThousands(size), formatSize(int64(size)))
+	fmt.Fprintf(&b, "Tokens: %s\n", formatThousands(totalTokens))
+
+	largest := append([]FileReport(nil), files...)
+	sort.SliceStable(largest, func(i, j int) bool {
+		return largest[i].Size > largest[j].Size
+	})
+	if len(largest) > statsTopFiles {
+		largest = largest[:statsTopFiles]
+	}
+	if len(largest) > 0 {
+		fmt.Fprintf(&b, "\nLargest files:\n")
+		for _, f := range largest {
+			fmt.Fprintf(&b, "%10s %10s tokens  %s\n", formatSize(int64(f.Size)), formatThousands(f.Tokens), f.Path)
+		}
+	}
+	return b.String()
+}
+
+// StatsPath returns the path of the statistics file written alongside
+// outputPath: output.txt becomes output.stats.json.
+func StatsPath(outputPath string) string {
+	return strings.TrimSuffix(outputPath, filepath.Ext(outputPath)) + ".stats.json"
+}
+
+type statsFile struct {
+	Path   string `json:"path"`
+	Size   int    `json:"size"`
+	Lines  int    `json:"lines"`
+	Tokens int    `json:"tokens"`
+}
+
+type statsSkipped struct {
+	Path   string `json:"path"`
+	Reason string `json:"reason"`
+}
+
+type statsCost struct {
+	Model      string  `json:"model"`
+	Tokens     int     `json:"tokens"`
+	PerMillion float64 `json:"perMillion"`
+	Dollars    float64 `json:"dollars"`
+}
+
+type statsDocument struct {
+	GeneratedAt string         `json:"generatedAt"`
+	DurationMs  int64          `json:"durationMs"`
+	Files       []statsFile    `json:"files"`
+	Skipped     []statsSkipped `json:"skipped"`
+	Totals      jsonSummary    `json:"totals"`
+	Costs       []statsCost    `json:"costs,omitempty"`
+}
+
+// StatsJSON returns the statistics of the build as JSON: the size, line
+// and token counts of every file, the files left out and why, and how
+// long the build took, and the estimated costs. Files dropped by maxtokens are listed as skipped
+// with the reason "maxTokens".
+func (r *Report) StatsJSON() ([]byte, error) {
+	doc := statsDocument{
+		GeneratedAt: time.Now().Format(time.RFC3339),
+		DurationMs:  r.Duration.Milliseconds(),
+		Files:       []statsFile{},
+		Skipped:     []statsSkipped{},
+	}
+	for _, f := range r.Files {
+		doc.Files = append(doc.Files, statsFile{Path: f.Path, Size: f.Size, Lines: f.Lines, Tokens: f.Tokens})
+		doc.Totals.Files++
+		doc.Totals.Size += f.Size
+		doc.Totals.Lines += f.Lines
+	}
+	doc.Totals.Tokens = r.TotalTokens
+	for _, s := range r.Skipped {
+		doc.Skipped = append(doc.Skipped, statsSkipped{Path: s.Path, Reason: s.Reason})
+	}
+	for _, f := range r.Omitted {
+		doc.Skipped = append(doc.Skipped, statsSkipped{Path: f.Path, Reason: "maxTokens"})
+	}
+	for _, c := range r.Costs {
+		doc.Costs = append(doc.Costs, statsCost{Model: c.Model, Tokens: c.Tokens, PerMillion: c.PerMillion, Dollars: c.Dollars})
+	}
+
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
@@ -0,0 +1,244 @@
+package promptbuilder
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// mapping is a key/value table read from a YAML or TOML config. Values are
+// strings, []any or *mapping. Keys keep their order in the file so that
+// structured configs behave like the equivalent list of directives.
+type mapping struct {
+	keys   []string
+	values map[string]any
+}
+
+func newMapping() *mapping {
+	return &mapping{values: make(map[string]any)}
+}
+
+func (m *mapping) set(key string, value any) {
+	if _, ok := m.values[key]; !ok {
+		m.keys = append(m.keys, key)
+	}
+	m.values[key] = value
+}
+
+// configFromMapping turns a structured config into a Config. Every key is
+// treated like the directive of the same name, lists repeat the directive
+// once per item, and "header" and "footer" hold the header and footer
+// text.
+func configFromMapping(m *mapping, opts ...ParseOption) (*Config, error) {
+	config := NewConfig()
+	for _, opt := range opts {
+		opt(config)
+	}
+	if err := config.applyMapping(m); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// applyMapping applies a structured config on top of c.
+func (c *Config) applyMapping(m *mapping) error {
+	for _, key := range m.keys {
+		lower := strings.ToLower(key)
+		value := m.values[key]
+
+		if lower == "header" || lower == "footer" {
+			text, ok := value.(string)
+			if !ok {
+				return fmt.Errorf("%s must be a string", lower)
+			}
+			if lower == "header" {
+				c.HeaderText = strings.TrimRight(text, "\n")
+			} else {
+				c.FooterText = strings.TrimRight(text, "\n")
+			}
+			continue
+		}
+
+		if err := c.applyValue(lower, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Config) applyValue(key string, value any) error {
+	switch v := value.(type) {
+	case string:
+		return c.applyDirective(key, v)
+	case []any:
+		for _, item := range v {
+			if err := c.applyValue(key, item); err != nil {
+				return err
+			}
+		}
+		return nil
+	case *mapping:
+		if key == "var" || key == "vars" {
+			for _, name := range v.keys {
+				varValue, ok := v.values[name].(string)
+				if !ok {
+					return fmt.Errorf("variable %s must be a scalar", name)
+				}
+				if err := c.applyDirective("var", name+"="+varValue); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		if key == "section" || key == "sections" {
+			return c.applySectionTable(v)
+		}
+		if key != "include" {
+			return fmt.Errorf("unexpected table for %s", key)
+		}
+		include, err := includeDirective(v)
+		if err != nil {
+			return err
+		}
+		return c.applyDirective(key, include)
+	}
+	return fmt.Errorf("unsupported value for %s", key)
+}
+
+// applySectionTable applies a section table such as
+// {name: Tests, intro: ..., include: [...]}.
+func (c *Config) applySectionTable(m *mapping) error {
+	name, ok := m.values["name"].(string)
+	if !ok || name == "" {
+		return fmt.Errorf("section table requires a name")
+	}
+	if err := c.applyDirective("section", name); err != nil {
+		return err
+	}
+
+	for _, key := range m.keys {
+		switch lower := strings.ToLower(key); lower {
+		case "name":
+		case "intro", "include":
+			if err := c.applyValue(lower, m.values[key]); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("unexpected key %s in section %s", key, name)
+		}
+	}
+	return nil
+}
+
+// includeDirective converts an include table such as
+// {path: src, priority: 10, excludeExtension: [css, map]} into
+// "src (priority=10) { excludeExtension=css,map }".
+func includeDirective(m *mapping) (string, error) {
+	path, ok := m.values["path"].(string)
+	if !ok || path == "" {
+		return "", fmt.Errorf("include table requires a path")
+	}
+
+	var options, excludes []string
+	keys := append([]string(nil), m.keys...)
+	sort.Strings(keys)
+	for _, key := range keys {
+		if key == "path" {
+			continue
+		}
+		if strings.HasPrefix(strings.ToLower(key), "exclude") {
+			values, err := scalarList(m.values[key])
+			if err != nil {
+				return "", fmt.Errorf("include option %s: %v", key, err)
+			}
+			excludes = append(excludes, key+"="+strings.Join(values, ","))
+			continue
+		}
+		value, ok := m.values[key].(string)
+		if !ok {
+			return "", fmt.Errorf("include option %s must be a scalar", key)
+		}
+		options = append(options, key+"="+value)
+	}
+
+	if len(options) > 0 {
+		path += " (" + strings.Join(options, ", ") + ")"
+	}
+	if len(excludes) > 0 {
+		path += " { " + strings.Join(excludes, "; ") + " }"
+	}
+	return path, nil
+}
+
+// scalarList returns a scalar or a list of scalars as a list.
+func scalarList(value any) ([]string, error) {
+	switch v := value.(type) {
+	case string:
+		return []string{v}, nil
+	case []any:
+		var values []string
+		for _, item := range v {
+			s, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("list items must be scalars")
+			}
+			values = append(values, s)
+		}
+		return values, nil
+	}
+	return nil, fmt.Errorf("must be a scalar or a list")
+}
+
+// splitTopLevel splits s on sep, ignoring separators inside quotes,
+// brackets and braces.
+func splitTopLevel(s string, sep byte) []string {
+	var parts []string
+	depth := 0
+	var quote byte
+	start := 0
+
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		switch {
+		case quote != 0:
+			if ch == '\\' && quote == '"' {
+				i++
+			} else if ch == quote {
+				quote = 0
+			}
+		case ch == '"' || ch == '\'':
+			quote = ch
+		case ch == '[' || ch == '{':
+			depth++
+		case ch == ']' || ch == '}':
+			depth--
+		case ch == sep && depth == 0:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	parts = append(parts, s[start:])
+
+	return parts
+}
+
+// stripComment removes a trailing "# comment" that is not inside quotes.
+func stripComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		ch := line[i]
+		switch {
+		case quote != 0:
+			if ch == '\\' && quote == '"' {
+				i++
+			} else if ch == quote {
+				quote = 0
+			}
+		case ch == '"' || ch == '\'':
+			quote = ch
+		case ch == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return strings.TrimRight(line[:i], " \t")
+		}
+	}
+	return line
+}
@@ -0,0 +1,208 @@
+package promptbuilder
+
+import (
+	"bufio"
+	"fmt"
+	"html"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// defaultTemplates reproduce the markdown layout. A user template is
+// parsed on top of them, so it only needs to define the parts it changes.
+const defaultTemplates = `{{define "header"}}{{if .Header}}{{.Header}}
+
+{{end}}{{end}}` +
+	"{{define \"file\"}}# {{.Path}}\n{{.Fence}}{{.Language}}\n{{.Content}}\n{{.Fence}}\n\n{{end}}" +
+	"{{define \"heading\"}}# {{.Name}}\n\n{{if .Intro}}{{.Intro}}\n\n{{end}}{{end}}" +
+	"{{define \"section\"}}# {{.Title}}\n{{.Fence}}{{.Language}}\n{{.Content}}\n{{.Fence}}\n\n{{end}}" +
+	"{{define \"footer\"}}{{if .Footer}}{{.Footer}}\n{{end}}{{end}}"
+
+// templateFuncs are the helper functions available to templates.
+var templateFuncs = template.FuncMap{
+	"escape": html.EscapeString,
+	"lower":  strings.ToLower,
+	"upper":  strings.ToUpper,
+	"trim":   strings.TrimSpace,
+}
+
+// templateDocument is the data of the "header" and "footer" templates.
+type templateDocument struct {
+	Header    string
+	Footer    string
+	Files     []templateFile
+	FileCount int
+	Tree      string
+}
+
+// templateFile is the data of the "file" template.
+type templateFile struct {
+	Index    int // 1-based position in the output
+	Path     string
+	RelPath  string
+	Section  string // name of the section the file belongs to, if any
+	Language string
+	Content  string
+	Fence    string
+	Lines    int // lines of the content
+	Size     int // bytes of the content
+}
+
+// templateSection is the data of the "section" template.
+type templateSection struct {
+	Name     string
+	Title    string
+	Language string
+	Content  string
+	Fence    string
+}
+
+// templateRenderer renders the output with a text/template file that
+// defines any of the "header", "heading", "file", "section" and "footer"
+// templates.
+type templateRenderer struct {
+	tmpl    *template.Template
+	baseDir string
+	err     error // first error from renderFile or renderSection
+}
+
+func newTemplateRenderer(path string, config *Config) (*templateRenderer, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading template: %v", err)
+	}
+
+	tmpl := template.Must(template.New("output").Funcs(templateFuncs).Parse(defaultTemplates))
+	if _, err := tmpl.Parse(string(content)); err != nil {
+		return nil, fmt.Errorf("error parsing template %s: %v", path, err)
+	}
+
+	return &templateRenderer{tmpl: tmpl, baseDir: config.BaseDir}, nil
+}
+
+func (r *templateRenderer) execute(name string, data any) string {
+	var b strings.Builder
+	if err := r.tmpl.ExecuteTemplate(&b, name, data); err != nil {
+		if r.err == nil {
+			r.err = fmt.Errorf("error executing template: %v", err)
+		}
+		return ""
+	}
+	return b.String()
+}
+
+func (r *templateRenderer) file(index int, path string, content string) templateFile {
+	return newTemplateFile(r.baseDir, index, path, content)
+}
+
+func newTemplateFile(baseDir string, index int, path string, content string) templateFile {
+	relPath := path
+	if filepath.IsAbs(path) {
+		if rel, err := filepath.Rel(baseDir, path); err == nil {
+			relPath = rel
+		}
+	}
+	return templateFile{
+		Index:    index,
+		Path:     path,
+		RelPath:  filepath.ToSlash(relPath),
+		Language: detectLanguage(path),
+		Content:  content,
+		Fence:    codeFence(content),
+		Lines:    countLines(content),
+		Size:     len(content),
+	}
+}
+
+// parseFileHeader parses the fileheader directive, a template for the
+// line before every file, and checks that it executes on a sample file so
+// that unknown fields fail when the config is read. An empty value
+// returns nil.
+func parseFileHeader(value string) (*template.Template, error) {
+	if value == "" {
+		return nil, nil
+	}
+	tmpl, err := template.New("fileheader").Funcs(templateFuncs).Parse(value)
+	if err != nil {
+		return nil, err
+	}
+	if err := tmpl.Execute(io.Discard, newTemplateFile(".", 1, "main.go", "package main\n")); err != nil {
+		return nil, err
+	}
+	return tmpl, nil
+}
+
+// renderFile renders a file for token estimation. The index is not known
+// yet, so the file is rendered again by writeOutput.
+func (r *templateRenderer) renderFile(path string, content string) string {
+	return r.execute("file", r.file(0, path, content))
+}
+
+func (r *templateRenderer) renderSection(section extraSection) string {
+	content := strings.TrimSuffix(section.Content, "\n")
+	return r.execute("section", templateSection{
+		Name:     section.Name,
+		Title:    section.Title,
+		Language: section.Language,
+		Content:  content,
+		Fence:    codeFence(content),
+	})
+}
+
+func (r *templateRenderer) renderHeading(section Section) string {
+	return r.execute("heading", section)
+}
+
+// writeOutput renders the files one at a time. The .Files of the header and
+// footer carry no content, so that the whole prompt is never held in
+// memory.
+func (r *templateRenderer) writeOutput(w io.Writer, doc *document) error {
+	data := templateDocument{
+		Header:    doc.Header,
+		Footer:    doc.Footer,
+		FileCount: len(doc.Sections),
+		Tree:      renderTree(sectionPaths(doc.Sections)),
+	}
+	for i, section := range doc.Sections {
+		file := r.file(i+1, section.Path, "")
+		file.Section = section.sectionName()
+		file.Lines = section.Lines
+		file.Size = section.Size
+		data.Files = append(data.Files, file)
+	}
+
+	b := bufio.NewWriter(w)
+	b.WriteString(r.execute("header", data))
+	for _, section := range doc.Before {
+		b.WriteString(r.renderSection(section))
+	}
+	index := 0
+	for _, group := range headingGroups(doc.Sections) {
+		if heading := group[0].Heading; heading != nil {
+			b.WriteString(r.renderHeading(*heading))
+		}
+		for _, section := range group {
+			section, err := doc.file(section)
+			if err != nil {
+				return err
+			}
+			file := data.Files[index]
+			file.Content = section.Content
+			file.Fence = codeFence(section.Content)
+			b.WriteString(r.execute("file", file))
+			index++
+		}
+	}
+	for _, section := range doc.After {
+		b.WriteString(r.renderSection(section))
+	}
+	b.WriteString(r.execute("footer", data))
+
+	if r.err != nil {
+		return r.err
+	}
+	return b.Flush()
+}
@@ -0,0 +1,99 @@
+package promptbuilder
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// tokenizer counts tokens for a model family. Families with a public
+// BPE vocabulary are counted exactly once it has been downloaded (see
+// FetchVocabulary). Otherwise, text is split with the same
+// pre-tokenization pattern tiktoken uses, and each piece is charged
+// according to the average piece length the family's vocabulary merges
+// into a single token. That estimate is typically within a few percent
+// of the real count for source code.
+type tokenizer struct {
+	name          string
+	charsPerToken float64
+	vocab         *vocabulary  // nil when the vocabulary is not public
+	bpe           *bpeEncoding // the loaded vocab, nil when estimating
+}
+
+var tokenizers = map[string]tokenizer{
+	"gpt-4o": {name: "o200k_base", charsPerToken: 4.2, vocab: o200kBase},
+	"gpt-4":  {name: "cl100k_base", charsPerToken: 3.8, vocab: cl100kBase},
+	"claude": {name: "claude", charsPerToken: 3.5},
+	"llama":  {name: "llama3", charsPerToken: 3.9},
+}
+
+// DefaultModel is the model family used when none is selected.
+const DefaultModel = "gpt-4o"
+
+// pretokenizePattern mirrors tiktoken's cl100k split pattern, minus the
+// negative lookahead that Go's regexp package does not support.
+var pretokenizePattern = regexp.MustCompile(`(?i:'s|'t|'re|'ve|'m|'ll|'d)|[^\r\n\p{L}\p{N}]?\p{L}+|\p{N}{1,3}| ?[^\s\p{L}\p{N}]+[\r\n]*|\s*[\r\n]+|\s+`)
+
+func getTokenizer(model string) (tokenizer, error) {
+	t, ok := tokenizers[strings.ToLower(model)]
+	if !ok {
+		return tokenizer{}, fmt.Errorf("unknown model %q (supported: %s)", model, strings.Join(SupportedModels(), ", "))
+	}
+	return t, nil
+}
+
+// loadVocabulary switches t to exact counts when its vocabulary has been
+// downloaded, and reports why not otherwise.
+func (t *tokenizer) loadVocabulary() error {
+	if t.vocab == nil {
+		return nil
+	}
+	bpe, err := loadEncoding(t.vocab)
+	if err != nil {
+		return err
+	}
+	t.bpe = bpe
+	return nil
+}
+
+// SupportedModels returns the model families tokens can be counted for.
+func SupportedModels() []string {
+	models := make([]string, 0, len(tokenizers))
+	for model := range tokenizers {
+		models = append(models, model)
+	}
+	sort.Strings(models)
+	return models
+}
+
+// VocabularyModels returns the model families with a public vocabulary,
+// whose tokens are counted exactly once FetchVocabulary has downloaded it.
+func VocabularyModels() []string {
+	var models []string
+	for model, t := range tokenizers {
+		if t.vocab != nil {
+			models = append(models, model)
+		}
+	}
+	sort.Strings(models)
+	return models
+}
+
+func (t tokenizer) countTokens(text string) int {
+	if t.bpe != nil {
+		return t.bpe.countTokens(text)
+	}
+	count := 0
+	for _, piece := range pretokenizePattern.FindAllString(text, -1) {
+		length := utf8.RuneCountInString(piece)
+		if length <= 4 {
+			count++
+			continue
+		}
+		count += int(math.Ceil(float64(length) / t.charsPerToken))
+	}
+	return count
+}
@@ -0,0 +1,205 @@
+package promptbuilder
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// parseTOML parses the subset of TOML used by promptbuilder configs:
+// key/value pairs, basic, literal and multi-line strings, integers,
+// booleans, arrays (possibly spanning lines), inline tables, [table]
+// headers and [[array-of-table]] headers. Dotted keys are not supported.
+func parseTOML(data string) (*mapping, error) {
+	root := newMapping()
+	current := root
+	lines := strings.Split(strings.ReplaceAll(data, "\r\n", "\n"), "\n")
+
+	for i := 0; i < len(lines); i++ {
+		lineNo := i + 1
+		line := strings.TrimSpace(stripComment(lines[i]))
+		if line == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[[") && strings.HasSuffix(line, "]]") {
+			name := strings.TrimSpace(line[2 : len(line)-2])
+			table := newMapping()
+			list, _ := root.values[name].([]any)
+			root.set(name, append(list, table))
+			current = table
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			name := strings.TrimSpace(line[1 : len(line)-1])
+			table := newMapping()
+			root.set(name, table)
+			current = table
+			continue
+		}
+
+		eq := strings.IndexByte(line, '=')
+		if eq == -1 {
+			return nil, fmt.Errorf("toml line %d: expected key = value", lineNo)
+		}
+		key, err := unquoteTOMLKey(strings.TrimSpace(line[:eq]))
+		if err != nil {
+			return nil, fmt.Errorf("toml line %d: %v", lineNo, err)
+		}
+		raw := strings.TrimSpace(line[eq+1:])
+
+		// Multi-line strings and arrays continue on the following lines
+		for _, delim := range []string{`"""`, `'''`} {
+			if strings.HasPrefix(raw, delim) && !strings.Contains(raw[3:], delim) {
+				raw = strings.TrimSpace(lines[i][strings.Index(lines[i], delim):])
+				for i+1 < len(lines) && !strings.Contains(raw[3:], delim) {
+					i++
+					raw += "\n" + lines[i]
+				}
+			}
+		}
+		for strings.HasPrefix(raw, "[") && !balanced(raw) && i+1 < len(lines) {
+			i++
+			raw += " " + strings.TrimSpace(stripComment(lines[i]))
+		}
+
+		value, err := parseTOMLValue(raw)
+		if err != nil {
+			return nil, fmt.Errorf("toml line %d: %v", lineNo, err)
+		}
+		current.set(key, value)
+	}
+
+	return root, nil
+}
+
+func parseTOMLValue(raw string) (any, error) {
+	switch {
+	case strings.HasPrefix(raw, `"""`) || strings.HasPrefix(raw, `'''`):
+		delim := raw[:3]
+		end := strings.LastIndex(raw, delim)
+		if end < 3 {
+			return nil, fmt.Errorf("unterminated multi-line string")
+		}
+		text := strings.TrimPrefix(raw[3:end], "\n")
+		if delim == `"""` {
+			return unescapeTOML(text)
+		}
+		return text, nil
+	case strings.HasPrefix(raw, `"`):
+		return strconv.Unquote(raw)
+	case strings.HasPrefix(raw, "'"):
+		if len(raw) < 2 || !strings.HasSuffix(raw, "'") {
+			return nil, fmt.Errorf("unterminated string")
+		}
+		return raw[1 : len(raw)-1], nil
+	case strings.HasPrefix(raw, "["):
+		if !strings.HasSuffix(raw, "]") {
+			return nil, fmt.Errorf("unterminated array")
+		}
+		list := make([]any, 0)
+		for _, item := range splitTopLevel(raw[1:len(raw)-1], ',') {
+			item = strings.TrimSpace(item)
+			if item == "" {
+				continue
+			}
+			value, err := parseTOMLValue(item)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, value)
+		}
+		return list, nil
+	case strings.HasPrefix(raw, "{"):
+		if !strings.HasSuffix(raw, "}") {
+			return nil, fmt.Errorf("unterminated inline table")
+		}
+		table := newMapping()
+		for _, pair := range splitTopLevel(raw[1:len(raw)-1], ',') {
+			if strings.TrimSpace(pair) == "" {
+				continue
+			}
+			eq := strings.IndexByte(pair, '=')
+			if eq == -1 {
+				return nil, fmt.Errorf("expected key = value in inline table")
+			}
+			key, err := unquoteTOMLKey(strings.TrimSpace(pair[:eq]))
+			if err != nil {
+				return nil, err
+			}
+			value, err := parseTOMLValue(strings.TrimSpace(pair[eq+1:]))
+			if err != nil {
+				return nil, err
+			}
+			table.set(key, value)
+		}
+		return table, nil
+	}
+
+	// Integers, floats and booleans are kept in their textual form and
+	// validated by the directive they are applied to.
+	return strings.ReplaceAll(raw, "_", ""), nil
+}
+
+func unquoteTOMLKey(key string) (string, error) {
+	if strings.HasPrefix(key, `"`) {
+		return strconv.Unquote(key)
+	}
+	if strings.HasPrefix(key, "'") && strings.HasSuffix(key, "'") && len(key) >= 2 {
+		return key[1 : len(key)-1], nil
+	}
+	if key == "" || strings.ContainsAny(key, " \t.") {
+		return "", fmt.Errorf("unsupported key %q", key)
+	}
+	return key, nil
+}
+
+// unescapeTOML resolves the escapes of a multi-line basic string,
+// including line-ending backslashes that join lines.
+func unescapeTOML(text string) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(text); i++ {
+		if text[i] != '\\' || i+1 >= len(text) {
+			b.WriteByte(text[i])
+			continue
+		}
+		if text[i+1] == '\n' {
+			i++
+			for i+1 < len(text) && strings.ContainsRune(" \t\n", rune(text[i+1])) {
+				i++
+			}
+			continue
+		}
+		unquoted, _, tail, err := strconv.UnquoteChar(text[i:], '"')
+		if err != nil {
+			return "", err
+		}
+		b.WriteRune(unquoted)
+		i = len(text) - len(tail) - 1
+	}
+	return b.String(), nil
+}
+
+// balanced reports whether all brackets outside strings are closed.
+func balanced(s string) bool {
+	depth := 0
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		switch {
+		case quote != 0:
+			if ch == '\\' && quote == '"' {
+				i++
+			} else if ch == quote {
+				quote = 0
+			}
+		case ch == '"' || ch == '\'':
+			quote = ch
+		case ch == '[' || ch == '{':
+			depth++
+		case ch == ']' || ch == '}':
+			depth--
+		}
+	}
+	return depth == 0
+}
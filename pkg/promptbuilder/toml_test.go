@@ -0,0 +1,72 @@
+package promptbuilder
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseTOML(t *testing.T) {
+	input := `# Prompt for the API
+header = """
+Review this code.
+# Not a comment
+Line \
+  joined."""
+basedir = '/project' # trailing comment
+maxfilesize = 1_000
+excludefolder = [
+  "node_modules", # generated
+  'dist',
+]
+include = [{ path = "docs/api.md", priority = 10 }, "src"]
+
+[var]
+"Team Name" = "Platform"
+
+[[section]]
+name = "Tests"
+include = ["test"]
+`
+	m, err := parseTOML(input)
+	if err != nil {
+		t.Fatalf("parseTOML: %v", err)
+	}
+	want := map[string]any{
+		"keys":          []string{"header", "basedir", "maxfilesize", "excludefolder", "include", "var", "section"},
+		"header":        "Review this code.\n# Not a comment\nLine joined.",
+		"basedir":       "/project",
+		"maxfilesize":   "1000",
+		"excludefolder": []any{"node_modules", "dist"},
+		"include": []any{
+			map[string]any{"keys": []string{"path", "priority"}, "path": "docs/api.md", "priority": "10"},
+			"src",
+		},
+		"var": map[string]any{"keys": []string{"Team Name"}, "Team Name": "Platform"},
+		"section": []any{
+			map[string]any{"keys": []string{"name", "include"}, "name": "Tests", "include": []any{"test"}},
+		},
+	}
+	if got := plain(m); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseTOML =\n%#v\nwant\n%#v", got, want)
+	}
+}
+
+func TestParseTOMLErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		err   string
+	}{
+		{"include\n", "toml line 1: expected key = value"},
+		{"a.b = 1\n", `toml line 1: unsupported key "a.b"`},
+		{"header = \"\"\"\nnever closed\n", "toml line 1: unterminated multi-line string"},
+		{"basedir = 'project\n", "toml line 1: unterminated string"},
+		{"include = { path = \"src\"\n", "toml line 1: unterminated inline table"},
+	}
+	for _, test := range tests {
+		_, err := parseTOML(test.input)
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("parseTOML(%q) = %v, want %q", test.input, err, test.err)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package promptbuilder
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+type treeNode struct {
+	name     string
+	children map[string]*treeNode
+}
+
+// renderTree draws the given relative file paths as an ASCII tree in the
+// style of the Unix tree command.
+func renderTree(paths []string) string {
+	root := &treeNode{children: make(map[string]*treeNode)}
+	for _, p := range paths {
+		node := root
+		for _, segment := range splitPath(filepath.ToSlash(p)) {
+			child, ok := node.children[segment]
+			if !ok {
+				child = &treeNode{name: segment, children: make(map[string]*treeNode)}
+				node.children[segment] = child
+			}
+			node = child
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString(".\n")
+	writeTreeChildren(&b, root, "")
+	return b.String()
+}
+
+func writeTreeChildren(b *strings.Builder, node *treeNode, prefix string) {
+	names := make([]string, 0, len(node.children))
+	for name := range node.children {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for i, name := range names {
+		child := node.children[name]
+		last := i == len(names)-1
+
+		connector, indent := "├── ", "│   "
+		if last {
+			connector, indent = "└── ", "    "
+		}
+
+		b.WriteString(prefix + connector + name)
+		if len(child.children) > 0 {
+			b.WriteString("/")
+		}
+		b.WriteString("\n")
+		writeTreeChildren(b, child, prefix+indent)
+	}
+}
+
+func sectionPaths(sections []fileSection) []string {
+	paths := make([]string, len(sections))
+	for i, section := range sections {
+		paths[i] = section.treePath()
+	}
+	return paths
+}
@@ -0,0 +1,162 @@
+package promptbuilder
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	truncateHead     = "head"
+	truncateTail     = "tail"
+	truncateHeadTail = "headtail"
+)
+
+// parseSize parses a human readable size such as "500", "100kb" or
+// "1.5mb" into bytes.
+func parseSize(value string) (int64, error) {
+	s := strings.ToLower(strings.TrimSpace(value))
+	multiplier := int64(1)
+	for _, unit := range []struct {
+		suffix string
+		size   int64
+	}{
+		{"gb", 1 << 30}, {"mb", 1 << 20}, {"kb", 1 << 10},
+		{"g", 1 << 30}, {"m", 1 << 20}, {"k", 1 << 10}, {"b", 1},
+	} {
+		if strings.HasSuffix(s, unit.suffix) {
+			s = strings.TrimSpace(strings.TrimSuffix(s, unit.suffix))
+			multiplier = unit.size
+			break
+		}
+	}
+
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", value)
+	}
+	return int64(n * float64(multiplier)), nil
+}
+
+// formatSize formats a byte count in the largest unit that keeps it at
+// least 1, e.g. "1.5 MB".
+func formatSize(size int64) string {
+	switch {
+	case size >= 1<<30:
+		return fmt.Sprintf("%.1f GB", float64(size)/(1<<30))
+	case size >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(size)/(1<<20))
+	case size >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(size)/(1<<10))
+	}
+	return fmt.Sprintf("%d B", size)
+}
+
+// truncateContent shortens content to roughly maxSize bytes, keeping whole
+// lines from the start, the end, or both, and marks the gap with the
+// number of lines that were left out.
+func truncateContent(content string, maxSize int64, mode string) string {
+	lines := strings.SplitAfter(content, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	headBudget, tailBudget := maxSize, int64(0)
+	switch mode {
+	case truncateTail:
+		headBudget, tailBudget = 0, maxSize
+	case truncateHeadTail:
+		headBudget, tailBudget = maxSize/2, maxSize-maxSize/2
+	}
+
+	head := 0
+	for size := int64(0); head < len(lines) && size+int64(len(lines[head])) <= headBudget; head++ {
+		size += int64(len(lines[head]))
+	}
+	tail := len(lines)
+	for size := int64(0); tail > head && size+int64(len(lines[tail-1])) <= tailBudget; tail-- {
+		size += int64(len(lines[tail-1]))
+	}
+
+	omitted := tail - head
+	if omitted == 0 {
+		return content
+	}
+
+	var b strings.Builder
+	for _, line := range lines[:head] {
+		b.WriteString(line)
+	}
+	if head > 0 && !strings.HasSuffix(lines[head-1], "\n") {
+		b.WriteString("\n")
+	}
+	fmt.Fprintf(&b, "[... truncated %s lines ...]\n", formatThousands(omitted))
+	for _, line := range lines[tail:] {
+		b.WriteString(line)
+	}
+	return b.String()
+}
+
+// isTable reports whether a file is tabular data that previewTable can
+// shorten.
+func isTable(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv", ".tsv":
+		return true
+	}
+	return false
+}
+
+// previewTable shortens a CSV or TSV file to its header row and its first
+// and last rows, and marks the gap with the number of rows that were left
+// out. Quoted fields may span lines.
+func previewTable(content string, rows int) string {
+	records := splitRecords(content)
+	total := len(records) - 1
+	if total <= 2*rows {
+		return content
+	}
+
+	var b strings.Builder
+	for _, record := range records[:1+rows] {
+		b.WriteString(record)
+	}
+	fmt.Fprintf(&b, "[... %s of %s rows omitted ...]\n", formatThousands(total-2*rows), formatThousands(total))
+	for _, record := range records[len(records)-rows:] {
+		b.WriteString(record)
+	}
+	return b.String()
+}
+
+// splitRecords splits CSV or TSV content after the line breaks that are
+// not inside a quoted field.
+func splitRecords(content string) []string {
+	var records []string
+	quoted := false
+	start := 0
+	for i := 0; i < len(content); i++ {
+		switch content[i] {
+		case '"':
+			quoted = !quoted
+		case '\n':
+			if !quoted {
+				records = append(records, content[start:i+1])
+				start = i + 1
+			}
+		}
+	}
+	if start < len(content) {
+		records = append(records, content[start:]+"\n")
+	}
+	return records
+}
+
+// formatThousands formats n with comma thousands separators.
+func formatThousands(n int) string {
+	s := strconv.Itoa(n)
+	for i := len(s) - 3; i > 0; i -= 3 {
+		s = s[:i] + "," + s[i:]
+	}
+	return s
+}
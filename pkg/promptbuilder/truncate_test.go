@@ -0,0 +1,59 @@
+package promptbuilder
+
+import "testing"
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		value string
+		want  int64
+	}{
+		{"0", 0},
+		{"512", 512},
+		{"100b", 100},
+		{"10k", 10 << 10},
+		{"10KB", 10 << 10},
+		{"1.5 MB", 3 << 19},
+		{"2m", 2 << 20},
+		{"1g", 1 << 30},
+		{" 3 gb ", 3 << 30},
+	}
+	for _, test := range tests {
+		got, err := parseSize(test.value)
+		if err != nil || got != test.want {
+			t.Errorf("parseSize(%q) = %d, %v, want %d", test.value, got, err, test.want)
+		}
+	}
+	for _, value := range []string{"", "kb", "-1", "1tb", "ten"} {
+		if got, err := parseSize(value); err == nil {
+			t.Errorf("parseSize(%q) = %d, want an error", value, got)
+		}
+	}
+}
+
+func TestTruncateContent(t *testing.T) {
+	content := "line 1\nline 2\nline 3\nline 4\nline 5\nline 6\n"
+	tests := []struct {
+		mode string
+		want string
+	}{
+		{truncateHead, "line 1\nline 2\n[... truncated 4 lines ...]\n"},
+		{truncateTail, "[... truncated 4 lines ...]\nline 5\nline 6\n"},
+		{truncateHeadTail, "line 1\n[... truncated 4 lines ...]\nline 6\n"},
+	}
+	for _, test := range tests {
+		if got := truncateContent(content, 15, test.mode); got != test.want {
+			t.Errorf("truncateContent(%s) = %q, want %q", test.mode, got, test.want)
+		}
+	}
+	if got := truncateContent(content, 100, truncateHead); got != content {
+		t.Errorf("truncateContent of a small file = %q", got)
+	}
+}
+
+func TestFormatThousands(t *testing.T) {
+	for n, want := range map[int]string{0: "0", 999: "999", 1000: "1,000", 1234567: "1,234,567"} {
+		if got := formatThousands(n); got != want {
+			t.Errorf("formatThousands(%d) = %q, want %q", n, got, want)
+		}
+	}
+}
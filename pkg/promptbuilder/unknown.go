@@ -0,0 +1,83 @@
+package promptbuilder
+
+import "fmt"
+
+// directiveNames are the keys applyDirective knows, which misspelled keys
+// are compared to.
+var directiveNames = []string{
+	"basedir", "include", "includecmd", "includebinary", "section", "intro",
+	"excludefolder", "excludeextension", "includeextension", "excludefile", "excludepattern",
+	"usegitignore", "usepromptignore", "ignorecase", "nearduplicates", "dedupe", "omittednote",
+	"anonymizepaths", "rename", "absolutepaths", "skipgenerated", "followsymlinks",
+	"includehidden", "stripnotebookoutputs", "directorystructure", "tree", "maxtokens",
+	"maxfilesize", "excludelargerthan", "maxfiles", "maxtotalsize", "csvpreview",
+	"truncatemode", "binarysamplesize", "textextension", "binaryextension", "forceinclude",
+	"encoding", "sort", "groupby", "stats", "followimports", "strict", "reverse",
+	"changed", "metadata", "redactsecrets", "trimtrailingwhitespace", "collapseblanklines",
+	"tabwidth", "stripcomments", "linenumbers", "promptcaching", "cache", "history",
+	"preset", "import", "redact", "footer", "footerfile", "template", "fileheader", "cost", "price",
+	"var", "gitdiff", "gitref", "gitdiffposition", "splittokens", "splitchars",
+}
+
+// UnknownKey is a directive of a configuration that is not known, most
+// likely a misspelled one, which is otherwise ignored.
+type UnknownKey struct {
+	Key  string
+	File string // file it was read from, "" when it was not read from a file
+	Line int    // line in the file, 0 when not known
+}
+
+// UnknownKeys returns the directives of the configuration that are not
+// known, in the order they were read.
+func (c *Config) UnknownKeys() []UnknownKey {
+	return c.unknown
+}
+
+// Suggestion returns the known directive closest to the key, or "" when
+// none is close enough to be what was meant.
+func (u UnknownKey) Suggestion() string {
+	best, bestDistance := "", len(u.Key)/3+1
+	for _, name := range directiveNames {
+		if d := editDistance(u.Key, name); d < bestDistance {
+			best, bestDistance = name, d
+		}
+	}
+	return best
+}
+
+// String describes the key and where it was read, with the directive
+// that was probably meant.
+func (u UnknownKey) String() string {
+	message := fmt.Sprintf("unknown directive %q", u.Key)
+	switch {
+	case u.File != "" && u.Line > 0:
+		message += fmt.Sprintf(" at %s:%d", u.File, u.Line)
+	case u.File != "":
+		message += " in " + u.File
+	}
+	if suggestion := u.Suggestion(); suggestion != "" {
+		message += fmt.Sprintf(", did you mean %s?", suggestion)
+	}
+	return message
+}
+
+// editDistance is the Levenshtein distance between a and b.
+func editDistance(a string, b string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
@@ -0,0 +1,113 @@
+package promptbuilder
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Warning is a kind of warning logged during a build, such as a binary
+// file skipped or an include path that does not exist, with every message
+// of that kind.
+type Warning struct {
+	Messages []string
+
+	key string // format of the messages, which tells their kind
+}
+
+// warningExamples is the number of messages of a kind shown by
+// WarningSummary.
+const warningExamples = 3
+
+// recordWarning adds a message logged with warnf to the warnings of the
+// build, grouped by its format.
+func (b *Builder) recordWarning(format string, message string) {
+	key := format
+	if key == "%s" {
+		key = message
+	}
+	for i := range b.warnings {
+		if b.warnings[i].key == key {
+			b.warnings[i].Messages = append(b.warnings[i].Messages, message)
+			return
+		}
+	}
+	b.warnings = append(b.warnings, Warning{Messages: []string{message}, key: key})
+}
+
+// recordRedactions adds the matches replaced by redact to the counts of
+// the build.
+func (b *Builder) recordRedactions(counts map[string]int) {
+	if b.redactions == nil {
+		return
+	}
+	for rule, count := range counts {
+		b.redactions[rule] += count
+	}
+}
+
+// WarningSummary returns the warnings of the build grouped by kind, the
+// matches replaced by redaction, and how many files were left out for
+// each reason, or "" when there were no warnings and nothing was
+// redacted.
+func (r *Report) WarningSummary() string {
+	if len(r.Warnings) == 0 && len(r.Redactions) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	if len(r.Warnings) > 0 {
+		count := 0
+		for _, w := range r.Warnings {
+			count += len(w.Messages)
+		}
+		fmt.Fprintf(&b, "Summary of %d warnings:\n", count)
+		for _, w := range r.Warnings {
+			for _, message := range w.Messages[:min(warningExamples, len(w.Messages))] {
+				fmt.Fprintf(&b, "  %s\n", strings.ReplaceAll(message, "\n", "\n    "))
+			}
+			if more := len(w.Messages) - warningExamples; more > 0 {
+				fmt.Fprintf(&b, "  ... and %d more like these\n", more)
+			}
+		}
+	}
+
+	if len(r.Redactions) > 0 {
+		rules := make([]string, 0, len(r.Redactions))
+		for rule := range r.Redactions {
+			rules = append(rules, rule)
+		}
+		sort.Strings(rules)
+		var counts []string
+		for _, rule := range rules {
+			counts = append(counts, fmt.Sprintf("%d %s", r.Redactions[rule], rule))
+		}
+		fmt.Fprintf(&b, "Redacted: %s\n", strings.Join(counts, ", "))
+	}
+
+	skipped := make(map[string]int)
+	for _, s := range r.Skipped {
+		skipped[s.Reason]++
+	}
+	if len(r.Omitted) > 0 {
+		skipped["maxTokens"] += len(r.Omitted)
+	}
+	if len(skipped) > 0 {
+		reasons := make([]string, 0, len(skipped))
+		for reason := range skipped {
+			reasons = append(reasons, reason)
+		}
+		sort.Slice(reasons, func(i, j int) bool {
+			if skipped[reasons[i]] != skipped[reasons[j]] {
+				return skipped[reasons[i]] > skipped[reasons[j]]
+			}
+			return reasons[i] < reasons[j]
+		})
+		var counts []string
+		for _, reason := range reasons {
+			counts = append(counts, fmt.Sprintf("%d %s", skipped[reason], reason))
+		}
+		fmt.Fprintf(&b, "Left out: %s\n", strings.Join(counts, ", "))
+	}
+	return b.String()
+}
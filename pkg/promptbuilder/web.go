@@ -0,0 +1,409 @@
+package promptbuilder
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Limits of fetching a URL include.
+const (
+	fetchTimeout  = 30 * time.Second
+	fetchMaxBytes = 10 << 20
+)
+
+// isURL reports whether an include path is a web document rather than a
+// path in basedir.
+func isURL(path string) bool {
+	return strings.HasPrefix(path, "https://") || strings.HasPrefix(path, "http://")
+}
+
+// fetchDocument downloads a URL include and returns its content and the
+// language of its code fence. HTML pages are converted to markdown; other
+// text is returned as it is.
+func fetchDocument(ctx context.Context, rawURL string) (string, string, error) {
+	ctx, cancel := context.WithTimeout(ctx, fetchTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return "", "", err
+	}
+	req.Header.Set("User-Agent", "promptbuilder")
+	req.Header.Set("Accept", "text/html, text/markdown, text/plain, */*;q=0.5")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", "", fmt.Errorf("server returned %s", resp.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, fetchMaxBytes+1))
+	if err != nil {
+		return "", "", err
+	}
+	if len(data) > fetchMaxBytes {
+		return "", "", fmt.Errorf("document is larger than %s", formatSize(fetchMaxBytes))
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	switch {
+	case mediaType == "text/html" || mediaType == "application/xhtml+xml":
+		return htmlToMarkdown(string(data), resp.Request.URL), "markdown", nil
+	case mediaType == "text/markdown":
+		return string(data), "markdown", nil
+	case strings.HasPrefix(mediaType, "text/"), mediaType == "application/json", mediaType == "",
+		strings.HasSuffix(mediaType, "+json"), strings.HasSuffix(mediaType, "+xml"), mediaType == "application/xml":
+		if bytes.IndexByte(data, 0) >= 0 || !utf8.Valid(data) {
+			return "", "", fmt.Errorf("document is binary")
+		}
+		return string(data), detectLanguage(resp.Request.URL.Path), nil
+	default:
+		return "", "", fmt.Errorf("unsupported content type %s", mediaType)
+	}
+}
+
+// Elements whose content never reaches the markdown, and elements that
+// start a new block.
+var (
+	skippedElements = map[string]bool{
+		"head": true, "script": true, "style": true, "noscript": true, "template": true,
+		"svg": true, "nav": true, "iframe": true, "button": true, "form": true,
+	}
+	blockElements = map[string]bool{
+		"p": true, "div": true, "section": true, "article": true, "main": true, "header": true,
+		"footer": true, "aside": true, "blockquote": true, "ul": true, "ol": true, "dl": true,
+		"dt": true, "dd": true, "table": true, "figure": true, "figcaption": true, "details": true,
+		"summary": true,
+	}
+)
+
+// htmlTag matches a tag: its slash, name and attributes.
+var htmlTag = regexp.MustCompile(`(?s)^<(/?)([a-zA-Z][a-zA-Z0-9-]*)([^>]*)>`)
+
+// htmlAttr matches an attribute with a quoted or bare value.
+var htmlAttr = regexp.MustCompile(`(?s)([a-zA-Z-]+)\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s>]+))`)
+
+// htmlToMarkdown converts an HTML page to markdown, keeping headings,
+// paragraphs, lists, links, code and tables, and leaving out scripts,
+// styles and navigation. When the page has a <main> or <article>
+// element, only that is converted. Relative links are resolved against
+// base.
+func htmlToMarkdown(page string, base *url.URL) string {
+	w := markdownWriter{base: base}
+
+	// The content element is found among the tags, so that "<main" in a
+	// script does not count
+	lower := strings.ToLower(page)
+	content := ""
+	for _, name := range []string{"main", "article"} {
+		if strings.Contains(lower, "<"+name) {
+			content = name
+			break
+		}
+	}
+	depth := 0
+
+	for len(page) > 0 {
+		i := strings.IndexByte(page, '<')
+		if i < 0 {
+			w.text(page)
+			break
+		}
+		if i > 0 {
+			w.text(page[:i])
+			page = page[i:]
+		}
+
+		if strings.HasPrefix(page, "<!--") {
+			end := strings.Index(page, "-->")
+			if end < 0 {
+				break
+			}
+			page = page[end+3:]
+			continue
+		}
+		match := htmlTag.FindStringSubmatch(page)
+		if match == nil {
+			if strings.HasPrefix(page, "<!") || strings.HasPrefix(page, "<?") {
+				// Doctype and processing instructions
+				if end := strings.IndexByte(page, '>'); end >= 0 {
+					page = page[end+1:]
+					continue
+				}
+			}
+			w.text("<")
+			page = page[1:]
+			continue
+		}
+		page = page[len(match[0]):]
+
+		name := strings.ToLower(match[2])
+		if match[1] == "" && skippedElements[name] {
+			// Drop everything up to the closing tag
+			end := strings.Index(strings.ToLower(page), "</"+name)
+			if end < 0 {
+				break
+			}
+			page = page[end:]
+			if close := strings.IndexByte(page, '>'); close >= 0 {
+				page = page[close+1:]
+			}
+			continue
+		}
+		if name == content {
+			if match[1] == "" {
+				if depth == 0 {
+					// Drop what came before it
+					w = markdownWriter{base: base}
+				}
+				depth++
+			} else if depth > 0 {
+				depth--
+				if depth == 0 {
+					break
+				}
+			}
+		}
+		w.tag(name, match[1] == "/", htmlAttrs(match[3]))
+	}
+	return w.String()
+}
+
+func htmlAttrs(s string) map[string]string {
+	attrs := make(map[string]string)
+	for _, match := range htmlAttr.FindAllStringSubmatch(s, -1) {
+		attrs[strings.ToLower(match[1])] = html.UnescapeString(match[2] + match[3] + match[4])
+	}
+	return attrs
+}
+
+// markdownWriter accumulates the markdown of htmlToMarkdown.
+type markdownWriter struct {
+	base  *url.URL
+	b     strings.Builder
+	pre   int      // depth of <pre> elements, where whitespace is kept
+	lists []int    // open lists: -1 for <ul>, else the last <ol> number
+	links []string // targets of the open <a> elements, "" for none
+	space bool     // whitespace is pending before the next text
+	cells int      // cells written in the current table row
+	heads bool     // the current table row has header cells
+}
+
+func (w *markdownWriter) String() string {
+	lines := strings.Split(w.b.String(), "\n")
+	var out []string
+	blank := true
+	for _, line := range lines {
+		line = strings.TrimRight(line, " \t")
+		if line == "" {
+			if blank {
+				continue
+			}
+			blank = true
+		} else {
+			blank = false
+		}
+		out = append(out, line)
+	}
+	return strings.TrimSpace(strings.Join(out, "\n")) + "\n"
+}
+
+// text writes the text between tags, collapsing whitespace outside of
+// <pre>.
+func (w *markdownWriter) text(s string) {
+	s = html.UnescapeString(s)
+	if w.pre > 0 {
+		w.b.WriteString(s)
+		return
+	}
+	fields := strings.Fields(s)
+	if len(fields) == 0 {
+		if s != "" {
+			w.space = true
+		}
+		return
+	}
+	if (w.space || s[0] == ' ' || s[0] == '\t' || s[0] == '\n' || s[0] == '\r') && !w.atLineStart() {
+		w.b.WriteByte(' ')
+	}
+	w.b.WriteString(strings.Join(fields, " "))
+	last := s[len(s)-1]
+	w.space = last == ' ' || last == '\t' || last == '\n' || last == '\r'
+}
+
+func (w *markdownWriter) atLineStart() bool {
+	s := w.b.String()
+	return s == "" || strings.HasSuffix(s, "\n") || strings.HasSuffix(s, "- ") || strings.HasSuffix(s, ". ") ||
+		strings.HasSuffix(s, "[") || strings.HasSuffix(s, "| ") || strings.HasSuffix(s, "> ")
+}
+
+// block starts a new paragraph.
+func (w *markdownWriter) block() {
+	w.b.WriteString("\n\n")
+	w.space = false
+}
+
+func (w *markdownWriter) tag(name string, closing bool, attrs map[string]string) {
+	if w.pre > 0 && name != "pre" {
+		return
+	}
+
+	switch name {
+	case "h1", "h2", "h3", "h4", "h5", "h6":
+		w.block()
+		if !closing {
+			w.b.WriteString(strings.Repeat("#", int(name[1]-'0')) + " ")
+		}
+	case "pre":
+		if closing {
+			w.pre = max(0, w.pre-1)
+			if w.pre == 0 {
+				w.b.WriteString("\n```")
+				w.block()
+			}
+		} else {
+			if w.pre == 0 {
+				w.block()
+				w.b.WriteString("```\n")
+			}
+			w.pre++
+		}
+	case "br":
+		w.b.WriteString("\n")
+		w.space = false
+	case "hr":
+		w.block()
+		w.b.WriteString("---")
+		w.block()
+	case "ul", "ol":
+		if closing {
+			if len(w.lists) > 0 {
+				w.lists = w.lists[:len(w.lists)-1]
+			}
+			if len(w.lists) == 0 {
+				w.block()
+			}
+		} else {
+			if len(w.lists) == 0 {
+				w.block()
+			}
+			if name == "ul" {
+				w.lists = append(w.lists, -1)
+			} else {
+				w.lists = append(w.lists, 0)
+			}
+		}
+	case "li":
+		if closing {
+			return
+		}
+		w.b.WriteString("\n")
+		w.space = false
+		if len(w.lists) == 0 {
+			w.b.WriteString("- ")
+			return
+		}
+		w.b.WriteString(strings.Repeat("  ", len(w.lists)-1))
+		if n := &w.lists[len(w.lists)-1]; *n >= 0 {
+			*n++
+			fmt.Fprintf(&w.b, "%d. ", *n)
+		} else {
+			w.b.WriteString("- ")
+		}
+	case "blockquote":
+		w.block()
+		if !closing {
+			w.b.WriteString("> ")
+		}
+	case "code", "kbd", "samp", "tt":
+		w.inline("`", closing)
+	case "strong", "b":
+		w.inline("**", closing)
+	case "em", "i":
+		w.inline("*", closing)
+	case "a":
+		if closing {
+			if len(w.links) == 0 {
+				return
+			}
+			target := w.links[len(w.links)-1]
+			w.links = w.links[:len(w.links)-1]
+			if target != "" {
+				w.b.WriteString("](" + target + ")")
+			}
+			return
+		}
+		target := w.resolve(attrs["href"])
+		w.links = append(w.links, target)
+		if target != "" {
+			w.inline("[", false)
+		}
+	case "tr":
+		if closing {
+			if w.heads && w.cells > 0 {
+				w.b.WriteString("\n|" + strings.Repeat(" --- |", w.cells))
+			}
+			return
+		}
+		w.b.WriteString("\n")
+		w.cells, w.heads = 0, false
+	case "td", "th":
+		if closing {
+			w.b.WriteString(" |")
+			return
+		}
+		if w.cells == 0 {
+			w.b.WriteString("|")
+		}
+		w.b.WriteString(" ")
+		w.space = false
+		w.cells++
+		w.heads = w.heads || name == "th"
+	default:
+		if blockElements[name] {
+			w.block()
+		}
+	}
+}
+
+// inline writes the marker of inline formatting. Whitespace pending
+// before an opening marker is written first, while after a closing one it
+// stays pending, so that "<b>bold </b>text" becomes "**bold** text".
+func (w *markdownWriter) inline(marker string, closing bool) {
+	if !closing {
+		if w.space && !w.atLineStart() {
+			w.b.WriteByte(' ')
+		}
+		w.space = false
+	}
+	w.b.WriteString(marker)
+}
+
+// resolve returns the absolute target of a link, or "" for links that
+// mean nothing outside of the page.
+func (w *markdownWriter) resolve(href string) string {
+	if href == "" || strings.HasPrefix(href, "#") || strings.HasPrefix(href, "javascript:") {
+		return ""
+	}
+	target, err := url.Parse(href)
+	if err != nil {
+		return ""
+	}
+	if w.base != nil {
+		target = w.base.ResolveReference(target)
+	}
+	return target.String()
+}
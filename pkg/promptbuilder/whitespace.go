@@ -0,0 +1,88 @@
+package promptbuilder
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// compactWhitespace applies the whitespace options of config to the
+// content of a file. Blank lines are left alone when keepLines is set,
+// since collapsing them renumbers the lines.
+func compactWhitespace(content string, path string, config *Config, keepLines bool) string {
+	if config.TrimWhitespace {
+		content = trimTrailingWhitespace(content)
+	}
+	if config.CollapseBlankLines && !keepLines {
+		content = collapseBlankLines(content)
+	}
+	if config.TabWidth > 0 && !keepsTabs(path) {
+		content = expandTabs(content, config.TabWidth)
+	}
+	return content
+}
+
+// keepsTabs reports whether tabs in a file carry meaning, as in Makefile
+// recipes and TSV columns.
+func keepsTabs(path string) bool {
+	return detectLanguage(path) == "makefile" || strings.EqualFold(filepath.Ext(path), ".tsv")
+}
+
+// trimTrailingWhitespace removes the spaces, tabs and carriage returns at
+// the ends of lines.
+func trimTrailingWhitespace(content string) string {
+	lines := strings.Split(content, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t\r")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// collapseBlankLines replaces runs of blank lines with a single one and
+// drops the blank lines at the start and the end.
+func collapseBlankLines(content string) string {
+	lines := strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+	kept := lines[:0]
+	previousBlank := true
+	for _, line := range lines {
+		blank := strings.TrimSpace(line) == ""
+		if blank && previousBlank {
+			continue
+		}
+		kept = append(kept, line)
+		previousBlank = blank
+	}
+	if previousBlank && len(kept) > 0 {
+		kept = kept[:len(kept)-1]
+	}
+
+	collapsed := strings.Join(kept, "\n")
+	if strings.HasSuffix(content, "\n") && collapsed != "" {
+		collapsed += "\n"
+	}
+	return collapsed
+}
+
+// expandTabs replaces tabs with spaces up to the next multiple of width.
+func expandTabs(content string, width int) string {
+	if !strings.Contains(content, "\t") {
+		return content
+	}
+	var b strings.Builder
+	b.Grow(len(content))
+	column := 0
+	for _, r := range content {
+		switch r {
+		case '\t':
+			n := width - column%width
+			b.WriteString(strings.Repeat(" ", n))
+			column += n
+		case '\n':
+			b.WriteRune(r)
+			column = 0
+		default:
+			b.WriteRune(r)
+			column++
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,271 @@
+package promptbuilder
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// parseYAML parses the subset of YAML used by promptbuilder configs:
+// nested block mappings and sequences, flow sequences ([a, b]), quoted
+// and plain scalars, literal (|) and folded (>) block scalars, and
+// comments.
+func parseYAML(data string) (*mapping, error) {
+	p := &yamlParser{lines: strings.Split(strings.ReplaceAll(data, "\r\n", "\n"), "\n")}
+
+	p.skipBlank()
+	if p.pos < len(p.lines) && strings.TrimSpace(p.lines[p.pos]) == "---" {
+		p.pos++
+	}
+
+	m, err := p.parseMapping(0)
+	if err != nil {
+		return nil, err
+	}
+
+	p.skipBlank()
+	if p.pos < len(p.lines) {
+		return nil, p.errorf("unexpected content")
+	}
+	return m, nil
+}
+
+type yamlParser struct {
+	lines []string
+	pos   int
+}
+
+func (p *yamlParser) errorf(format string, args ...any) error {
+	return fmt.Errorf("yaml line %d: %s", p.pos+1, fmt.Sprintf(format, args...))
+}
+
+// skipBlank moves past empty and comment-only lines.
+func (p *yamlParser) skipBlank() {
+	for p.pos < len(p.lines) {
+		trimmed := strings.TrimSpace(p.lines[p.pos])
+		if trimmed != "" && !strings.HasPrefix(trimmed, "#") {
+			return
+		}
+		p.pos++
+	}
+}
+
+func indentOf(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " "))
+}
+
+func (p *yamlParser) parseMapping(indent int) (*mapping, error) {
+	m := newMapping()
+
+	for {
+		p.skipBlank()
+		if p.pos >= len(p.lines) {
+			return m, nil
+		}
+
+		line := p.lines[p.pos]
+		ind := indentOf(line)
+		if ind < indent {
+			return m, nil
+		}
+		if ind > indent {
+			return nil, p.errorf("unexpected indentation")
+		}
+
+		content := stripComment(strings.TrimSpace(line))
+		if strings.HasPrefix(content, "- ") || content == "-" {
+			return m, nil
+		}
+
+		key, rest, ok := splitYAMLKey(content)
+		if !ok {
+			return nil, p.errorf("expected key: value")
+		}
+		p.pos++
+
+		value, err := p.parseValue(rest, ind)
+		if err != nil {
+			return nil, err
+		}
+		m.set(key, value)
+	}
+}
+
+// parseValue parses the value following "key:" or "- " on a line that is
+// indented by ind.
+func (p *yamlParser) parseValue(rest string, ind int) (any, error) {
+	switch {
+	case rest == "":
+		p.skipBlank()
+		if p.pos >= len(p.lines) {
+			return "", nil
+		}
+		next := p.lines[p.pos]
+		nextInd := indentOf(next)
+		nextContent := strings.TrimSpace(next)
+		isList := strings.HasPrefix(nextContent, "- ") || nextContent == "-"
+
+		if isList && nextInd >= ind {
+			return p.parseList(nextInd)
+		}
+		if nextInd > ind {
+			return p.parseMapping(nextInd)
+		}
+		return "", nil
+	case strings.HasPrefix(rest, "|") || strings.HasPrefix(rest, ">"):
+		return p.parseBlockScalar(rest, ind), nil
+	case strings.HasPrefix(rest, "["):
+		return parseFlowList(rest)
+	}
+	return unquoteYAML(rest)
+}
+
+func (p *yamlParser) parseList(indent int) ([]any, error) {
+	list := make([]any, 0)
+
+	for {
+		p.skipBlank()
+		if p.pos >= len(p.lines) {
+			return list, nil
+		}
+
+		line := p.lines[p.pos]
+		if indentOf(line) != indent {
+			return list, nil
+		}
+		content := stripComment(strings.TrimSpace(line))
+		if !strings.HasPrefix(content, "- ") && content != "-" {
+			return list, nil
+		}
+		item := strings.TrimSpace(strings.TrimPrefix(content, "-"))
+
+		// "- key: value" starts a mapping whose keys line up with the
+		// first key, so re-read the line with the dash blanked out.
+		if _, _, ok := splitYAMLKey(item); ok && !strings.HasPrefix(item, "[") {
+			p.lines[p.pos] = strings.Repeat(" ", indent+2) + item
+			m, err := p.parseMapping(indent + 2)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, m)
+			continue
+		}
+
+		p.pos++
+		value, err := p.parseValue(item, indent)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, value)
+	}
+}
+
+// parseBlockScalar reads the indented lines of a | or > block scalar.
+func (p *yamlParser) parseBlockScalar(indicator string, ind int) string {
+	var lines []string
+	blockIndent := -1
+
+	for p.pos < len(p.lines) {
+		line := p.lines[p.pos]
+		if strings.TrimSpace(line) == "" {
+			lines = append(lines, "")
+			p.pos++
+			continue
+		}
+		lineInd := indentOf(line)
+		if lineInd <= ind {
+			break
+		}
+		if blockIndent == -1 {
+			blockIndent = lineInd
+		}
+		if lineInd < blockIndent {
+			break
+		}
+		lines = append(lines, line[blockIndent:])
+		p.pos++
+	}
+
+	// Trailing blank lines belong to whatever follows the block
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	var text string
+	if strings.HasPrefix(indicator, ">") {
+		var b strings.Builder
+		for i, line := range lines {
+			switch {
+			case line == "":
+				b.WriteString("\n")
+			case i > 0 && lines[i-1] != "":
+				b.WriteString(" " + line)
+			default:
+				b.WriteString(line)
+			}
+		}
+		text = b.String()
+	} else {
+		text = strings.Join(lines, "\n")
+	}
+
+	if !strings.HasSuffix(indicator, "-") && text != "" {
+		text += "\n"
+	}
+	return text
+}
+
+// splitYAMLKey splits "key: value" and "key:" lines.
+func splitYAMLKey(content string) (string, string, bool) {
+	if strings.HasPrefix(content, "\"") || strings.HasPrefix(content, "'") {
+		end := strings.IndexByte(content[1:], content[0])
+		if end == -1 {
+			return "", "", false
+		}
+		key := content[1 : end+1]
+		rest := content[end+2:]
+		if !strings.HasPrefix(rest, ":") {
+			return "", "", false
+		}
+		return key, strings.TrimSpace(rest[1:]), true
+	}
+
+	if i := strings.Index(content, ": "); i > 0 {
+		return strings.TrimSpace(content[:i]), strings.TrimSpace(content[i+2:]), true
+	}
+	if strings.HasSuffix(content, ":") && len(content) > 1 {
+		return strings.TrimSpace(content[:len(content)-1]), "", true
+	}
+	return "", "", false
+}
+
+func parseFlowList(s string) ([]any, error) {
+	s = strings.TrimSpace(s)
+	if !strings.HasSuffix(s, "]") {
+		return nil, fmt.Errorf("unterminated list: %s", s)
+	}
+
+	list := make([]any, 0)
+	inner := strings.TrimSpace(s[1 : len(s)-1])
+	if inner == "" {
+		return list, nil
+	}
+	for _, item := range splitTopLevel(inner, ',') {
+		value, err := unquoteYAML(strings.TrimSpace(item))
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, value)
+	}
+	return list, nil
+}
+
+func unquoteYAML(s string) (string, error) {
+	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+		return strconv.Unquote(s)
+	}
+	if len(s) >= 2 && s[0] == '\'' && s[len(s)-1] == '\'' {
+		return strings.ReplaceAll(s[1:len(s)-1], "''", "'"), nil
+	}
+	return s, nil
+}
@@ -0,0 +1,106 @@
+package promptbuilder
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// plain converts the values of a parsed mapping to maps and slices that
+// reflect.DeepEqual can compare, keeping the key order in "keys".
+func plain(value any) any {
+	switch v := value.(type) {
+	case *mapping:
+		m := map[string]any{"keys": v.keys}
+		for key, item := range v.values {
+			m[key] = plain(item)
+		}
+		return m
+	case []any:
+		list := make([]any, len(v))
+		for i, item := range v {
+			list[i] = plain(item)
+		}
+		return list
+	}
+	return value
+}
+
+func TestParseYAML(t *testing.T) {
+	input := `---
+# Prompt for the API
+header: |
+  Review this code.
+
+  # Not a comment
+basedir: "/project" # trailing comment
+excludefolder: [node_modules, 'it''s', "dist"]
+include:
+  - src
+  - path: docs/api.md
+    priority: 10
+footer: >-
+  Answer
+  briefly.
+var:
+  Team: Platform
+empty:
+`
+	m, err := parseYAML(input)
+	if err != nil {
+		t.Fatalf("parseYAML: %v", err)
+	}
+	want := map[string]any{
+		"keys":          []string{"header", "basedir", "excludefolder", "include", "footer", "var", "empty"},
+		"header":        "Review this code.\n\n# Not a comment\n",
+		"basedir":       "/project",
+		"excludefolder": []any{"node_modules", "it's", "dist"},
+		"include": []any{
+			"src",
+			map[string]any{"keys": []string{"path", "priority"}, "path": "docs/api.md", "priority": "10"},
+		},
+		"footer": "Answer briefly.",
+		"var":    map[string]any{"keys": []string{"Team"}, "Team": "Platform"},
+		"empty":  "",
+	}
+	if got := plain(m); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseYAML =\n%#v\nwant\n%#v", got, want)
+	}
+}
+
+func TestParseYAMLErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		err   string
+	}{
+		{"include: src\n  nested: x\n", "yaml line 2: unexpected indentation"},
+		{"just text\n", "yaml line 1: expected key: value"},
+		{"include: [src, docs\n", "unterminated list"},
+	}
+	for _, test := range tests {
+		_, err := parseYAML(test.input)
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("parseYAML(%q) = %v, want %q", test.input, err, test.err)
+		}
+	}
+}
+
+// TestYAMLConfig checks that a YAML config behaves like the equivalent
+// directives.
+func TestYAMLConfig(t *testing.T) {
+	m, err := parseYAML("header: Review this code.\nbasedir: /project\ninclude: [src, docs]\nexcludeextension:\n  - map\nusegitignore: true\n")
+	if err != nil {
+		t.Fatalf("parseYAML: %v", err)
+	}
+	structured, err := configFromMapping(m)
+	if err != nil {
+		t.Fatalf("configFromMapping: %v", err)
+	}
+	directives, err := ParseConfig(strings.NewReader("Review this code.\n---\nbasedir=/project\ninclude=src\ninclude=docs\nexcludeextension=map\nusegitignore=true\n"))
+	if err != nil {
+		t.Fatalf("ParseConfig: %v", err)
+	}
+	if !reflect.DeepEqual(structured, directives) {
+		t.Errorf("YAML config = %+v, want %+v", structured, directives)
+	}
+}
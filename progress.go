@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"promptbuilder/pkg/promptbuilder"
+)
+
+// progressThreshold is the number of files from which a progress bar is
+// shown. Smaller builds finish before it would be of any use.
+const progressThreshold = 500
+
+// progressInterval is the minimum time between two redraws of the bar.
+const progressInterval = 100 * time.Millisecond
+
+// progressWidth is the width of the bar itself, in characters.
+const progressWidth = 30
+
+// progressBar draws the progress of a build on a single terminal line.
+type progressBar struct {
+	mu    sync.Mutex
+	w     io.Writer
+	last  time.Time
+	line  string // what is on the terminal, "" when the bar is cleared
+	state promptbuilder.Progress
+}
+
+// isTerminal reports whether f is a terminal rather than a file or pipe.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// update records the progress and redraws the bar, at most every
+// progressInterval. The bar is removed once all files are done.
+func (p *progressBar) update(progress promptbuilder.Progress) {
+	if progress.Total < progressThreshold {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.state = progress
+	if progress.Done >= progress.Total {
+		p.clearLocked()
+		return
+	}
+	if p.last.IsZero() {
+		// Builds that finish within the first interval show no bar
+		p.last = time.Now()
+		return
+	}
+	if time.Since(p.last) < progressInterval {
+		return
+	}
+	p.last = time.Now()
+	p.drawLocked()
+}
+
+func (p *progressBar) drawLocked() {
+	filled := progressWidth * p.state.Done / p.state.Total
+	bar := strings.Repeat("=", filled)
+	if filled < progressWidth {
+		bar += ">" + strings.Repeat(" ", progressWidth-filled-1)
+	}
+	p.line = fmt.Sprintf("[%s] %s", bar, p.state)
+	fmt.Fprint(p.w, "\r"+p.line+"\x1b[K")
+}
+
+// clear removes the bar from the terminal so that a message can be
+// written on its line. The next update draws it again.
+func (p *progressBar) clear() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.clearLocked()
+}
+
+func (p *progressBar) clearLocked() {
+	if p.line != "" {
+		fmt.Fprint(p.w, "\r\x1b[K")
+		p.line = ""
+	}
+}
+
+// progressHandler clears the progress bar before every message, so that
+// messages and the bar do not end up on the same line.
+type progressHandler struct {
+	slog.Handler
+	bar *progressBar
+}
+
+func (h progressHandler) Handle(ctx context.Context, r slog.Record) error {
+	h.bar.clear()
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h progressHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return progressHandler{h.Handler.WithAttrs(attrs), h.bar}
+}
+
+func (h progressHandler) WithGroup(name string) slog.Handler {
+	return progressHandler{h.Handler.WithGroup(name), h.bar}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"promptbuilder/pkg/promptbuilder"
+)
+
+// runSelect builds a prompt from the files most similar to a question,
+// chosen among the files the input file selects, and returns the exit
+// code.
+func runSelect(args []string) int {
+	flags := flag.NewFlagSet("select", flag.ExitOnError)
+	inputFile := flags.String("input", "input.txt", "Input file path")
+	outputFile := flags.String("output", "output.txt", "Output file path, or - for stdout")
+	format := flags.String("format", promptbuilder.FormatMarkdown, "Output format ("+strings.Join(promptbuilder.OutputFormats, ", ")+")")
+	model := flags.String("model", promptbuilder.DefaultModel, "Model family to count tokens for ("+strings.Join(promptbuilder.SupportedModels(), ", ")+"); gpt-4o and gpt-4 are counted exactly once promptbuilder vocabulary has downloaded their tokenizer, the others estimated")
+	query := flags.String("query", "", "Question the files are ranked against")
+	top := flags.Int("top", 20, "Number of most similar files to include")
+	maxTokens := flags.String("max-tokens", "", "Token budget; the least similar files are dropped first to meet it")
+	provider := flags.String("provider", promptbuilder.ProviderLocal, "Embedding provider ("+strings.Join(promptbuilder.EmbeddingProviders, ", ")+")")
+	embedModel := flags.String("embed-model", "", "Embedding model (default: the provider's default embedding model)")
+	list := flags.Bool("list", false, "Print the ranked files with their scores instead of writing a prompt")
+	flags.Parse(args)
+
+	if *query == "" {
+		logger.Error("select requires a question given with -query")
+		return exitConfig
+	}
+
+	config, err := promptbuilder.ReadConfig(*inputFile)
+	if err != nil {
+		logger.Error(fmt.Sprintf("Cannot read input file: %v", err))
+		return exitConfig
+	}
+	if *maxTokens != "" {
+		if err := config.Set("maxtokens", *maxTokens); err != nil {
+			logger.Error(fmt.Sprintf("Invalid flag: %v", err))
+			return exitConfig
+		}
+	}
+	ctx, stop := signalContext()
+	defer stop()
+
+	if err := config.ValidateContext(ctx); err != nil {
+		logger.Error(fmt.Sprintf("Invalid configuration: %v", err))
+		return exitConfig
+	}
+	embedder, err := promptbuilder.NewEmbedder(*provider, *embedModel)
+	if err != nil {
+		logger.Error(err.Error())
+		return exitConfig
+	}
+
+	ranker, err := promptbuilder.New(config, promptbuilder.WithSlog(logger))
+	if err != nil {
+		logger.Error(err.Error())
+		return exitConfig
+	}
+	ranked, err := ranker.Rank(ctx, *query, embedder)
+	if err != nil {
+		logger.Error(err.Error())
+		return exitCode(err)
+	}
+	if len(ranked) == 0 {
+		logger.Warn("No files found matching the include paths")
+		return exitNoFiles
+	}
+
+	if *list {
+		for _, file := range ranked {
+			fmt.Printf("%.4f  %s\n", file.Score, file.Path)
+		}
+		return 0
+	}
+	for i, file := range ranked[:min(*top, len(ranked))] {
+		logger.Debug(fmt.Sprintf("  %2d. %.4f  %s", i+1, file.Score, file.Path), "path", file.Path, "score", file.Score)
+	}
+
+	if err := config.UseRanking(ranked, *top); err != nil {
+		logger.Error(err.Error())
+		return exitError
+	}
+	builder, err := promptbuilder.New(config,
+		promptbuilder.WithFormat(*format),
+		promptbuilder.WithModel(*model),
+		promptbuilder.WithSlog(logger),
+	)
+	if err != nil {
+		logger.Error(err.Error())
+		return exitConfig
+	}
+	report, err := buildToFile(ctx, builder, *outputFile, false)
+	if err != nil {
+		logger.Error(fmt.Sprintf("Cannot generate output: %v", err))
+		return exitCode(err)
+	}
+
+	logTokenReport(report, *model)
+	logger.Info(fmt.Sprintf("Selected %d of %d files for the query", len(report.Files), len(ranked)), "files", len(report.Files))
+	if *outputFile != stdoutPath {
+		logger.Info("Output written to: "+*outputFile, "output", *outputFile)
+	}
+	return 0
+}
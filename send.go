@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"promptbuilder/pkg/promptbuilder"
+)
+
+// sendPrompt builds the prompt, appends the question, sends it to the
+// model provider and writes the reply to outputPath. With noClobber, an
+// existing outputPath is not replaced.
+func sendPrompt(ctx context.Context, builder *promptbuilder.Builder, client *promptbuilder.Client, question string, outputPath string, noClobber bool) error {
+	var prompt strings.Builder
+	report, err := builder.Build(ctx, &prompt)
+	if err != nil {
+		return fmt.Errorf("error generating prompt: %w", err)
+	}
+	content := strings.TrimRight(prompt.String(), "\n") + "\n\n" + question
+
+	logger.Info(fmt.Sprintf("Sending %d files (%d estimated tokens) to %s (%s)", len(report.Files), report.TotalTokens, client.Provider, client.Model),
+		"files", len(report.Files), "tokens", report.TotalTokens, "provider", client.Provider, "model", client.Model)
+	reply, err := client.Chat(ctx, []promptbuilder.Message{{Role: "user", Content: content}})
+	if err != nil {
+		return err
+	}
+	if !strings.HasSuffix(reply, "\n") {
+		reply += "\n"
+	}
+
+	if outputPath == stdoutPath {
+		_, err = os.Stdout.WriteString(reply)
+		return err
+	}
+	output, err := createAtomic(outputPath)
+	if err != nil {
+		return fmt.Errorf("error writing response: %v", err)
+	}
+	_, err = output.WriteString(reply)
+	if closeErr := output.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = output.commit(noClobber)
+	}
+	if err != nil {
+		output.abort()
+		return fmt.Errorf("error writing response: %v", err)
+	}
+	logger.Info("Response written to: "+outputPath, "output", outputPath)
+	return nil
+}
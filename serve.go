@@ -0,0 +1,311 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"promptbuilder/pkg/promptbuilder"
+)
+
+// maxConfigSize limits the config JSON accepted by POST /build.
+const maxConfigSize = 1 << 20
+
+// configExtensions are the extensions of the config files served as
+// profiles.
+var configExtensions = map[string]bool{".txt": true, ".yaml": true, ".yml": true, ".toml": true, ".json": true}
+
+var errProfileNotFound = errors.New("profile not found")
+
+// postedDirectives are the directives a config posted to /build may set.
+// They select and shape the files of the -basedir of the server;
+// anything that reads other files or directories, runs git or a command,
+// or writes to disk is reserved to the profiles on the server.
+var postedDirectives = map[string]bool{
+	"include": true, "section": true, "sections": true, "intro": true, "header": true, "footer": true,
+	"excludefolder": true, "excludeextension": true, "includeextension": true, "excludefile": true, "excludepattern": true,
+	"usegitignore": true, "directorystructure": true, "tree": true, "maxtokens": true, "maxfilesize": true,
+	"excludelargerthan": true, "truncatemode": true, "redactsecrets": true, "stripcomments": true, "linenumbers": true,
+	"preset": true, "redact": true, "var": true, "vars": true, "promptcaching": true, "sort": true, "reverse": true,
+	"groupby": true, "stats": true, "strict": true, "followimports": true, "includehidden": true, "encoding": true,
+	"binarysamplesize": true, "textextension": true, "binaryextension": true, "forceinclude": true,
+	"stripnotebookoutputs": true, "csvpreview": true, "skipgenerated": true, "trimtrailingwhitespace": true,
+	"collapseblanklines": true, "tabwidth": true, "fileheader": true, "anonymizepaths": true, "rename": true,
+	"cost": true, "price": true, "dedupe": true, "nearduplicates": true, "maxfiles": true, "maxtotalsize": true,
+	"omittednote": true, "usepromptignore": true, "ignorecase": true,
+}
+
+// promptServer serves prompts over HTTP. Profiles are the config files in
+// profilesDir, named after the file without its extension.
+type promptServer struct {
+	profilesDir string
+	baseDir     string // basedir of posted configs
+}
+
+// fileInfo is a file of a GET /files response.
+type fileInfo struct {
+	Path   string `json:"path"`
+	Size   int    `json:"size"`
+	Lines  int    `json:"lines"`
+	Tokens int    `json:"tokens"`
+}
+
+// runServe serves the HTTP API until the listener fails and returns the
+// exit code.
+func runServe(args []string) int {
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	addr := flags.String("http", "localhost:8080", "Address to listen on")
+	profilesDir := flags.String("profiles", "profiles", "Directory of config files served as profiles")
+	baseDir := flags.String("basedir", ".", "Directory the configs posted to /build read their files from")
+	flags.Parse(args)
+
+	server := &promptServer{profilesDir: *profilesDir, baseDir: *baseDir}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /build", server.handleBuild)
+	mux.HandleFunc("GET /profiles", server.handleProfiles)
+	mux.HandleFunc("GET /files", server.handleFiles)
+
+	log.Printf("promptbuilder v%s listening on %s", version, *addr)
+	if err := http.ListenAndServe(*addr, mux); err != nil {
+		log.Printf("Error: %v", err)
+		return exitError
+	}
+	return 0
+}
+
+// handleBuild builds the config posted as JSON, with the basedir of the
+// server, or the profile named by the profile parameter, and responds
+// with the prompt. The format and model parameters work like the flags
+// of the same name.
+func (s *promptServer) handleBuild(w http.ResponseWriter, r *http.Request) {
+	var config *promptbuilder.Config
+	var opts []promptbuilder.Option
+	var err error
+	if name := r.URL.Query().Get("profile"); name != "" {
+		config, err = s.readProfile(name)
+	} else {
+		var body []byte
+		body, err = io.ReadAll(io.LimitReader(r.Body, maxConfigSize))
+		if err == nil {
+			// Checked on the keys of the body, before parsing applies them
+			if err := checkPostedDirectives(body); err != nil {
+				http.Error(w, err.Error(), http.StatusForbidden)
+				return
+			}
+			config, err = promptbuilder.ParseConfigJSON(body, promptbuilder.WithoutExpansion())
+		}
+		if err == nil {
+			if err := checkPostedIncludes(config); err != nil {
+				http.Error(w, err.Error(), http.StatusForbidden)
+				return
+			}
+			config.BaseDir = s.baseDir
+			opts = append(opts, promptbuilder.WithoutGit())
+		}
+	}
+	if err != nil {
+		configError(w, err)
+		return
+	}
+
+	builder, format, err := newServerBuilder(config, r, opts...)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Build into memory so that a failed build still gets an error status
+	var output bytes.Buffer
+	report, err := builder.Build(r.Context(), &output)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	log.Printf("%s %s: %d files, %d tokens", r.Method, r.URL, len(report.Files), report.TotalTokens)
+
+	w.Header().Set("Content-Type", contentType(format, config))
+	w.Header().Set("X-Total-Tokens", strconv.Itoa(report.TotalTokens))
+	w.Write(output.Bytes())
+}
+
+// checkPostedDirectives returns an error when a config posted to /build
+// sets a directive other than postedDirectives. A body that is not a JSON
+// object is left to the config parser to report.
+func checkPostedDirectives(body []byte) error {
+	var keys map[string]json.RawMessage
+	if err := json.Unmarshal(body, &keys); err != nil {
+		return nil
+	}
+	for key := range keys {
+		if !postedDirectives[strings.ToLower(key)] {
+			return fmt.Errorf("%s is only allowed in profiles", key)
+		}
+	}
+	return nil
+}
+
+// checkPostedIncludes returns an error when a config posted to /build
+// includes a path outside basedir.
+func checkPostedIncludes(config *promptbuilder.Config) error {
+	paths := config.ForceIncludes
+	for _, include := range config.Includes {
+		paths = append(paths, include.Path)
+	}
+	for _, path := range paths {
+		if !filepath.IsLocal(path) || strings.Contains(path, "://") {
+			return fmt.Errorf("include %s is outside of basedir, which is only allowed in profiles", path)
+		}
+	}
+	return nil
+}
+
+// handleProfiles responds with the names of the profiles.
+func (s *promptServer) handleProfiles(w http.ResponseWriter, r *http.Request) {
+	profiles, err := s.profiles()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	writeJSON(w, map[string]any{"profiles": names})
+}
+
+// handleFiles responds with the files a build of the profile would
+// contain, with their size, line count and estimated tokens.
+func (s *promptServer) handleFiles(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("profile")
+	if name == "" {
+		http.Error(w, "profile parameter is required", http.StatusBadRequest)
+		return
+	}
+	config, err := s.readProfile(name)
+	if err != nil {
+		configError(w, err)
+		return
+	}
+
+	builder, _, err := newServerBuilder(config, r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	report, err := builder.DryRun(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, map[string]any{
+		"files":       fileInfos(report.Files),
+		"omitted":     fileInfos(report.Omitted),
+		"totalTokens": report.TotalTokens,
+	})
+}
+
+// profiles maps the profile names to their config files.
+func (s *promptServer) profiles() (map[string]string, error) {
+	entries, err := os.ReadDir(s.profilesDir)
+	if err != nil {
+		return nil, fmt.Errorf("error reading profiles: %v", err)
+	}
+
+	profiles := make(map[string]string)
+	for _, entry := range entries {
+		ext := strings.ToLower(filepath.Ext(entry.Name()))
+		if entry.IsDir() || !configExtensions[ext] {
+			continue
+		}
+		name := strings.TrimSuffix(entry.Name(), filepath.Ext(entry.Name()))
+		profiles[name] = filepath.Join(s.profilesDir, entry.Name())
+	}
+	return profiles, nil
+}
+
+func (s *promptServer) readProfile(name string) (*promptbuilder.Config, error) {
+	profiles, err := s.profiles()
+	if err != nil {
+		return nil, err
+	}
+	path, ok := profiles[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", errProfileNotFound, name)
+	}
+	return promptbuilder.ReadConfig(path)
+}
+
+// newServerBuilder validates the config and creates a builder with the
+// format and model parameters of the request, and opts.
+func newServerBuilder(config *promptbuilder.Config, r *http.Request, opts ...promptbuilder.Option) (*promptbuilder.Builder, string, error) {
+	if err := config.Validate(); err != nil {
+		return nil, "", fmt.Errorf("invalid configuration: %v", err)
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = promptbuilder.FormatMarkdown
+	}
+	model := r.URL.Query().Get("model")
+	if model == "" {
+		model = promptbuilder.DefaultModel
+	}
+
+	opts = append(opts,
+		promptbuilder.WithFormat(format),
+		promptbuilder.WithModel(model),
+		promptbuilder.WithLogger(io.Discard),
+	)
+	builder, err := promptbuilder.New(config, opts...)
+	return builder, format, err
+}
+
+func contentType(format string, config *promptbuilder.Config) string {
+	switch {
+	case config.Template != "":
+		return "text/plain; charset=utf-8"
+	case format == promptbuilder.FormatJSON:
+		return "application/json"
+	case format == promptbuilder.FormatXML:
+		return "application/xml; charset=utf-8"
+	}
+	return "text/markdown; charset=utf-8"
+}
+
+// configError reports an error reading a config: a missing profile is
+// not found, anything else is a bad request.
+func configError(w http.ResponseWriter, err error) {
+	status := http.StatusBadRequest
+	if errors.Is(err, errProfileNotFound) {
+		status = http.StatusNotFound
+	}
+	http.Error(w, err.Error(), status)
+}
+
+func writeJSON(w http.ResponseWriter, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(value)
+}
+
+func fileInfos(files []promptbuilder.FileReport) []fileInfo {
+	infos := make([]fileInfo, 0, len(files))
+	for _, f := range files {
+		infos = append(infos, fileInfo{Path: f.Path, Size: f.Size, Lines: f.Lines, Tokens: f.Tokens})
+	}
+	return infos
+}
@@ -0,0 +1,344 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"promptbuilder/pkg/promptbuilder"
+)
+
+// sessionsDir holds a directory per session, relative to the current
+// directory.
+var sessionsDir = filepath.Join(".promptbuilder", "sessions")
+
+// sessionName keeps session names usable as directory names.
+var sessionName = regexp.MustCompile(`^[A-Za-z0-9_-][A-Za-z0-9_.-]*$`)
+
+// session is an ongoing conversation with a model about the files of an
+// input file, stored as session.json in its directory. Every turn has a
+// directory of its own, numbered from 001, holding the message sent
+// (prompt.md), the model's answer (answer.md) and the files the message
+// covered (files.json).
+type session struct {
+	Name    string        `json:"name"`
+	Input   string        `json:"input"` // absolute path of the input file
+	Format  string        `json:"format"`
+	Model   string        `json:"model"`
+	Created string        `json:"created"`
+	Turns   []sessionTurn `json:"turns"`
+
+	dir string
+}
+
+type sessionTurn struct {
+	Time     string `json:"time"`
+	Question string `json:"question,omitempty"`
+	Files    int    `json:"files"`  // files sent in this turn
+	Tokens   int    `json:"tokens"` // estimated tokens of the files and header
+	Answered bool   `json:"answered"`
+}
+
+const sessionUsage = `Usage: promptbuilder session <command> [flags] [args]
+
+Commands:
+  start name [question]   Start a session with the full context of the input file
+  ask name question       Send the files changed since the previous turn with a question
+  answer name [file]      Store the model's answer to the last turn, read from file or stdin
+  show name               Print the questions and answers of a session
+  list                    List the sessions
+
+The message to send is printed to stdout, or written to -output.
+Sessions are stored under .promptbuilder/sessions/.`
+
+// runSession tracks a conversation: the initial context, the changes sent
+// with every later question, and the answers of the model. It returns the
+// exit code.
+func runSession(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, sessionUsage)
+		return exitConfig
+	}
+
+	var err error
+	switch args[0] {
+	case "start":
+		err = sessionStart(args[1:])
+	case "ask":
+		err = sessionAsk(args[1:])
+	case "answer":
+		err = sessionAnswer(args[1:])
+	case "show":
+		err = sessionShow(args[1:])
+	case "list":
+		err = sessionList()
+	default:
+		fmt.Fprintln(os.Stderr, sessionUsage)
+		return exitConfig
+	}
+	if err != nil {
+		logger.Error(err.Error())
+		return exitCode(err)
+	}
+	return 0
+}
+
+func sessionStart(args []string) error {
+	flags := flag.NewFlagSet("session start", flag.ExitOnError)
+	inputFile := flags.String("input", "input.txt", "Input file path")
+	format := flags.String("format", promptbuilder.FormatMarkdown, "Output format ("+strings.Join(promptbuilder.OutputFormats, ", ")+")")
+	model := flags.String("model", promptbuilder.DefaultModel, "Model family to count tokens for ("+strings.Join(promptbuilder.SupportedModels(), ", ")+"); gpt-4o and gpt-4 are counted exactly once promptbuilder vocabulary has downloaded their tokenizer, the others estimated")
+	outputFile := flags.String("output", stdoutPath, "Where the message is written, or - for stdout")
+	flags.Parse(args)
+	if flags.NArg() < 1 {
+		return fmt.Errorf("session start needs a session name")
+	}
+
+	name := flags.Arg(0)
+	if !sessionName.MatchString(name) {
+		return fmt.Errorf("invalid session name %q, use letters, digits, dots, dashes and underscores", name)
+	}
+	dir := filepath.Join(sessionsDir, name)
+	if _, err := os.Stat(dir); err == nil {
+		return fmt.Errorf("session %s already exists in %s", name, dir)
+	}
+	input, err := filepath.Abs(*inputFile)
+	if err != nil {
+		return err
+	}
+
+	s := &session{
+		Name:    name,
+		Input:   input,
+		Format:  *format,
+		Model:   *model,
+		Created: time.Now().Format(time.RFC3339),
+		Turns:   []sessionTurn{},
+		dir:     dir,
+	}
+	return s.turn(strings.Join(flags.Args()[1:], " "), *outputFile)
+}
+
+func sessionAsk(args []string) error {
+	flags := flag.NewFlagSet("session ask", flag.ExitOnError)
+	outputFile := flags.String("output", stdoutPath, "Where the message is written, or - for stdout")
+	flags.Parse(args)
+	if flags.NArg() < 2 {
+		return fmt.Errorf("session ask needs a session name and a question")
+	}
+
+	s, err := readSession(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	if last := s.Turns[len(s.Turns)-1]; !last.Answered {
+		logger.Warn(fmt.Sprintf("Turn %d of session %s has no stored answer", len(s.Turns), s.Name))
+	}
+	return s.turn(strings.Join(flags.Args()[1:], " "), *outputFile)
+}
+
+func sessionAnswer(args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("session answer needs a session name")
+	}
+	s, err := readSession(args[0])
+	if err != nil {
+		return err
+	}
+
+	var answer []byte
+	if len(args) > 1 && args[1] != stdoutPath {
+		answer, err = os.ReadFile(args[1])
+	} else {
+		answer, err = io.ReadAll(os.Stdin)
+	}
+	if err != nil {
+		return fmt.Errorf("error reading answer: %v", err)
+	}
+
+	turn := len(s.Turns)
+	if err := os.WriteFile(filepath.Join(s.turnDir(turn), "answer.md"), answer, 0o644); err != nil {
+		return err
+	}
+	s.Turns[turn-1].Answered = true
+	if err := s.save(); err != nil {
+		return err
+	}
+	logger.Info(fmt.Sprintf("Stored the answer to turn %d of session %s", turn, s.Name))
+	return nil
+}
+
+func sessionShow(args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("session show needs a session name")
+	}
+	s, err := readSession(args[0])
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("# Session %s\n\nInput: %s\nStarted: %s\n", s.Name, s.Input, s.Created)
+	for i, turn := range s.Turns {
+		fmt.Printf("\n## Turn %d (%s)\n\n%d files, %d estimated tokens\n", i+1, turn.Time, turn.Files, turn.Tokens)
+		if turn.Question != "" {
+			fmt.Printf("\n### Question\n\n%s\n", turn.Question)
+		}
+		if turn.Answered {
+			answer, err := os.ReadFile(filepath.Join(s.turnDir(i+1), "answer.md"))
+			if err != nil {
+				return err
+			}
+			fmt.Printf("\n### Answer\n\n%s\n", strings.TrimRight(string(answer), "\n"))
+		}
+	}
+	return nil
+}
+
+func sessionList() error {
+	entries, err := os.ReadDir(sessionsDir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		s, err := readSession(entry.Name())
+		if err != nil {
+			logger.Warn(err.Error())
+			continue
+		}
+		fmt.Printf("%-20s %3d turns  started %s\n", s.Name, len(s.Turns), s.Created)
+	}
+	return nil
+}
+
+func readSession(name string) (*session, error) {
+	if !sessionName.MatchString(name) {
+		return nil, fmt.Errorf("invalid session name %q", name)
+	}
+	dir := filepath.Join(sessionsDir, name)
+	data, err := os.ReadFile(filepath.Join(dir, "session.json"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("no session named %s, start it with: promptbuilder session start %s", name, name)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	s := &session{dir: dir}
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("error parsing session %s: %v", name, err)
+	}
+	if len(s.Turns) == 0 {
+		return nil, fmt.Errorf("session %s has no turns", name)
+	}
+	return s, nil
+}
+
+func (s *session) save() error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(s.dir, "session.json"), append(data, '\n'), 0o644)
+}
+
+func (s *session) turnDir(turn int) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%03d", turn))
+}
+
+// turn builds the message of the next turn and stores it. The first turn
+// holds the full context; later ones only the files that changed since
+// the previous turn, without the header, footer and extra sections that
+// the model already has.
+func (s *session) turn(question string, outputFile string) error {
+	config, err := promptbuilder.ReadConfig(s.Input)
+	if err != nil {
+		return fmt.Errorf("cannot read input file: %w", err)
+	}
+	options := []promptbuilder.Option{
+		promptbuilder.WithFormat(s.Format),
+		promptbuilder.WithModel(s.Model),
+		promptbuilder.WithSlog(logger),
+	}
+	if len(s.Turns) > 0 {
+		previous, err := promptbuilder.ReadManifest(s.turnDir(len(s.Turns)))
+		if err != nil {
+			return err
+		}
+		options = append(options, promptbuilder.WithPrevious(previous))
+		config.HeaderText = ""
+		config.FooterText = ""
+		config.Tree = false
+		config.DirectoryStructure = false
+		config.Metadata = false
+		config.GitDiff = ""
+		config.Commands = nil
+		config.Attachments = nil
+		config.Stats = false
+	}
+
+	ctx, stop := signalContext()
+	defer stop()
+	if err := config.ValidateContext(ctx); err != nil {
+		return err
+	}
+	builder, err := promptbuilder.New(config, options...)
+	if err != nil {
+		return err
+	}
+
+	var prompt strings.Builder
+	report, err := builder.Build(ctx, &prompt)
+	if err != nil {
+		return fmt.Errorf("error generating prompt: %w", err)
+	}
+	message := prompt.String()
+	if question != "" {
+		message = strings.TrimRight(message, "\n") + "\n\n" + question + "\n"
+	}
+
+	turn := len(s.Turns) + 1
+	dir := s.turnDir(turn)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, "prompt.md"), []byte(message), 0o644); err != nil {
+		return err
+	}
+	if err := report.WriteManifest(dir); err != nil {
+		return err
+	}
+	s.Turns = append(s.Turns, sessionTurn{
+		Time:     time.Now().Format(time.RFC3339),
+		Question: question,
+		Files:    len(report.Files),
+		Tokens:   report.TotalTokens,
+	})
+	if err := s.save(); err != nil {
+		return err
+	}
+
+	if outputFile == stdoutPath {
+		_, err = os.Stdout.WriteString(message)
+	} else {
+		err = os.WriteFile(outputFile, []byte(message), 0o644)
+	}
+	if err != nil {
+		return err
+	}
+	logger.Info(fmt.Sprintf("Turn %d of session %s: %d files, %d estimated tokens", turn, s.Name, len(report.Files), report.TotalTokens),
+		"turn", turn, "files", len(report.Files), "tokens", report.TotalTokens)
+	return nil
+}
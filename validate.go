@@ -0,0 +1,85 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"promptbuilder/pkg/promptbuilder"
+)
+
+// runValidate checks an input file without generating output: it reports
+// unknown directives, includes that match no file, exclude rules that
+// match nothing and contradicting options. It returns exitConfig when
+// anything was found, so that CI can check the input files of a
+// repository.
+func runValidate(args []string) int {
+	flags := flag.NewFlagSet("validate", flag.ExitOnError)
+	inputFile := flags.String("input", "", "Input file to check (default: input.txt, or the nearest one found above)")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: promptbuilder validate [-input file]")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	path := *inputFile
+	if path == "" {
+		found, err := findInputFile()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: cannot look for an input file: %v\n", err)
+			return exitError
+		}
+		if found == "" {
+			fmt.Fprintf(os.Stderr, "Error: no input file found in this directory or above\n")
+			return exitConfig
+		}
+		// Paths in the input file are relative to its directory
+		if err := os.Chdir(filepath.Dir(found)); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return exitError
+		}
+		path = filepath.Base(found)
+	}
+
+	config, err := promptbuilder.ReadConfig(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+		return exitConfig
+	}
+	ctx, stop := signalContext()
+	defer stop()
+	if err := config.ValidateContext(ctx); err != nil {
+		for _, unknown := range config.UnknownKeys() {
+			fmt.Println(unknown)
+		}
+		fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+		return exitConfig
+	}
+
+	builder, err := promptbuilder.New(config)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+		return exitConfig
+	}
+	problems, err := builder.Check(ctx)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitCode(err)
+	}
+	if len(problems) > 0 {
+		fmt.Printf("%s: %d problems found\n", path, len(problems))
+		for _, problem := range problems {
+			fmt.Printf("  %s\n", problem)
+		}
+		return exitConfig
+	}
+
+	files, err := builder.Files(ctx)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitCode(err)
+	}
+	fmt.Printf("%s: no problems found, %d files included\n", path, len(files))
+	return 0
+}
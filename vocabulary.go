@@ -0,0 +1,47 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"promptbuilder/pkg/promptbuilder"
+)
+
+// runVocabulary downloads the BPE vocabulary of a model family, or of
+// every family that has one, to the user cache directory. Builds never
+// download it themselves, and estimate the tokens until it is there.
+func runVocabulary(args []string) int {
+	flags := flag.NewFlagSet("vocabulary", flag.ExitOnError)
+	model := flags.String("model", "", "Model family to download the vocabulary of ("+strings.Join(promptbuilder.VocabularyModels(), ", ")+"; default: all of them)")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: promptbuilder vocabulary [-model name]")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	models := promptbuilder.VocabularyModels()
+	if *model != "" {
+		if !slices.Contains(models, strings.ToLower(*model)) {
+			fmt.Fprintf(os.Stderr, "Error: %s has no public vocabulary (use %s)\n", *model, strings.Join(models, " or "))
+			return exitConfig
+		}
+		models = []string{strings.ToLower(*model)}
+	}
+	ctx, stop := signalContext()
+	defer stop()
+	for _, name := range models {
+		if err := promptbuilder.FetchVocabulary(ctx, name); err != nil {
+			if ctx.Err() != nil {
+				fmt.Fprintln(os.Stderr, "Interrupted")
+				return exitInterrupted
+			}
+			fmt.Fprintf(os.Stderr, "Error: cannot download the token vocabulary of %s: %v\n", name, err)
+			return exitError
+		}
+		fmt.Printf("Tokens of %s are counted exactly\n", name)
+	}
+	return 0
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"promptbuilder/pkg/promptbuilder"
+)
+
+// defaultWatchInterval is how often watch looks for changes.
+const defaultWatchInterval = time.Second
+
+// runWatch generates the prompt, then generates it again whenever the
+// input file, the header and footer files or an included file change,
+// until interrupted. Every build runs as a build command of its own, so
+// that a failed build does not end the watch.
+func runWatch(args []string) int {
+	interval := defaultWatchInterval
+	var buildArgs []string
+	// -interval is the only flag of watch, the others are passed to build
+	for i := 0; i < len(args); i++ {
+		name, value, hasValue := strings.Cut(strings.TrimLeft(args[i], "-"), "=")
+		if !strings.HasPrefix(args[i], "-") || name != "interval" {
+			buildArgs = append(buildArgs, args[i])
+			continue
+		}
+		if !hasValue && i+1 < len(args) {
+			i++
+			value = args[i]
+		}
+		d, err := time.ParseDuration(value)
+		if err != nil || d <= 0 {
+			fmt.Fprintf(os.Stderr, "Error: invalid value for -interval: %q\n", value)
+			return exitConfig
+		}
+		interval = d
+	}
+
+	opts := defineBuildFlags()
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: promptbuilder watch [-interval 1s] [build flags]")
+		fmt.Fprintln(os.Stderr, "  -interval duration\n    \tHow often to look for changes (default 1s)")
+		flag.PrintDefaults()
+	}
+	flag.CommandLine.Parse(buildArgs)
+	if flag.NArg() > 0 {
+		fmt.Fprintf(os.Stderr, "Error: unexpected argument %q\n", flag.Arg(0))
+		return exitConfig
+	}
+	flagLogger, err := newLogger(*opts.logFormat, *opts.quiet, *opts.verbose)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid flag: %v\n", err)
+		return exitConfig
+	}
+	logger = flagLogger
+	if *opts.dryRun || *opts.send != "" || *opts.filesFrom == stdoutPath || *opts.fromStackTrace == stdoutPath {
+		fmt.Fprintln(os.Stderr, "Error: watch cannot be combined with -dry-run, -send or reading from stdin")
+		return exitConfig
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+	// The builds run where watch was started, with the flags as given
+	dir, err := os.Getwd()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitError
+	}
+	opts.useInputFile()
+
+	ctx, stop := signalContext()
+	defer stop()
+
+	build := func() {
+		cmd := exec.CommandContext(ctx, exe, append([]string{"build"}, buildArgs...)...)
+		cmd.Dir = dir
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil && ctx.Err() == nil {
+			logger.Warn(fmt.Sprintf("Build failed: %v", err))
+		}
+	}
+
+	build()
+	stamps := opts.watchedFiles(ctx)
+	logger.Info(fmt.Sprintf("Watching %d files for changes, press Ctrl+C to stop", len(stamps)), "files", len(stamps))
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return 0
+		case <-ticker.C:
+		}
+
+		current := opts.watchedFiles(ctx)
+		changed := changedFiles(stamps, current)
+		if len(changed) == 0 {
+			continue
+		}
+		message := "Changed: " + changed[0]
+		if len(changed) > 1 {
+			message += fmt.Sprintf(" and %d more", len(changed)-1)
+		}
+		logger.Info(message+", building again", "changed", changed)
+		build()
+		// The build may have written into a watched folder
+		stamps = opts.watchedFiles(ctx)
+	}
+}
+
+// watchedFiles returns the size and modification time of the files a
+// build reads, by path. When the configuration cannot be read, as while
+// it is being edited, only the input file is watched.
+func (opts *buildFlags) watchedFiles(ctx context.Context) map[string]string {
+	paths := []string{*opts.inputFile, *opts.headerFile, *opts.footerFile, *opts.filesFrom, *opts.fromStackTrace}
+	if f := flag.Lookup("template"); f != nil {
+		paths = append(paths, f.Value.String())
+	}
+
+	config, err := readConfig(*opts.inputFile)
+	if err == nil {
+		err = applyConfigFlags(config)
+	}
+	if err == nil && *opts.auto {
+		_, err = config.AutoDetect()
+	}
+	if err == nil {
+		err = config.ValidateContext(ctx)
+	}
+	var builder *promptbuilder.Builder
+	if err == nil {
+		builder, err = promptbuilder.New(config, promptbuilder.WithLogger(io.Discard))
+	}
+	if err == nil {
+		files, err := builder.Files(ctx)
+		if err == nil {
+			for _, file := range files {
+				paths = append(paths, filepath.Join(config.BaseDir, file.RelPath))
+			}
+		}
+	}
+
+	output, _ := filepath.Abs(*opts.outputFile)
+	dir, _ := os.Getwd()
+	stamps := make(map[string]string)
+	for _, path := range paths {
+		if path == "" || path == stdoutPath {
+			continue
+		}
+		abs, err := filepath.Abs(path)
+		if err != nil || isOutputFile(abs, output) {
+			continue
+		}
+		// Paths are logged when they change, shortest where possible
+		if rel, err := filepath.Rel(dir, abs); err == nil && !strings.HasPrefix(rel, "..") {
+			path = rel
+		}
+		if info, err := os.Stat(abs); err == nil {
+			stamps[path] = fmt.Sprintf("%d %d", info.Size(), info.ModTime().UnixNano())
+		} else {
+			stamps[path] = ""
+		}
+	}
+	return stamps
+}
+
+// isOutputFile reports whether path is written by the build to output:
+// the output itself, one of its parts, its statistics or its path map.
+func isOutputFile(path string, output string) bool {
+	if path == output || path == promptbuilder.StatsPath(output) || path == promptbuilder.PathMapPath(output) {
+		return true
+	}
+	ext := filepath.Ext(output)
+	return strings.HasPrefix(path, strings.TrimSuffix(output, ext)+".part") && strings.HasSuffix(path, ext)
+}
+
+// changedFiles returns the paths added, removed or changed between two
+// calls of watchedFiles, sorted.
+func changedFiles(before, after map[string]string) []string {
+	var changed []string
+	for path, stamp := range after {
+		if previous, ok := before[path]; !ok || previous != stamp {
+			changed = append(changed, path)
+		}
+	}
+	for path := range before {
+		if _, ok := after[path]; !ok {
+			changed = append(changed, path)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}